@@ -188,7 +188,7 @@ func NewFs(name, root string) (fs.Fs, error) {
 		root:         root,
 		c:            c,
 		pacer:        pacer.New().SetMinSleep(minSleep).SetPacer(pacer.AmazonCloudDrivePacer),
-		noAuthClient: fs.Config.Client(),
+		noAuthClient: fs.Config.RemoteClient(name),
 	}
 	f.features = (&fs.Features{
 		CaseInsensitive:         true,
@@ -0,0 +1,352 @@
+// Package archive provides a read only remote which shows the
+// contents of a zip or tar file on another remote as directories and
+// files.
+package archive
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+var (
+	errorReadOnly = errors.New("archive remotes are read only")
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "archive",
+		Description: "Read the contents of a zip or tar archive",
+		NewFs:       NewFs,
+		Options: []fs.Option{{
+			Name: "remote",
+			Help: "Archive to read - it should end in .zip, .tar, .tar.gz or .tgz.\nNormally should contain a ':' and a path, eg \"myremote:path/to/build.zip\".",
+		}},
+	})
+}
+
+// readFn reads the members of an archive
+type readFn func(archive fs.Object) ([]*member, error)
+
+// format describes an archive format
+type format struct {
+	suffix    string        // file name suffix of the format
+	read      readFn        // reads the members of the archive
+	precision time.Duration // precision of the modification times
+}
+
+// formats are the supported archive formats
+var formats = []format{
+	{suffix: ".zip", read: readZip, precision: 2 * time.Second},
+	{suffix: ".tar", read: readTar, precision: time.Second},
+	{suffix: ".tar.gz", read: readTarGz, precision: time.Second},
+	{suffix: ".tgz", read: readTarGz, precision: time.Second},
+}
+
+// findFormat returns the format of the archive named name
+func findFormat(name string) (*format, error) {
+	lowerName := strings.ToLower(name)
+	for i := range formats {
+		if strings.HasSuffix(lowerName, formats[i].suffix) {
+			return &formats[i], nil
+		}
+	}
+	return nil, errors.Errorf("don't know how to read archive %q - it should end in .zip, .tar, .tar.gz or .tgz", name)
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(name, root string) (fs.Fs, error) {
+	remote := fs.ConfigFileGet(name, "remote")
+	if strings.HasPrefix(remote, name+":") {
+		return nil, errors.New("can't point archive remote at itself - check the value of the remote setting")
+	}
+	_, _, archivePath, err := fs.ParseRemote(remote)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse remote %q", remote)
+	}
+	archiveFs, err := fs.NewFs(remote)
+	if err != fs.ErrorIsFile {
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to make remote %q to read the archive from", remote)
+		}
+		return nil, errors.Errorf("archive %q not found", remote)
+	}
+	archive, err := archiveFs.NewObject(path.Base(archivePath))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find archive %q", remote)
+	}
+	return newFs(name, root, archive)
+}
+
+// newFs makes an Fs showing the contents of archive
+func newFs(name, root string, archive fs.Object) (fs.Fs, error) {
+	format, err := findFormat(archive.Remote())
+	if err != nil {
+		return nil, err
+	}
+	root = strings.Trim(root, "/")
+	f := &Fs{
+		name:    name,
+		root:    root,
+		archive: archive,
+		format:  format,
+	}
+	f.features = (&fs.Features{
+		CanHaveEmptyDirectories: true,
+	}).Fill(f)
+	if root != "" {
+		idx, err := f.getIndex()
+		if err != nil {
+			return nil, err
+		}
+		if m, ok := idx.members[root]; ok && !m.isDir {
+			// return an error with an fs which points to the parent
+			f.root = path.Dir(root)
+			if f.root == "." {
+				f.root = ""
+			}
+			return f, fs.ErrorIsFile
+		}
+	}
+	return f, nil
+}
+
+// Fs represents the contents of an archive
+type Fs struct {
+	name     string       // name of this remote
+	root     string       // the path in the archive we are working on
+	features *fs.Features // optional features
+	archive  fs.Object    // the archive itself
+	format   *format      // the format of the archive
+	mu       sync.Mutex   // protects the following
+	index    *index       // the contents of the archive once read
+}
+
+// getIndex returns the contents of the archive, reading them the first
+// time it is called
+func (f *Fs) getIndex() (*index, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.index != nil {
+		return f.index, nil
+	}
+	fs.Debugf(f, "Reading contents of archive")
+	members, err := f.format.read(f.archive)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read archive %q", f.archive.Remote())
+	}
+	f.index = newIndex(members, f.archive.ModTime())
+	return f.index, nil
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("archive '%s' root '%s'", f.archive.Remote(), f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision of the modification times in the archive
+func (f *Fs) Precision() time.Duration {
+	return f.format.precision
+}
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() fs.HashSet {
+	return fs.HashSet(fs.HashNone)
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(dir string) (entries fs.DirEntries, err error) {
+	idx, err := f.getIndex()
+	if err != nil {
+		return nil, err
+	}
+	dirPath := path.Join(f.root, dir)
+	if dirPath != "" {
+		if m, ok := idx.members[dirPath]; !ok || !m.isDir {
+			return nil, fs.ErrorDirNotFound
+		}
+	}
+	for _, m := range idx.dirs[dirPath] {
+		remote := path.Join(dir, path.Base(m.name))
+		if m.isDir {
+			entries = append(entries, fs.NewDir(remote, m.modTime))
+		} else {
+			entries = append(entries, f.newObject(remote, m))
+		}
+	}
+	return entries, nil
+}
+
+// newObject makes an Object for the member m at remote
+func (f *Fs) newObject(remote string, m *member) *Object {
+	return &Object{
+		fs:     f,
+		remote: remote,
+		member: m,
+	}
+}
+
+// NewObject finds the Object at remote.  If it can't be found
+// it returns the error fs.ErrorObjectNotFound.
+func (f *Fs) NewObject(remote string) (fs.Object, error) {
+	idx, err := f.getIndex()
+	if err != nil {
+		return nil, err
+	}
+	m, ok := idx.members[path.Join(f.root, remote)]
+	if !ok {
+		return nil, fs.ErrorObjectNotFound
+	}
+	if m.isDir {
+		return nil, fs.ErrorNotAFile
+	}
+	return f.newObject(remote, m), nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+func (f *Fs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return nil, errorReadOnly
+}
+
+// Mkdir makes the directory
+func (f *Fs) Mkdir(dir string) error {
+	return errorReadOnly
+}
+
+// Rmdir removes the directory
+func (f *Fs) Rmdir(dir string) error {
+	return errorReadOnly
+}
+
+// Object is a file in the archive
+type Object struct {
+	fs     *Fs     // what this object is part of
+	remote string  // the remote path
+	member *member // the member of the archive
+}
+
+// Fs returns the parent Fs
+func (o *Object) Fs() fs.Info {
+	return o.fs
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Hash returns "" as archives don't store any supported checksums
+func (o *Object) Hash(t fs.HashType) (string, error) {
+	return "", fs.ErrHashUnsupported
+}
+
+// Size returns the uncompressed size of the file
+func (o *Object) Size() int64 {
+	return o.member.size
+}
+
+// ModTime returns the modification time of the file
+func (o *Object) ModTime() time.Time {
+	return o.member.modTime
+}
+
+// SetModTime sets the modification time of the file
+func (o *Object) SetModTime(modTime time.Time) error {
+	return errorReadOnly
+}
+
+// Storable returns a boolean showing whether this object storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// Open the file for read.  Call Close() on the returned io.ReadCloser
+func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(o.Size())
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	if limit < 0 || offset+limit > o.member.size {
+		limit = o.member.size - offset
+	}
+	if limit <= 0 {
+		return emptyReadCloser{}, nil
+	}
+	return o.member.open(offset, limit)
+}
+
+// Update the file with the contents of the io.Reader
+func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return errorReadOnly
+}
+
+// Remove the file
+func (o *Object) Remove() error {
+	return errorReadOnly
+}
+
+// emptyReadCloser is an io.ReadCloser with nothing to read
+type emptyReadCloser struct{}
+
+// Read returns io.EOF
+func (emptyReadCloser) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+// Close does nothing
+func (emptyReadCloser) Close() error {
+	return nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs     = (*Fs)(nil)
+	_ fs.Object = (*Object)(nil)
+)
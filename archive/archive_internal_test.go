@@ -0,0 +1,276 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	_ "github.com/ncw/rclone/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testFile is a file put in the test archives
+type testFile struct {
+	name     string
+	contents string
+	stored   bool // set to store rather than compress in zip files
+}
+
+var (
+	testModTime = fstest.Time("2001-02-03T04:05:06Z")
+	bigContents = strings.Repeat("0123456789abcdef", 64*1024)
+	testFiles   = []testFile{
+		{name: "dir/", contents: ""},
+		{name: "dir/file.txt", contents: "hello world"},
+		{name: "dir/empty.txt", contents: ""},
+		{name: "deep/a/b/stored.txt", contents: "stored data", stored: true},
+		{name: "big.bin", contents: bigContents, stored: true},
+		{name: "bigdeflated.bin", contents: bigContents},
+	}
+)
+
+// writeZip writes testFiles as a zip archive to out
+func writeZip(t *testing.T, out io.Writer) {
+	zw := zip.NewWriter(out)
+	for _, file := range testFiles {
+		header := &zip.FileHeader{
+			Name:   file.name,
+			Method: zip.Deflate,
+		}
+		if file.stored {
+			header.Method = zip.Store
+		}
+		header.SetModTime(testModTime)
+		w, err := zw.CreateHeader(header)
+		require.NoError(t, err)
+		_, err = io.WriteString(w, file.contents)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+}
+
+// writeTar writes testFiles as a tar archive to out, with names
+// starting with ./ as GNU tar makes them
+func writeTar(t *testing.T, out io.Writer) {
+	tw := tar.NewWriter(out)
+	for _, file := range testFiles {
+		header := &tar.Header{
+			Name:     "./" + file.name,
+			Mode:     0644,
+			Size:     int64(len(file.contents)),
+			ModTime:  testModTime,
+			Typeflag: tar.TypeReg,
+		}
+		if strings.HasSuffix(file.name, "/") {
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0755
+		}
+		require.NoError(t, tw.WriteHeader(header))
+		_, err := io.WriteString(tw, file.contents)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+}
+
+// writeTarGz writes testFiles as a gzipped tar archive to out
+func writeTarGz(t *testing.T, out io.Writer) {
+	gz := gzip.NewWriter(out)
+	writeTar(t, gz)
+	require.NoError(t, gz.Close())
+}
+
+// newTestFs writes an archive called name with write into a temporary
+// directory and returns an archive remote of it with the root given
+// and a function to tidy up
+func newTestFs(t *testing.T, name string, write func(*testing.T, io.Writer), root string) (fs.Fs, func(), error) {
+	dir, cleanup := fstest.NewLocalDir(t)
+	archivePath := filepath.Join(dir, name)
+	out, err := os.Create(archivePath)
+	require.NoError(t, err)
+	write(t, out)
+	require.NoError(t, out.Close())
+	f, err := fstest.NewConfiguredFs("TestArchive", "type", "archive", "remote", archivePath)
+	if err == nil && root != "" {
+		f, err = fs.NewFs("TestArchive:" + root)
+	}
+	return f, cleanup, err
+}
+
+// listAll returns the sorted remotes of all the entries under dir
+func listAll(t *testing.T, f fs.Fs, dir string) (names []string) {
+	entries, err := f.List(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		name := entry.Remote()
+		if _, ok := entry.(fs.Directory); ok {
+			names = append(names, name+"/")
+			names = append(names, listAll(t, f, name)...)
+		} else {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+var testFormats = []struct {
+	name  string
+	write func(*testing.T, io.Writer)
+}{
+	{"test.zip", writeZip},
+	{"test.tar", writeTar},
+	{"test.tar.gz", writeTarGz},
+	{"test.tgz", writeTarGz},
+}
+
+func TestArchive(t *testing.T) {
+	for _, format := range testFormats {
+		t.Run(format.name, func(t *testing.T) {
+			f, cleanup, err := newTestFs(t, format.name, format.write, "")
+			require.NoError(t, err)
+			defer cleanup()
+
+			assert.Equal(t, []string{
+				"big.bin",
+				"bigdeflated.bin",
+				"deep/",
+				"deep/a/",
+				"deep/a/b/",
+				"deep/a/b/stored.txt",
+				"dir/",
+				"dir/empty.txt",
+				"dir/file.txt",
+			}, listAll(t, f, ""))
+			_, err = f.List("potato")
+			assert.Equal(t, fs.ErrorDirNotFound, err)
+			_, err = f.List("dir/file.txt")
+			assert.Equal(t, fs.ErrorDirNotFound, err)
+			_, err = f.NewObject("dir")
+			assert.Equal(t, fs.ErrorNotAFile, err)
+			_, err = f.NewObject("potato")
+			assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+			for _, file := range testFiles {
+				if strings.HasSuffix(file.name, "/") {
+					continue
+				}
+				o, err := f.NewObject(file.name)
+				require.NoError(t, err)
+				assert.Equal(t, int64(len(file.contents)), o.Size())
+				assert.True(t, testModTime.Equal(o.ModTime()), file.name)
+				assert.Equal(t, file.contents, fstest.ReadObject(t, f, file.name), file.name)
+			}
+
+			// Parts of files can be read
+			assert.Equal(t, "world", fstest.ReadObject(t, f, "dir/file.txt", &fs.SeekOption{Offset: 6}))
+			assert.Equal(t, "lo w", fstest.ReadObject(t, f, "dir/file.txt", &fs.RangeOption{Start: 3, End: 6}))
+			assert.Equal(t, "ld", fstest.ReadObject(t, f, "dir/file.txt", &fs.RangeOption{Start: -1, End: 2}))
+			assert.Equal(t, "", fstest.ReadObject(t, f, "dir/file.txt", &fs.SeekOption{Offset: 11}))
+			for _, remote := range []string{"big.bin", "bigdeflated.bin"} {
+				offset := int64(len(bigContents)/2 + 3)
+				want := bigContents[offset : offset+100]
+				assert.Equal(t, want, fstest.ReadObject(t, f, remote, &fs.RangeOption{Start: offset, End: offset + 99}), remote)
+			}
+
+			// Nothing can be changed
+			o, err := f.NewObject("dir/file.txt")
+			require.NoError(t, err)
+			assert.Equal(t, errorReadOnly, o.Remove())
+			assert.Equal(t, errorReadOnly, f.Mkdir("newdir"))
+			src := fs.NewStaticObjectInfo("new.txt", testModTime, 5, true, nil, nil)
+			_, err = f.Put(strings.NewReader("hello"), src)
+			assert.Equal(t, errorReadOnly, err)
+		})
+	}
+}
+
+func TestArchiveRoot(t *testing.T) {
+	f, cleanup, err := newTestFs(t, "test.zip", writeZip, "deep/a")
+	require.NoError(t, err)
+	defer cleanup()
+	assert.Equal(t, []string{"b/", "b/stored.txt"}, listAll(t, f, ""))
+	assert.Equal(t, "stored data", fstest.ReadObject(t, f, "b/stored.txt"))
+
+	// Pointing at a file in the archive points at its directory
+	f, cleanup, err = newTestFs(t, "test.zip", writeZip, "dir/file.txt")
+	assert.Equal(t, fs.ErrorIsFile, err)
+	defer cleanup()
+	assert.Equal(t, "dir", f.Root())
+	assert.Equal(t, "hello world", fstest.ReadObject(t, f, "file.txt"))
+}
+
+func TestArchiveUnknownFormat(t *testing.T) {
+	_, cleanup, err := newTestFs(t, "test.rar", writeZip, "")
+	defer cleanup()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "don't know how to read archive")
+}
+
+// countingObject is an fs.Object counting the bytes read from it
+type countingObject struct {
+	fs.Object
+	data  []byte
+	mu    sync.Mutex
+	read  int64
+	opens int
+}
+
+// Size returns the size of the data
+func (o *countingObject) Size() int64 {
+	return int64(len(o.data))
+}
+
+// ModTime returns the test modification time
+func (o *countingObject) ModTime() time.Time {
+	return testModTime
+}
+
+// Remote returns the name of the archive
+func (o *countingObject) Remote() string {
+	return "test.zip"
+}
+
+// Open reads the range of the data requested counting the bytes
+func (o *countingObject) Open(options ...fs.OpenOption) (io.ReadCloser, error) {
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		if x, ok := option.(*fs.RangeOption); ok {
+			offset, limit = x.Decode(o.Size())
+		}
+	}
+	data := o.data[offset:]
+	if limit >= 0 && limit < int64(len(data)) {
+		data = data[:limit]
+	}
+	o.mu.Lock()
+	o.read += int64(len(data))
+	o.opens++
+	o.mu.Unlock()
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func TestZipRangedReads(t *testing.T) {
+	var buf bytes.Buffer
+	writeZip(t, &buf)
+	o := &countingObject{data: buf.Bytes()}
+	f, err := newFs("TestArchive", "", o)
+	require.NoError(t, err)
+
+	// Reading a small file only reads the end of the archive and the file
+	assert.Equal(t, "hello world", fstest.ReadObject(t, f, "dir/file.txt"))
+	assert.True(t, o.read < int64(len(bigContents)/4), "read %d bytes of %d", o.read, len(o.data))
+	assert.True(t, o.opens <= 4, "opened %d times", o.opens)
+}
@@ -0,0 +1,88 @@
+package archive
+
+import (
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+)
+
+// openFn opens limit bytes of the data of a member starting at
+// offset.  limit will be > 0 and offset+limit <= size.
+type openFn func(offset, limit int64) (io.ReadCloser, error)
+
+// member describes a file or directory in the archive
+type member struct {
+	name    string    // path in the archive
+	isDir   bool      // set if this is a directory
+	size    int64     // uncompressed size of a file
+	modTime time.Time // modification time
+	open    openFn    // opens the data of a file
+}
+
+// index is the contents of an archive
+type index struct {
+	modTime time.Time            // modification time for directories not in the archive
+	members map[string]*member   // all the files and directories by path
+	dirs    map[string][]*member // the contents of each directory
+}
+
+// cleanName turns the name of a member in an archive into a path
+// relative to the root of the archive, returning false if it should
+// be ignored
+func cleanName(name string) (string, bool) {
+	name = path.Clean(strings.TrimLeft(name, "/"))
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	return name, true
+}
+
+// newIndex makes an index from the members of an archive.
+//
+// Directories which aren't in the archive themselves are made with
+// the modification time passed in.
+func newIndex(members []*member, modTime time.Time) *index {
+	idx := &index{
+		modTime: modTime,
+		members: make(map[string]*member, len(members)),
+		dirs:    map[string][]*member{"": nil},
+	}
+	for _, m := range members {
+		name, ok := cleanName(m.name)
+		if !ok {
+			fs.Debugf(nil, "Ignoring archive member %q", m.name)
+			continue
+		}
+		m.name = name
+		idx.add(m)
+	}
+	return idx
+}
+
+// add m to the index along with any parent directories needed
+func (idx *index) add(m *member) {
+	if existing, ok := idx.members[m.name]; ok {
+		if existing.isDir != m.isDir {
+			fs.Debugf(nil, "Ignoring archive member %q which clashes with a previous one", m.name)
+			return
+		}
+		// Later members replace earlier ones
+		*existing = *m
+		return
+	}
+	parent := path.Dir(m.name)
+	if parent == "." {
+		parent = ""
+	} else if _, ok := idx.members[parent]; !ok {
+		idx.add(&member{
+			name:    parent,
+			isDir:   true,
+			modTime: idx.modTime,
+		})
+	}
+	idx.members[m.name] = m
+	idx.dirs[parent] = append(idx.dirs[parent], m)
+}
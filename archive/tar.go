@@ -0,0 +1,146 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	in io.Reader
+	n  int64
+}
+
+// Read data counting the bytes
+func (r *countingReader) Read(p []byte) (n int, err error) {
+	n, err = r.in.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// readTarMembers reads the members of the tar stream in.  newOpen is
+// called to make the open function of each file with the index of
+// its header in the stream and the offset of its data.
+func readTarMembers(in io.Reader, newOpen func(i int, dataOffset int64) openFn) (members []*member, err error) {
+	counter := &countingReader{in: in}
+	tr := tar.NewReader(counter)
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			members = append(members, &member{
+				name:    hdr.Name,
+				isDir:   true,
+				modTime: hdr.ModTime,
+			})
+		case tar.TypeReg, tar.TypeRegA:
+			members = append(members, &member{
+				name:    hdr.Name,
+				size:    hdr.Size,
+				modTime: hdr.ModTime,
+				open:    newOpen(i, counter.n),
+			})
+		default:
+			fs.Debugf(nil, "Ignoring archive member %q of type %q", hdr.Name, hdr.Typeflag)
+		}
+	}
+	return members, nil
+}
+
+// readTar reads the members of an uncompressed tar archive
+//
+// The whole archive has to be read to find them, but the data of each
+// file can be read directly from the archive afterwards.
+func readTar(archive fs.Object) (members []*member, err error) {
+	in, err := archive.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(in, &err)
+	return readTarMembers(in, func(i int, dataOffset int64) openFn {
+		return func(offset, limit int64) (io.ReadCloser, error) {
+			in, err := archive.Open(&fs.RangeOption{Start: dataOffset + offset, End: dataOffset + offset + limit - 1})
+			if err != nil {
+				return nil, err
+			}
+			return fs.NewLimitedReadCloser(in, limit), nil
+		}
+	})
+}
+
+// readTarGz reads the members of a gzipped tar archive
+//
+// The whole archive has to be read to find them, and opening a file
+// reads the archive from the start until the file is found.
+func readTarGz(archive fs.Object) (members []*member, err error) {
+	in, err := archive.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(in, &err)
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, err
+	}
+	return readTarMembers(gz, func(i int, dataOffset int64) openFn {
+		return func(offset, limit int64) (io.ReadCloser, error) {
+			return openTarGzFile(archive, i, offset, limit)
+		}
+	})
+}
+
+// tarGzReadCloser reads a file from a gzipped tar archive and closes
+// the archive
+type tarGzReadCloser struct {
+	io.Reader           // the file
+	in        io.Closer // the archive
+}
+
+// Close the archive
+func (rc *tarGzReadCloser) Close() error {
+	return rc.in.Close()
+}
+
+// openTarGzFile opens limit bytes starting at offset of the file
+// whose header is the i-th in the gzipped tar archive
+func openTarGzFile(archive fs.Object, i int, offset, limit int64) (rc io.ReadCloser, err error) {
+	in, err := archive.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = in.Close()
+		}
+	}()
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for j := 0; j <= i; j++ {
+		_, err = tr.Next()
+		if err == io.EOF {
+			return nil, errors.New("archive changed since it was read")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = io.CopyN(ioutil.Discard, tr, offset)
+	if err != nil {
+		return nil, err
+	}
+	return fs.NewLimitedReadCloser(&tarGzReadCloser{Reader: tr, in: in}, limit), nil
+}
@@ -0,0 +1,195 @@
+package archive
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// readAtBlockSize is the minimum amount objectReaderAt reads at once
+const readAtBlockSize = 64 * 1024
+
+// objectReaderAt implements io.ReaderAt on an object using ranged
+// reads.  It reads at least readAtBlockSize bytes at once and keeps
+// the last block read so the small reads archive/zip does don't each
+// need a request.
+type objectReaderAt struct {
+	o      fs.Object  // the object to read
+	mu     sync.Mutex // protects the following
+	offset int64      // offset of block in the object
+	block  []byte     // last block read
+}
+
+// newObjectReaderAt makes an io.ReaderAt reading from o
+func newObjectReaderAt(o fs.Object) *objectReaderAt {
+	return &objectReaderAt{
+		o: o,
+	}
+}
+
+// ReadAt reads len(p) bytes at off into p
+func (r *objectReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	size := r.o.Size()
+	for len(p) > 0 {
+		if off >= size {
+			return n, io.EOF
+		}
+		if off < r.offset || off >= r.offset+int64(len(r.block)) {
+			err = r.readBlock(off, int64(len(p)), size)
+			if err != nil {
+				return n, err
+			}
+		}
+		copied := copy(p, r.block[off-r.offset:])
+		n += copied
+		off += int64(copied)
+		p = p[copied:]
+	}
+	return n, nil
+}
+
+// readBlock reads at least length bytes at offset off into the block
+func (r *objectReaderAt) readBlock(off, length, size int64) (err error) {
+	if length < readAtBlockSize {
+		length = readAtBlockSize
+	}
+	if off+length > size {
+		length = size - off
+	}
+	in, err := r.o.Open(&fs.RangeOption{Start: off, End: off + length - 1})
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(in, &err)
+	block := make([]byte, length)
+	_, err = io.ReadFull(in, block)
+	if err != nil {
+		return err
+	}
+	r.offset, r.block = off, block
+	return nil
+}
+
+// readZip reads the members of a zip archive from its central
+// directory at the end of the archive so only that is read
+func readZip(archive fs.Object) ([]*member, error) {
+	r, err := zip.NewReader(newObjectReaderAt(archive), archive.Size())
+	if err != nil {
+		return nil, err
+	}
+	members := make([]*member, 0, len(r.File))
+	for _, file := range r.File {
+		file := file
+		m := &member{
+			name:    file.Name,
+			isDir:   strings.HasSuffix(file.Name, "/"),
+			size:    int64(file.UncompressedSize64),
+			modTime: file.ModTime(),
+		}
+		if !m.isDir {
+			m.open = func(offset, limit int64) (io.ReadCloser, error) {
+				return openZipFile(archive, file, offset, limit)
+			}
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// openZipFile opens limit bytes of file in the zip archive starting
+// at offset
+//
+// Only the compressed data of file is read from the archive.  Stored
+// files can be read from any offset, but deflated ones have to be
+// decompressed from the start.
+func openZipFile(archive fs.Object, file *zip.File, offset, limit int64) (io.ReadCloser, error) {
+	dataOffset, err := file.DataOffset()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read header of %q", file.Name)
+	}
+	switch file.Method {
+	case zip.Store:
+		in, err := archive.Open(&fs.RangeOption{Start: dataOffset + offset, End: dataOffset + offset + limit - 1})
+		if err != nil {
+			return nil, err
+		}
+		in = fs.NewLimitedReadCloser(in, limit)
+		if offset == 0 && limit == int64(file.UncompressedSize64) {
+			in = newCRCReadCloser(in, file)
+		}
+		return in, nil
+	case zip.Deflate:
+		compressedSize := int64(file.CompressedSize64)
+		in, err := archive.Open(&fs.RangeOption{Start: dataOffset, End: dataOffset + compressedSize - 1})
+		if err != nil {
+			return nil, err
+		}
+		rc := &decompressReadCloser{
+			Reader: flate.NewReader(fs.NewLimitedReadCloser(in, compressedSize)),
+			in:     in,
+		}
+		if offset == 0 && limit == int64(file.UncompressedSize64) {
+			return newCRCReadCloser(rc, file), nil
+		}
+		_, err = io.CopyN(ioutil.Discard, rc, offset)
+		if err != nil {
+			_ = rc.Close()
+			return nil, errors.Wrapf(err, "failed to seek in %q", file.Name)
+		}
+		return fs.NewLimitedReadCloser(rc, limit), nil
+	}
+	return nil, errors.Errorf("can't read %q: unsupported compression method %d", file.Name, file.Method)
+}
+
+// decompressReadCloser reads decompressed data and closes both the
+// decompressor and the stream it is reading from
+type decompressReadCloser struct {
+	io.Reader           // the decompressor
+	in        io.Closer // the compressed stream
+}
+
+// Close the decompressor and the stream
+func (rc *decompressReadCloser) Close() error {
+	err := rc.Reader.(io.Closer).Close()
+	closeErr := rc.in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// crcReadCloser checks the CRC-32 of a whole file as it is read
+type crcReadCloser struct {
+	io.ReadCloser
+	file *zip.File   // the file being read
+	hash hash.Hash32 // CRC-32 of the data read so far
+}
+
+// newCRCReadCloser returns in wrapped so it checks the CRC-32 of file
+func newCRCReadCloser(in io.ReadCloser, file *zip.File) io.ReadCloser {
+	return &crcReadCloser{
+		ReadCloser: in,
+		file:       file,
+		hash:       crc32.NewIEEE(),
+	}
+}
+
+// Read data checking the CRC-32 at the end
+func (r *crcReadCloser) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	_, _ = r.hash.Write(p[:n])
+	if err == io.EOF && r.hash.Sum32() != r.file.CRC32 {
+		err = errors.Errorf("corrupted data in %q: CRC-32 mismatch", r.file.Name)
+	}
+	return n, err
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/storage"
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/multipart"
 	"github.com/ncw/rclone/pacer"
 	"github.com/pkg/errors"
 )
@@ -80,12 +81,11 @@ type Fs struct {
 	endpoint         string       // name of the starting api endpoint
 	bc               *storage.BlobStorageClient
 	cc               *storage.Container
-	container        string                // the container we are working on
-	containerOKMu    sync.Mutex            // mutex to protect container OK
-	containerOK      bool                  // true if we have created the container
-	containerDeleted bool                  // true if we have deleted the container
-	pacer            *pacer.Pacer          // To pace and retry the API calls
-	uploadToken      *pacer.TokenDispenser // control concurrency
+	container        string       // the container we are working on
+	containerOKMu    sync.Mutex   // mutex to protect container OK
+	containerOK      bool         // true if we have created the container
+	containerDeleted bool         // true if we have deleted the container
+	pacer            *pacer.Pacer // To pace and retry the API calls
 }
 
 // Object describes a azure object
@@ -199,20 +199,19 @@ func NewFs(name, root string) (fs.Fs, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to make azure storage client")
 	}
-	client.HTTPClient = fs.Config.Client()
+	client.HTTPClient = fs.Config.RemoteClient(name)
 	bc := client.GetBlobService()
 
 	f := &Fs{
-		name:        name,
-		container:   container,
-		root:        directory,
-		account:     account,
-		key:         keyBytes,
-		endpoint:    endpoint,
-		bc:          &bc,
-		cc:          bc.GetContainerReference(container),
-		pacer:       pacer.New().SetMinSleep(minSleep).SetMaxSleep(maxSleep).SetDecayConstant(decayConstant),
-		uploadToken: pacer.NewTokenDispenser(fs.Config.Transfers),
+		name:      name,
+		container: container,
+		root:      directory,
+		account:   account,
+		key:       keyBytes,
+		endpoint:  endpoint,
+		bc:        &bc,
+		cc:        bc.GetContainerReference(container),
+		pacer:     pacer.New().SetMinSleep(minSleep).SetMaxSleep(maxSleep).SetDecayConstant(decayConstant),
 	}
 	f.features = (&fs.Features{
 		ReadMimeType:  true,
@@ -913,10 +912,52 @@ func urlEncode(in string) string {
 	return out.String()
 }
 
+// makeBlockID makes the base64 encoded block ID for rawID
+func makeBlockID(rawID uint64) string {
+	bytesID := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bytesID, rawID)
+	return base64.StdEncoding.EncodeToString(bytesID)
+}
+
+// resumeMultipart returns the MD5s of the blocks sent by an
+// interrupted upload of blob which are still waiting to be
+// committed, or nil if there was no interrupted upload
+func (o *Object) resumeMultipart(resume *fs.ResumableUpload, blob *storage.Blob) (prev []string) {
+	state := resume.Resume()
+	if state == nil {
+		return nil
+	}
+	var blockList storage.BlockListResponse
+	err := o.fs.pacer.Call(func() (bool, error) {
+		var err error
+		blockList, err = blob.GetBlockList(storage.BlockListTypeUncommitted, nil)
+		return o.fs.shouldRetry(err)
+	})
+	if err != nil {
+		fs.Debugf(o, "Can't resume multipart upload - starting again: %v", err)
+		return nil
+	}
+	uncommitted := make(map[string]bool, len(blockList.UncommittedBlocks))
+	for _, block := range blockList.UncommittedBlocks {
+		uncommitted[block.Name] = true
+	}
+	prev = make([]string, len(state.Parts))
+	for part, md5sum := range state.Parts {
+		if uncommitted[makeBlockID(uint64(part+1))] {
+			prev[part] = md5sum
+		}
+	}
+	return prev
+}
+
 // uploadMultipart uploads a file using multipart upload
 //
 // Write a larger blob, using CreateBlockBlob, PutBlock, and PutBlockList.
-func (o *Object) uploadMultipart(in io.Reader, size int64, blob *storage.Blob, putBlobOptions *storage.PutBlobOptions) (err error) {
+//
+// If the upload of src was interrupted before then it is resumed if
+// possible.
+func (o *Object) uploadMultipart(in io.Reader, src fs.ObjectInfo, blob *storage.Blob, putBlobOptions *storage.PutBlobOptions) (err error) {
+	size := src.Size()
 	// Calculate correct chunkSize
 	chunkSize := int64(chunkSize)
 	var totalParts int64
@@ -936,105 +977,66 @@ func (o *Object) uploadMultipart(in io.Reader, size int64, blob *storage.Blob, p
 			return errors.Errorf("can't upload as it is too big %v - takes more than %d chunks of %v", fs.SizeSuffix(size), totalParts, fs.SizeSuffix(chunkSize/2))
 		}
 	}
-	fs.Debugf(o, "Multipart upload session started for %d parts of size %v", totalParts, fs.SizeSuffix(chunkSize))
-
-	// Create an empty blob
-	err = o.fs.pacer.Call(func() (bool, error) {
-		err := blob.CreateBlockBlob(putBlobOptions)
-		return o.fs.shouldRetry(err)
-	})
-
-	// block ID variables
-	var (
-		rawID   uint64
-		bytesID = make([]byte, 8)
-		blockID = "" // id in base64 encoded form
-		blocks  = make([]storage.Block, 0, totalParts)
-	)
-
-	// increment the blockID
-	nextID := func() {
-		rawID++
-		binary.LittleEndian.PutUint64(bytesID, rawID)
-		blockID = base64.StdEncoding.EncodeToString(bytesID)
-		blocks = append(blocks, storage.Block{
-			ID:     blockID,
-			Status: storage.BlockStatusLatest,
+	// Carry on with the blocks of an interrupted upload if
+	// possible - creating the blob would throw them away
+	resume := fs.NewResumableUpload(o.fs, o.remote, src, chunkSize)
+	prev := o.resumeMultipart(resume, blob)
+	if prev == nil {
+		fs.Debugf(o, "Multipart upload session started for %d parts of size %v", totalParts, fs.SizeSuffix(chunkSize))
+
+		// Create an empty blob
+		err = o.fs.pacer.Call(func() (bool, error) {
+			err := blob.CreateBlockBlob(putBlobOptions)
+			return o.fs.shouldRetry(err)
 		})
+		resume.Start("")
 	}
 
-	// Upload the chunks
-	remaining := size
-	position := int64(0)
-	errs := make(chan error, 1)
-	var wg sync.WaitGroup
-outer:
-	for part := 0; part < int(totalParts); part++ {
-		// Check any errors
-		select {
-		case err = <-errs:
-			break outer
-		default:
-		}
-
-		reqSize := remaining
-		if reqSize >= chunkSize {
-			reqSize = chunkSize
-		}
-
-		// Make a block of memory
-		buf := make([]byte, reqSize)
-
-		// Read the chunk
-		_, err = io.ReadFull(in, buf)
-		if err != nil {
-			err = errors.Wrap(err, "multipart upload failed to read source")
-			break outer
-		}
-
-		// Transfer the chunk
-		nextID()
-		wg.Add(1)
-		o.fs.uploadToken.Get()
-		go func(part int, position int64, blockID string) {
-			defer wg.Done()
-			defer o.fs.uploadToken.Put()
-			fs.Debugf(o, "Uploading part %d/%d offset %v/%v part size %v", part+1, totalParts, fs.SizeSuffix(position), fs.SizeSuffix(size), fs.SizeSuffix(chunkSize))
+	// partMD5 returns the MD5 of the part in base64 encoded form
+	partMD5 := func(part *multipart.Part) string {
+		md5sum := md5.Sum(part.Data)
+		return base64.StdEncoding.EncodeToString(md5sum[:])
+	}
 
+	// Upload the chunks
+	u := multipart.Uploader{
+		Obj:      o,
+		Pacer:    o.fs.pacer,
+		PartSize: chunkSize,
+		Skip: func(part *multipart.Part) string {
+			// Skip the chunk if it was sent before
+			if part.Number < len(prev) && prev[part.Number] == partMD5(part) {
+				return makeBlockID(uint64(part.Number + 1))
+			}
+			return ""
+		},
+		Send: func(part *multipart.Part) (string, bool, error) {
 			// Upload the block, with MD5 for check
-			md5sum := md5.Sum(buf)
+			blockID := makeBlockID(uint64(part.Number + 1))
+			contentMD5 := partMD5(part)
 			putBlockOptions := storage.PutBlockOptions{
-				ContentMD5: base64.StdEncoding.EncodeToString(md5sum[:]),
+				ContentMD5: contentMD5,
 			}
-			err = o.fs.pacer.Call(func() (bool, error) {
-				err = blob.PutBlockWithLength(blockID, uint64(len(buf)), bytes.NewBuffer(buf), &putBlockOptions)
-				return o.fs.shouldRetry(err)
-			})
-
+			err := blob.PutBlockWithLength(blockID, uint64(len(part.Data)), bytes.NewBuffer(part.Data), &putBlockOptions)
+			retry, err := o.fs.shouldRetry(err)
 			if err != nil {
-				err = errors.Wrap(err, "multipart upload failed to upload part")
-				select {
-				case errs <- err:
-				default:
-				}
-				return
+				return "", retry, errors.Wrap(err, "multipart upload failed to upload part")
 			}
-		}(part, position, blockID)
-
-		// ready for next block
-		remaining -= chunkSize
-		position += chunkSize
-	}
-	wg.Wait()
-	if err == nil {
-		select {
-		case err = <-errs:
-		default:
-		}
+			resume.SetPart(part.Number, contentMD5)
+			return blockID, false, nil
+		},
 	}
+	blockIDs, err := u.Upload(in, size)
 	if err != nil {
 		return err
 	}
+	blocks := make([]storage.Block, len(blockIDs))
+	for i, blockID := range blockIDs {
+		blocks[i] = storage.Block{
+			ID:     blockID,
+			Status: storage.BlockStatusLatest,
+		}
+	}
 
 	// Finalise the upload session
 	putBlockListOptions := storage.PutBlockListOptions{}
@@ -1045,6 +1047,7 @@ outer:
 	if err != nil {
 		return errors.Wrap(err, "multipart upload failed to finalize")
 	}
+	resume.Finish()
 	return nil
 }
 
@@ -1073,7 +1076,7 @@ func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOptio
 	err = o.fs.pacer.CallNoRetry(func() (bool, error) {
 		if size >= int64(uploadCutoff) {
 			// If a large file upload in chunks
-			err = o.uploadMultipart(in, size, blob, &putBlobOptions)
+			err = o.uploadMultipart(in, src, blob, &putBlobOptions)
 		} else {
 			// Write a small blob in one transaction
 			if size == 0 {
@@ -11,11 +11,14 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"io/ioutil"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/ncw/rclone/b2/api"
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/multipart"
 	"github.com/ncw/rclone/rest"
 	"github.com/pkg/errors"
 )
@@ -72,11 +75,17 @@ type largeUpload struct {
 	size     int64                           // total size
 	parts    int64                           // calculated number of parts
 	sha1s    []string                        // slice of SHA1s for each part
+	prev     []string                        // SHA1s of the parts sent by an interrupted upload
+	resume   *fs.ResumableUpload             // saves the parts sent so the upload can be resumed
+	acked    int32                           // number of parts B2 has acknowledged - use atomic
 	uploadMu sync.Mutex                      // lock for upload variable
 	uploads  []*api.GetUploadPartURLResponse // result of get upload URL calls
 }
 
 // newLargeUpload starts an upload of object o from in with metadata in src
+//
+// If the upload of src was interrupted before then it is resumed if
+// possible.
 func (f *Fs) newLargeUpload(o *Object, in io.Reader, src fs.ObjectInfo) (up *largeUpload, err error) {
 	remote := o.remote
 	size := src.Size()
@@ -87,6 +96,40 @@ func (f *Fs) newLargeUpload(o *Object, in io.Reader, src fs.ObjectInfo) (up *lar
 	if parts > maxParts {
 		return nil, errors.Errorf("%q too big (%d bytes) makes too many parts %d > %d - increase --b2-chunk-size", remote, size, parts, maxParts)
 	}
+	up = &largeUpload{
+		f:      f,
+		o:      o,
+		in:     in,
+		size:   size,
+		parts:  parts,
+		resume: fs.NewResumableUpload(f, remote, src, int64(chunkSize)),
+	}
+	state := up.resume.Resume()
+	if state != nil && int64(len(state.Parts)) <= parts {
+		// Check the large file is still there by asking for
+		// an upload URL for it
+		up.id = state.Session
+		upload, err := up.getUploadURL()
+		if err == nil {
+			up.returnUploadURL(upload)
+			up.prev = state.Parts
+			return up, nil
+		}
+		fs.Debugf(o, "Can't resume large file upload - starting again: %v", err)
+		up.clearUploadURL()
+	}
+	// Cancel the large file of an interrupted upload which isn't
+	// being resumed as its state is about to be replaced
+	stale := up.resume.Stale()
+	if state != nil {
+		stale = state.Session
+	}
+	if stale != "" {
+		fs.Debugf(o, "Cancelling large file upload %q which won't be resumed", stale)
+		if cancelErr := f.cancelLargeFile(stale); cancelErr != nil {
+			fs.Debugf(o, "Failed to cancel large file upload %q: %v", stale, cancelErr)
+		}
+	}
 	modTime := src.ModTime()
 	opts := rest.Opts{
 		Method: "POST",
@@ -116,15 +159,8 @@ func (f *Fs) newLargeUpload(o *Object, in io.Reader, src fs.ObjectInfo) (up *lar
 	if err != nil {
 		return nil, err
 	}
-	up = &largeUpload{
-		f:     f,
-		o:     o,
-		in:    in,
-		id:    response.ID,
-		size:  size,
-		parts: parts,
-		sha1s: make([]string, parts),
-	}
+	up.id = response.ID
+	up.resume.Start(up.id)
 	return up, nil
 }
 
@@ -172,73 +208,88 @@ func (up *largeUpload) clearUploadURL() {
 	up.uploadMu.Unlock()
 }
 
-// Transfer a chunk
-func (up *largeUpload) transferChunk(part int64, body []byte) error {
-	in := newHashAppendingReader(bytes.NewReader(body), sha1.New())
-	size := int64(len(body)) + int64(in.AdditionalLength())
-
-	err := up.f.pacer.Call(func() (bool, error) {
-		fs.Debugf(up.o, "Sending chunk %d length %d", part, len(body))
+// sendChunk sends part of the file - it is an Uploader.Send function
+func (up *largeUpload) sendChunk(part *multipart.Part) (id string, retry bool, err error) {
+	in := newHashAppendingReader(bytes.NewReader(part.Data), sha1.New())
+	size := int64(len(part.Data)) + int64(in.AdditionalLength())
 
-		// Get upload URL
-		upload, err := up.getUploadURL()
-		if err != nil {
-			return false, err
-		}
+	// Get upload URL
+	upload, err := up.getUploadURL()
+	if err != nil {
+		return "", false, err
+	}
 
-		// Authorization
-		//
-		// An upload authorization token, from b2_get_upload_part_url.
-		//
-		// X-Bz-Part-Number
-		//
-		// A number from 1 to 10000. The parts uploaded for one file
-		// must have contiguous numbers, starting with 1.
-		//
-		// Content-Length
-		//
-		// The number of bytes in the file being uploaded. Note that
-		// this header is required; you cannot leave it out and just
-		// use chunked encoding.  The minimum size of every part but
-		// the last one is 100MB.
-		//
-		// X-Bz-Content-Sha1
-		//
-		// The SHA1 checksum of the this part of the file. B2 will
-		// check this when the part is uploaded, to make sure that the
-		// data arrived correctly.  The same SHA1 checksum must be
-		// passed to b2_finish_large_file.
-		opts := rest.Opts{
-			Method:  "POST",
-			RootURL: upload.UploadURL,
-			Body:    fs.AccountPart(up.o, in),
-			ExtraHeaders: map[string]string{
-				"Authorization":    upload.AuthorizationToken,
-				"X-Bz-Part-Number": fmt.Sprintf("%d", part),
-				sha1Header:         "hex_digits_at_end",
-			},
-			ContentLength: &size,
-		}
+	// Authorization
+	//
+	// An upload authorization token, from b2_get_upload_part_url.
+	//
+	// X-Bz-Part-Number
+	//
+	// A number from 1 to 10000. The parts uploaded for one file
+	// must have contiguous numbers, starting with 1.
+	//
+	// Content-Length
+	//
+	// The number of bytes in the file being uploaded. Note that
+	// this header is required; you cannot leave it out and just
+	// use chunked encoding.  The minimum size of every part but
+	// the last one is 100MB.
+	//
+	// X-Bz-Content-Sha1
+	//
+	// The SHA1 checksum of the this part of the file. B2 will
+	// check this when the part is uploaded, to make sure that the
+	// data arrived correctly.  The same SHA1 checksum must be
+	// passed to b2_finish_large_file.
+	opts := rest.Opts{
+		Method:  "POST",
+		RootURL: upload.UploadURL,
+		Body:    fs.AccountPart(up.o, in),
+		ExtraHeaders: map[string]string{
+			"Authorization":    upload.AuthorizationToken,
+			"X-Bz-Part-Number": fmt.Sprintf("%d", part.Number+1),
+			sha1Header:         "hex_digits_at_end",
+		},
+		ContentLength: &size,
+	}
 
-		var response api.UploadPartResponse
+	var response api.UploadPartResponse
 
-		resp, err := up.f.srv.CallJSON(&opts, nil, &response)
-		retry, err := up.f.shouldRetry(resp, err)
-		// On retryable error clear PartUploadURL
-		if retry {
-			fs.Debugf(up.o, "Clearing part upload URL because of error: %v", err)
-			upload = nil
-		}
-		up.returnUploadURL(upload)
-		return retry, err
-	})
+	resp, err := up.f.srv.CallJSON(&opts, nil, &response)
+	retry, err = up.f.shouldRetry(resp, err)
+	// On retryable error clear PartUploadURL
+	if retry {
+		fs.Debugf(up.o, "Clearing part upload URL because of error: %v", err)
+		upload = nil
+	}
+	up.returnUploadURL(upload)
 	if err != nil {
-		fs.Debugf(up.o, "Error sending chunk %d: %v", part, err)
-	} else {
-		fs.Debugf(up.o, "Done sending chunk %d", part)
+		fs.Debugf(up.o, "Error sending chunk %d: %v", part.Number+1, err)
+		return "", retry, err
 	}
-	up.sha1s[part-1] = in.HexSum()
-	return err
+	up.resume.SetPart(part.Number, in.HexSum())
+	atomic.AddInt32(&up.acked, 1)
+	return in.HexSum(), false, nil
+}
+
+// uploaded returns the SHA1 of part if it was sent by an interrupted
+// upload with the same contents, otherwise "" - it is an Uploader.Skip
+// function
+//
+// Parts which were sent are passed through the accounting so the
+// progress of the transfer includes them.
+func (up *largeUpload) uploaded(part *multipart.Part) string {
+	if part.Number >= len(up.prev) || up.prev[part.Number] == "" {
+		return ""
+	}
+	sum := sha1.Sum(part.Data)
+	if hex.EncodeToString(sum[:]) != up.prev[part.Number] {
+		fs.Debugf(up.o, "Chunk %d has changed since it was sent - sending it again", part.Number+1)
+		return ""
+	}
+	_, _ = io.Copy(ioutil.Discard, fs.AccountPart(up.o, bytes.NewReader(part.Data)))
+	atomic.AddInt32(&up.acked, 1)
+	return up.prev[part.Number]
 }
 
 // finish closes off the large upload
@@ -262,77 +313,58 @@ func (up *largeUpload) finish() error {
 	return up.o.decodeMetaDataFileInfo(&response)
 }
 
-// cancel aborts the large upload
-func (up *largeUpload) cancel() error {
+// cancelLargeFile aborts the large upload with id
+func (f *Fs) cancelLargeFile(id string) error {
 	opts := rest.Opts{
 		Method: "POST",
 		Path:   "/b2_cancel_large_file",
 	}
 	var request = api.CancelLargeFileRequest{
-		ID: up.id,
+		ID: id,
 	}
 	var response api.CancelLargeFileResponse
-	err := up.f.pacer.Call(func() (bool, error) {
-		resp, err := up.f.srv.CallJSON(&opts, &request, &response)
-		return up.f.shouldRetry(resp, err)
+	err := f.pacer.Call(func() (bool, error) {
+		resp, err := f.srv.CallJSON(&opts, &request, &response)
+		return f.shouldRetry(resp, err)
 	})
 	return err
 }
 
+// cancel aborts the large upload
+func (up *largeUpload) cancel() error {
+	return up.f.cancelLargeFile(up.id)
+}
+
+// resumable returns whether the large file should be kept after the
+// upload failed with err so it can be resumed.  It is only kept if
+// the upload state is being saved, B2 has acknowledged some parts,
+// and err looks like a passing problem with the network or B2 rather
+// than a problem with the source.
+func (up *largeUpload) resumable(err error) bool {
+	if up.resume == nil || atomic.LoadInt32(&up.acked) == 0 {
+		return false
+	}
+	if apiErr, ok := errors.Cause(err).(*api.Error); ok {
+		return apiErr.Status == 429 || apiErr.Status >= 500
+	}
+	return fs.ShouldRetry(err)
+}
+
 // Upload uploads the chunks from the input
-func (up *largeUpload) Upload() error {
+func (up *largeUpload) Upload() (err error) {
 	fs.Debugf(up.o, "Starting upload of large file in %d chunks (id %q)", up.parts, up.id)
-	remaining := up.size
-	errs := make(chan error, 1)
-	var wg sync.WaitGroup
-	var err error
 	fs.AccountByPart(up.o) // Cancel whole file accounting before reading
-outer:
-	for part := int64(1); part <= up.parts; part++ {
-		// Check any errors
-		select {
-		case err = <-errs:
-			break outer
-		default:
-		}
-
-		reqSize := remaining
-		if reqSize >= int64(chunkSize) {
-			reqSize = int64(chunkSize)
-		}
-
-		// Get a block of memory
-		buf := up.f.getUploadBlock()[:reqSize]
-
-		// Read the chunk
-		_, err = io.ReadFull(up.in, buf)
-		if err != nil {
-			up.f.putUploadBlock(buf)
-			break outer
-		}
-
-		// Transfer the chunk
-		wg.Add(1)
-		go func(part int64, buf []byte) {
-			defer wg.Done()
-			defer up.f.putUploadBlock(buf)
-			err := up.transferChunk(part, buf)
-			if err != nil {
-				select {
-				case errs <- err:
-				default:
-				}
-			}
-		}(part, buf)
-
-		remaining -= reqSize
+	u := multipart.Uploader{
+		Obj:      up.o,
+		Pacer:    up.f.pacer,
+		PartSize: int64(chunkSize),
+		Skip:     up.uploaded,
+		Send:     up.sendChunk,
 	}
-	wg.Wait()
-	if err == nil {
-		select {
-		case err = <-errs:
-		default:
-		}
+	up.sha1s, err = u.Upload(up.in, up.size)
+	if err != nil && up.resumable(err) {
+		fs.Debugf(up.o, "Keeping large file upload to resume after error: %v", err)
+		return err
 	}
 	if err != nil {
 		fs.Debugf(up.o, "Cancelling large file upload due to error: %v", err)
@@ -340,9 +372,15 @@ outer:
 		if cancelErr != nil {
 			fs.Errorf(up.o, "Failed to cancel large file upload: %v", cancelErr)
 		}
+		up.resume.Finish()
 		return err
 	}
 	// Check any errors
 	fs.Debugf(up.o, "Finishing large file upload")
-	return up.finish()
+	err = up.finish()
+	if err != nil {
+		return err
+	}
+	up.resume.Finish()
+	return nil
 }
@@ -23,23 +23,34 @@ docs = [
     # Keep these alphabetical by full name
     "amazonclouddrive.md",
     "s3.md",
+    "archive.md",
     "b2.md",
     "box.md",
+    "cache.md",
+    "cas.md",
+    "chunker.md",
+    "compress.md",
     "crypt.md",
     "dropbox.md",
+    "erasure.md",
     "ftp.md",
     "googlecloudstorage.md",
     "drive.md",
+    "hasher.md",
     "http.md",
     "hubic.md",
     "azureblob.md",
     "onedrive.md",
+    "mirror.md",
     "qingstor.md",
     "swift.md",
     "sftp.md",
+    "union.md",
+    "webdav.md",
     "yandex.md",
 
     "local.md",
+    "memory.md",
     "changelog.md",
     "bugs.md",
     "faq.md",
@@ -0,0 +1,624 @@
+// Package cache provides a wrapper for Fs and Object which caches the
+// directory listings, metadata and data of a slow remote on the
+// local disk
+package cache
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// Globals
+var (
+	// Flags
+	cacheDir            = fs.StringP("cache-dir", "", defaultCacheDir(), "Directory rclone will use for caching.")
+	cacheWorkers        = fs.IntP("cache-workers", "", 4, "How many chunks to read ahead in the background while reading a file.")
+	cacheInfoAge        = fs.DurationP("cache-info-age", "", 6*time.Hour, "How long to cache file structure information (directory listings, file size, mod times etc).")
+	cacheChunkSize      = fs.SizeSuffix(5 * 1024 * 1024)
+	cacheTotalChunkSize = fs.SizeSuffix(10 * 1024 * 1024 * 1024)
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "cache",
+		Description: "Cache a remote",
+		NewFs:       NewFs,
+		Options: []fs.Option{{
+			Name: "remote",
+			Help: "Remote to cache.\nNormally should contain a ':' and a path, eg \"myremote:path/to/dir\",\n\"myremote:bucket\" or maybe \"myremote:\" (not recommended).",
+		}, {
+			Name: "chunk_size",
+			Help: "The size of a chunk. Lower values are better for slow connections.\nLeave blank to use the value of --cache-chunk-size (default 5M).",
+			Examples: []fs.OptionExample{{
+				Value: "1m",
+				Help:  "1MB",
+			}, {
+				Value: "5M",
+				Help:  "5 MB",
+			}, {
+				Value: "10M",
+				Help:  "10 MB",
+			}},
+			Optional: true,
+		}, {
+			Name: "total_chunk_size",
+			Help: "The total size that the chunks can take up on the local disk. The least\nrecently used chunks will be removed when the cache grows beyond this.\nLeave blank to use the value of --cache-total-chunk-size (default 10G).",
+			Examples: []fs.OptionExample{{
+				Value: "500M",
+				Help:  "500 MB",
+			}, {
+				Value: "1G",
+				Help:  "1 GB",
+			}, {
+				Value: "10G",
+				Help:  "10 GB",
+			}},
+			Optional: true,
+		}, {
+			Name: "info_age",
+			Help: "How long to cache file structure information (directory listings, file size, mod times etc).\nLeave blank to use the value of --cache-info-age (default 6h).",
+			Examples: []fs.OptionExample{{
+				Value: "1h",
+				Help:  "1 hour",
+			}, {
+				Value: "24h",
+				Help:  "24 hours",
+			}, {
+				Value: "48h",
+				Help:  "48 hours",
+			}},
+			Optional: true,
+		}},
+	})
+	fs.VarP(&cacheChunkSize, "cache-chunk-size", "", "The size of a chunk of cached file data.")
+	fs.VarP(&cacheTotalChunkSize, "cache-total-chunk-size", "", "The total size which the cached chunks can take up on the local disk.")
+}
+
+// defaultCacheDir returns the directory to cache in if --cache-dir
+// isn't set
+func defaultCacheDir() string {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "rclone")
+	}
+	homedir := os.Getenv("HOME")
+	if usr, err := user.Current(); err == nil {
+		homedir = usr.HomeDir
+	}
+	if homedir == "" {
+		return filepath.Join(os.TempDir(), "rclone-cache")
+	}
+	return filepath.Join(homedir, ".cache", "rclone")
+}
+
+// NewFs contstructs an Fs from the path, container:path
+func NewFs(name, rpath string) (fs.Fs, error) {
+	remote := fs.ConfigFileGet(name, "remote")
+	if strings.HasPrefix(remote, name+":") {
+		return nil, errors.New("can't point cache remote at itself - check the value of the remote setting")
+	}
+	chunkSize := cacheChunkSize
+	if value := fs.ConfigFileGet(name, "chunk_size"); value != "" {
+		err := chunkSize.Set(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read chunk_size")
+		}
+	}
+	if chunkSize <= 0 {
+		return nil, errors.Errorf("chunk_size must be greater than 0 - not %v", chunkSize)
+	}
+	totalChunkSize := cacheTotalChunkSize
+	if value := fs.ConfigFileGet(name, "total_chunk_size"); value != "" {
+		err := totalChunkSize.Set(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read total_chunk_size")
+		}
+	}
+	infoAge := *cacheInfoAge
+	if value := fs.ConfigFileGet(name, "info_age"); value != "" {
+		var err error
+		infoAge, err = fs.ParseDuration(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read info_age")
+		}
+	}
+
+	root := strings.Trim(path.Clean(rpath), "/")
+	if root == "." {
+		root = ""
+	}
+	remotePath := path.Join(remote, root)
+	wrappedFs, err := fs.NewFs(remotePath)
+	if err != fs.ErrorIsFile && err != nil {
+		return nil, errors.Wrapf(err, "failed to make remote %q to wrap", remotePath)
+	}
+	if err == fs.ErrorIsFile {
+		// The wrapped Fs now points to the parent so follow it
+		root = parentDir(root)
+	}
+	f := &Fs{
+		Fs:        wrappedFs,
+		name:      name,
+		root:      root,
+		store:     getStore(filepath.Join(*cacheDir, name), int64(totalChunkSize)),
+		chunkSize: int64(chunkSize),
+		infoAge:   infoAge,
+		workers:   *cacheWorkers,
+	}
+	// the features here are ones we could support, and they are
+	// ANDed with the ones from wrappedFs
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false, // the cache is keyed on the file name
+		ReadMimeType:            false,
+		WriteMimeType:           false,
+		BucketBased:             true,
+		CanHaveEmptyDirectories: true,
+	}).Fill(f).Mask(wrappedFs)
+	// The cache can always be flushed whether the wrapped Fs has a
+	// directory cache or not
+	f.features.DirCacheFlush = f.DirCacheFlush
+	return f, err
+}
+
+// Fs represents a wrapped fs.Fs
+type Fs struct {
+	fs.Fs
+	name      string
+	root      string
+	features  *fs.Features // optional features
+	store     *store       // persistent storage for the cache
+	chunkSize int64        // size of the chunks of file data
+	infoAge   time.Duration
+	workers   int // number of chunks to read ahead
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// String returns a description of the FS
+func (f *Fs) String() string {
+	return fmt.Sprintf("Cached remote '%s:%s'", f.name, f.root)
+}
+
+// cachePath returns the path of remote in the cache, which is
+// relative to the root of the remote rather than the root of f
+func (f *Fs) cachePath(remote string) string {
+	if f.root == "" {
+		return remote
+	}
+	if remote == "" {
+		return f.root
+	}
+	return path.Join(f.root, remote)
+}
+
+// logError logs a failure to update the cache - these are not
+// returned to the caller as the operation on the remote succeeded
+func (f *Fs) logError(err error, what string) {
+	if err != nil {
+		fs.Errorf(f, "Failed to %s in cache: %v", what, err)
+	}
+}
+
+// cacheObject records o in the listing of its directory, discarding
+// any data cached under the same name
+func (f *Fs) cacheObject(o *Object) {
+	remote := f.cachePath(o.remote)
+	f.logError(f.store.removeChunks(remote), "remove chunks")
+	f.logError(f.store.addEntry(remote, o.entry()), "add object")
+}
+
+// uncacheObject removes the object at remote from the cache
+func (f *Fs) uncacheObject(remote string) {
+	remote = f.cachePath(remote)
+	f.logError(f.store.removeChunks(remote), "remove chunks")
+	f.logError(f.store.removeEntry(remote), "remove object")
+}
+
+// cacheDir records that dir exists
+func (f *Fs) cacheDir(dir string) {
+	dir = f.cachePath(dir)
+	if dir == "" {
+		return
+	}
+	f.logError(f.store.addEntry(dir, cachedEntry{IsDir: true, Size: -1, ModTime: time.Now()}), "add directory")
+}
+
+// uncacheDir removes dir and everything in it from the cache
+func (f *Fs) uncacheDir(dir string) {
+	dir = f.cachePath(dir)
+	f.logError(f.store.removeDir(dir), "remove directory")
+	f.logError(f.store.removeEntry(dir), "remove directory")
+}
+
+// fromListing makes directory entries for dir from the cached listing
+func (f *Fs) fromListing(dir string, l *listing) (entries fs.DirEntries) {
+	entries = make(fs.DirEntries, 0, len(l.Entries))
+	for i := range l.Entries {
+		entry := &l.Entries[i]
+		remote := path.Join(dir, entry.Name)
+		if entry.IsDir {
+			entries = append(entries, fs.NewDir(remote, entry.ModTime).SetSize(entry.Size))
+		} else {
+			entries = append(entries, f.newObjectFromEntry(remote, entry))
+		}
+	}
+	return entries
+}
+
+// toListing wraps the entries read from the remote and makes a
+// listing from them.  Hashes are kept from the old listing for
+// files which haven't changed.
+func (f *Fs) toListing(entries fs.DirEntries, old *listing) (newEntries fs.DirEntries, l *listing, err error) {
+	l = &listing{
+		CachedAt: time.Now(),
+		Entries:  make([]cachedEntry, 0, len(entries)),
+	}
+	newEntries = entries[:0] // in place filter
+	for _, entry := range entries {
+		switch x := entry.(type) {
+		case fs.Object:
+			o := f.newObject(x)
+			cached := o.entry()
+			if old != nil {
+				if oldEntry := old.find(cached.Name); oldEntry != nil && !oldEntry.IsDir && oldEntry.Size == cached.Size && oldEntry.ModTime.Equal(cached.ModTime) {
+					cached.Hashes = oldEntry.Hashes
+					o.hashes = oldEntry.Hashes
+				}
+			}
+			l.Entries = append(l.Entries, cached)
+			newEntries = append(newEntries, o)
+		case fs.Directory:
+			l.Entries = append(l.Entries, cachedEntry{
+				Name:    path.Base(x.Remote()),
+				IsDir:   true,
+				Size:    x.Size(),
+				ModTime: x.ModTime(),
+			})
+			newEntries = append(newEntries, x)
+		default:
+			return nil, nil, errors.Errorf("Unknown object type %T", entry)
+		}
+	}
+	return newEntries, l, nil
+}
+
+// discardChanged removes the cached data for entries in the old
+// listing of dir which have changed or gone in the new listing
+func (f *Fs) discardChanged(dir string, old, new *listing) {
+	if old == nil {
+		return
+	}
+	for _, oldEntry := range old.Entries {
+		remote := path.Join(dir, oldEntry.Name)
+		newEntry := new.find(oldEntry.Name)
+		switch {
+		case oldEntry.IsDir && (newEntry == nil || !newEntry.IsDir):
+			fs.Debugf(f, "%q: directory removed from remote", remote)
+			f.logError(f.store.removeDir(remote), "remove directory")
+		case !oldEntry.IsDir && (newEntry == nil || newEntry.IsDir || newEntry.Size != oldEntry.Size || !newEntry.ModTime.Equal(oldEntry.ModTime)):
+			fs.Debugf(f, "%q: file changed on remote", remote)
+			f.logError(f.store.removeChunks(remote), "remove chunks")
+		}
+	}
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(dir string) (entries fs.DirEntries, err error) {
+	cacheDir := f.cachePath(dir)
+	old, err := f.store.readListing(cacheDir)
+	if err != nil {
+		fs.Errorf(f, "Ignoring cached listing of %q: %v", dir, err)
+		old = nil
+	}
+	if old != nil && time.Since(old.CachedAt) < f.infoAge {
+		return f.fromListing(dir, old), nil
+	}
+	entries, err = f.Fs.List(dir)
+	if err == fs.ErrorDirNotFound {
+		f.uncacheDir(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries, l, err := f.toListing(entries, old)
+	if err != nil {
+		return nil, err
+	}
+	f.discardChanged(cacheDir, old, l)
+	f.logError(f.store.writeListing(cacheDir, l), "store listing")
+	return entries, nil
+}
+
+// NewObject finds the Object at remote.
+//
+// If the listing of the directory is in the cache then the Object is
+// made from that without contacting the remote.
+func (f *Fs) NewObject(remote string) (fs.Object, error) {
+	l, err := f.store.readListing(f.cachePath(parentDir(remote)))
+	if err != nil {
+		fs.Errorf(f, "Ignoring cached listing for %q: %v", remote, err)
+		l = nil
+	}
+	if l != nil && time.Since(l.CachedAt) < f.infoAge {
+		entry := l.find(path.Base(remote))
+		if entry == nil || entry.IsDir {
+			return nil, fs.ErrorObjectNotFound
+		}
+		return f.newObjectFromEntry(remote, entry), nil
+	}
+	o, err := f.Fs.NewObject(remote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o), nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(f.Fs.Put, in, src, options...)
+}
+
+// put uploads with the put function passed in and caches the result
+func (f *Fs) put(put func(io.Reader, fs.ObjectInfo, ...fs.OpenOption) (fs.Object, error), in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	o, err := put(in, src, options...)
+	if err != nil {
+		// the remote may have been left with a partial object
+		f.uncacheObject(src.Remote())
+		return nil, err
+	}
+	wrapped := f.newObject(o)
+	f.cacheObject(wrapped)
+	return wrapped, nil
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	do := f.Fs.Features().PutStream
+	if do == nil {
+		return nil, errors.New("can't PutStream")
+	}
+	return f.put(do, in, src, options...)
+}
+
+// PutUnchecked uploads the object
+//
+// This will create a duplicate if we upload a new file without
+// checking to see if there is one already - use Put() for that.
+func (f *Fs) PutUnchecked(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	do := f.Fs.Features().PutUnchecked
+	if do == nil {
+		return nil, errors.New("can't PutUnchecked")
+	}
+	return f.put(do, in, src, options...)
+}
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() fs.HashSet {
+	return f.Fs.Hashes()
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(dir string) error {
+	err := f.Fs.Mkdir(dir)
+	if err != nil {
+		return err
+	}
+	f.cacheDir(dir)
+	return nil
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(dir string) error {
+	err := f.Fs.Rmdir(dir)
+	if err != nil {
+		return err
+	}
+	f.uncacheDir(dir)
+	return nil
+}
+
+// Purge all files in the root and the root directory
+//
+// Implement this if you have a way of deleting all the files
+// quicker than just running Remove() on the result of List()
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge() error {
+	do := f.Fs.Features().Purge
+	if do == nil {
+		return fs.ErrorCantPurge
+	}
+	err := do()
+	// Some of the files may have been deleted even on error
+	f.uncacheDir("")
+	return err
+}
+
+// Copy src to this remote using server side copy operations.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Copy
+	if do == nil {
+		return nil, fs.ErrorCantCopy
+	}
+	o, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantCopy
+	}
+	srcObj, err := o.getObject()
+	if err != nil {
+		return nil, err
+	}
+	oResult, err := do(srcObj, remote)
+	if err != nil {
+		return nil, err
+	}
+	wrapped := f.newObject(oResult)
+	f.cacheObject(wrapped)
+	return wrapped, nil
+}
+
+// Move src to this remote using server side move operations.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Move
+	if do == nil {
+		return nil, fs.ErrorCantMove
+	}
+	o, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantMove
+	}
+	srcObj, err := o.getObject()
+	if err != nil {
+		return nil, err
+	}
+	oResult, err := do(srcObj, remote)
+	if err != nil {
+		return nil, err
+	}
+	o.f.uncacheObject(o.remote)
+	wrapped := f.newObject(oResult)
+	f.cacheObject(wrapped)
+	return wrapped, nil
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(src fs.Fs, srcRemote, dstRemote string) error {
+	do := f.Fs.Features().DirMove
+	if do == nil {
+		return fs.ErrorCantDirMove
+	}
+	srcFs, ok := src.(*Fs)
+	if !ok {
+		fs.Debugf(srcFs, "Can't move directory - not same remote type")
+		return fs.ErrorCantDirMove
+	}
+	err := do(srcFs.Fs, srcRemote, dstRemote)
+	if err != nil {
+		return err
+	}
+	srcFs.uncacheDir(srcRemote)
+	f.uncacheDir(dstRemote)
+	f.cacheDir(dstRemote)
+	return nil
+}
+
+// DirChangeNotify calls notifyFunc with the path of each directory
+// which has changed on the wrapped remote after invalidating the
+// cache for it.
+//
+// Close the returned channel to stop being notified.
+func (f *Fs) DirChangeNotify(notifyFunc func(string), pollInterval time.Duration) chan bool {
+	do := f.Fs.Features().DirChangeNotify
+	if do == nil {
+		return nil
+	}
+	return do(func(dir string) {
+		fs.Debugf(f, "%q: changed on remote - expiring cached listing", dir)
+		f.logError(f.store.expireListing(f.cachePath(dir)), "expire listing")
+		notifyFunc(dir)
+	}, pollInterval)
+}
+
+// DirCacheFlush marks all the cached listings as out of date so they
+// are read again from the remote
+func (f *Fs) DirCacheFlush() {
+	f.logError(f.store.expireListings(f.root), "expire listings")
+	if do := f.Fs.Features().DirCacheFlush; do != nil {
+		do()
+	}
+}
+
+// CleanUp the trash in the Fs
+//
+// Implement this if you have a way of emptying the trash or
+// otherwise cleaning up old versions of files.
+func (f *Fs) CleanUp() error {
+	do := f.Fs.Features().CleanUp
+	if do == nil {
+		return errors.New("can't CleanUp")
+	}
+	return do()
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs {
+	return f.Fs
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs                = (*Fs)(nil)
+	_ fs.Purger            = (*Fs)(nil)
+	_ fs.Copier            = (*Fs)(nil)
+	_ fs.Mover             = (*Fs)(nil)
+	_ fs.DirMover          = (*Fs)(nil)
+	_ fs.PutUncheckeder    = (*Fs)(nil)
+	_ fs.PutStreamer       = (*Fs)(nil)
+	_ fs.CleanUpper        = (*Fs)(nil)
+	_ fs.UnWrapper         = (*Fs)(nil)
+	_ fs.DirChangeNotifier = (*Fs)(nil)
+	_ fs.DirCacheFlusher   = (*Fs)(nil)
+	_ fs.Object            = (*Object)(nil)
+)
@@ -0,0 +1,25 @@
+package cache_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/ncw/rclone/fstest/fstests"
+	"github.com/spf13/pflag"
+)
+
+// Create the TestCache: remote
+func init() {
+	tempdir := filepath.Join(os.TempDir(), "rclone-cache-test-remote")
+	name := "TestCache"
+	err := pflag.Set("cache-dir", filepath.Join(os.TempDir(), "rclone-cache-test-cache"))
+	if err != nil {
+		panic(err)
+	}
+	fstests.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "cache"},
+		{Name: name, Key: "remote", Value: tempdir},
+		// use small chunks so files are read in several
+		{Name: name, Key: "chunk_size", Value: "16b"},
+	}
+}
@@ -0,0 +1,265 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	_ "github.com/ncw/rclone/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFs makes a cache remote wrapping a temporary local
+// directory returning the Fs, the local directory and a function to
+// tidy up
+func newTestFs(t *testing.T) (*Fs, string, func()) {
+	dirs, cleanup := fstest.NewLocalDirs(t, 2)
+	remote := dirs[0]
+	oldCacheDir := *cacheDir
+	*cacheDir = dirs[1]
+	f, err := fstest.NewConfiguredFs("TestCacheInternal", "type", "cache", "remote", remote, "chunk_size", "4b")
+	require.NoError(t, err)
+	return f.(*Fs), remote, func() {
+		f.(*Fs).store.readAheads.Wait()
+		*cacheDir = oldCacheDir
+		cleanup()
+	}
+}
+
+// listNames lists dir returning the sorted names
+func listNames(t *testing.T, f fs.Fs, dir string) (names []string) {
+	entries, err := f.List(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		names = append(names, entry.Remote())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestListingCached(t *testing.T) {
+	f, remote, cleanup := newTestFs(t)
+	defer cleanup()
+	t1 := fstest.Time("2001-02-03T04:05:06Z")
+
+	fstest.WriteFile(t, remote, "one.txt", "one", t1)
+	assert.Equal(t, []string{"one.txt"}, listNames(t, f, ""))
+
+	// Changes on the remote aren't seen until the listing expires
+	fstest.WriteFile(t, remote, "two.txt", "two", t1)
+	assert.Equal(t, []string{"one.txt"}, listNames(t, f, ""))
+	_, err := f.NewObject("two.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	f.DirCacheFlush()
+	assert.Equal(t, []string{"one.txt", "two.txt"}, listNames(t, f, ""))
+
+	// Changes made through the cache are seen straight away
+	require.NoError(t, f.Mkdir("dir"))
+	o, err := f.NewObject("one.txt")
+	require.NoError(t, err)
+	require.NoError(t, o.Remove())
+	assert.Equal(t, []string{"dir", "two.txt"}, listNames(t, f, ""))
+
+	// The listing is persistent
+	f2, err := fs.NewFs(f.Name() + ":")
+	require.NoError(t, err)
+	fstest.WriteFile(t, remote, "three.txt", "three", t1)
+	assert.Equal(t, []string{"dir", "two.txt"}, listNames(t, f2, ""))
+
+	// Unless it is older than info_age
+	f.infoAge = 0
+	assert.Equal(t, []string{"dir", "three.txt", "two.txt"}, listNames(t, f, ""))
+}
+
+func TestReadFromChunks(t *testing.T) {
+	f, remote, cleanup := newTestFs(t)
+	defer cleanup()
+	t1 := fstest.Time("2001-02-03T04:05:06Z")
+
+	fstest.WriteFile(t, remote, "file.txt", "0123456789", t1)
+	assert.Equal(t, []string{"file.txt"}, listNames(t, f, ""))
+	assert.Equal(t, "0123456789", fstest.ReadObject(t, f, "file.txt"))
+	for _, offset := range []int64{0, 4, 8} {
+		assert.True(t, f.store.hasChunk("file.txt", offset), offset)
+	}
+
+	// Change the file without changing the size or modtime so
+	// the cache can't notice - the data comes from the chunks
+	fstest.WriteFile(t, remote, "file.txt", "abcdefghij", t1)
+	assert.Equal(t, "0123456789", fstest.ReadObject(t, f, "file.txt"))
+
+	// Ranges are read from the chunks
+	o, err := f.NewObject("file.txt")
+	require.NoError(t, err)
+	in, err := o.Open(&fs.RangeOption{Start: 3, End: 8})
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "345678", string(data))
+
+	// A change noticed when the listing is read again discards
+	// the chunks
+	t2 := fstest.Time("2002-02-03T04:05:06Z")
+	fstest.WriteFile(t, remote, "file.txt", "ABCDEFGHIJKL", t2)
+	f.DirCacheFlush()
+	assert.Equal(t, []string{"file.txt"}, listNames(t, f, ""))
+	assert.False(t, f.store.hasChunk("file.txt", 0))
+	assert.Equal(t, "ABCDEFGHIJKL", fstest.ReadObject(t, f, "file.txt"))
+}
+
+func TestReadAhead(t *testing.T) {
+	f, remote, cleanup := newTestFs(t)
+	defer cleanup()
+	t1 := fstest.Time("2001-02-03T04:05:06Z")
+	f.workers = 2
+
+	fstest.WriteFile(t, remote, "file.txt", "0123456789abcdefghij", t1)
+	o, err := f.NewObject("file.txt")
+	require.NoError(t, err)
+	in, err := o.Open()
+	require.NoError(t, err)
+	buf := make([]byte, 1)
+	_, err = in.Read(buf)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+
+	// The next two chunks should be read in the background
+	for i := 0; i < 100 && !(f.store.hasChunk("file.txt", 4) && f.store.hasChunk("file.txt", 8)); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, f.store.hasChunk("file.txt", 4))
+	assert.True(t, f.store.hasChunk("file.txt", 8))
+	assert.False(t, f.store.hasChunk("file.txt", 12))
+}
+
+func TestTotalChunkSize(t *testing.T) {
+	f, _, cleanup := newTestFs(t)
+	defer cleanup()
+	s := f.store
+	s.mu.Lock()
+	s.totalSize = 8
+	s.mu.Unlock()
+
+	version := newChunksObject(4, time.Now())
+	for _, remote := range []string{"a", "b", "c"} {
+		require.NoError(t, s.checkChunks(remote, version))
+	}
+	require.NoError(t, s.writeChunk("a", version, 0, []byte("1234")))
+	require.NoError(t, s.writeChunk("b", version, 0, []byte("1234")))
+	assert.True(t, s.hasChunk("a", 0))
+
+	// Reading a chunk marks it as recently used
+	data, err := s.readChunk("a", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "1234", string(data))
+
+	require.NoError(t, s.writeChunk("c", version, 0, []byte("1234")))
+	assert.True(t, s.hasChunk("a", 0))
+	assert.False(t, s.hasChunk("b", 0))
+	assert.True(t, s.hasChunk("c", 0))
+
+	// Removed chunks no longer count towards the total
+	require.NoError(t, s.removeChunks("a"))
+	require.NoError(t, s.checkChunks("b", version))
+	require.NoError(t, s.writeChunk("b", version, 0, []byte("1234")))
+	assert.True(t, s.hasChunk("b", 0))
+	assert.True(t, s.hasChunk("c", 0))
+
+	// A new store orders the chunks already on disk by their
+	// modification times
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(s.chunkPath("c", 0), old, old))
+	s2 := &store{dir: s.dir, totalSize: 8}
+	require.NoError(t, s2.checkChunks("a", version))
+	require.NoError(t, s2.writeChunk("a", version, 0, []byte("1234")))
+	assert.True(t, s2.hasChunk("a", 0))
+	assert.True(t, s2.hasChunk("b", 0))
+	assert.False(t, s2.hasChunk("c", 0))
+}
+
+func TestCheckChunks(t *testing.T) {
+	f, _, cleanup := newTestFs(t)
+	defer cleanup()
+	s := f.store
+	t1 := fstest.Time("2001-02-03T04:05:06Z")
+	t2 := fstest.Time("2002-02-03T04:05:06Z")
+
+	v1, v2 := newChunksObject(4, t1), newChunksObject(4, t2)
+	require.NoError(t, s.checkChunks("dir/file", v1))
+	require.NoError(t, s.writeChunk("dir/file", v1, 0, []byte("1234")))
+
+	// Same object keeps the chunks
+	require.NoError(t, s.checkChunks("dir/file", v1))
+	assert.True(t, s.hasChunk("dir/file", 0))
+
+	// Changed object discards them
+	require.NoError(t, s.checkChunks("dir/file", v2))
+	assert.False(t, s.hasChunk("dir/file", 0))
+
+	// Chunks read from the old object aren't stored
+	require.NoError(t, s.writeChunk("dir/file", v1, 0, []byte("1234")))
+	assert.False(t, s.hasChunk("dir/file", 0))
+
+	// The marker isn't counted as a chunk
+	chunks, err := s.listChunks()
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(chunks))
+}
+
+// notifyFs is an Fs with a DirChangeNotify which can be triggered
+type notifyFs struct {
+	fs.Fs
+	notify func(string)
+}
+
+func (f *notifyFs) Features() *fs.Features {
+	return (&fs.Features{}).Fill(f)
+}
+
+func (f *notifyFs) DirChangeNotify(notifyFunc func(string), pollInterval time.Duration) chan bool {
+	f.notify = notifyFunc
+	return make(chan bool)
+}
+
+func TestDirChangeNotify(t *testing.T) {
+	f, remote, cleanup := newTestFs(t)
+	defer cleanup()
+	t1 := fstest.Time("2001-02-03T04:05:06Z")
+	wrapped := &notifyFs{Fs: f.Fs}
+	f.Fs = wrapped
+
+	require.NoError(t, os.MkdirAll(filepath.Join(remote, "dir"), 0777))
+	fstest.WriteFile(t, remote, "dir/one.txt", "one", t1)
+	assert.Equal(t, []string{"dir/one.txt"}, listNames(t, f, "dir"))
+
+	var changes []string
+	quit := f.DirChangeNotify(func(dir string) {
+		changes = append(changes, dir)
+	}, time.Second)
+	require.NotNil(t, quit)
+	require.NotNil(t, wrapped.notify)
+
+	fstest.WriteFile(t, remote, "dir/two.txt", "two", t1)
+	assert.Equal(t, []string{"dir/one.txt"}, listNames(t, f, "dir"))
+	wrapped.notify("dir")
+	assert.Equal(t, []string{"dir"}, changes)
+	assert.Equal(t, []string{"dir/one.txt", "dir/two.txt"}, listNames(t, f, "dir"))
+}
+
+func TestOsPathToDir(t *testing.T) {
+	f, _, cleanup := newTestFs(t)
+	defer cleanup()
+	for _, dir := range []string{"", "a", "a/b c/d"} {
+		rel, err := filepath.Rel(f.store.dir, f.store.dirPath(dir))
+		require.NoError(t, err)
+		assert.Equal(t, dir, osPathToDir(rel))
+	}
+}
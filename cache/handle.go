@@ -0,0 +1,174 @@
+// Read file data through the chunk cache
+
+package cache
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// handle reads an Object through the chunk cache, reading the
+// following chunks ahead in the background
+type handle struct {
+	o           *Object
+	remote      string       // path of the object in the cache
+	size        int64        // size of the object when opened
+	version     chunksObject // version of the object when opened
+	offset      int64        // offset of the next byte to read
+	end         int64        // read up to here
+	chunk       []byte       // data of the current chunk
+	chunkOffset int64        // offset of chunk in the file
+	closed      bool
+}
+
+// newHandle makes a handle to read o from offset up to end
+//
+// Any cached chunks which weren't read from this version of the
+// object are discarded.
+func newHandle(o *Object, offset, end int64) *handle {
+	h := &handle{
+		o:           o,
+		remote:      o.f.cachePath(o.remote),
+		size:        o.Size(),
+		version:     newChunksObject(o.Size(), o.ModTime()),
+		offset:      offset,
+		end:         end,
+		chunkOffset: -1,
+	}
+	o.f.logError(o.f.store.checkChunks(h.remote, h.version), "check chunks")
+	return h
+}
+
+// chunkLen returns the length of the chunk at offset
+func (h *handle) chunkLen(offset int64) int64 {
+	n := h.size - offset
+	if n > h.o.f.chunkSize {
+		n = h.o.f.chunkSize
+	}
+	return n
+}
+
+// Read reads up to len(p) bytes into p
+func (h *handle) Read(p []byte) (n int, err error) {
+	if h.closed {
+		return 0, errors.New("read on closed file")
+	}
+	if h.offset >= h.end {
+		return 0, io.EOF
+	}
+	chunkOffset := h.offset - h.offset%h.o.f.chunkSize
+	if chunkOffset != h.chunkOffset {
+		h.chunk, err = h.getChunk(chunkOffset)
+		if err != nil {
+			return 0, err
+		}
+		h.chunkOffset = chunkOffset
+		h.readAhead(chunkOffset + h.o.f.chunkSize)
+	}
+	if h.offset-chunkOffset >= int64(len(h.chunk)) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	data := h.chunk[h.offset-chunkOffset:]
+	if remaining := h.end - h.offset; int64(len(data)) > remaining {
+		data = data[:remaining]
+	}
+	n = copy(p, data)
+	h.offset += int64(n)
+	return n, nil
+}
+
+// Close the handle - any chunks being read ahead will still be
+// stored in the cache
+func (h *handle) Close() error {
+	h.closed = true
+	h.chunk = nil
+	return nil
+}
+
+// getChunk returns the chunk at offset from the cache or the remote
+func (h *handle) getChunk(offset int64) ([]byte, error) {
+	data, err := h.o.f.store.readChunk(h.remote, offset)
+	if err != nil {
+		fs.Errorf(h.o, "Ignoring cached chunk at %d: %v", offset, err)
+	} else if data != nil && int64(len(data)) == h.chunkLen(offset) {
+		return data, nil
+	}
+	return h.download(offset)
+}
+
+// readAhead starts reading the chunks from offset in the background
+// if they aren't already cached
+func (h *handle) readAhead(offset int64) {
+	for i := 0; i < h.o.f.workers; i++ {
+		if offset >= h.end {
+			break
+		}
+		if !h.o.f.store.hasChunk(h.remote, offset) {
+			h.o.f.store.readAheads.Add(1)
+			go func(offset int64) {
+				defer h.o.f.store.readAheads.Done()
+				_, err := h.download(offset)
+				if err != nil {
+					fs.Debugf(h.o, "Failed to read ahead chunk at %d: %v", offset, err)
+				}
+			}(offset)
+		}
+		offset += h.o.f.chunkSize
+	}
+}
+
+// download reads the chunk at offset from the remote and stores it
+// in the cache.  If the chunk is already being downloaded it waits
+// for that to finish instead.
+func (h *handle) download(offset int64) ([]byte, error) {
+	s := h.o.f.store
+	key := fmt.Sprintf("%s@%d:%d", s.chunkPath(h.remote, offset), h.version.Size, h.version.ModTime.UnixNano())
+	s.downloadsMu.Lock()
+	d, found := s.downloads[key]
+	if found {
+		s.downloadsMu.Unlock()
+		<-d.done
+		return d.data, d.err
+	}
+	d = &download{done: make(chan struct{})}
+	s.downloads[key] = d
+	s.downloadsMu.Unlock()
+
+	d.data, d.err = h.fetch(offset)
+	if d.err == nil {
+		h.o.f.logError(s.writeChunk(h.remote, h.version, offset, d.data), "store chunk")
+	}
+
+	s.downloadsMu.Lock()
+	delete(s.downloads, key)
+	s.downloadsMu.Unlock()
+	close(d.done)
+	return d.data, d.err
+}
+
+// fetch reads the chunk at offset from the wrapped Object
+func (h *handle) fetch(offset int64) (data []byte, err error) {
+	obj, err := h.o.getObject()
+	if err != nil {
+		return nil, err
+	}
+	var options []fs.OpenOption
+	if offset > 0 {
+		options = append(options, &fs.SeekOption{Offset: offset})
+	}
+	in, err := obj.Open(options...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open chunk")
+	}
+	defer fs.CheckClose(in, &err)
+	data = make([]byte, h.chunkLen(offset))
+	_, err = io.ReadFull(in, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read chunk")
+	}
+	fs.Debugf(h.o, "Read chunk at %d from remote", offset)
+	return data, nil
+}
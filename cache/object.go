@@ -0,0 +1,264 @@
+package cache
+
+import (
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+)
+
+// Object describes a wrapped Object
+//
+// The metadata is read from the cache if possible and the wrapped
+// Object is only looked up when it is needed.
+type Object struct {
+	f       *Fs
+	remote  string
+	size    int64
+	modTime time.Time
+
+	mu     sync.Mutex             // protects below
+	hashes map[fs.HashType]string // cached hashes
+	obj    fs.Object              // wrapped Object or nil if not looked up
+}
+
+// newObject makes an Object wrapping o
+func (f *Fs) newObject(o fs.Object) *Object {
+	return &Object{
+		f:       f,
+		remote:  o.Remote(),
+		size:    o.Size(),
+		modTime: o.ModTime(),
+		obj:     o,
+	}
+}
+
+// newObjectFromEntry makes an Object at remote from the cached entry
+func (f *Fs) newObjectFromEntry(remote string, entry *cachedEntry) *Object {
+	return &Object{
+		f:       f,
+		remote:  remote,
+		size:    entry.Size,
+		modTime: entry.ModTime,
+		hashes:  copyHashes(entry.Hashes),
+	}
+}
+
+// copyHashes returns a copy of hashes
+func copyHashes(hashes map[fs.HashType]string) map[fs.HashType]string {
+	if hashes == nil {
+		return nil
+	}
+	out := make(map[fs.HashType]string, len(hashes))
+	for k, v := range hashes {
+		out[k] = v
+	}
+	return out
+}
+
+// entry returns the Object as a cachedEntry
+func (o *Object) entry() cachedEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return cachedEntry{
+		Name:    path.Base(o.remote),
+		Size:    o.size,
+		ModTime: o.modTime,
+		Hashes:  copyHashes(o.hashes),
+	}
+}
+
+// getObject returns the wrapped Object, looking it up if necessary
+func (o *Object) getObject() (fs.Object, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.obj != nil {
+		return o.obj, nil
+	}
+	obj, err := o.f.Fs.NewObject(o.remote)
+	if err == fs.ErrorObjectNotFound {
+		// The cached listing is out of date
+		o.f.logError(o.f.store.expireListing(o.f.cachePath(parentDir(o.remote))), "expire listing")
+	}
+	if err != nil {
+		return nil, err
+	}
+	o.obj = obj
+	return obj, nil
+}
+
+// setMetadata reads the metadata from the wrapped Object after it has
+// been changed
+func (o *Object) setMetadata(obj fs.Object, clearHashes bool) {
+	o.mu.Lock()
+	o.size = obj.Size()
+	o.modTime = obj.ModTime()
+	if clearHashes {
+		o.hashes = nil
+	}
+	o.mu.Unlock()
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// ModTime returns the modification time of the object
+func (o *Object) ModTime() time.Time {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.modTime
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.size
+}
+
+// Storable returns whether object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// Hash returns the selected checksum of the file
+// If no checksum is available it returns ""
+//
+// Hashes read from the remote are stored in the cache.
+func (o *Object) Hash(hashType fs.HashType) (string, error) {
+	o.mu.Lock()
+	hash, found := o.hashes[hashType]
+	o.mu.Unlock()
+	if found {
+		return hash, nil
+	}
+	obj, err := o.getObject()
+	if err != nil {
+		return "", err
+	}
+	hash, err = obj.Hash(hashType)
+	if err != nil || hash == "" {
+		return hash, err
+	}
+	o.mu.Lock()
+	if o.hashes == nil {
+		o.hashes = make(map[fs.HashType]string)
+	}
+	o.hashes[hashType] = hash
+	size, modTime := o.size, o.modTime
+	o.mu.Unlock()
+	// Store the hash in the listing if it is for the same file
+	err = o.f.store.updateListing(o.f.cachePath(parentDir(o.remote)), func(l *listing) {
+		entry := l.find(path.Base(o.remote))
+		if entry == nil || entry.IsDir || entry.Size != size || !entry.ModTime.Equal(modTime) {
+			return
+		}
+		if entry.Hashes == nil {
+			entry.Hashes = make(map[fs.HashType]string)
+		}
+		entry.Hashes[hashType] = hash
+	})
+	o.f.logError(err, "store hash")
+	return hash, nil
+}
+
+// SetModTime sets the modification time of the file
+func (o *Object) SetModTime(modTime time.Time) error {
+	obj, err := o.getObject()
+	if err != nil {
+		return err
+	}
+	err = obj.SetModTime(modTime)
+	if err != nil {
+		return err
+	}
+	o.setMetadata(obj, false)
+	o.f.logError(o.f.store.addEntry(o.f.cachePath(o.remote), o.entry()), "update object")
+	return nil
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+//
+// The data is read in chunks which are stored in the cache.
+func (o *Object) Open(options ...fs.OpenOption) (rc io.ReadCloser, err error) {
+	size := o.Size()
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(size)
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	if offset > size {
+		offset = size
+	}
+	end := size
+	if limit >= 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return newHandle(o, offset, end), nil
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	obj, err := o.getObject()
+	if err != nil {
+		return err
+	}
+	err = obj.Update(in, src, options...)
+	if err != nil {
+		// the remote may have been left with a partial object
+		o.f.uncacheObject(o.remote)
+		return err
+	}
+	o.setMetadata(obj, true)
+	o.f.cacheObject(o)
+	return nil
+}
+
+// Remove an object
+func (o *Object) Remove() error {
+	obj, err := o.getObject()
+	if err != nil {
+		return err
+	}
+	err = obj.Remove()
+	if err != nil {
+		return err
+	}
+	o.f.uncacheObject(o.remote)
+	return nil
+}
+
+// UnWrap returns the wrapped Object or nil if it couldn't be found
+func (o *Object) UnWrap() fs.Object {
+	obj, err := o.getObject()
+	if err != nil {
+		fs.Debugf(o, "Couldn't find wrapped object: %v", err)
+		return nil
+	}
+	return obj
+}
@@ -0,0 +1,555 @@
+// Persistent storage of the cached listings and file chunks
+
+package cache
+
+import (
+	"container/list"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// The cache for each remote is kept in a directory named after the
+// remote in the cache directory.
+//
+// This mirrors the directory structure of the remote with each
+// directory name prefixed with "d." and the chunks of each file kept
+// in a directory named after the file prefixed with "f.".  The
+// listing of each directory is stored as JSON in a file called
+// ".listing" in that directory.  This means that removing a directory
+// from the cache removes the listings and chunks of everything in it.
+//
+// The size and modification time of the file the chunks were read
+// from are stored in ".object" with the chunks so they can be
+// discarded if the file changes.
+const (
+	listingName = ".listing"
+	objectName  = ".object"
+	dirPrefix   = "d."
+	filePrefix  = "f."
+)
+
+// cachedEntry is a directory entry as stored in a listing
+type cachedEntry struct {
+	Name    string                 `json:"name"`
+	IsDir   bool                   `json:"isDir,omitempty"`
+	Size    int64                  `json:"size"`
+	ModTime time.Time              `json:"modTime"`
+	Hashes  map[fs.HashType]string `json:"hashes,omitempty"`
+}
+
+// listing is the cached contents of a directory
+type listing struct {
+	CachedAt time.Time     `json:"cachedAt"`
+	Entries  []cachedEntry `json:"entries"`
+}
+
+// find returns the entry called name or nil if not found
+func (l *listing) find(name string) *cachedEntry {
+	for i := range l.Entries {
+		if l.Entries[i].Name == name {
+			return &l.Entries[i]
+		}
+	}
+	return nil
+}
+
+// put adds or replaces the entry with the same name
+func (l *listing) put(entry cachedEntry) {
+	if old := l.find(entry.Name); old != nil {
+		*old = entry
+		return
+	}
+	l.Entries = append(l.Entries, entry)
+}
+
+// remove removes the entry called name if present
+func (l *listing) remove(name string) {
+	for i := range l.Entries {
+		if l.Entries[i].Name == name {
+			l.Entries = append(l.Entries[:i], l.Entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// store is the persistent cache for a single remote
+type store struct {
+	dir string // directory the cache is stored in
+
+	mu        sync.Mutex               // protects the listings and below
+	totalSize int64                    // max size of the chunks on disk
+	used      int64                    // bytes used by the chunks in lru
+	lru       *list.List               // chunkFiles most recently used first or nil if not read yet
+	chunks    map[string]*list.Element // the elements of lru by path
+
+	downloadsMu sync.Mutex
+	downloads   map[string]*download // chunks being downloaded
+	readAheads  sync.WaitGroup       // running read ahead goroutines
+}
+
+// download is a chunk being fetched from the remote
+type download struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+var (
+	storesMu sync.Mutex
+	stores   = map[string]*store{}
+)
+
+// getStore returns the store for the cache directory dir, sharing it
+// with any other users of dir in this process
+func getStore(dir string, totalSize int64) *store {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	s := stores[dir]
+	if s == nil {
+		s = &store{
+			dir:       dir,
+			downloads: make(map[string]*download),
+		}
+		stores[dir] = s
+	}
+	s.mu.Lock()
+	s.totalSize = totalSize
+	s.mu.Unlock()
+	return s
+}
+
+// dirPath returns the OS path to the cache directory for dir
+func (s *store) dirPath(dir string) string {
+	return fs.PrefixedDirPath(s.dir, dir, dirPrefix)
+}
+
+// chunkDir returns the OS path to the directory holding the chunks
+// for the file remote
+func (s *store) chunkDir(remote string) string {
+	dir, leaf := path.Split(remote)
+	return filepath.Join(s.dirPath(strings.TrimSuffix(dir, "/")), filePrefix+leaf)
+}
+
+// chunkPath returns the OS path to the chunk at offset in remote
+func (s *store) chunkPath(remote string, offset int64) string {
+	return filepath.Join(s.chunkDir(remote), strconv.FormatInt(offset, 10))
+}
+
+// getListing reads the listing for dir returning nil if not cached
+//
+// Call with the lock held
+func (s *store) getListing(dir string) (*listing, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.dirPath(dir), listingName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read cached listing")
+	}
+	l := new(listing)
+	err = json.Unmarshal(data, l)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode cached listing")
+	}
+	return l, nil
+}
+
+// putListing writes the listing for dir
+//
+// Call with the lock held
+func (s *store) putListing(dir string, l *listing) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode cached listing")
+	}
+	err = fs.WriteFileAtomic(filepath.Join(s.dirPath(dir), listingName), data)
+	if err != nil {
+		return errors.Wrap(err, "failed to write cached listing")
+	}
+	return nil
+}
+
+// readListing returns the listing for dir or nil if not cached
+func (s *store) readListing(dir string) (*listing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getListing(dir)
+}
+
+// writeListing stores the listing for dir
+func (s *store) writeListing(dir string, l *listing) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.putListing(dir, l)
+}
+
+// updateListing calls fn to modify the listing of dir if it is
+// cached.  If the listing isn't cached it does nothing.
+func (s *store) updateListing(dir string, fn func(l *listing)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, err := s.getListing(dir)
+	if err != nil || l == nil {
+		return err
+	}
+	fn(l)
+	return s.putListing(dir, l)
+}
+
+// parentDir returns the parent directory of remote with "" for the root
+func parentDir(remote string) string {
+	dir := path.Dir(remote)
+	if dir == "." || dir == "/" {
+		dir = ""
+	}
+	return dir
+}
+
+// addEntry adds entry for remote to the listing of its parent if
+// that is cached.  It also adds the parent directories to the
+// listings of their parents if missing as they will have been
+// created on the remote.
+func (s *store) addEntry(remote string, entry cachedEntry) error {
+	entry.Name = path.Base(remote)
+	err := s.updateListing(parentDir(remote), func(l *listing) {
+		l.put(entry)
+	})
+	if err != nil {
+		return err
+	}
+	for dir := parentDir(remote); dir != ""; dir = parentDir(dir) {
+		err = s.updateListing(parentDir(dir), func(l *listing) {
+			if l.find(path.Base(dir)) == nil {
+				l.put(cachedEntry{Name: path.Base(dir), IsDir: true, Size: -1, ModTime: time.Now()})
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeEntry removes remote from the listing of its parent if that
+// is cached
+func (s *store) removeEntry(remote string) error {
+	if remote == "" {
+		return nil
+	}
+	return s.updateListing(parentDir(remote), func(l *listing) {
+		l.remove(path.Base(remote))
+	})
+}
+
+// expireListing marks the cached listing of dir as out of date so it
+// will be read again from the remote.  The entries are kept so the
+// chunks of changed files can be discarded when it is.
+func (s *store) expireListing(dir string) error {
+	return s.updateListing(dir, func(l *listing) {
+		l.CachedAt = time.Time{}
+	})
+}
+
+// removeDir removes the listings and chunks of dir and everything
+// in it
+func (s *store) removeDir(dir string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forgetChunks(s.dirPath(dir))
+	return os.RemoveAll(s.dirPath(dir))
+}
+
+// removeChunks removes the cached data of the file remote
+func (s *store) removeChunks(remote string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forgetChunks(s.chunkDir(remote))
+	return os.RemoveAll(s.chunkDir(remote))
+}
+
+// expireListings marks the cached listings of dir and everything in
+// it as out of date
+func (s *store) expireListings(dir string) error {
+	var dirs []string
+	root := s.dirPath(dir)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if p != root && !strings.HasPrefix(info.Name(), dirPrefix) {
+			// don't descend into the chunk directories
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, p)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range dirs {
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+		err = s.expireListing(osPathToDir(rel))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// osPathToDir converts a path relative to the cache directory back
+// into a directory on the remote
+func osPathToDir(rel string) string {
+	if rel == "." {
+		return ""
+	}
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range segments {
+		segments[i] = strings.TrimPrefix(segments[i], dirPrefix)
+	}
+	return strings.Join(segments, "/")
+}
+
+// readChunk reads the cached chunk at offset in remote returning nil
+// if it isn't cached
+func (s *store) readChunk(remote string, offset int64) ([]byte, error) {
+	name := s.chunkPath(remote, offset)
+	data, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Mark the chunk as recently used, on disk too so the order is
+	// kept when the cache is next loaded
+	now := time.Now()
+	_ = os.Chtimes(name, now, now)
+	s.mu.Lock()
+	s.useChunk(name, int64(len(data)))
+	s.mu.Unlock()
+	return data, nil
+}
+
+// chunksObject is the version of the file the chunks were read from
+type chunksObject struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// newChunksObject makes a chunksObject for a file with size and
+// modTime, normalising modTime so it compares equal after being
+// stored
+func newChunksObject(size int64, modTime time.Time) chunksObject {
+	return chunksObject{Size: size, ModTime: modTime.UTC().Round(0)}
+}
+
+// getChunksObject reads the version of the file the chunks of
+// remote are for, returning an empty chunksObject if not known
+//
+// Call with the lock held
+func (s *store) getChunksObject(remote string) (version chunksObject, err error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.chunkDir(remote), objectName))
+	if os.IsNotExist(err) {
+		return version, nil
+	}
+	if err != nil {
+		return version, err
+	}
+	err = json.Unmarshal(data, &version)
+	if err != nil {
+		return chunksObject{}, nil
+	}
+	version.ModTime = version.ModTime.UTC()
+	return version, nil
+}
+
+// checkChunks discards the chunks of remote unless they were read
+// from version of the file
+func (s *store) checkChunks(remote string, version chunksObject) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, err := s.getChunksObject(remote)
+	if err == nil && current == version {
+		return nil
+	}
+	s.forgetChunks(s.chunkDir(remote))
+	err = os.RemoveAll(s.chunkDir(remote))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(version)
+	if err != nil {
+		return err
+	}
+	return fs.WriteFileAtomic(filepath.Join(s.chunkDir(remote), objectName), data)
+}
+
+// hasChunk returns whether the chunk at offset in remote is cached
+func (s *store) hasChunk(remote string, offset int64) bool {
+	_, err := os.Stat(s.chunkPath(remote, offset))
+	return err == nil
+}
+
+// writeChunk stores the chunk at offset in remote, removing the
+// least recently used chunks if the cache is now too big
+//
+// The chunk is only stored if the chunks in the cache are still for
+// the version of the file it was read from.
+func (s *store) writeChunk(remote string, version chunksObject, offset int64, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, err := s.getChunksObject(remote)
+	if err != nil || current != version {
+		// the file has changed since the chunk was read
+		return err
+	}
+	err = s.loadChunks()
+	if err != nil {
+		return err
+	}
+	name := s.chunkPath(remote, offset)
+	err = fs.WriteFileAtomic(name, data)
+	if err != nil {
+		return errors.Wrap(err, "failed to write chunk")
+	}
+	s.useChunk(name, int64(len(data)))
+	if s.totalSize > 0 && s.used > s.totalSize {
+		return s.cleanUp()
+	}
+	return nil
+}
+
+// chunkFile is a chunk stored on disk
+type chunkFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// byModTime sorts chunks with the least recently used first
+type byModTime []chunkFile
+
+func (x byModTime) Len() int           { return len(x) }
+func (x byModTime) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+func (x byModTime) Less(i, j int) bool { return x[i].modTime.Before(x[j].modTime) }
+
+// listChunks returns all the chunk files in the cache
+//
+// Call with the lock held
+func (s *store) listChunks() (chunks []chunkFile, err error) {
+	err = filepath.Walk(s.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		chunks = append(chunks, chunkFile{path: p, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	return chunks, err
+}
+
+// loadChunks reads the chunks on disk into the lru if not done
+// already, least recently modified last
+//
+// Call with the lock held
+func (s *store) loadChunks() error {
+	if s.lru != nil {
+		return nil
+	}
+	chunks, err := s.listChunks()
+	if err != nil {
+		return errors.Wrap(err, "failed to list chunks")
+	}
+	sort.Sort(byModTime(chunks))
+	s.lru = list.New()
+	s.chunks = make(map[string]*list.Element, len(chunks))
+	s.used = 0
+	for _, chunk := range chunks {
+		s.chunks[chunk.path] = s.lru.PushFront(chunk)
+		s.used += chunk.size
+	}
+	return nil
+}
+
+// useChunk records that the chunk at OS path p with size has just
+// been written or read
+//
+// Call with the lock held
+func (s *store) useChunk(p string, size int64) {
+	if s.lru == nil {
+		return
+	}
+	if e, ok := s.chunks[p]; ok {
+		chunk := e.Value.(chunkFile)
+		s.used += size - chunk.size
+		chunk.size = size
+		e.Value = chunk
+		s.lru.MoveToFront(e)
+		return
+	}
+	s.chunks[p] = s.lru.PushFront(chunkFile{path: p, size: size})
+	s.used += size
+}
+
+// forgetChunks removes the chunks in the directory dir from the lru
+// as they are about to be removed
+//
+// Call with the lock held
+func (s *store) forgetChunks(dir string) {
+	if s.lru == nil {
+		return
+	}
+	prefix := dir + string(filepath.Separator)
+	for p, e := range s.chunks {
+		if strings.HasPrefix(p, prefix) {
+			s.used -= e.Value.(chunkFile).size
+			s.lru.Remove(e)
+			delete(s.chunks, p)
+		}
+	}
+}
+
+// cleanUp removes the least recently used chunks until the cache is
+// within its size limit
+//
+// Call with the lock held
+func (s *store) cleanUp() error {
+	for s.used > s.totalSize && s.lru.Len() > 0 {
+		e := s.lru.Back()
+		chunk := e.Value.(chunkFile)
+		err := os.Remove(chunk.path)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed to remove chunk")
+		}
+		s.used -= chunk.size
+		s.lru.Remove(e)
+		delete(s.chunks, chunk.path)
+	}
+	fs.Debugf(nil, "cache: cleaned up %q to %v", s.dir, fs.SizeSuffix(s.used))
+	return nil
+}
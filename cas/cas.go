@@ -0,0 +1,885 @@
+// Package cas provides wrappers for Fs and Object which store file
+// data as content addressed chunks so identical data is only stored
+// once
+package cas
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// Constants
+const (
+	defaultChunkSize = 1024 * 1024
+	minChunkSize     = 1024
+	manifestVersion  = 1
+	maxManifestSize  = 64 * 1024 * 1024
+	filesDir         = "files"
+	chunksDir        = "chunks"
+	manifestSuffix   = ".cas"
+)
+
+// maxCachedDirs is the most directories whose names existingObject
+// remembers
+const maxCachedDirs = 100
+
+// manifestRe matches the names of manifests returning the name and
+// size in hex of the file
+var manifestRe = regexp.MustCompile(`^(.+)\.([0-9a-f]+)` + regexp.QuoteMeta(manifestSuffix) + `$`)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "cas",
+		Description: "Deduplicate file data by storing it in content addressed chunks",
+		NewFs:       NewFs,
+		Options: []fs.Option{{
+			Name: "remote",
+			Help: "Remote to store the files and chunks on.\nNormally should contain a ':' and a path, eg \"myremote:path/to/dir\",\n\"myremote:bucket\" or maybe \"myremote:\" (not recommended).",
+		}, {
+			Name:     "chunk_size",
+			Help:     "Average size of the chunks files are split into.\nLeave blank to use the default of 1M.",
+			Optional: true,
+			Examples: []fs.OptionExample{{
+				Value: "256k",
+				Help:  "256 kB",
+			}, {
+				Value: "1M",
+				Help:  "1 MB",
+			}, {
+				Value: "4M",
+				Help:  "4 MB",
+			}},
+		}},
+	})
+}
+
+// NewFs contstructs an Fs from the path, container:path
+func NewFs(name, rpath string) (fs.Fs, error) {
+	chunkSize := fs.SizeSuffix(defaultChunkSize)
+	if value := fs.ConfigFileGet(name, "chunk_size"); value != "" {
+		err := chunkSize.Set(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read chunk_size")
+		}
+	}
+	if chunkSize < minChunkSize || chunkSize&(chunkSize-1) != 0 {
+		return nil, errors.Errorf("chunk_size must be a power of 2 of at least %v - not %v", fs.SizeSuffix(minChunkSize), chunkSize)
+	}
+	remote := fs.ConfigFileGet(name, "remote")
+	if strings.HasPrefix(remote, name+":") {
+		return nil, errors.New("can't point cas remote at itself - check the value of the remote setting")
+	}
+	rpath = strings.Trim(rpath, "/")
+	f, err := newFs(name, remote, rpath, int(chunkSize))
+	if err != nil {
+		return nil, err
+	}
+	// The names of the manifests include the size of the file so
+	// see if rpath is a file by looking it up in its parent
+	if rpath != "" {
+		parentFs, err := newFs(name, remote, parentDir(rpath), int(chunkSize))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := parentFs.NewObject(path.Base(rpath)); err == nil {
+			return parentFs, fs.ErrorIsFile
+		}
+	}
+	return f, nil
+}
+
+// newFs makes an Fs storing files under rpath on remote
+func newFs(name, remote, rpath string, chunkSize int) (*Fs, error) {
+	filesPath := path.Join(remote, filesDir, rpath)
+	files, err := fs.NewFs(filesPath)
+	if err != fs.ErrorIsFile && err != nil {
+		return nil, errors.Wrapf(err, "failed to make remote %q to store files", filesPath)
+	}
+	allFiles, newErr := fs.NewFs(path.Join(remote, filesDir))
+	if newErr != nil {
+		return nil, errors.Wrap(newErr, "failed to make remote to list all files")
+	}
+	chunks, newErr := fs.NewFs(path.Join(remote, chunksDir))
+	if newErr != nil {
+		return nil, errors.Wrap(newErr, "failed to make remote to store chunks")
+	}
+	f := &Fs{
+		name:      name,
+		root:      rpath,
+		files:     files,
+		allFiles:  allFiles,
+		chunks:    chunks,
+		chunkSize: chunkSize,
+	}
+	// the features here are ones we could support, and they are
+	// ANDed with the ones from the remote the files are on
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		ReadMimeType:            false,
+		WriteMimeType:           false,
+		BucketBased:             true,
+		CanHaveEmptyDirectories: true,
+	}).Fill(f).Mask(files)
+	// these only need files to be stored on the remote so always
+	// work
+	f.features.Copy = f.Copy
+	f.features.Move = f.Move
+	f.features.PutStream = f.PutStream
+	f.features.CleanUp = f.CleanUp
+	f.features.DisableList(fs.Config.DisableFeatures)
+	return f, nil
+}
+
+// Fs represents a wrapped fs.Fs
+type Fs struct {
+	name      string
+	root      string
+	features  *fs.Features // optional features
+	files     fs.Fs        // where the manifests of the files are stored
+	allFiles  fs.Fs        // the root of files
+	chunks    fs.Fs        // where the chunks are stored
+	chunkSize int          // average size of chunks
+	// names in files of the manifests in up to maxCachedDirs
+	// directories which have been put into, by directory and
+	// file name
+	dirsMu sync.Mutex
+	dirs   map[string]map[string]string
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// String returns a description of the FS
+func (f *Fs) String() string {
+	return fmt.Sprintf("Content addressed '%s:%s'", f.name, f.root)
+}
+
+// Precision of the ModTimes in this Fs
+func (f *Fs) Precision() time.Duration {
+	return f.files.Precision()
+}
+
+// Hashes returns the supported hash sets.
+//
+// The MD5 and SHA1 of each file are stored in its manifest.
+func (f *Fs) Hashes() fs.HashSet {
+	return fs.NewHashSet(fs.HashMD5, fs.HashSHA1)
+}
+
+// chunkRef refers to a chunk in a manifest
+type chunkRef struct {
+	Hash string `json:"hash"` // SHA-256 of the chunk in hex
+	Size int64  `json:"size"`
+}
+
+// manifest is stored in place of each file listing its chunks
+type manifest struct {
+	Version int        `json:"ver"`
+	Size    int64      `json:"size"`
+	MD5     string     `json:"md5"`
+	SHA1    string     `json:"sha1"`
+	Chunks  []chunkRef `json:"chunks"`
+}
+
+// chunkPath returns the path of the chunk with hash in f.chunks
+func chunkPath(hash string) string {
+	return path.Join(hash[:2], hash)
+}
+
+// encodeName returns the name of the manifest of the file remote of
+// size
+func encodeName(remote string, size int64) string {
+	return fmt.Sprintf("%s.%x%s", remote, size, manifestSuffix)
+}
+
+// decodeName returns the name and size of the file whose manifest is
+// called name.  It returns an error if name isn't a manifest name.
+func decodeName(name string) (remote string, size int64, err error) {
+	match := manifestRe.FindStringSubmatch(name)
+	if match == nil {
+		return "", -1, errors.New("not a manifest name")
+	}
+	size, err = strconv.ParseInt(match[2], 16, 64)
+	if err != nil {
+		return "", -1, errors.Wrap(err, "bad size in manifest name")
+	}
+	return match[1], size, nil
+}
+
+// parentDir returns the directory remote is in
+func parentDir(remote string) string {
+	dir := path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	return dir
+}
+
+// storeChunk stores data as a chunk unless it is stored already
+//
+// Chunks in stored have been stored by this upload so aren't looked
+// for again.  Chunks stored by earlier uploads are always looked for
+// as another rclone may have cleaned them up since.
+func (f *Fs) storeChunk(data []byte, stored map[string]struct{}) (ref chunkRef, err error) {
+	sum := sha256.Sum256(data)
+	ref = chunkRef{
+		Hash: hex.EncodeToString(sum[:]),
+		Size: int64(len(data)),
+	}
+	if _, ok := stored[ref.Hash]; ok {
+		return ref, nil
+	}
+	remote := chunkPath(ref.Hash)
+	o, err := f.chunks.NewObject(remote)
+	if err == nil && o.Size() == ref.Size {
+		fs.Debugf(o, "Chunk already stored")
+		stored[ref.Hash] = struct{}{}
+		return ref, nil
+	}
+	if err != nil && err != fs.ErrorObjectNotFound {
+		return ref, errors.Wrap(err, "failed to look for chunk")
+	}
+	info := fs.NewStaticObjectInfo(remote, time.Now(), ref.Size, true, nil, nil)
+	if o != nil {
+		// the chunk is the wrong size so must be damaged
+		err = o.Update(bytes.NewReader(data), info)
+	} else {
+		_, err = f.chunks.Put(bytes.NewReader(data), info)
+	}
+	if err != nil {
+		return ref, errors.Wrap(err, "failed to upload chunk")
+	}
+	stored[ref.Hash] = struct{}{}
+	return ref, nil
+}
+
+// put splits in into chunks, stores the ones which aren't already
+// stored, then stores the manifest updating existing if set
+func (f *Fs) put(in io.Reader, src fs.ObjectInfo, existing *Object, options ...fs.OpenOption) (*Object, error) {
+	hasher, err := fs.NewMultiHasherTypes(fs.NewHashSet(fs.HashMD5, fs.HashSHA1))
+	if err != nil {
+		return nil, err
+	}
+	s := newSplitter(io.TeeReader(in, hasher), f.chunkSize)
+	man := &manifest{
+		Version: manifestVersion,
+		Chunks:  []chunkRef{},
+	}
+	stored := map[string]struct{}{}
+	for {
+		data, err := s.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		ref, err := f.storeChunk(data, stored)
+		if err != nil {
+			return nil, err
+		}
+		man.Chunks = append(man.Chunks, ref)
+		man.Size += ref.Size
+	}
+	if size := src.Size(); size >= 0 && size != man.Size {
+		return nil, errors.Errorf("read %d bytes expecting %d", man.Size, size)
+	}
+	sums := hasher.Sums()
+	man.MD5, man.SHA1 = sums[fs.HashMD5], sums[fs.HashSHA1]
+	return f.putManifest(man, src.Remote(), src.ModTime(), existing, options...)
+}
+
+// putManifest stores man as the file remote, replacing existing if
+// set
+//
+// If the name of the manifest changes, as the size of the file has,
+// the old manifest is removed once the new one is stored.
+func (f *Fs) putManifest(man *manifest, remote string, modTime time.Time, existing *Object, options ...fs.OpenOption) (*Object, error) {
+	data, err := json.Marshal(man)
+	if err != nil {
+		return nil, err
+	}
+	name := encodeName(remote, man.Size)
+	info := fs.NewStaticObjectInfo(name, modTime, int64(len(data)), true, nil, nil)
+	var o fs.Object
+	if existing != nil && existing.Object.Remote() == name {
+		o = existing.Object
+		err = o.Update(bytes.NewReader(data), info, options...)
+	} else {
+		o, err = f.files.Put(bytes.NewReader(data), info, options...)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to upload manifest")
+	}
+	f.setName(remote, name)
+	if existing != nil && existing.Object.Remote() != name {
+		err = existing.Object.Remove()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to remove old manifest")
+		}
+	}
+	newO, err := f.newObject(o)
+	if err != nil {
+		return nil, err
+	}
+	newO.man = man
+	return newO, nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	existing, err := f.existingObject(src.Remote())
+	switch err {
+	case nil:
+	case fs.ErrorObjectNotFound:
+		existing = nil
+	default:
+		return nil, err
+	}
+	newO, err := f.put(in, src, existing, options...)
+	if err != nil {
+		return nil, err
+	}
+	return newO, nil
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.Put(in, src, options...)
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(dir string) (entries fs.DirEntries, err error) {
+	entries, err = f.files.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	newEntries := entries[:0]
+	for _, entry := range entries {
+		switch x := entry.(type) {
+		case fs.Object:
+			o, err := f.newObject(x)
+			if err != nil {
+				fs.Debugf(x, "Skipping file which isn't a manifest: %v", err)
+				continue
+			}
+			newEntries = append(newEntries, o)
+		case fs.Directory:
+			newEntries = append(newEntries, entry)
+		default:
+			return nil, errors.Errorf("Unknown object type %T", entry)
+		}
+	}
+	return newEntries, nil
+}
+
+// NewObject finds the Object at remote.
+//
+// As the names of the manifests include the size of the file this
+// lists the directory remote is in to find it.
+func (f *Fs) NewObject(remote string) (fs.Object, error) {
+	entries, err := f.files.List(parentDir(remote))
+	if err == fs.ErrorDirNotFound {
+		return nil, fs.ErrorObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		o, ok := entry.(fs.Object)
+		if !ok {
+			continue
+		}
+		if name, _, err := decodeName(o.Remote()); err == nil && name == remote {
+			return f.newObject(o)
+		}
+	}
+	return nil, fs.ErrorObjectNotFound
+}
+
+// existingObject finds the Object at remote before it is overwritten.
+//
+// Unlike NewObject this doesn't list the directory remote is in each
+// time.  Instead the names of the manifests in it are listed the
+// first time and remembered, along with those of the files put there
+// since, so putting many files into a directory only lists it once.
+func (f *Fs) existingObject(remote string) (*Object, error) {
+	dir := parentDir(remote)
+	f.dirsMu.Lock()
+	names, ok := f.dirs[dir]
+	f.dirsMu.Unlock()
+	if !ok {
+		entries, err := f.files.List(dir)
+		if err != nil && err != fs.ErrorDirNotFound {
+			return nil, err
+		}
+		names = make(map[string]string)
+		for _, entry := range entries {
+			if o, ok := entry.(fs.Object); ok {
+				if name, _, err := decodeName(o.Remote()); err == nil {
+					names[name] = o.Remote()
+				}
+			}
+		}
+		f.dirsMu.Lock()
+		if f.dirs == nil {
+			f.dirs = make(map[string]map[string]string)
+		}
+		// forget any directory to make room
+		for oldDir := range f.dirs {
+			if len(f.dirs) < maxCachedDirs {
+				break
+			}
+			delete(f.dirs, oldDir)
+		}
+		f.dirs[dir] = names
+		f.dirsMu.Unlock()
+	}
+	f.dirsMu.Lock()
+	name := names[remote]
+	f.dirsMu.Unlock()
+	if name == "" {
+		return nil, fs.ErrorObjectNotFound
+	}
+	o, err := f.files.NewObject(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o)
+}
+
+// setName records that the manifest of the file remote is called
+// name if the directory it is in has been listed by existingObject
+func (f *Fs) setName(remote, name string) {
+	f.dirsMu.Lock()
+	if names := f.dirs[parentDir(remote)]; names != nil {
+		names[remote] = name
+	}
+	f.dirsMu.Unlock()
+}
+
+// forgetName records that the file remote has been removed if the
+// directory it is in has been listed by existingObject
+func (f *Fs) forgetName(remote string) {
+	f.dirsMu.Lock()
+	if names := f.dirs[parentDir(remote)]; names != nil {
+		delete(names, remote)
+	}
+	f.dirsMu.Unlock()
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(dir string) error {
+	return f.files.Mkdir(dir)
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(dir string) error {
+	return f.files.Rmdir(dir)
+}
+
+// copyManifest stores the manifest of src as remote
+func (f *Fs) copyManifest(src fs.Object, remote string) (*Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantCopy
+	}
+	man, err := srcObj.readManifest()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := f.existingObject(remote)
+	if err != nil && err != fs.ErrorObjectNotFound {
+		return nil, err
+	}
+	return f.putManifest(man, remote, srcObj.ModTime(), existing)
+}
+
+// Copy src to this remote using server side copy operations.
+//
+// Only the manifest is copied as the chunks are shared.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(src fs.Object, remote string) (fs.Object, error) {
+	if _, ok := src.(*Object); !ok {
+		fs.Debugf(src, "Can't copy - not same remote type")
+		return nil, fs.ErrorCantCopy
+	}
+	return f.copyManifest(src, remote)
+}
+
+// Move src to this remote using server side move operations.
+//
+// Only the manifest is moved as the chunks are shared.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't move - not same remote type")
+		return nil, fs.ErrorCantMove
+	}
+	o, err := f.copyManifest(src, remote)
+	if err != nil {
+		return nil, err
+	}
+	return o, srcObj.Remove()
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+//
+// This is the remote the manifests of the files are stored on
+func (f *Fs) UnWrap() fs.Fs {
+	return f.files
+}
+
+// Object describes a file stored as a manifest of chunks
+type Object struct {
+	fs.Object            // the manifest
+	f         *Fs        // the Fs the object is on
+	remote    string     // the name of the file
+	size      int64      // the size of the file
+	mu        sync.Mutex // protects the following
+	man       *manifest  // the manifest once read
+}
+
+// newObject wraps the manifest o returning an error if its name can't
+// be decoded
+func (f *Fs) newObject(o fs.Object) (*Object, error) {
+	remote, size, err := decodeName(o.Remote())
+	if err != nil {
+		return nil, err
+	}
+	return &Object{
+		Object: o,
+		f:      f,
+		remote: remote,
+		size:   size,
+	}, nil
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// readManifest reads and checks the manifest of the object
+func (o *Object) readManifest() (*manifest, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.man != nil {
+		return o.man, nil
+	}
+	man, err := readManifest(o.Object)
+	if err != nil {
+		return nil, err
+	}
+	if man.Size != o.size {
+		return nil, errors.Errorf("manifest is for %d bytes but its name says %d", man.Size, o.size)
+	}
+	o.man = man
+	return man, nil
+}
+
+// readManifest reads and checks the manifest stored in o
+func readManifest(o fs.Object) (*manifest, error) {
+	in, err := o.Open()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open manifest")
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(in, maxManifestSize))
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read manifest")
+	}
+	man := new(manifest)
+	err = json.Unmarshal(data, man)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode manifest")
+	}
+	if man.Version != manifestVersion {
+		return nil, errors.Errorf("unknown manifest version %d", man.Version)
+	}
+	var size int64
+	for _, ref := range man.Chunks {
+		if len(ref.Hash) != 2*sha256.Size || ref.Size <= 0 {
+			return nil, errors.Errorf("bad chunk %q in manifest", ref.Hash)
+		}
+		size += ref.Size
+	}
+	if size != man.Size {
+		return nil, errors.Errorf("chunks in manifest add up to %d bytes expecting %d", size, man.Size)
+	}
+	return man, nil
+}
+
+// Size returns the size of the file, which is stored in the name of
+// the manifest
+func (o *Object) Size() int64 {
+	return o.size
+}
+
+// Hash returns the selected checksum of the file
+// If no checksum is available it returns ""
+func (o *Object) Hash(hashType fs.HashType) (string, error) {
+	man, err := o.readManifest()
+	if err != nil {
+		return "", err
+	}
+	switch hashType {
+	case fs.HashMD5:
+		return man.MD5, nil
+	case fs.HashSHA1:
+		return man.SHA1, nil
+	}
+	return "", fs.ErrHashUnsupported
+}
+
+// UnWrap returns the wrapped Object
+func (o *Object) UnWrap() fs.Object {
+	return o.Object
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+//
+// Only the chunks in the range requested are read.
+func (o *Object) Open(options ...fs.OpenOption) (rc io.ReadCloser, err error) {
+	man, err := o.readManifest()
+	if err != nil {
+		return nil, err
+	}
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(man.Size)
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	return newChunkReader(o.f.chunks, man.Chunks, offset, limit), nil
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	newO, err := o.f.put(in, src, o, options...)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	o.Object, o.size, o.man = newO.Object, newO.size, newO.man
+	o.mu.Unlock()
+	return nil
+}
+
+// Remove the manifest of the object
+//
+// The chunks are left as other files may use them - "rclone cleanup"
+// removes the ones which aren't used.
+func (o *Object) Remove() error {
+	err := o.Object.Remove()
+	if err != nil {
+		return err
+	}
+	o.f.forgetName(o.remote)
+	return nil
+}
+
+// chunkReader reads a range of a file opening the chunks as they are
+// needed
+type chunkReader struct {
+	chunks fs.Fs         // where the chunks are stored
+	refs   []chunkRef    // chunks still to read
+	offset int64         // offset to open the next chunk at
+	limit  int64         // bytes left to read or -1 for all
+	in     io.ReadCloser // the chunk being read or nil
+}
+
+// newChunkReader makes a reader for limit bytes (-1 for all) of the
+// chunks refs starting at offset
+func newChunkReader(chunks fs.Fs, refs []chunkRef, offset, limit int64) *chunkReader {
+	for len(refs) > 0 && offset >= refs[0].Size {
+		offset -= refs[0].Size
+		refs = refs[1:]
+	}
+	return &chunkReader{
+		chunks: chunks,
+		refs:   refs,
+		offset: offset,
+		limit:  limit,
+	}
+}
+
+// openChunk opens the next chunk
+//
+// Chunks read from the start are checked against their hash as they
+// are read.
+func (r *chunkReader) openChunk() (io.ReadCloser, error) {
+	ref := r.refs[0]
+	o, err := r.chunks.NewObject(chunkPath(ref.Hash))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find chunk %s", ref.Hash)
+	}
+	if r.offset > 0 {
+		return o.Open(&fs.SeekOption{Offset: r.offset})
+	}
+	in, err := o.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &checkReader{ReadCloser: in, ref: ref, hash: sha256.New()}, nil
+}
+
+// Read bytes from the chunks
+func (r *chunkReader) Read(p []byte) (n int, err error) {
+	for {
+		if r.limit == 0 {
+			return 0, io.EOF
+		}
+		if r.in == nil {
+			if len(r.refs) == 0 {
+				return 0, io.EOF
+			}
+			r.in, err = r.openChunk()
+			if err != nil {
+				return 0, errors.Wrap(err, "failed to open chunk")
+			}
+			r.refs, r.offset = r.refs[1:], 0
+		}
+		if r.limit > 0 && int64(len(p)) > r.limit {
+			p = p[:r.limit]
+		}
+		n, err = r.in.Read(p)
+		if r.limit > 0 {
+			r.limit -= int64(n)
+		}
+		if err == io.EOF {
+			err = r.in.Close()
+			r.in = nil
+			if err != nil || n > 0 {
+				return n, err
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Close the chunk being read
+func (r *chunkReader) Close() error {
+	if r.in == nil {
+		return nil
+	}
+	err := r.in.Close()
+	r.in = nil
+	return err
+}
+
+// checkReader checks the data of a chunk matches its hash
+type checkReader struct {
+	io.ReadCloser
+	ref  chunkRef
+	hash hash.Hash
+	n    int64
+}
+
+// Read data checking the hash at the end
+func (r *checkReader) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	_, _ = r.hash.Write(p[:n])
+	r.n += int64(n)
+	if err == io.EOF {
+		if r.n != r.ref.Size || hex.EncodeToString(r.hash.Sum(nil)) != r.ref.Hash {
+			err = errors.Errorf("chunk %s is corrupted", r.ref.Hash)
+		}
+	}
+	return n, err
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs          = (*Fs)(nil)
+	_ fs.Copier      = (*Fs)(nil)
+	_ fs.Mover       = (*Fs)(nil)
+	_ fs.PutStreamer = (*Fs)(nil)
+	_ fs.CleanUpper  = (*Fs)(nil)
+	_ fs.UnWrapper   = (*Fs)(nil)
+	_ fs.Object      = (*Object)(nil)
+)
@@ -0,0 +1,232 @@
+package cas
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	_ "github.com/ncw/rclone/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// randomData makes size bytes of random data
+func randomData(size int) []byte {
+	data := make([]byte, size)
+	_, _ = rand.Read(data)
+	return data
+}
+
+// split returns the chunks s makes of data
+func split(t *testing.T, data []byte, avgSize int) (chunks [][]byte) {
+	s := newSplitter(bytes.NewReader(data), avgSize)
+	for {
+		chunk, err := s.next()
+		if err != nil {
+			require.Equal(t, "EOF", err.Error())
+			return chunks
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+func TestSplitter(t *testing.T) {
+	const avgSize = 4096
+	data := randomData(1024 * 1024)
+	chunks := split(t, data, avgSize)
+	assert.Equal(t, data, bytes.Join(chunks, nil))
+	for i, chunk := range chunks {
+		assert.True(t, len(chunk) <= 4*avgSize, "chunk %d too big: %d", i, len(chunk))
+		if i < len(chunks)-1 {
+			assert.True(t, len(chunk) > avgSize/4, "chunk %d too small: %d", i, len(chunk))
+		}
+	}
+	// roughly the average size
+	assert.True(t, len(chunks) > len(data)/avgSize/2 && len(chunks) < len(data)/avgSize*2, "%d chunks", len(chunks))
+
+	// inserting data near the start only changes the chunks near it
+	changed := append(append(append([]byte(nil), data[:1000]...), []byte("inserted")...), data[1000:]...)
+	seen := map[string]bool{}
+	for _, chunk := range chunks {
+		seen[string(chunk)] = true
+	}
+	newChunks := split(t, changed, avgSize)
+	different := 0
+	for _, chunk := range newChunks {
+		if !seen[string(chunk)] {
+			different++
+		}
+	}
+	assert.True(t, different <= 3, "%d chunks changed", different)
+
+	assert.Equal(t, 0, len(split(t, nil, avgSize)))
+}
+
+// newTestFs makes a cas remote on a temporary local directory
+// returning the Fs, the directory and a function to tidy up
+func newTestFs(t *testing.T) (*Fs, string, func()) {
+	dir, cleanup := fstest.NewLocalDir(t)
+	f, err := fstest.NewConfiguredFs("TestCasInternal", "type", "cas", "remote", dir, "chunk_size", "4k")
+	require.NoError(t, err)
+	return f.(*Fs), dir, cleanup
+}
+
+// chunkFiles returns the paths of the chunks stored in dir
+func chunkFiles(t *testing.T, dir string) (files []string) {
+	err := filepath.Walk(filepath.Join(dir, chunksDir), func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if !os.IsNotExist(err) {
+		require.NoError(t, err)
+	}
+	return files
+}
+
+func TestBadChunkSize(t *testing.T) {
+	for _, value := range []string{"potato", "100", "3k"} {
+		_, err := fstest.NewConfiguredFs("TestCasBadChunkSize", "type", "cas", "remote", os.TempDir(), "chunk_size", value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	f, dir, cleanup := newTestFs(t)
+	defer cleanup()
+	data := randomData(256 * 1024)
+	fstest.PutFile(t, f, "one.bin", string(data))
+	stored := len(chunkFiles(t, dir))
+	assert.True(t, stored > 1, "%d chunks", stored)
+
+	// the same data again doesn't store any more chunks
+	fstest.PutFile(t, f, "dir/two.bin", string(data))
+	assert.Equal(t, stored, len(chunkFiles(t, dir)))
+
+	// and changing a little of it only stores a few
+	changed := append([]byte(nil), data...)
+	copy(changed[100*1024:], "changed")
+	fstest.PutFile(t, f, "one.bin", string(changed))
+	assert.True(t, len(chunkFiles(t, dir)) <= stored+3, "%d chunks", len(chunkFiles(t, dir)))
+
+	assert.Equal(t, string(data), fstest.ReadObject(t, f, "dir/two.bin"))
+	assert.Equal(t, string(changed), fstest.ReadObject(t, f, "one.bin"))
+
+	// a fresh Fs doesn't know what is stored but still finds it
+	fresh, err := fs.NewFs(f.name + ":")
+	require.NoError(t, err)
+	fstest.PutFile(t, fresh, "three.bin", string(data))
+	assert.True(t, len(chunkFiles(t, dir)) <= stored+3, "%d chunks", len(chunkFiles(t, dir)))
+}
+
+func TestRangedRead(t *testing.T) {
+	f, _, cleanup := newTestFs(t)
+	defer cleanup()
+	data := randomData(100*1024 + 7)
+	fstest.PutFile(t, f, "file.bin", string(data))
+	for _, start := range []int64{0, 1, 4095, 4096, 50 * 1024, int64(len(data) - 1)} {
+		end := start + 20*1024
+		if end >= int64(len(data)) {
+			end = int64(len(data) - 1)
+		}
+		assert.Equal(t, string(data[start:end+1]), fstest.ReadObject(t, f, "file.bin", &fs.RangeOption{Start: start, End: end}), "start %d", start)
+	}
+	assert.Equal(t, string(data[1000:]), fstest.ReadObject(t, f, "file.bin", &fs.SeekOption{Offset: 1000}))
+}
+
+func TestCorruptChunk(t *testing.T) {
+	f, dir, cleanup := newTestFs(t)
+	defer cleanup()
+	fstest.PutFile(t, f, "file.bin", string(randomData(64*1024)))
+	file := chunkFiles(t, dir)[0]
+	data, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	data[0] ^= 0xFF
+	require.NoError(t, ioutil.WriteFile(file, data, 0666))
+
+	o, err := f.NewObject("file.bin")
+	require.NoError(t, err)
+	in, err := o.Open()
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(in)
+	assert.Error(t, err)
+	require.NoError(t, in.Close())
+}
+
+func TestCleanUp(t *testing.T) {
+	f, dir, cleanup := newTestFs(t)
+	defer cleanup()
+
+	// nothing stored yet
+	require.NoError(t, f.CleanUp())
+
+	kept := randomData(64 * 1024)
+	fstest.PutFile(t, f, "dir/kept.bin", string(kept))
+	keptChunks := len(chunkFiles(t, dir))
+	removedData := randomData(64 * 1024)
+	removed := fstest.PutFile(t, f, "removed.bin", string(removedData))
+	require.NoError(t, removed.Remove())
+	assert.True(t, len(chunkFiles(t, dir)) > keptChunks)
+
+	// files outside the root of the Fs keep their chunks too
+	sub, err := fs.NewFs(f.name + ":other")
+	require.NoError(t, err)
+	require.NoError(t, sub.Features().CleanUp())
+	assert.Equal(t, keptChunks, len(chunkFiles(t, dir)))
+	assert.Equal(t, string(kept), fstest.ReadObject(t, f, "dir/kept.bin"))
+
+	// f stores the chunks another rclone removed again
+	fstest.PutFile(t, f, "removed.bin", string(removedData))
+	assert.Equal(t, string(removedData), fstest.ReadObject(t, f, "removed.bin"))
+
+	// an unreadable manifest stops the clean up
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, filesDir, encodeName("bad.bin", 6)), []byte("potato"), 0666))
+	require.NoError(t, removed.Remove())
+	before := len(chunkFiles(t, dir))
+	assert.Error(t, f.CleanUp())
+	assert.Equal(t, before, len(chunkFiles(t, dir)))
+}
+
+func TestManifestNames(t *testing.T) {
+	f, dir, cleanup := newTestFs(t)
+	defer cleanup()
+	fstest.PutFile(t, f, "dir/file.bin", "hello")
+	assert.Equal(t, []string{"file.bin.5.cas"}, fstest.LocalNames(t, filepath.Join(dir, filesDir, "dir")))
+
+	// the size is listed without reading the manifest
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, filesDir, "dir", "file.bin.5.cas"), []byte("potato"), 0666))
+	entries, err := f.List("dir")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, "dir/file.bin", entries[0].Remote())
+	assert.Equal(t, int64(5), entries[0].Size())
+
+	// putting a different size replaces the manifest
+	fstest.PutFile(t, f, "dir/file.bin", "hello world")
+	assert.Equal(t, []string{"file.bin.b.cas"}, fstest.LocalNames(t, filepath.Join(dir, filesDir, "dir")))
+	o, err := f.NewObject("dir/file.bin")
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), o.Size())
+	assert.Equal(t, "hello world", fstest.ReadObject(t, f, "dir/file.bin"))
+
+	// as does updating it
+	src := fs.NewStaticObjectInfo("dir/file.bin", fstest.Time("2001-02-03T04:05:06Z"), 3, true, nil, nil)
+	require.NoError(t, o.Update(strings.NewReader("bye"), src))
+	assert.Equal(t, []string{"file.bin.3.cas"}, fstest.LocalNames(t, filepath.Join(dir, filesDir, "dir")))
+	assert.Equal(t, "bye", fstest.ReadObject(t, f, "dir/file.bin"))
+
+	// and files which aren't manifests are ignored
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, filesDir, "dir", "other.bin"), []byte("potato"), 0666))
+	entries, err = f.List("dir")
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+	_, err = f.NewObject("dir/other.bin")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+}
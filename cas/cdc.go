@@ -0,0 +1,90 @@
+// Content defined chunking
+
+package cas
+
+import (
+	"io"
+)
+
+// gear is a table of random numbers for the rolling hash, made with
+// splitmix64 from a fixed seed so the chunk boundaries never change
+var gear [256]uint64
+
+func init() {
+	x := uint64(0x72636c6f6e65) // "rclone"
+	for i := range gear {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// splitter splits a stream into chunks whose boundaries depend on
+// the data around them rather than their offset in the stream, so
+// inserting or removing data only changes the chunks near the
+// change.
+//
+// A gear hash is rolled over the data and a chunk ends where the top
+// bits of the hash are all zero, but not before minSize bytes or
+// after maxSize bytes.
+type splitter struct {
+	in      io.Reader
+	minSize int
+	maxSize int
+	mask    uint64 // the top bits of the hash to check
+	buf     []byte // data read but not returned yet
+	eof     bool   // set when in has been read to the end
+}
+
+// newSplitter makes a splitter of in making chunks of about avgSize
+// bytes, which should be a power of 2
+func newSplitter(in io.Reader, avgSize int) *splitter {
+	bits := uint(0)
+	for 1<<(bits+1) <= avgSize {
+		bits++
+	}
+	return &splitter{
+		in:      in,
+		minSize: avgSize / 4,
+		maxSize: avgSize * 4,
+		mask:    ((uint64(1) << bits) - 1) << (64 - bits),
+		buf:     make([]byte, 0, avgSize*4),
+	}
+}
+
+// boundary returns the length of the chunk at the start of data
+func (s *splitter) boundary(data []byte) int {
+	if len(data) <= s.minSize {
+		return len(data)
+	}
+	var h uint64
+	for i := s.minSize; i < len(data); i++ {
+		h = (h << 1) + gear[data[i]]
+		if h&s.mask == 0 {
+			return i + 1
+		}
+	}
+	return len(data)
+}
+
+// next returns the next chunk or io.EOF if there are no more
+func (s *splitter) next() ([]byte, error) {
+	if !s.eof && len(s.buf) < s.maxSize {
+		n, err := io.ReadFull(s.in, s.buf[len(s.buf):s.maxSize])
+		s.buf = s.buf[:len(s.buf)+n]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			s.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if len(s.buf) == 0 {
+		return nil, io.EOF
+	}
+	n := s.boundary(s.buf)
+	chunk := append([]byte(nil), s.buf[:n]...)
+	s.buf = s.buf[:copy(s.buf, s.buf[n:])]
+	return chunk, nil
+}
@@ -0,0 +1,75 @@
+package cas
+
+import (
+	"path"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// referenced returns the set of chunks used by any of the files on
+// the remote, not just the ones under the root of f
+//
+// Any manifest which can't be read is an error as the chunks it uses
+// aren't known.
+func (f *Fs) referenced() (map[string]struct{}, error) {
+	objs, _, err := fs.WalkGetAll(f.allFiles, "", true, -1)
+	if err == fs.ErrorDirNotFound {
+		return map[string]struct{}{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list files")
+	}
+	used := map[string]struct{}{}
+	for _, o := range objs {
+		man, err := readManifest(o)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read manifest of %q", o.Remote())
+		}
+		for _, ref := range man.Chunks {
+			used[ref.Hash] = struct{}{}
+		}
+	}
+	return used, nil
+}
+
+// CleanUp removes the chunks which aren't used by any file.
+//
+// This mustn't be run while files are being written to the remote as
+// the chunks of files whose manifests haven't been written yet would
+// be removed.
+func (f *Fs) CleanUp() error {
+	used, err := f.referenced()
+	if err != nil {
+		return err
+	}
+	chunks, _, err := fs.WalkGetAll(f.chunks, "", true, -1)
+	if err == fs.ErrorDirNotFound {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to list chunks")
+	}
+	var removed, errs int
+	var size int64
+	for _, chunk := range chunks {
+		if _, ok := used[path.Base(chunk.Remote())]; ok {
+			continue
+		}
+		err := chunk.Remove()
+		if err != nil {
+			fs.Stats.Error()
+			fs.Errorf(chunk, "Failed to remove unused chunk: %v", err)
+			errs++
+			continue
+		}
+		fs.Debugf(chunk, "Removed unused chunk")
+		removed++
+		size += chunk.Size()
+	}
+	fs.Logf(f, "Removed %d unused chunks of %d totalling %v", removed, len(chunks), fs.SizeSuffix(size))
+	if errs > 0 {
+		return errors.Errorf("failed to remove %d unused chunks", errs)
+	}
+	return nil
+}
@@ -0,0 +1,892 @@
+// Package chunker provides wrappers for Fs and Object which split
+// large files into chunks
+package chunker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// Constants
+const (
+	defaultChunkSize = 2 * 1024 * 1024 * 1024
+	chunkInfix       = ".rclone_chunk."
+	metadataVersion  = 1
+	maxMetadataSize  = 1024 * 1024
+
+	// Updating a chunked file alternates between two sets of chunk
+	// names so the new chunks can be uploaded without overwriting
+	// the old ones.
+	chunkGenerations = 2
+)
+
+// chunkRe matches the names of chunks returning the name of the file
+// they are part of, the chunk number and the generation suffix
+var chunkRe = regexp.MustCompile(`^(.+)` + regexp.QuoteMeta(chunkInfix) + `([0-9]{3,})(_1)?$`)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "chunker",
+		Description: "Split large files into chunks",
+		NewFs:       NewFs,
+		Options: []fs.Option{{
+			Name: "remote",
+			Help: "Remote to store the chunks on.\nNormally should contain a ':' and a path, eg \"myremote:path/to/dir\",\n\"myremote:bucket\" or maybe \"myremote:\" (not recommended).",
+		}, {
+			Name:     "chunk_size",
+			Help:     "Files larger than this are split into chunks of this size.\nLeave blank to use the default of 2G.",
+			Optional: true,
+			Examples: []fs.OptionExample{{
+				Value: "100M",
+				Help:  "100 MB",
+			}, {
+				Value: "1G",
+				Help:  "1 GB",
+			}, {
+				Value: "2G",
+				Help:  "2 GB",
+			}},
+		}},
+	})
+}
+
+// NewFs contstructs an Fs from the path, container:path
+func NewFs(name, rpath string) (fs.Fs, error) {
+	chunkSize := fs.SizeSuffix(defaultChunkSize)
+	if value := fs.ConfigFileGet(name, "chunk_size"); value != "" {
+		err := chunkSize.Set(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read chunk_size")
+		}
+	}
+	if chunkSize <= 0 {
+		return nil, errors.Errorf("chunk_size must be greater than 0 - not %v", chunkSize)
+	}
+	remote := fs.ConfigFileGet(name, "remote")
+	if strings.HasPrefix(remote, name+":") {
+		return nil, errors.New("can't point chunker remote at itself - check the value of the remote setting")
+	}
+	remotePath := path.Join(remote, rpath)
+	wrappedFs, err := fs.NewFs(remotePath)
+	if err != fs.ErrorIsFile && err != nil {
+		return nil, errors.Wrapf(err, "failed to make remote %q to wrap", remotePath)
+	}
+	f := &Fs{
+		Fs:        wrappedFs,
+		name:      name,
+		root:      rpath,
+		chunkSize: int64(chunkSize),
+	}
+	// the features here are ones we could support, and they are
+	// ANDed with the ones from wrappedFs
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		ReadMimeType:            false,
+		WriteMimeType:           false,
+		BucketBased:             true,
+		CanHaveEmptyDirectories: true,
+	}).Fill(f).Mask(wrappedFs)
+	return f, err
+}
+
+// Fs represents a wrapped fs.Fs
+type Fs struct {
+	fs.Fs
+	name      string
+	root      string
+	features  *fs.Features // optional features
+	chunkSize int64        // files bigger than this are chunked
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// String returns a description of the FS
+func (f *Fs) String() string {
+	return fmt.Sprintf("Chunked drive '%s:%s'", f.name, f.root)
+}
+
+// Hashes returns the supported hash sets.
+//
+// The MD5 and SHA1 of chunked files are stored with them so these
+// are supported if the wrapped remote supports them for the files
+// which aren't chunked.
+func (f *Fs) Hashes() fs.HashSet {
+	return f.Fs.Hashes().Overlap(fs.NewHashSet(fs.HashMD5, fs.HashSHA1))
+}
+
+// chunkName returns the name of chunk number n (starting from 1) of
+// generation gen of remote
+func chunkName(remote string, gen, n int) string {
+	if gen == 0 {
+		return fmt.Sprintf("%s%s%03d", remote, chunkInfix, n)
+	}
+	return fmt.Sprintf("%s%s%03d_%d", remote, chunkInfix, n, gen)
+}
+
+// parseChunkName returns the name of the file that remote is a chunk
+// of, the generation and the chunk number or "" if remote isn't a
+// chunk
+func parseChunkName(remote string) (string, int, int) {
+	match := chunkRe.FindStringSubmatch(remote)
+	if match == nil {
+		return "", 0, 0
+	}
+	n, err := strconv.Atoi(match[2])
+	if err != nil || n < 1 {
+		return "", 0, 0
+	}
+	gen := 0
+	if match[3] != "" {
+		gen = 1
+	}
+	return match[1], gen, n
+}
+
+// chunkEntry is a chunk found while listing
+type chunkEntry struct {
+	n int
+	o fs.Object
+}
+
+// chunkSets are the chunks of each generation of a file
+type chunkSets [chunkGenerations][]fs.Object
+
+// byNumber sorts chunkEntries by chunk number
+type byNumber []chunkEntry
+
+func (x byNumber) Len() int           { return len(x) }
+func (x byNumber) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+func (x byNumber) Less(i, j int) bool { return x[i].n < x[j].n }
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// The chunks aren't listed, instead they are attached to the file
+// they are part of.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(dir string) (entries fs.DirEntries, err error) {
+	wrappedEntries, err := f.Fs.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	chunks := map[string]*[chunkGenerations][]chunkEntry{}
+	for _, entry := range wrappedEntries {
+		if o, ok := entry.(fs.Object); ok {
+			if remote, gen, n := parseChunkName(o.Remote()); remote != "" {
+				if chunks[remote] == nil {
+					chunks[remote] = new([chunkGenerations][]chunkEntry)
+				}
+				chunks[remote][gen] = append(chunks[remote][gen], chunkEntry{n: n, o: o})
+			}
+		}
+	}
+	for _, entry := range wrappedEntries {
+		switch x := entry.(type) {
+		case fs.Object:
+			if remote, _, _ := parseChunkName(x.Remote()); remote != "" {
+				continue
+			}
+			var sets chunkSets
+			if found := chunks[x.Remote()]; found != nil {
+				for gen := range found {
+					sets[gen] = sortChunks(x, found[gen])
+				}
+			}
+			gen, objectChunks := pickChunks(x, sets)
+			entries = append(entries, f.newObject(x, gen, objectChunks))
+		case fs.Directory:
+			entries = append(entries, x)
+		default:
+			return nil, errors.Errorf("Unknown object type %T", entry)
+		}
+	}
+	return entries, nil
+}
+
+// sortChunks returns the chunks of o in order ignoring any after a
+// missing chunk
+func sortChunks(o fs.Object, entries []chunkEntry) (chunks []fs.Object) {
+	sort.Sort(byNumber(entries))
+	for i, entry := range entries {
+		if entry.n != i+1 {
+			fs.Errorf(o, "Chunk %d is missing", i+1)
+			break
+		}
+		chunks = append(chunks, entry.o)
+	}
+	return chunks
+}
+
+// pickChunks returns the generation and chunks of the file o from the
+// chunks found of each generation.
+//
+// Normally at most one generation has chunks.  If both have then an
+// update was interrupted or is in progress so the metadata is read to
+// find out which chunks are current.
+func pickChunks(o fs.Object, sets chunkSets) (gen int, chunks []fs.Object) {
+	if len(sets[1]) == 0 {
+		return 0, sets[0]
+	}
+	if len(sets[0]) == 0 {
+		return 1, sets[1]
+	}
+	meta, err := decodeMetadata(o)
+	if err != nil {
+		fs.Errorf(o, "Found chunks of two versions: %v", err)
+		return 0, sets[0]
+	}
+	return meta.Gen, sets[meta.Gen]
+}
+
+// findChunks returns the chunks of generation gen of remote from
+// number n onwards
+func (f *Fs) findChunks(remote string, gen, n int) (chunks []fs.Object, err error) {
+	for ; ; n++ {
+		chunk, err := f.Fs.NewObject(chunkName(remote, gen, n))
+		if err == fs.ErrorObjectNotFound {
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+// removeChunks removes the chunks of generation gen of remote from
+// number n onwards
+func (f *Fs) removeChunks(remote string, gen, n int) error {
+	chunks, err := f.findChunks(remote, gen, n)
+	if err != nil {
+		return err
+	}
+	return removeAll(chunks)
+}
+
+// removeAll removes all of objects
+func removeAll(objects []fs.Object) error {
+	for _, o := range objects {
+		err := o.Remove()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewObject finds the Object at remote.
+func (f *Fs) NewObject(remote string) (fs.Object, error) {
+	if name, _, _ := parseChunkName(remote); name != "" {
+		return nil, fs.ErrorObjectNotFound
+	}
+	o, err := f.Fs.NewObject(remote)
+	if err != nil {
+		return nil, err
+	}
+	var sets chunkSets
+	for gen := range sets {
+		sets[gen], err = f.findChunks(remote, gen, 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	gen, chunks := pickChunks(o, sets)
+	return f.newObject(o, gen, chunks), nil
+}
+
+// put uploads in to the remote path with the modTime given of the
+// given size splitting it into chunks if necessary
+//
+// existing is the object being updated or nil.  If it is chunked then
+// the new chunks are uploaded with the names of the other generation
+// and the old chunks are only removed once the metadata pointing to
+// the new ones has been written, so a failed update leaves it intact.
+func (f *Fs) put(in io.Reader, src fs.ObjectInfo, existing *Object, options ...fs.OpenOption) (*Object, error) {
+	remote := src.Remote()
+	if name, _, _ := parseChunkName(remote); name != "" {
+		return nil, errors.Errorf("can't store %q as it is named like a chunk", remote)
+	}
+	size := src.Size()
+	if size < 0 {
+		return nil, errors.New("can't upload files of unknown size")
+	}
+	if size <= f.chunkSize {
+		var o fs.Object
+		var err error
+		if existing != nil && !existing.isChunked() {
+			o, err = existing.Object, existing.Object.Update(in, src, options...)
+		} else {
+			o, err = f.Fs.Put(in, src, options...)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// remove the chunks if it was chunked before
+		for gen := 0; gen < chunkGenerations; gen++ {
+			err = f.removeChunks(remote, gen, 1)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to remove old chunks")
+			}
+		}
+		return f.newObject(o, 0, nil), nil
+	}
+
+	gen := 0
+	if existing != nil && existing.isChunked() {
+		gen = 1 - existing.gen
+	}
+	hasher, err := fs.NewMultiHasherTypes(fs.NewHashSet(fs.HashMD5, fs.HashSHA1))
+	if err != nil {
+		return nil, err
+	}
+	in = io.TeeReader(in, hasher)
+	var chunks []fs.Object
+	for n, left := 1, size; left > 0; n++ {
+		chunkSize := f.chunkSize
+		if left < chunkSize {
+			chunkSize = left
+		}
+		info := fs.NewStaticObjectInfo(chunkName(remote, gen, n), src.ModTime(), chunkSize, true, nil, nil)
+		chunk, err := f.Fs.Put(io.LimitReader(in, chunkSize), info, options...)
+		if err == nil && chunk.Size() != chunkSize {
+			chunks = append(chunks, chunk)
+			err = errors.Errorf("chunk %d is the wrong size %d expecting %d", n, chunk.Size(), chunkSize)
+		}
+		if err != nil {
+			// only the new chunks need removing - the old
+			// version of the file is untouched
+			_ = removeAll(chunks)
+			return nil, errors.Wrapf(err, "failed to upload chunk %d", n)
+		}
+		chunks = append(chunks, chunk)
+		left -= chunkSize
+	}
+	sums := hasher.Sums()
+	meta := &metadata{
+		Version: metadataVersion,
+		Size:    size,
+		Chunks:  len(chunks),
+		Gen:     gen,
+		MD5:     sums[fs.HashMD5],
+		SHA1:    sums[fs.HashSHA1],
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		_ = removeAll(chunks)
+		return nil, err
+	}
+	info := fs.NewStaticObjectInfo(remote, src.ModTime(), int64(len(data)), true, nil, nil)
+	o, err := f.Fs.Put(bytes.NewReader(data), info, options...)
+	if err != nil {
+		_ = removeAll(chunks)
+		return nil, errors.Wrap(err, "failed to upload metadata")
+	}
+	// remove the chunks of the old version and any left over from
+	// an interrupted update
+	err = f.removeChunks(remote, 1-gen, 1)
+	if err == nil {
+		err = f.removeChunks(remote, gen, len(chunks)+1)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to remove old chunks")
+	}
+	newO := f.newObject(o, gen, chunks)
+	newO.meta = meta
+	return newO, nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	var existing *Object
+	o, err := f.NewObject(src.Remote())
+	switch err {
+	case nil:
+		existing = o.(*Object)
+	case fs.ErrorObjectNotFound:
+	default:
+		return nil, err
+	}
+	return f.put(in, src, existing, options...)
+}
+
+// Purge all files in the root and the root directory
+//
+// Implement this if you have a way of deleting all the files
+// quicker than just running Remove() on the result of List()
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge() error {
+	do := f.Fs.Features().Purge
+	if do == nil {
+		return fs.ErrorCantPurge
+	}
+	return do()
+}
+
+// copyOrMove copies or moves src to remote with do which is the
+// Copy or Move of the wrapped remote
+//
+// If the destination is chunked with the same generation as src then
+// the chunks are given the names of the other generation so a failure
+// part way through leaves the destination intact, as in put.
+func (f *Fs) copyOrMove(src *Object, remote string, do func(fs.Object, string) (fs.Object, error), move bool) (fs.Object, error) {
+	gen := src.gen
+	if src.isChunked() {
+		dst, err := f.NewObject(remote)
+		switch err {
+		case nil:
+			if dstObj := dst.(*Object); dstObj.isChunked() && dstObj.gen == gen {
+				gen = 1 - gen
+			}
+		case fs.ErrorObjectNotFound:
+		default:
+			return nil, err
+		}
+	}
+	var chunks []fs.Object
+	// failed removes the new chunks if copying.  If moving they
+	// are the only copy of the data so are left for the user.
+	failed := func(err error) (fs.Object, error) {
+		if !move {
+			_ = removeAll(chunks)
+		}
+		return nil, err
+	}
+	for i, chunk := range src.chunks {
+		newChunk, err := do(chunk, chunkName(remote, gen, i+1))
+		if err != nil {
+			return failed(err)
+		}
+		chunks = append(chunks, newChunk)
+	}
+	var o fs.Object
+	var meta *metadata
+	if gen == src.gen {
+		var err error
+		o, err = do(src.Object, remote)
+		if err != nil {
+			return failed(err)
+		}
+	} else {
+		// the metadata needs to point at the new chunks
+		srcMeta, err := src.readMetadata()
+		if err != nil {
+			return failed(err)
+		}
+		newMeta := *srcMeta
+		newMeta.Gen = gen
+		meta = &newMeta
+		data, err := json.Marshal(meta)
+		if err != nil {
+			return failed(err)
+		}
+		info := fs.NewStaticObjectInfo(remote, src.ModTime(), int64(len(data)), true, nil, nil)
+		o, err = f.Fs.Put(bytes.NewReader(data), info)
+		if err != nil {
+			return failed(errors.Wrap(err, "failed to upload metadata"))
+		}
+		if move {
+			err = src.Object.Remove()
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to remove moved metadata")
+			}
+		}
+	}
+	// remove any chunks of a file which was there before
+	err := f.removeChunks(remote, gen, len(chunks)+1)
+	if err == nil {
+		err = f.removeChunks(remote, 1-gen, 1)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to remove old chunks")
+	}
+	newO := f.newObject(o, gen, chunks)
+	newO.meta = meta
+	return newO, nil
+}
+
+// Copy src to this remote using server side copy operations.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Copy
+	if do == nil {
+		return nil, fs.ErrorCantCopy
+	}
+	o, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantCopy
+	}
+	return f.copyOrMove(o, remote, do, false)
+}
+
+// Move src to this remote using server side move operations.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Move
+	if do == nil {
+		return nil, fs.ErrorCantMove
+	}
+	o, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantMove
+	}
+	return f.copyOrMove(o, remote, do, true)
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(src fs.Fs, srcRemote, dstRemote string) error {
+	do := f.Fs.Features().DirMove
+	if do == nil {
+		return fs.ErrorCantDirMove
+	}
+	srcFs, ok := src.(*Fs)
+	if !ok {
+		fs.Debugf(srcFs, "Can't move directory - not same remote type")
+		return fs.ErrorCantDirMove
+	}
+	return do(srcFs.Fs, srcRemote, dstRemote)
+}
+
+// CleanUp the trash in the Fs
+//
+// Implement this if you have a way of emptying the trash or
+// otherwise cleaning up old versions of files.
+func (f *Fs) CleanUp() error {
+	do := f.Fs.Features().CleanUp
+	if do == nil {
+		return errors.New("can't CleanUp")
+	}
+	return do()
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs {
+	return f.Fs
+}
+
+// metadata is stored in place of a file which has been chunked
+type metadata struct {
+	Version int    `json:"ver"`
+	Size    int64  `json:"size"`
+	Chunks  int    `json:"nchunks"`
+	Gen     int    `json:"gen,omitempty"`
+	MD5     string `json:"md5,omitempty"`
+	SHA1    string `json:"sha1,omitempty"`
+}
+
+// Object describes a wrapped Object
+//
+// If the file has been chunked then the wrapped Object holds the
+// metadata and the data is in the chunks.
+type Object struct {
+	fs.Object
+	f      *Fs
+	gen    int         // generation of the chunks
+	chunks []fs.Object // the chunks in order if chunked
+	mu     sync.Mutex  // protects meta
+	meta   *metadata   // metadata of a chunked file once read
+}
+
+// newObject makes a new Object from o with the chunks of generation
+// gen if it is chunked
+func (f *Fs) newObject(o fs.Object, gen int, chunks []fs.Object) *Object {
+	return &Object{
+		Object: o,
+		f:      f,
+		gen:    gen,
+		chunks: chunks,
+	}
+}
+
+// isChunked returns whether the file is stored in chunks
+func (o *Object) isChunked() bool {
+	return len(o.chunks) > 0
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.Remote()
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	if !o.isChunked() {
+		return o.Object.Size()
+	}
+	var size int64
+	for _, chunk := range o.chunks {
+		size += chunk.Size()
+	}
+	return size
+}
+
+// decodeMetadata reads and decodes the metadata stored in o
+func decodeMetadata(o fs.Object) (*metadata, error) {
+	in, err := o.Open()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open metadata")
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(in, maxMetadataSize))
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read metadata")
+	}
+	meta := new(metadata)
+	err = json.Unmarshal(data, meta)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode metadata")
+	}
+	if meta.Version != metadataVersion {
+		return nil, errors.Errorf("unknown metadata version %d", meta.Version)
+	}
+	if meta.Gen < 0 || meta.Gen >= chunkGenerations {
+		return nil, errors.Errorf("unknown chunk version %d", meta.Gen)
+	}
+	return meta, nil
+}
+
+// readMetadata reads and checks the metadata of a chunked file
+func (o *Object) readMetadata() (*metadata, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.meta != nil {
+		return o.meta, nil
+	}
+	meta, err := decodeMetadata(o.Object)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Gen != o.gen {
+		return nil, errors.Errorf("found chunks of version %d expecting %d", o.gen, meta.Gen)
+	}
+	if meta.Chunks != len(o.chunks) || meta.Size != o.Size() {
+		return nil, errors.Errorf("found %d chunks with size %d expecting %d with size %d", len(o.chunks), o.Size(), meta.Chunks, meta.Size)
+	}
+	o.meta = meta
+	return meta, nil
+}
+
+// Hash returns the selected checksum of the file
+// If no checksum is available it returns ""
+func (o *Object) Hash(hashType fs.HashType) (string, error) {
+	if !o.isChunked() {
+		return o.Object.Hash(hashType)
+	}
+	meta, err := o.readMetadata()
+	if err != nil {
+		return "", err
+	}
+	switch hashType {
+	case fs.HashMD5:
+		return meta.MD5, nil
+	case fs.HashSHA1:
+		return meta.SHA1, nil
+	}
+	return "", fs.ErrHashUnsupported
+}
+
+// UnWrap returns the wrapped Object
+func (o *Object) UnWrap() fs.Object {
+	return o.Object
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+//
+// Only the chunks in the range requested are opened.
+func (o *Object) Open(options ...fs.OpenOption) (rc io.ReadCloser, err error) {
+	if !o.isChunked() {
+		return o.Object.Open(options...)
+	}
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(o.Size())
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	_, err = o.readMetadata()
+	if err != nil {
+		return nil, err
+	}
+	return newChunkReader(o.chunks, offset, limit), nil
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	newO, err := o.f.put(in, src, o, options...)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	o.Object, o.gen, o.chunks, o.meta = newO.Object, newO.gen, newO.chunks, newO.meta
+	o.mu.Unlock()
+	return nil
+}
+
+// Remove an object
+func (o *Object) Remove() error {
+	err := removeAll(o.chunks)
+	if err != nil {
+		return err
+	}
+	return o.Object.Remove()
+}
+
+// chunkReader reads a range of a chunked file opening the chunks as
+// they are needed
+type chunkReader struct {
+	chunks []fs.Object   // chunks still to read
+	offset int64         // offset to open the next chunk at
+	limit  int64         // bytes left to read or -1 for all
+	in     io.ReadCloser // the chunk being read or nil
+}
+
+// newChunkReader makes a reader for limit bytes (-1 for all) of
+// chunks starting at offset
+func newChunkReader(chunks []fs.Object, offset, limit int64) *chunkReader {
+	for len(chunks) > 0 && offset >= chunks[0].Size() {
+		offset -= chunks[0].Size()
+		chunks = chunks[1:]
+	}
+	return &chunkReader{
+		chunks: chunks,
+		offset: offset,
+		limit:  limit,
+	}
+}
+
+// Read bytes from the chunks
+func (r *chunkReader) Read(p []byte) (n int, err error) {
+	for {
+		if r.limit == 0 {
+			return 0, io.EOF
+		}
+		if r.in == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+			var options []fs.OpenOption
+			if r.offset > 0 {
+				options = append(options, &fs.SeekOption{Offset: r.offset})
+			}
+			r.in, err = r.chunks[0].Open(options...)
+			if err != nil {
+				return 0, errors.Wrap(err, "failed to open chunk")
+			}
+			r.chunks, r.offset = r.chunks[1:], 0
+		}
+		if r.limit > 0 && int64(len(p)) > r.limit {
+			p = p[:r.limit]
+		}
+		n, err = r.in.Read(p)
+		if r.limit > 0 {
+			r.limit -= int64(n)
+		}
+		if err == io.EOF {
+			err = r.in.Close()
+			r.in = nil
+			if err != nil || n > 0 {
+				return n, err
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Close the chunk being read
+func (r *chunkReader) Close() error {
+	if r.in == nil {
+		return nil
+	}
+	err := r.in.Close()
+	r.in = nil
+	return err
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs         = (*Fs)(nil)
+	_ fs.Purger     = (*Fs)(nil)
+	_ fs.Copier     = (*Fs)(nil)
+	_ fs.Mover      = (*Fs)(nil)
+	_ fs.DirMover   = (*Fs)(nil)
+	_ fs.CleanUpper = (*Fs)(nil)
+	_ fs.UnWrapper  = (*Fs)(nil)
+	_ fs.Object     = (*Object)(nil)
+)
@@ -0,0 +1,289 @@
+package chunker
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	_ "github.com/ncw/rclone/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFs makes a chunker remote with 4 byte chunks wrapping a
+// temporary local directory returning the Fs, the local directory and
+// a function to tidy up
+func newTestFs(t *testing.T) (*Fs, string, func()) {
+	dir, cleanup := fstest.NewLocalDir(t)
+	f, err := fstest.NewConfiguredFs("TestChunkerInternal", "type", "chunker", "remote", dir, "chunk_size", "4b")
+	require.NoError(t, err)
+	return f.(*Fs), dir, cleanup
+}
+
+func TestParseChunkName(t *testing.T) {
+	for _, test := range []struct {
+		in     string
+		remote string
+		gen    int
+		n      int
+	}{
+		{"file.txt", "", 0, 0},
+		{"file.txt.rclone_chunk.001", "file.txt", 0, 1},
+		{"dir/file.txt.rclone_chunk.1234", "dir/file.txt", 0, 1234},
+		{"file.txt.rclone_chunk.002_1", "file.txt", 1, 2},
+		{"file.txt.rclone_chunk.002_2", "", 0, 0},
+		{"file.txt.rclone_chunk.01", "", 0, 0},
+		{"file.txt.rclone_chunk.000", "", 0, 0},
+		{".rclone_chunk.001", "", 0, 0},
+	} {
+		remote, gen, n := parseChunkName(test.in)
+		assert.Equal(t, test.remote, remote, test.in)
+		assert.Equal(t, test.gen, gen, test.in)
+		assert.Equal(t, test.n, n, test.in)
+	}
+	assert.Equal(t, "a.rclone_chunk.012", chunkName("a", 0, 12))
+	assert.Equal(t, "a.rclone_chunk.012_1", chunkName("a", 1, 12))
+}
+
+func TestChunked(t *testing.T) {
+	f, dir, cleanup := newTestFs(t)
+	defer cleanup()
+
+	contents := "0123456789"
+	o := fstest.PutFile(t, f, "file.txt", contents)
+	assert.Equal(t, int64(10), o.Size())
+	assert.Equal(t, []string{
+		"file.txt",
+		"file.txt.rclone_chunk.001",
+		"file.txt.rclone_chunk.002",
+		"file.txt.rclone_chunk.003",
+	}, fstest.LocalNames(t, dir))
+
+	// The chunks are hidden from the listing
+	entries, err := f.List("")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, "file.txt", entries[0].Remote())
+	assert.Equal(t, int64(10), entries[0].Size())
+	_, err = f.NewObject("file.txt.rclone_chunk.001")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	// The hashes are of the whole file
+	md5sum := md5.Sum([]byte(contents))
+	sha1sum := sha1.Sum([]byte(contents))
+	o, err = f.NewObject("file.txt")
+	require.NoError(t, err)
+	hash, err := o.Hash(fs.HashMD5)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(md5sum[:]), hash)
+	hash, err = o.Hash(fs.HashSHA1)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(sha1sum[:]), hash)
+	assert.Equal(t, contents, fstest.ReadObject(t, f, "file.txt"))
+
+	// Updating the file uploads the chunks under the other names
+	// and removes the old ones
+	fstest.PutFile(t, f, "file.txt", "abcdef")
+	assert.Equal(t, []string{
+		"file.txt",
+		"file.txt.rclone_chunk.001_1",
+		"file.txt.rclone_chunk.002_1",
+	}, fstest.LocalNames(t, dir))
+	assert.Equal(t, "abcdef", fstest.ReadObject(t, f, "file.txt"))
+	fstest.PutFile(t, f, "file.txt", "ABCDEFGHI")
+	assert.Equal(t, []string{
+		"file.txt",
+		"file.txt.rclone_chunk.001",
+		"file.txt.rclone_chunk.002",
+		"file.txt.rclone_chunk.003",
+	}, fstest.LocalNames(t, dir))
+	assert.Equal(t, "ABCDEFGHI", fstest.ReadObject(t, f, "file.txt"))
+
+	// As does making it small enough not to chunk
+	fstest.PutFile(t, f, "file.txt", "abc")
+	assert.Equal(t, []string{"file.txt"}, fstest.LocalNames(t, dir))
+	assert.Equal(t, "abc", fstest.ReadObject(t, f, "file.txt"))
+
+	// Files can't be named like chunks
+	src := fs.NewStaticObjectInfo("a.rclone_chunk.001", time.Now(), 1, true, nil, nil)
+	_, err = f.Put(strings.NewReader("a"), src)
+	assert.Error(t, err)
+}
+
+// errorReader returns the data then err
+type errorReader struct {
+	data string
+	err  error
+}
+
+func (r *errorReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestChunkedUpdateFailed(t *testing.T) {
+	f, dir, cleanup := newTestFs(t)
+	defer cleanup()
+	o := fstest.PutFile(t, f, "file.txt", "0123456789")
+
+	// A failed update leaves the old version alone and removes the
+	// new chunks
+	src := fs.NewStaticObjectInfo("file.txt", time.Now(), 12, true, nil, nil)
+	err := o.Update(&errorReader{data: "abcdef", err: errors.New("read failed")}, src)
+	require.Error(t, err)
+	assert.Equal(t, []string{
+		"file.txt",
+		"file.txt.rclone_chunk.001",
+		"file.txt.rclone_chunk.002",
+		"file.txt.rclone_chunk.003",
+	}, fstest.LocalNames(t, dir))
+	assert.Equal(t, "0123456789", fstest.ReadObject(t, f, "file.txt"))
+
+	// Chunks left over from an interrupted update are ignored
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "file.txt.rclone_chunk.001_1"), []byte("abcd"), 0666))
+	assert.Equal(t, "0123456789", fstest.ReadObject(t, f, "file.txt"))
+	entries, err := f.List("")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, int64(10), entries[0].Size())
+
+	// and removed by the next update
+	fstest.PutFile(t, f, "file.txt", "abcdef")
+	assert.Equal(t, []string{
+		"file.txt",
+		"file.txt.rclone_chunk.001_1",
+		"file.txt.rclone_chunk.002_1",
+	}, fstest.LocalNames(t, dir))
+	assert.Equal(t, "abcdef", fstest.ReadObject(t, f, "file.txt"))
+}
+
+func TestChunkedRange(t *testing.T) {
+	f, dir, cleanup := newTestFs(t)
+	defer cleanup()
+	fstest.PutFile(t, f, "file.txt", "0123456789")
+
+	assert.Equal(t, "3456789", fstest.ReadObject(t, f, "file.txt", &fs.SeekOption{Offset: 3}))
+	assert.Equal(t, "2345", fstest.ReadObject(t, f, "file.txt", &fs.RangeOption{Start: 2, End: 5}))
+	assert.Equal(t, "89", fstest.ReadObject(t, f, "file.txt", &fs.RangeOption{Start: -1, End: 2}))
+	assert.Equal(t, "", fstest.ReadObject(t, f, "file.txt", &fs.SeekOption{Offset: 10}))
+
+	// Only the chunks in the range are read
+	o, err := f.NewObject("file.txt")
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(dir, "file.txt.rclone_chunk.001")))
+	require.NoError(t, os.Remove(filepath.Join(dir, "file.txt.rclone_chunk.003")))
+	in, err := o.Open(&fs.RangeOption{Start: 5, End: 6})
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "56", string(data))
+}
+
+func TestChunkedMissing(t *testing.T) {
+	f, dir, cleanup := newTestFs(t)
+	defer cleanup()
+	fstest.PutFile(t, f, "file.txt", "0123456789")
+	require.NoError(t, os.Remove(filepath.Join(dir, "file.txt.rclone_chunk.003")))
+
+	// The metadata doesn't match the chunks
+	o, err := f.NewObject("file.txt")
+	require.NoError(t, err)
+	_, err = o.Open()
+	assert.Error(t, err)
+	_, err = o.Hash(fs.HashMD5)
+	assert.Error(t, err)
+}
+
+func TestChunkedMove(t *testing.T) {
+	f, dir, cleanup := newTestFs(t)
+	defer cleanup()
+	o := fstest.PutFile(t, f, "file.txt", "0123456789")
+	// a bigger file to be overwritten
+	fstest.PutFile(t, f, "moved.txt", "0123456789abcdef")
+
+	// the chunks are moved to the other generation's names so as
+	// not to overwrite the destination's
+	moved, err := f.Move(o, "moved.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), moved.Size())
+	assert.Equal(t, []string{
+		"moved.txt",
+		"moved.txt.rclone_chunk.001_1",
+		"moved.txt.rclone_chunk.002_1",
+		"moved.txt.rclone_chunk.003_1",
+	}, fstest.LocalNames(t, dir))
+	assert.Equal(t, "0123456789", fstest.ReadObject(t, f, "moved.txt"))
+	hash, err := moved.Hash(fs.HashMD5)
+	require.NoError(t, err)
+	assert.Equal(t, "781e5e245d69b566979b86e28d23f2c7", hash)
+
+	require.NoError(t, moved.Remove())
+	assert.Equal(t, []string(nil), fstest.LocalNames(t, dir))
+}
+
+// failCopyFs is an Fs which can Copy n times before failing
+type failCopyFs struct {
+	fs.Fs
+	n int
+}
+
+func (f *failCopyFs) Features() *fs.Features {
+	return (&fs.Features{}).Fill(f)
+}
+
+func (f *failCopyFs) Copy(src fs.Object, remote string) (fs.Object, error) {
+	if f.n == 0 {
+		return nil, errors.New("copy failed")
+	}
+	f.n--
+	in, err := src.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = in.Close() }()
+	return f.Fs.Put(in, fs.NewStaticObjectInfo(remote, src.ModTime(), src.Size(), true, nil, nil))
+}
+
+func TestChunkedCopyFailed(t *testing.T) {
+	f, dir, cleanup := newTestFs(t)
+	defer cleanup()
+	o := fstest.PutFile(t, f, "file.txt", "0123456789")
+	fstest.PutFile(t, f, "copied.txt", "abcdef")
+	f.Fs = &failCopyFs{Fs: f.Fs, n: 2}
+
+	// A failed copy leaves the destination alone and removes the
+	// new chunks
+	_, err := f.Copy(o, "copied.txt")
+	require.Error(t, err)
+	assert.Equal(t, []string{
+		"copied.txt",
+		"copied.txt.rclone_chunk.001",
+		"copied.txt.rclone_chunk.002",
+		"file.txt",
+		"file.txt.rclone_chunk.001",
+		"file.txt.rclone_chunk.002",
+		"file.txt.rclone_chunk.003",
+	}, fstest.LocalNames(t, dir))
+	assert.Equal(t, "abcdef", fstest.ReadObject(t, f, "copied.txt"))
+	assert.Equal(t, "0123456789", fstest.ReadObject(t, f, "file.txt"))
+
+	// A copy that succeeds replaces it
+	f.Fs.(*failCopyFs).n = 4
+	_, err = f.Copy(o, "copied.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", fstest.ReadObject(t, f, "copied.txt"))
+}
@@ -0,0 +1,97 @@
+package bisync
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs"
+	"github.com/spf13/cobra"
+)
+
+// Globals
+var (
+	bisyncDir      = defaultBisyncDir()
+	conflictSuffix = ".conflict"
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefintion)
+	commandDefintion.Flags().StringVarP(&bisyncDir, "bisync-dir", "", bisyncDir, "Directory to keep the listings of previous bisyncs in.")
+	commandDefintion.Flags().StringVarP(&conflictSuffix, "conflict-suffix", "", conflictSuffix, "Suffix to add to the older version of files changed on both sides.")
+}
+
+var commandDefintion = &cobra.Command{
+	Use:   "bisync path1:path path2:path",
+	Short: `Make path1 and path2 identical, modifying both.`,
+	Long: `
+Bisync makes two directories identical by propagating the changes
+made to each one since the last bisync to the other.  Files created
+or changed on one side are copied to the other, and files deleted on
+one side are deleted from the other.  Doesn't transfer unchanged
+files, testing by size and modification time or MD5SUM.
+
+To work out what changed, the listings of both sides are saved after
+each successful bisync in the directory given by ` + "`" + `--bisync-dir` + "`" + `.
+On the first bisync of two directories there are no listings, so all
+the files are treated as new.  Files only on one side are copied to
+the other and nothing is deleted.  The listings saved are the ones
+made at the start with the changes bisync made applied, so files
+changed while it is running are picked up by the next bisync.
+
+If a file was changed on both sides then the newer version is kept
+and the older one is renamed with ` + "`" + `--conflict-suffix` + "`" + ` added to its
+name, so both sides end up with both versions.  A file which was
+changed on one side and deleted on the other is kept.
+
+If all the files on one side have gone since the last bisync then
+nothing is done, in case the directory is missing by mistake.  If
+the deletions were intended then remove the listings from the
+` + "`" + `--bisync-dir` + "`" + ` directory and run bisync again.
+
+If there were any errors the listings aren't saved, so the changes
+will be retried by the next bisync.
+
+Empty directories aren't synced.
+
+**Important**: Since this can cause data loss, test first with the
+` + "`" + `--dry-run` + "`" + ` flag to see exactly what would be copied and deleted.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		path1, path2 := cmd.NewFsSrcDst(args)
+		cmd.Run(true, true, command, func() error {
+			return fs.Bisync(path1, path2, listingsFile(path1, path2), conflictSuffix)
+		})
+	},
+}
+
+// defaultBisyncDir returns the directory the listings are kept in by
+// default
+func defaultBisyncDir() string {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "rclone", "bisync")
+	}
+	homedir := os.Getenv("HOME")
+	if usr, err := user.Current(); err == nil {
+		homedir = usr.HomeDir
+	}
+	if homedir == "" {
+		return filepath.Join(os.TempDir(), "rclone-bisync")
+	}
+	return filepath.Join(homedir, ".cache", "rclone", "bisync")
+}
+
+// unsafeChars are the characters replaced in the names of listings
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// listingsFile returns the name of the file to keep the listings of
+// path1 and path2 in
+func listingsFile(path1, path2 fs.Fs) string {
+	name := func(f fs.Fs) string {
+		return unsafeChars.ReplaceAllString(f.Name()+"_"+f.Root(), "_")
+	}
+	return filepath.Join(bisyncDir, name(path1)+".."+name(path2)+".json")
+}
@@ -16,6 +16,8 @@ var commandDefintion = &cobra.Command{
 	Long: `
 Clean up the remote if possible.  Empty the trash or delete old file
 versions. Not supported by all remotes.
+
+On a cas remote this removes the chunks which aren't used by any file.
 `,
 	Run: func(command *cobra.Command, args []string) {
 		cmd.CheckArgs(1, 1, command, args)
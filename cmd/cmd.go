@@ -20,6 +20,7 @@ import (
 	"github.com/spf13/pflag"
 
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/rc"
 )
 
 // Globals
@@ -95,6 +96,7 @@ func runRoot(cmd *cobra.Command, args []string) {
 func init() {
 	Root.Run = runRoot
 	Root.Flags().BoolVarP(&version, "version", "V", false, "Print the version number")
+	rc.AddFlags(pflag.CommandLine, &rc.Opt)
 	cobra.OnInitialize(initConfig)
 }
 
@@ -372,4 +374,10 @@ func initConfig() {
 	} else {
 		fs.Config.DataRateUnit = *dataRateUnit
 	}
+
+	// Start the remote control server if configured
+	_, err := rc.Start(&rc.Opt)
+	if err != nil {
+		log.Fatalf("Failed to start remote control: %v", err)
+	}
 }
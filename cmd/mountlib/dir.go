@@ -478,6 +478,43 @@ func (d *Dir) Rename(oldName, newName string, destDir *Dir) error {
 	return nil
 }
 
+// Copy the file oldName to newName in destDir using a server side copy
+//
+// This returns an error if the remote doesn't support Copy
+func (d *Dir) Copy(oldName, newName string, destDir *Dir) error {
+	if d.fsys.readOnly {
+		return EROFS
+	}
+	oldPath := path.Join(d.path, oldName)
+	newPath := path.Join(destDir.path, newName)
+	// fs.Debugf(oldPath, "Dir.Copy to %q", newPath)
+	oldItem, err := d.lookupNode(oldName)
+	if err != nil {
+		fs.Errorf(oldPath, "Dir.Copy error: %v", err)
+		return err
+	}
+	oldObject, ok := oldItem.Obj.(fs.Object)
+	if !ok {
+		err = errors.Errorf("can't copy %T", oldItem.Obj)
+		fs.Errorf(oldPath, "Dir.Copy error: %v", err)
+		return err
+	}
+	doCopy := d.f.Features().Copy
+	if doCopy == nil {
+		err = errors.Errorf("Fs %q can't copy files (no Copy)", d.f)
+		fs.Errorf(oldPath, "Dir.Copy error: %v", err)
+		return err
+	}
+	newObject, err := doCopy(oldObject, newPath)
+	if err != nil {
+		fs.Errorf(oldPath, "Dir.Copy error: %v", err)
+		return err
+	}
+	destDir.addObject(newObject, newFile(destDir, newObject, newName))
+	// fs.Debugf(newPath, "Dir.Copy copied from %q", oldPath)
+	return nil
+}
+
 // Fsync the directory
 //
 // Note that we don't do anything except return OK
@@ -170,6 +170,12 @@ func (f *File) waitForValidObject() (o fs.Object, err error) {
 	return nil, ENOENT
 }
 
+// Object returns the fs.Object for the file, waiting a short time for
+// it to become valid if it is being written.
+func (f *File) Object() (fs.Object, error) {
+	return f.waitForValidObject()
+}
+
 // OpenRead open the file for read
 func (f *File) OpenRead() (fh *ReadFileHandle, err error) {
 	// if o is nil it isn't valid yet
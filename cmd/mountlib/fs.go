@@ -66,6 +66,8 @@ func NewFS(f fs.Fs) *FS {
 	if PollInterval > 0 {
 		fsys.PollChanges(PollInterval)
 	}
+
+	fsys.addRC()
 	return fsys
 }
 
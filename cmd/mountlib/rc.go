@@ -0,0 +1,72 @@
+package mountlib
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/pkg/errors"
+)
+
+// addRC adds the remote control commands for the FS.
+//
+// If more than one FS is created the commands act on the most recent.
+func (fsys *FS) addRC() {
+	rc.Add(rc.Call{
+		Path: "vfs/forget",
+		Fn: func(in rc.Params) (out rc.Params, err error) {
+			root, err := fsys.Root()
+			if err != nil {
+				return nil, err
+			}
+			forgotten := []string{}
+			if len(in) == 0 {
+				root.ForgetAll()
+			} else {
+				for k, v := range in {
+					p, ok := v.(string)
+					if !ok {
+						return nil, errors.Errorf("value must be string %q=%v", k, v)
+					}
+					p = strings.Trim(p, "/")
+					switch {
+					case strings.HasPrefix(k, "file"):
+						dir := path.Dir(p)
+						if dir == "." {
+							dir = ""
+						}
+						root.ForgetPath(dir)
+					case strings.HasPrefix(k, "dir"):
+						root.ForgetPath(p)
+					default:
+						return nil, errors.Errorf("unknown key %q", k)
+					}
+					forgotten = append(forgotten, p)
+				}
+			}
+			sort.Strings(forgotten)
+			out = rc.Params{
+				"forgotten": forgotten,
+			}
+			return out, nil
+		},
+		Title: "Forget files or directories in the directory cache.",
+		Help: `
+This forgets the paths in the directory cache causing them to be
+re-read from the remote when needed.
+
+If no paths are passed in then it will forget all the paths in the
+directory cache.
+
+	rclone rc vfs/forget
+
+Otherwise pass files or dirs in as file=path or dir=path.  Any
+parameter key starting with file will forget the directory containing
+that file and any parameter key starting with dir will forget that
+directory, eg
+
+	rclone rc vfs/forget file=hello file2=goodbye dir=home/junk
+`,
+	})
+}
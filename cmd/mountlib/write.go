@@ -178,6 +178,23 @@ func (fh *WriteFileHandle) Flush() error {
 	return err
 }
 
+// Abort is called instead of Release if the data being written can't
+// be finished.  It fails the upload with err so what has been written
+// so far isn't stored.
+func (fh *WriteFileHandle) Abort(err error) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	if fh.closed {
+		return
+	}
+	fs.Debugf(fh.remote, "WriteFileHandle.Abort: %v", err)
+	fh.closed = true
+	fs.Stats.DoneTransferring(fh.remote, false)
+	fh.file.addWriters(-1)
+	_ = fh.pipeWriter.CloseWithError(err)
+	<-fh.result
+}
+
 // Release is called when we are finished with the file handle
 //
 // It isn't called directly from userspace so the error is ignored by
@@ -0,0 +1,118 @@
+package prehash
+
+import (
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/hasher"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefintion)
+}
+
+var commandDefintion = &cobra.Command{
+	Use:   "prehash hasherremote:path",
+	Short: `Reads the files on a hasher remote to store their checksums.`,
+	Long: `
+rclone prehash reads every file on a hasher remote whose checksums
+aren't known yet so that the hasher stores their MD5 and SHA1
+checksums.  After it has run commands such as check, sync --checksum
+and sync --track-renames can use the checksums without reading the
+files again.
+
+Use it like this
+
+    rclone prehash hasherremote:path
+
+Files whose checksums are already stored and are unchanged since
+aren't read again.  This obeys the include and exclude flags and reads
+--checkers files at once.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		fsrc := cmd.NewFsSrc(args)
+		cmd.Run(false, true, command, func() error {
+			return prehash(fsrc)
+		})
+	},
+}
+
+// prehash reads all the files on f whose checksums aren't known
+func prehash(f fs.Fs) error {
+	fhasher, ok := f.(*hasher.Fs)
+	if !ok {
+		return errors.Errorf("%s:%s is not a hasher remote", f.Name(), f.Root())
+	}
+	var (
+		wg      sync.WaitGroup
+		objects = make(chan fs.Object, fs.Config.Checkers)
+	)
+	wg.Add(fs.Config.Checkers)
+	for i := 0; i < fs.Config.Checkers; i++ {
+		go func() {
+			defer wg.Done()
+			for o := range objects {
+				readObject(o)
+			}
+		}()
+	}
+	err := fs.ListFn(fhasher, func(o fs.Object) {
+		objects <- o
+	})
+	close(objects)
+	wg.Wait()
+	return err
+}
+
+// hashesKnown returns whether both the MD5 and SHA1 of o are known,
+// either from the wrapped remote or stored by the hasher
+func hashesKnown(o fs.Object) bool {
+	for _, hashType := range []fs.HashType{fs.HashMD5, fs.HashSHA1} {
+		sum, err := o.Hash(hashType)
+		if err != nil || sum == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// readObject reads all of o if its checksums aren't known
+func readObject(o fs.Object) {
+	fs.Stats.Checking(o.Remote())
+	known := hashesKnown(o)
+	fs.Stats.DoneChecking(o.Remote())
+	if known {
+		fs.Debugf(o, "Checksums already known")
+		return
+	}
+	var err error
+	fs.Stats.Transferring(o.Remote())
+	defer func() {
+		fs.Stats.DoneTransferring(o.Remote(), err == nil)
+	}()
+	var in io.ReadCloser
+	in, err = o.Open()
+	if err != nil {
+		fs.Stats.Error()
+		fs.Errorf(o, "Failed to open: %v", err)
+		return
+	}
+	in = fs.NewAccount(in, o).WithBuffer() // account and buffer the transfer
+	_, err = io.Copy(ioutil.Discard, in)
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fs.Stats.Error()
+		fs.Errorf(o, "Failed to read: %v", err)
+		return
+	}
+	fs.Infof(o, "Stored checksums")
+}
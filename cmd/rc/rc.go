@@ -0,0 +1,147 @@
+package rc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	noOutput = false
+	url      = "http://localhost:5572/"
+	authUser = ""
+	authPass = ""
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefintion)
+	commandDefintion.Flags().BoolVarP(&noOutput, "no-output", "", noOutput, "If set don't output the JSON result.")
+	commandDefintion.Flags().StringVarP(&url, "url", "", url, "URL to connect to rclone remote control.")
+	commandDefintion.Flags().StringVarP(&authUser, "user", "", authUser, "Username to use to rclone remote control.")
+	commandDefintion.Flags().StringVarP(&authPass, "pass", "", authPass, "Password to use to connect to rclone remote control.")
+}
+
+var commandDefintion = &cobra.Command{
+	Use:   "rc commands parameter",
+	Short: `Run a command against a running rclone.`,
+	Long: `
+This runs a command against a running rclone.  Use the --url flag to
+specify an non default URL to connect on.  This can be either a
+":port" which is taken to mean "http://localhost:port" or a
+"host:port" which is taken to mean "http://host:port"
+
+The running rclone needs to have been started with the --rc flag, eg
+
+    rclone mount --rc remote: /path/to/mountpoint
+
+Arguments should be passed in as parameter=value.
+
+The result will be returned as a JSON object by default.
+
+Use "rclone rc rc/list" to see a list of all possible commands, eg
+
+    rclone rc core/stats
+    rclone rc core/bwlimit rate=1M
+    rclone rc vfs/forget dir=path/to/dir
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1e9, command, args)
+		cmd.Run(false, false, command, func() error {
+			return run(args)
+		})
+	},
+}
+
+// run the command passed in
+func run(args []string) error {
+	path := strings.Trim(args[0], "/")
+	in := make(rc.Params)
+	for _, param := range args[1:] {
+		equals := strings.IndexRune(param, '=')
+		if equals < 0 {
+			return errors.Errorf("no '=' found in parameter %q", param)
+		}
+		in[param[:equals]] = param[equals+1:]
+	}
+	out, err := doCall(path, in)
+	if err != nil {
+		return err
+	}
+	if !noOutput {
+		err := rc.WriteJSON(os.Stdout, out)
+		if err != nil {
+			return errors.Wrap(err, "failed to output JSON")
+		}
+	}
+	return nil
+}
+
+// fixURL makes the url passed in a full URL ending in /
+func fixURL(url string) string {
+	if strings.HasPrefix(url, ":") {
+		url = "localhost" + url
+	}
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = "http://" + url
+	}
+	if !strings.HasSuffix(url, "/") {
+		url += "/"
+	}
+	return url
+}
+
+// do a call from (path, in) to (out, err).
+//
+// if err is set, out may be a valid error return or it may be nil
+func doCall(path string, in rc.Params) (out rc.Params, err error) {
+	// Do HTTP request
+	client := fs.Config.Client()
+	data, err := json.Marshal(in)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode JSON")
+	}
+	req, err := http.NewRequest("POST", fixURL(url)+path, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to make request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if authUser != "" || authPass != "" {
+		req.SetBasicAuth(authUser, authPass)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "connection failed")
+	}
+	defer fs.CheckClose(resp.Body, &err)
+
+	if resp.StatusCode != http.StatusOK {
+		var body []byte
+		body, err = ioutil.ReadAll(resp.Body)
+		var bodyString string
+		if err == nil {
+			bodyString = string(body)
+		} else {
+			bodyString = err.Error()
+		}
+		bodyString = strings.TrimSpace(bodyString)
+		return nil, errors.Errorf("Failed to read rc response: %s: %s", resp.Status, bodyString)
+	}
+
+	// Parse output
+	out = make(rc.Params)
+	err = json.NewDecoder(resp.Body).Decode(&out)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode JSON")
+	}
+
+	return out, err
+}
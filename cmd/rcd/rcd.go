@@ -0,0 +1,48 @@
+package rcd
+
+import (
+	"log"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefintion)
+}
+
+var commandDefintion = &cobra.Command{
+	Use:   "rcd",
+	Short: `Run rclone listening to remote control commands only.`,
+	Long: `
+This runs rclone so that it only listens to remote control commands.
+
+This is useful if you are controlling rclone via the rc API.
+
+Jobs such as sync/sync, sync/copy, sync/move and operations/purge
+are run in the background, each with their own transfer stats.  Use
+job/status to poll them and job/stop to cancel them, eg
+
+    rclone rcd &
+    rclone rc sync/copy srcFs=drive:src dstFs=/tmp/dst
+    rclone rc job/status jobid=1
+    rclone rc job/stop jobid=1
+
+The server is configured with the --rc-* flags, eg --rc-addr, --rc-user
+and --rc-pass.  See the documentation for --rc for more info.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(0, 0, command, args)
+		if rc.Opt.Enabled {
+			log.Fatalf("Don't supply --rc flag when using rcd")
+		}
+		opt := rc.Opt
+		opt.Enabled = true
+		s, err := rc.Start(&opt)
+		if err != nil {
+			log.Fatalf("Failed to start remote control: %v", err)
+		}
+		s.Wait()
+	},
+}
@@ -0,0 +1,61 @@
+package repair
+
+import (
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefintion)
+}
+
+var commandDefintion = &cobra.Command{
+	Use:   "repair remote:path",
+	Short: `Repairs the remotes under a mirror or erasure remote.`,
+	Long: `
+rclone repair fixes the remotes a mirror or erasure remote stores its
+files on after they have got out of step.
+
+Use it like this
+
+    rclone repair mirrorremote:path
+
+For a mirror remote it checks that all the remotes have the same
+files and directories.  They can get out of step if changes fail on
+some of the remotes when the mirror's failure_policy is degraded, or
+if the remotes are changed other than through the mirror.  Files which
+are missing from or different on some of the remotes are copied to
+them from the remote with the newest version of the file, and missing
+directories are made.  Nothing is ever deleted, so a file deleted on
+only some of the remotes will be put back on them.
+
+For an erasure remote it reads all the shards of every file, and
+rebuilds any which are missing or damaged from the others.  Shards
+left from interrupted updates are removed.
+
+Use --dry-run to see what would be done without changing anything.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		fsrc := cmd.NewFsSrc(args)
+		cmd.Run(true, true, command, func() error {
+			return repair(fsrc)
+		})
+	},
+}
+
+// repairer is a remote which can repair its upstreams
+type repairer interface {
+	Repair() error
+}
+
+// repair makes the upstreams of f consistent again
+func repair(f fs.Fs) error {
+	r, ok := f.(repairer)
+	if !ok {
+		return errors.Errorf("%s:%s is not a mirror or erasure remote", f.Name(), f.Root())
+	}
+	return r.Repair()
+}
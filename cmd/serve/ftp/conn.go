@@ -0,0 +1,956 @@
+package ftp
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/cmd/mountlib"
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// dataTimeout is how long to wait for a data connection to be made
+const dataTimeout = 30 * time.Second
+
+// Errors returned to the client
+var (
+	errIsDirectory  = errors.New("is a directory")
+	errNotDirectory = errors.New("not a directory")
+	errNoDataConn   = errors.New("use PORT or PASV first")
+	errForeignAddr  = errors.New("data connection must be to or from the client's address")
+)
+
+// conn is a single FTP control connection
+type conn struct {
+	s          *server
+	ctrl       net.Conn
+	r          *bufio.Scanner
+	w          *bufio.Writer
+	remoteIP   net.IP
+	user       string       // user from USER
+	loggedIn   bool         // set once PASS succeeds
+	cwd        string       // current working directory - always absolute
+	restart    int64        // offset from REST for the next RETR
+	renameFrom string       // path from RNFR for the next RNTO
+	pasv       net.Listener // listener from PASV or EPSV
+	activeAddr string       // address from PORT or EPRT
+	quit       bool         // set when the connection should be closed
+}
+
+func newConn(s *server, ctrl net.Conn) *conn {
+	c := &conn{
+		s:    s,
+		ctrl: ctrl,
+		r:    bufio.NewScanner(ctrl),
+		w:    bufio.NewWriter(ctrl),
+		cwd:  "/",
+	}
+	if addr, ok := ctrl.RemoteAddr().(*net.TCPAddr); ok {
+		c.remoteIP = addr.IP
+	}
+	return c
+}
+
+// String converts it to printable
+func (c *conn) String() string {
+	return c.ctrl.RemoteAddr().String()
+}
+
+// command describes an FTP command
+type command struct {
+	fn        func(c *conn, arg string)
+	needLogin bool // set if the user must be logged in to use it
+}
+
+// commands is all the FTP commands which are supported
+var commands = map[string]command{
+	"ABOR": {(*conn).cmdAbor, false},
+	"ALLO": {(*conn).cmdAllo, false},
+	"CDUP": {(*conn).cmdCdup, true},
+	"CWD":  {(*conn).cmdCwd, true},
+	"DELE": {(*conn).cmdDele, true},
+	"EPRT": {(*conn).cmdEprt, true},
+	"EPSV": {(*conn).cmdEpsv, true},
+	"FEAT": {(*conn).cmdFeat, false},
+	"LIST": {(*conn).cmdList, true},
+	"MDTM": {(*conn).cmdMdtm, true},
+	"MKD":  {(*conn).cmdMkd, true},
+	"MLSD": {(*conn).cmdMlsd, true},
+	"MLST": {(*conn).cmdMlst, true},
+	"MODE": {(*conn).cmdMode, false},
+	"NLST": {(*conn).cmdNlst, true},
+	"NOOP": {(*conn).cmdNoop, false},
+	"OPTS": {(*conn).cmdOpts, false},
+	"PASS": {(*conn).cmdPass, false},
+	"PASV": {(*conn).cmdPasv, true},
+	"PORT": {(*conn).cmdPort, true},
+	"PWD":  {(*conn).cmdPwd, true},
+	"QUIT": {(*conn).cmdQuit, false},
+	"REST": {(*conn).cmdRest, true},
+	"RETR": {(*conn).cmdRetr, true},
+	"RMD":  {(*conn).cmdRmd, true},
+	"RNFR": {(*conn).cmdRnfr, true},
+	"RNTO": {(*conn).cmdRnto, true},
+	"SIZE": {(*conn).cmdSize, true},
+	"STOR": {(*conn).cmdStor, true},
+	"STRU": {(*conn).cmdStru, false},
+	"SYST": {(*conn).cmdSyst, false},
+	"TYPE": {(*conn).cmdType, false},
+	"USER": {(*conn).cmdUser, false},
+	"XCUP": {(*conn).cmdCdup, true},
+	"XCWD": {(*conn).cmdCwd, true},
+	"XMKD": {(*conn).cmdMkd, true},
+	"XPWD": {(*conn).cmdPwd, true},
+	"XRMD": {(*conn).cmdRmd, true},
+}
+
+// serve reads commands from the control connection until the client
+// quits or the connection is closed
+func (c *conn) serve() {
+	fs.Infof(c, "FTP connection opened")
+	defer fs.Infof(c, "FTP connection closed")
+	defer c.close()
+	c.reply(220, "Welcome to rclone %s FTP server", fs.Version)
+	for !c.quit && c.r.Scan() {
+		line := strings.TrimRight(c.r.Text(), "\r")
+		name, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			name, arg = line[:i], line[i+1:]
+		}
+		name = strings.ToUpper(name)
+		if name == "PASS" {
+			fs.Debugf(c, "> PASS XXXX")
+		} else {
+			fs.Debugf(c, "> %s", line)
+		}
+		cmd, ok := commands[name]
+		switch {
+		case !ok:
+			c.reply(502, "Command %q not implemented", name)
+		case cmd.needLogin && !c.loggedIn:
+			c.reply(530, "Not logged in")
+		default:
+			cmd.fn(c, arg)
+		}
+		// REST and RNFR only apply to the command which follows
+		if name != "REST" {
+			c.restart = 0
+		}
+		if name != "RNFR" {
+			c.renameFrom = ""
+		}
+	}
+	if err := c.r.Err(); err != nil {
+		fs.Debugf(c, "Error reading FTP command: %v", err)
+	}
+}
+
+// close the control connection and any passive listener
+func (c *conn) close() {
+	c.closePassive()
+	_ = c.ctrl.Close()
+}
+
+// reply sends a single line reply to the client
+func (c *conn) reply(code int, format string, args ...interface{}) {
+	c.replyLines(code, fmt.Sprintf(format, args...), nil, "")
+}
+
+// replyLines sends a multi-line reply to the client.  Each of lines
+// is sent indented with a space between first and last.
+func (c *conn) replyLines(code int, first string, lines []string, last string) {
+	if len(lines) == 0 && last == "" {
+		fs.Debugf(c, "< %d %s", code, first)
+		_, _ = fmt.Fprintf(c.w, "%d %s\r\n", code, first)
+	} else {
+		fs.Debugf(c, "< %d-%s", code, first)
+		_, _ = fmt.Fprintf(c.w, "%d-%s\r\n", code, first)
+		for _, line := range lines {
+			_, _ = fmt.Fprintf(c.w, " %s\r\n", line)
+		}
+		_, _ = fmt.Fprintf(c.w, "%d %s\r\n", code, last)
+	}
+	err := c.w.Flush()
+	if err != nil {
+		fs.Debugf(c, "Error writing FTP reply: %v", err)
+	}
+}
+
+// replyError sends the error as a 550 reply
+func (c *conn) replyError(what string, err error) {
+	fs.Infof(c, "%s failed: %v", what, err)
+	c.reply(550, "%s failed: %v", what, err)
+}
+
+// absPath converts arg into a cleaned absolute path using the
+// current directory
+func (c *conn) absPath(arg string) string {
+	if !strings.HasPrefix(arg, "/") {
+		arg = path.Join(c.cwd, arg)
+	}
+	return path.Clean("/" + arg)
+}
+
+// lookup finds the node at the absolute path p
+func (c *conn) lookup(p string) (mountlib.Node, error) {
+	return c.s.fs.Lookup(strings.TrimPrefix(p, "/"))
+}
+
+// lookupParent finds the parent directory of the absolute path p
+// and returns it with the leaf name
+func (c *conn) lookupParent(p string) (*mountlib.Dir, string, error) {
+	dirPath, leaf := path.Split(p)
+	if leaf == "" {
+		return nil, "", errors.New("can't use the root directory")
+	}
+	node, err := c.lookup(dirPath)
+	if err != nil {
+		return nil, "", err
+	}
+	dir, ok := node.(*mountlib.Dir)
+	if !ok {
+		return nil, "", errNotDirectory
+	}
+	return dir, leaf, nil
+}
+
+// lookupFile finds the file at the absolute path p
+func (c *conn) lookupFile(p string) (*mountlib.File, error) {
+	node, err := c.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	file, ok := node.(*mountlib.File)
+	if !ok {
+		return nil, errIsDirectory
+	}
+	return file, nil
+}
+
+// quote quotes a path for a 257 reply as described in RFC 959
+func quote(p string) string {
+	return `"` + strings.Replace(p, `"`, `""`, -1) + `"`
+}
+
+// ------------------------------------------------------------
+// Login and session commands
+
+func (c *conn) cmdUser(arg string) {
+	c.user = arg
+	c.loggedIn = false
+	c.reply(331, "Password required for %s", arg)
+}
+
+func (c *conn) cmdPass(arg string) {
+	if c.user == "" {
+		c.reply(503, "Send USER first")
+		return
+	}
+	opt := &c.s.opt
+	if subtle.ConstantTimeCompare([]byte(c.user), []byte(opt.BasicUser)) != 1 ||
+		(opt.BasicPass != "" && subtle.ConstantTimeCompare([]byte(arg), []byte(opt.BasicPass)) != 1) {
+		fs.Infof(c, "Login failed for %q", c.user)
+		c.reply(530, "Login incorrect")
+		return
+	}
+	c.loggedIn = true
+	fs.Infof(c, "Logged in as %q", c.user)
+	c.reply(230, "User %s logged in", c.user)
+}
+
+func (c *conn) cmdQuit(arg string) {
+	c.reply(221, "Goodbye")
+	c.quit = true
+}
+
+func (c *conn) cmdNoop(arg string) {
+	c.reply(200, "OK")
+}
+
+func (c *conn) cmdSyst(arg string) {
+	c.reply(215, "UNIX Type: L8")
+}
+
+func (c *conn) cmdFeat(arg string) {
+	c.replyLines(211, "Features:", []string{
+		"EPRT",
+		"EPSV",
+		"MDTM",
+		"MLST type*;size*;modify*;",
+		"PASV",
+		"REST STREAM",
+		"SIZE",
+		"UTF8",
+	}, "End")
+}
+
+func (c *conn) cmdOpts(arg string) {
+	if strings.ToUpper(arg) == "UTF8 ON" {
+		c.reply(200, "UTF8 mode enabled")
+		return
+	}
+	c.reply(501, "Option %q not understood", arg)
+}
+
+func (c *conn) cmdType(arg string) {
+	switch strings.ToUpper(arg) {
+	case "I", "L 8", "A", "A N":
+		// Everything is transferred in binary
+		c.reply(200, "Type set to %s", arg)
+	default:
+		c.reply(504, "Type %q not supported", arg)
+	}
+}
+
+func (c *conn) cmdMode(arg string) {
+	if strings.ToUpper(arg) != "S" {
+		c.reply(504, "Only stream mode is supported")
+		return
+	}
+	c.reply(200, "Mode set to S")
+}
+
+func (c *conn) cmdStru(arg string) {
+	if strings.ToUpper(arg) != "F" {
+		c.reply(504, "Only file structure is supported")
+		return
+	}
+	c.reply(200, "Structure set to F")
+}
+
+func (c *conn) cmdAllo(arg string) {
+	c.reply(202, "No storage allocation necessary")
+}
+
+func (c *conn) cmdAbor(arg string) {
+	c.reply(225, "No transfer to abort")
+}
+
+// ------------------------------------------------------------
+// Directory navigation
+
+func (c *conn) cmdPwd(arg string) {
+	c.reply(257, "%s is the current directory", quote(c.cwd))
+}
+
+func (c *conn) cmdCwd(arg string) {
+	p := c.absPath(arg)
+	node, err := c.lookup(p)
+	if err == nil && node.IsFile() {
+		err = errNotDirectory
+	}
+	if err != nil {
+		c.replyError("CWD", err)
+		return
+	}
+	c.cwd = p
+	c.reply(250, "Directory changed to %s", p)
+}
+
+func (c *conn) cmdCdup(arg string) {
+	c.cmdCwd("..")
+}
+
+// ------------------------------------------------------------
+// Data connections
+
+// closePassive closes any open passive listener
+func (c *conn) closePassive() {
+	if c.pasv != nil {
+		_ = c.pasv.Close()
+		c.pasv = nil
+	}
+}
+
+// listenPassive opens a listener for a passive data connection on the
+// address the client connected to using a port from the configured
+// range
+func (c *conn) listenPassive() (net.Listener, error) {
+	c.closePassive()
+	c.activeAddr = ""
+	host, _, err := net.SplitHostPort(c.ctrl.LocalAddr().String())
+	if err != nil {
+		return nil, err
+	}
+	min, max := c.s.pasvMin, c.s.pasvMax
+	if min == 0 {
+		return net.Listen("tcp", net.JoinHostPort(host, "0"))
+	}
+	// Try every port in the range starting at a random one
+	n := max - min + 1
+	start := rand.Intn(n)
+	for i := 0; i < n; i++ {
+		port := min + (start+i)%n
+		ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err == nil {
+			return ln, nil
+		}
+	}
+	return nil, errors.Errorf("no free passive ports in range %d-%d", min, max)
+}
+
+func (c *conn) cmdPasv(arg string) {
+	ip := net.ParseIP(c.s.opt.PublicIP)
+	if ip == nil {
+		if addr, ok := c.ctrl.LocalAddr().(*net.TCPAddr); ok {
+			ip = addr.IP
+		}
+	}
+	ip = ip.To4()
+	if ip == nil {
+		c.reply(425, "Can't use PASV over IPv6 - use EPSV")
+		return
+	}
+	ln, err := c.listenPassive()
+	if err != nil {
+		c.reply(425, "Can't open passive connection: %v", err)
+		return
+	}
+	c.pasv = ln
+	port := ln.Addr().(*net.TCPAddr).Port
+	c.reply(227, "Entering Passive Mode (%d,%d,%d,%d,%d,%d)", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xFF)
+}
+
+func (c *conn) cmdEpsv(arg string) {
+	if strings.ToUpper(arg) == "ALL" {
+		c.reply(200, "EPSV ALL OK")
+		return
+	}
+	ln, err := c.listenPassive()
+	if err != nil {
+		c.reply(425, "Can't open passive connection: %v", err)
+		return
+	}
+	c.pasv = ln
+	c.reply(229, "Entering Extended Passive Mode (|||%d|)", ln.Addr().(*net.TCPAddr).Port)
+}
+
+// setActive sets the address for an active data connection checking
+// that it is the client's own address
+func (c *conn) setActive(ip net.IP, port int) {
+	if ip == nil || port <= 0 || port > 65535 {
+		c.reply(501, "Bad address")
+		return
+	}
+	if !ip.Equal(c.remoteIP) {
+		fs.Infof(c, "Refusing data connection to %v", ip)
+		c.reply(504, "Data connection must be to the client's address")
+		return
+	}
+	c.closePassive()
+	c.activeAddr = net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	c.reply(200, "Active data connection to %s", c.activeAddr)
+}
+
+func (c *conn) cmdPort(arg string) {
+	parts := strings.Split(arg, ",")
+	if len(parts) != 6 {
+		c.reply(501, "Bad PORT %q", arg)
+		return
+	}
+	var bytes [6]byte
+	for i, part := range parts {
+		n, err := strconv.ParseUint(strings.TrimSpace(part), 10, 8)
+		if err != nil {
+			c.reply(501, "Bad PORT %q", arg)
+			return
+		}
+		bytes[i] = byte(n)
+	}
+	c.setActive(net.IPv4(bytes[0], bytes[1], bytes[2], bytes[3]), int(bytes[4])<<8|int(bytes[5]))
+}
+
+func (c *conn) cmdEprt(arg string) {
+	// arg looks like |1|132.235.1.2|6275|
+	if len(arg) < 2 {
+		c.reply(501, "Bad EPRT %q", arg)
+		return
+	}
+	parts := strings.Split(arg, arg[:1])
+	if len(parts) != 5 {
+		c.reply(501, "Bad EPRT %q", arg)
+		return
+	}
+	port, err := strconv.Atoi(parts[3])
+	if err != nil {
+		c.reply(501, "Bad EPRT %q", arg)
+		return
+	}
+	c.setActive(net.ParseIP(parts[2]), port)
+}
+
+// openData opens the data connection set up with PASV, EPSV, PORT or
+// EPRT
+func (c *conn) openData() (net.Conn, error) {
+	if c.pasv != nil {
+		ln := c.pasv
+		c.pasv = nil
+		defer func() {
+			_ = ln.Close()
+		}()
+		if tcpLn, ok := ln.(*net.TCPListener); ok {
+			_ = tcpLn.SetDeadline(time.Now().Add(dataTimeout))
+		}
+		dataConn, err := ln.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if addr, ok := dataConn.RemoteAddr().(*net.TCPAddr); !ok || !addr.IP.Equal(c.remoteIP) {
+			_ = dataConn.Close()
+			return nil, errForeignAddr
+		}
+		return dataConn, nil
+	}
+	if c.activeAddr != "" {
+		addr := c.activeAddr
+		c.activeAddr = ""
+		return net.DialTimeout("tcp", addr, dataTimeout)
+	}
+	return nil, errNoDataConn
+}
+
+// transfer opens the data connection and calls fn with it, replying
+// to the client with the result
+func (c *conn) transfer(fn func(dataConn net.Conn) error) {
+	c.reply(150, "Opening data connection")
+	dataConn, err := c.openData()
+	if err != nil {
+		fs.Infof(c, "Failed to open data connection: %v", err)
+		c.reply(425, "Can't open data connection: %v", err)
+		return
+	}
+	err = fn(dataConn)
+	closeErr := dataConn.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fs.Infof(c, "Transfer failed: %v", err)
+		c.reply(451, "Transfer failed: %v", err)
+		return
+	}
+	c.reply(226, "Transfer complete")
+}
+
+// ------------------------------------------------------------
+// Listings
+
+// fileInfo describes an entry in a listing
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+// nodeInfo returns the fileInfo for node which is called name
+func nodeInfo(name string, node mountlib.Node) (fileInfo, error) {
+	switch x := node.(type) {
+	case *mountlib.Dir:
+		return fileInfo{name: name, modTime: x.ModTime(), isDir: true}, nil
+	case *mountlib.File:
+		modTime, size, _, err := x.Attr(mountlib.NoModTime)
+		if err != nil {
+			return fileInfo{}, err
+		}
+		return fileInfo{name: name, size: int64(size), modTime: modTime}, nil
+	}
+	return fileInfo{}, errors.Errorf("unknown node type %T", node)
+}
+
+// byName sorts a []fileInfo by name
+type byName []fileInfo
+
+func (fis byName) Len() int           { return len(fis) }
+func (fis byName) Swap(i, j int)      { fis[i], fis[j] = fis[j], fis[i] }
+func (fis byName) Less(i, j int) bool { return fis[i].name < fis[j].name }
+
+// list returns the entries for the absolute path p which may be a
+// directory or a file
+func (c *conn) list(p string) ([]fileInfo, error) {
+	node, err := c.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := node.(*mountlib.Dir)
+	if !ok {
+		fi, err := nodeInfo(path.Base(p), node)
+		if err != nil {
+			return nil, err
+		}
+		return []fileInfo{fi}, nil
+	}
+	items, err := dir.ReadDirAll()
+	if err != nil {
+		return nil, err
+	}
+	fis := make([]fileInfo, 0, len(items))
+	for _, item := range items {
+		leaf := path.Base(item.Obj.Remote())
+		node, err := dir.Lookup(leaf)
+		if err != nil {
+			return nil, err
+		}
+		fi, err := nodeInfo(leaf, node)
+		if err != nil {
+			return nil, err
+		}
+		fis = append(fis, fi)
+	}
+	sort.Sort(byName(fis))
+	return fis, nil
+}
+
+// lsLine formats fi like a line of "ls -l" output
+func lsLine(fi fileInfo, now time.Time) string {
+	mode := mountlib.FilePerms
+	if fi.isDir {
+		mode = os.ModeDir | mountlib.DirPerms
+	}
+	modTime := fi.modTime.UTC()
+	timeFormat := "Jan _2  2006"
+	if modTime.Year() == now.Year() {
+		timeFormat = "Jan _2 15:04"
+	}
+	return fmt.Sprintf("%s 1 rclone rclone %12d %s %s", mode, fi.size, modTime.Format(timeFormat), fi.name)
+}
+
+// factsLine formats fi as the facts from RFC 3659 used by MLSD and
+// MLST
+func factsLine(fi fileInfo, name string) string {
+	modify := fi.modTime.UTC().Format("20060102150405")
+	if fi.isDir {
+		return fmt.Sprintf("type=dir;modify=%s; %s", modify, name)
+	}
+	return fmt.Sprintf("type=file;size=%d;modify=%s; %s", fi.size, modify, name)
+}
+
+// listArg removes any "ls" style options from a LIST or NLST argument
+func listArg(arg string) string {
+	for strings.HasPrefix(arg, "-") {
+		i := strings.IndexByte(arg, ' ')
+		if i < 0 {
+			return ""
+		}
+		arg = strings.TrimLeft(arg[i+1:], " ")
+	}
+	return arg
+}
+
+// sendListing lists the path in arg sending one line per entry as
+// formatted by format
+func (c *conn) sendListing(what, arg string, format func(fi fileInfo) string) {
+	fis, err := c.list(c.absPath(arg))
+	if err != nil {
+		c.replyError(what, err)
+		return
+	}
+	c.transfer(func(dataConn net.Conn) error {
+		w := bufio.NewWriter(dataConn)
+		for _, fi := range fis {
+			_, err := fmt.Fprintf(w, "%s\r\n", format(fi))
+			if err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	})
+}
+
+func (c *conn) cmdList(arg string) {
+	now := time.Now()
+	c.sendListing("LIST", listArg(arg), func(fi fileInfo) string {
+		return lsLine(fi, now)
+	})
+}
+
+func (c *conn) cmdNlst(arg string) {
+	c.sendListing("NLST", listArg(arg), func(fi fileInfo) string {
+		return fi.name
+	})
+}
+
+func (c *conn) cmdMlsd(arg string) {
+	c.sendListing("MLSD", arg, func(fi fileInfo) string {
+		return factsLine(fi, fi.name)
+	})
+}
+
+func (c *conn) cmdMlst(arg string) {
+	p := c.absPath(arg)
+	node, err := c.lookup(p)
+	if err != nil {
+		c.replyError("MLST", err)
+		return
+	}
+	fi, err := nodeInfo(path.Base(p), node)
+	if err != nil {
+		c.replyError("MLST", err)
+		return
+	}
+	c.replyLines(250, "Listing "+p, []string{factsLine(fi, p)}, "End")
+}
+
+func (c *conn) cmdSize(arg string) {
+	file, err := c.lookupFile(c.absPath(arg))
+	if err != nil {
+		c.replyError("SIZE", err)
+		return
+	}
+	_, size, _, err := file.Attr(true)
+	if err != nil {
+		c.replyError("SIZE", err)
+		return
+	}
+	c.reply(213, "%d", size)
+}
+
+func (c *conn) cmdMdtm(arg string) {
+	file, err := c.lookupFile(c.absPath(arg))
+	if err != nil {
+		c.replyError("MDTM", err)
+		return
+	}
+	modTime, _, _, err := file.Attr(mountlib.NoModTime)
+	if err != nil {
+		c.replyError("MDTM", err)
+		return
+	}
+	c.reply(213, "%s", modTime.UTC().Format("20060102150405"))
+}
+
+// ------------------------------------------------------------
+// Transfers
+
+func (c *conn) cmdRest(arg string) {
+	offset, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || offset < 0 {
+		c.reply(501, "Bad REST offset %q", arg)
+		return
+	}
+	c.restart = offset
+	c.reply(350, "Restarting at %d. Send RETR to start transfer", offset)
+}
+
+func (c *conn) cmdRetr(arg string) {
+	p := c.absPath(arg)
+	remote := strings.TrimPrefix(p, "/")
+	file, err := c.lookupFile(p)
+	if err != nil {
+		c.replyError("RETR", err)
+		return
+	}
+	obj, err := file.Object()
+	if err != nil {
+		c.replyError("RETR", err)
+		return
+	}
+	offset := c.restart
+	size := obj.Size()
+	if size >= 0 && offset > size {
+		c.reply(554, "REST offset %d is beyond the end of the file", offset)
+		return
+	}
+	var options []fs.OpenOption
+	if offset > 0 {
+		options = append(options, &fs.SeekOption{Offset: offset})
+	}
+	in, err := obj.Open(options...)
+	if err != nil {
+		c.replyError("RETR", err)
+		return
+	}
+	if size >= 0 {
+		size -= offset
+	}
+	fs.Stats.Transferring(remote)
+	acc := fs.NewAccountSizeName(in, size, remote)
+	fs.Infof(remote, "%s: Serving file from offset %d", c, offset)
+	c.transfer(func(dataConn net.Conn) error {
+		_, err := io.Copy(dataConn, acc)
+		return err
+	})
+	closeErr := acc.Close()
+	if closeErr != nil {
+		fs.Errorf(remote, "Failed to close file: %v", closeErr)
+	}
+	fs.Stats.DoneTransferring(remote, true)
+}
+
+func (c *conn) cmdStor(arg string) {
+	if c.restart != 0 {
+		c.reply(554, "Resuming uploads is not supported")
+		return
+	}
+	p := c.absPath(arg)
+	dir, leaf, err := c.lookupParent(p)
+	if err != nil {
+		c.replyError("STOR", err)
+		return
+	}
+	// Check the destination before opening the data connection but
+	// only open it for write once the data connection is open so
+	// the handle can't be left open if that fails
+	var file *mountlib.File
+	node, err := dir.Lookup(leaf)
+	switch {
+	case err == mountlib.ENOENT:
+		err = nil
+	case err != nil:
+	case node.IsFile():
+		file = node.(*mountlib.File)
+	default:
+		err = errIsDirectory
+	}
+	if err != nil {
+		c.replyError("STOR", err)
+		return
+	}
+	fs.Infof(p, "%s: Receiving file", c)
+	c.transfer(func(dataConn net.Conn) (err error) {
+		// Upload over an existing file under a temporary name if
+		// it can be renamed afterwards so a failed upload leaves
+		// the old file alone
+		name := leaf
+		var fh *mountlib.WriteFileHandle
+		switch {
+		case file == nil:
+			_, fh, err = dir.Create(leaf)
+		case c.s.f.Features().Move != nil:
+			name = fmt.Sprintf(".%s.%08x.partial", leaf, rand.Uint32())
+			_, fh, err = dir.Create(name)
+		default:
+			fh, err = file.OpenWrite()
+		}
+		if err != nil {
+			return err
+		}
+		buf := make([]byte, 64*1024)
+		var readErr error
+		for readErr == nil {
+			var n int
+			n, readErr = dataConn.Read(buf)
+			if n > 0 {
+				_, err := fh.Write(buf[:n], fh.Offset())
+				if err != nil {
+					fh.Abort(err)
+					return err
+				}
+			}
+		}
+		if readErr != io.EOF {
+			fh.Abort(readErr)
+			return readErr
+		}
+		err = fh.Release()
+		if err != nil || name == leaf {
+			return err
+		}
+		err = dir.Rename(name, leaf, dir)
+		if err != nil {
+			_ = dir.Remove(name)
+		}
+		return err
+	})
+}
+
+// ------------------------------------------------------------
+// File and directory manipulation
+
+func (c *conn) cmdDele(arg string) {
+	p := c.absPath(arg)
+	dir, leaf, err := c.lookupParent(p)
+	if err == nil {
+		_, err = c.lookupFile(p)
+	}
+	if err == nil {
+		err = dir.Remove(leaf)
+	}
+	if err != nil {
+		c.replyError("DELE", err)
+		return
+	}
+	c.reply(250, "Deleted %s", p)
+}
+
+func (c *conn) cmdMkd(arg string) {
+	p := c.absPath(arg)
+	dir, leaf, err := c.lookupParent(p)
+	if err == nil {
+		_, err = dir.Lookup(leaf)
+		if err == nil {
+			err = mountlib.EEXIST
+		} else if err == mountlib.ENOENT {
+			_, err = dir.Mkdir(leaf)
+		}
+	}
+	if err != nil {
+		c.replyError("MKD", err)
+		return
+	}
+	c.reply(257, "%s created", quote(p))
+}
+
+func (c *conn) cmdRmd(arg string) {
+	p := c.absPath(arg)
+	dir, leaf, err := c.lookupParent(p)
+	if err == nil {
+		var node mountlib.Node
+		node, err = dir.Lookup(leaf)
+		if err == nil && node.IsFile() {
+			err = errNotDirectory
+		}
+	}
+	if err == nil {
+		err = dir.Remove(leaf)
+	}
+	if err != nil {
+		c.replyError("RMD", err)
+		return
+	}
+	c.reply(250, "Removed %s", p)
+}
+
+func (c *conn) cmdRnfr(arg string) {
+	p := c.absPath(arg)
+	_, err := c.lookup(p)
+	if err != nil {
+		c.replyError("RNFR", err)
+		return
+	}
+	c.renameFrom = p
+	c.reply(350, "Ready for RNTO")
+}
+
+func (c *conn) cmdRnto(arg string) {
+	if c.renameFrom == "" {
+		c.reply(503, "Send RNFR first")
+		return
+	}
+	oldDir, oldLeaf, err := c.lookupParent(c.renameFrom)
+	if err != nil {
+		c.replyError("RNTO", err)
+		return
+	}
+	newDir, newLeaf, err := c.lookupParent(c.absPath(arg))
+	if err != nil {
+		c.replyError("RNTO", err)
+		return
+	}
+	err = oldDir.Rename(oldLeaf, newLeaf, newDir)
+	if err != nil {
+		c.replyError("RNTO", err)
+		return
+	}
+	c.reply(250, "Renamed %s", c.renameFrom)
+}
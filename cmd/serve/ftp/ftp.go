@@ -0,0 +1,239 @@
+// Package ftp implements an FTP server for rclone
+package ftp
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/cmd/mountlib"
+	"github.com/ncw/rclone/cmd/serve"
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Options contains options for the FTP server
+type Options struct {
+	ListenAddr   string // Port to listen on
+	PublicIP     string // IP address to advertise for passive connections
+	PassivePorts string // Range of ports to use for passive connections
+	BasicUser    string // single username for authentication
+	BasicPass    string // password for BasicUser - any password is accepted if empty
+}
+
+// DefaultOpt is the default values used for Options
+var DefaultOpt = Options{
+	ListenAddr:   "localhost:2121",
+	PassivePorts: "30000-32000",
+	BasicUser:    "anonymous",
+}
+
+// Globals
+var (
+	opt = DefaultOpt
+)
+
+// AddFlags adds flags for the FTP server to the flagSet storing them
+// in opt
+func AddFlags(flags *pflag.FlagSet, opt *Options) {
+	flags.StringVarP(&opt.ListenAddr, "addr", "", opt.ListenAddr, "IPaddress:Port or :Port to bind server to.")
+	flags.StringVarP(&opt.PublicIP, "public-ip", "", opt.PublicIP, "Public IP address to advertise for passive connections.")
+	flags.StringVarP(&opt.PassivePorts, "passive-port", "", opt.PassivePorts, "Passive port range to use.")
+	flags.StringVarP(&opt.BasicUser, "user", "", opt.BasicUser, "User name for authentication.")
+	flags.StringVarP(&opt.BasicPass, "pass", "", opt.BasicPass, "Password for authentication. (empty value allow every password)")
+}
+
+func init() {
+	AddFlags(Command.Flags(), &opt)
+	mountlib.AddFlags(Command.Flags())
+	serve.Command.AddCommand(Command)
+}
+
+// Command definition for cobra
+var Command = &cobra.Command{
+	Use:   "ftp remote:path",
+	Short: `Serve remote:path over FTP.`,
+	Long: `rclone serve ftp implements a basic FTP server to serve the remote
+over the FTP protocol.  This can be used by FTP clients or you can
+make a remote of type ftp to read and write it.
+
+The server supports reading and writing unless --read-only is set.
+Files are streamed to the remote as they are uploaded so, as with
+rclone mount, they are always written from the start - REST can be
+used to resume downloads but not uploads.
+
+Transfers are always done in binary mode even if the client asks for
+ASCII.
+
+### Server options
+
+Use --addr to specify which IP address and port the server should
+listen on, eg --addr 1.2.3.4:8000 or --addr :8080 to listen to all
+IPs.  By default it only listens on localhost.
+
+Passive mode data connections are made to a port in the range given
+by --passive-port, eg --passive-port 30000-32000.  Use 0 to let the
+operating system choose.  The address advertised to clients in
+response to PASV is the address the client connected to, or
+--public-ip if set which is useful behind NAT.
+
+Active mode (PORT and EPRT) is supported but the data connection may
+only be made to the client's own IP address.
+
+#### Authentication
+
+By default this will serve files to the user "anonymous" with any
+password.  Use --user and --pass to set the single username and
+password.  If --pass is empty then any password is accepted.
+
+### Directory Cache
+
+Directory listings are cached in the same way as they are for rclone
+mount.  Use --dir-cache-time to control how long a directory listing
+is considered valid, and --poll-interval to control how often the
+remote is polled for changes on remotes which support it.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cmd.NewFsSrc(args)
+		cmd.Run(false, true, command, func() error {
+			s, err := newServer(f, &opt)
+			if err != nil {
+				return err
+			}
+			err = s.Serve()
+			if err != nil {
+				return err
+			}
+			s.Wait()
+			return nil
+		})
+	},
+}
+
+// server contains everything to run the server
+type server struct {
+	f        fs.Fs
+	fs       *mountlib.FS
+	opt      Options
+	pasvMin  int // lowest passive port or 0 for any
+	pasvMax  int // highest passive port
+	listener net.Listener
+	waitChan chan struct{}  // for waiting on the listener to close
+	wg       sync.WaitGroup // for waiting on the connections to close
+	mu       sync.Mutex     // protects the following
+	conns    map[*conn]struct{}
+}
+
+// parsePortRange parses a port range like "30000-32000" returning
+// the lowest and highest port.  "0" or "" mean any port and return 0, 0.
+func parsePortRange(portRange string) (min, max int, err error) {
+	portRange = strings.TrimSpace(portRange)
+	if portRange == "" || portRange == "0" {
+		return 0, 0, nil
+	}
+	parts := strings.SplitN(portRange, "-", 2)
+	min, err = strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, errors.Errorf("bad port range %q", portRange)
+	}
+	max = min
+	if len(parts) == 2 {
+		max, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return 0, 0, errors.Errorf("bad port range %q", portRange)
+		}
+	}
+	if min <= 0 || max > 65535 || min > max {
+		return 0, 0, errors.Errorf("bad port range %q", portRange)
+	}
+	return min, max, nil
+}
+
+func newServer(f fs.Fs, opt *Options) (*server, error) {
+	s := &server{
+		f:     f,
+		fs:    mountlib.NewFS(f),
+		opt:   *opt,
+		conns: make(map[*conn]struct{}),
+	}
+	var err error
+	s.pasvMin, s.pasvMax, err = parsePortRange(opt.PassivePorts)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid --passive-port")
+	}
+	if opt.PublicIP != "" && net.ParseIP(opt.PublicIP).To4() == nil {
+		return nil, errors.Errorf("invalid --public-ip %q - must be an IPv4 address", opt.PublicIP)
+	}
+	return s, nil
+}
+
+// Serve runs the FTP server - doesn't block
+func (s *server) Serve() error {
+	ln, err := net.Listen("tcp", s.opt.ListenAddr)
+	if err != nil {
+		return errors.Wrap(err, "start server failed")
+	}
+	s.listener = ln
+	s.waitChan = make(chan struct{})
+	go func() {
+		defer close(s.waitChan)
+		for {
+			netConn, err := ln.Accept()
+			if err != nil {
+				fs.Debugf(nil, "Error on accepting FTP connection: %v", err)
+				return
+			}
+			c := newConn(s, netConn)
+			s.mu.Lock()
+			s.conns[c] = struct{}{}
+			s.mu.Unlock()
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				c.serve()
+				s.mu.Lock()
+				delete(s.conns, c)
+				s.mu.Unlock()
+			}()
+		}
+	}()
+	fs.Logf(s.f, "FTP Server started on %s", s.URL())
+	return nil
+}
+
+// Wait blocks while the listener is open.
+func (s *server) Wait() {
+	<-s.waitChan
+}
+
+// Close shuts the running server down along with any open
+// connections
+func (s *server) Close() {
+	err := s.listener.Close()
+	if err != nil {
+		fs.Errorf(nil, "Error on closing FTP server: %v", err)
+		return
+	}
+	<-s.waitChan
+	s.mu.Lock()
+	for c := range s.conns {
+		_ = c.ctrl.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// URL returns the serving address of this server
+func (s *server) URL() string {
+	addr := s.opt.ListenAddr
+	if s.listener != nil {
+		addr = s.listener.Addr().String()
+	}
+	return fmt.Sprintf("ftp://%s/", addr)
+}
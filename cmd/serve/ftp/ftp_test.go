@@ -0,0 +1,350 @@
+package ftp
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/ncw/rclone/cmd/mountlib"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	_ "github.com/ncw/rclone/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startServer makes a local directory with some files in and serves
+// it returning the server, the directory and a function to tidy up
+func startServer(t *testing.T, opt *Options) (*server, string, func()) {
+	fstest.Initialise()
+	dir, err := ioutil.TempDir("", "rclone-serve-ftp-test")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub dir"), 0777))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "one.txt"), []byte("0123456789"), 0666))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sub dir", "two.txt"), []byte("hello"), 0666))
+
+	f, err := fs.NewFs(dir)
+	require.NoError(t, err)
+
+	s, err := newServer(f, opt)
+	require.NoError(t, err)
+	require.NoError(t, s.Serve())
+	return s, dir, func() {
+		s.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// defaultOpt returns the default options listening on a random port
+func defaultOpt() *Options {
+	opt := DefaultOpt
+	opt.ListenAddr = "localhost:0"
+	opt.PassivePorts = "0"
+	return &opt
+}
+
+// dial connects and logs in to the server
+func dial(t *testing.T, s *server, user, pass string) *ftp.ServerConn {
+	u, err := url.Parse(s.URL())
+	require.NoError(t, err)
+	c, err := ftp.DialTimeout(u.Host, 10*time.Second)
+	require.NoError(t, err)
+	require.NoError(t, c.Login(user, pass))
+	return c
+}
+
+// retr reads the file at path starting at offset
+func retr(t *testing.T, c *ftp.ServerConn, path string, offset uint64) string {
+	r, err := c.RetrFrom(path, offset)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	return string(data)
+}
+
+// contents returns the contents of the file at path in dir
+func contents(t *testing.T, dir, path string) string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+	require.NoError(t, err)
+	return string(data)
+}
+
+// exists returns whether path exists in dir
+func exists(dir, path string) bool {
+	_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path)))
+	return err == nil
+}
+
+func TestServeFTPRead(t *testing.T) {
+	s, _, cleanup := startServer(t, defaultOpt())
+	defer cleanup()
+	c := dial(t, s, "anonymous", "anything")
+	defer func() { _ = c.Quit() }()
+
+	// Listing - uses MLSD
+	entries, err := c.List("/")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "one.txt", entries[0].Name)
+	assert.Equal(t, ftp.EntryTypeFile, entries[0].Type)
+	assert.Equal(t, uint64(10), entries[0].Size)
+	assert.Equal(t, "sub dir", entries[1].Name)
+	assert.Equal(t, ftp.EntryTypeFolder, entries[1].Type)
+
+	names, err := c.NameList("-a sub dir")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"two.txt"}, names)
+
+	// Directory navigation
+	require.NoError(t, c.ChangeDir("sub dir"))
+	cwd, err := c.CurrentDir()
+	require.NoError(t, err)
+	assert.Equal(t, "/sub dir", cwd)
+	assert.Equal(t, "hello", retr(t, c, "two.txt", 0))
+	require.NoError(t, c.ChangeDirToParent())
+	cwd, err = c.CurrentDir()
+	require.NoError(t, err)
+	assert.Equal(t, "/", cwd)
+	assert.Error(t, c.ChangeDir("one.txt"))
+	assert.Error(t, c.ChangeDir("notfound"))
+
+	// Files
+	size, err := c.FileSize("one.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), size)
+	assert.Equal(t, "0123456789", retr(t, c, "one.txt", 0))
+	assert.Equal(t, "56789", retr(t, c, "/one.txt", 5))
+	assert.Equal(t, "", retr(t, c, "one.txt", 10))
+	_, err = c.Retr("notfound.txt")
+	assert.Error(t, err)
+	_, err = c.Retr("sub dir")
+	assert.Error(t, err)
+
+	// Check PASV works as well as EPSV
+	c.DisableEPSV = true
+	assert.Equal(t, "234", retr(t, c, "one.txt", 2)[:3])
+}
+
+func TestServeFTPWrite(t *testing.T) {
+	s, dir, cleanup := startServer(t, defaultOpt())
+	defer cleanup()
+	c := dial(t, s, "anonymous", "")
+	defer func() { _ = c.Quit() }()
+
+	// Upload then read back
+	require.NoError(t, c.Stor("new.txt", strings.NewReader("potato")))
+	assert.Equal(t, "potato", contents(t, dir, "new.txt"))
+	assert.Equal(t, "potato", retr(t, c, "new.txt", 0))
+
+	// Overwrite
+	require.NoError(t, c.Stor("new.txt", strings.NewReader("sausage")))
+	assert.Equal(t, "sausage", contents(t, dir, "new.txt"))
+
+	// Larger than one buffer
+	big := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+	require.NoError(t, c.Stor("sub dir/big.bin", bytes.NewReader(big)))
+	assert.Equal(t, string(big), contents(t, dir, "sub dir/big.bin"))
+
+	// Resuming uploads isn't supported
+	assert.Error(t, c.StorFrom("new.txt", strings.NewReader("xx"), 2))
+	assert.Equal(t, "sausage", contents(t, dir, "new.txt"))
+
+	// Directories
+	require.NoError(t, c.MakeDir("new dir"))
+	assert.True(t, exists(dir, "new dir"))
+	assert.Error(t, c.MakeDir("new dir"))
+	assert.Error(t, c.MakeDir("missing/dir"))
+
+	// Rename a file and a directory
+	require.NoError(t, c.Rename("new.txt", "new dir/moved.txt"))
+	assert.False(t, exists(dir, "new.txt"))
+	assert.Equal(t, "sausage", contents(t, dir, "new dir/moved.txt"))
+	require.NoError(t, c.Rename("/new dir", "/moved dir"))
+	assert.Equal(t, "sausage", contents(t, dir, "moved dir/moved.txt"))
+	assert.Error(t, c.Rename("notfound", "other"))
+
+	// Remove
+	assert.Error(t, c.RemoveDir("moved dir"))
+	assert.Error(t, c.Delete("moved dir"))
+	require.NoError(t, c.Delete("moved dir/moved.txt"))
+	assert.False(t, exists(dir, "moved dir/moved.txt"))
+	assert.Error(t, c.RemoveDir("one.txt"))
+	require.NoError(t, c.RemoveDir("moved dir"))
+	assert.False(t, exists(dir, "moved dir"))
+	assert.Error(t, c.Delete("notfound.txt"))
+}
+
+func TestServeFTPWriteNoDataConn(t *testing.T) {
+	s, dir, cleanup := startServer(t, defaultOpt())
+	defer cleanup()
+	u, err := url.Parse(s.URL())
+	require.NoError(t, err)
+	c, err := textproto.Dial("tcp", u.Host)
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+	cmd := func(expectCode int, format string, args ...interface{}) {
+		if format != "" {
+			_, err := c.Cmd(format, args...)
+			require.NoError(t, err)
+		}
+		_, _, err := c.ReadResponse(expectCode)
+		require.NoError(t, err)
+	}
+	cmd(220, "")
+	cmd(331, "USER anonymous")
+	cmd(230, "PASS anything")
+
+	// STOR without PASV or PORT can't open the data connection
+	// which must leave the files alone
+	for _, name := range []string{"one.txt", "new.txt"} {
+		cmd(150, "STOR %s", name)
+		cmd(425, "")
+	}
+	assert.Equal(t, "0123456789", contents(t, dir, "one.txt"))
+	assert.False(t, exists(dir, "new.txt"))
+	cmd(221, "QUIT")
+}
+
+func TestServeFTPWriteAborted(t *testing.T) {
+	s, dir, cleanup := startServer(t, defaultOpt())
+	defer cleanup()
+	u, err := url.Parse(s.URL())
+	require.NoError(t, err)
+	c, err := textproto.Dial("tcp", u.Host)
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+	cmd := func(expectCode int, format string, args ...interface{}) string {
+		if format != "" {
+			_, err := c.Cmd(format, args...)
+			require.NoError(t, err)
+		}
+		_, msg, err := c.ReadResponse(expectCode)
+		require.NoError(t, err)
+		return msg
+	}
+	cmd(220, "")
+	cmd(331, "USER anonymous")
+	cmd(230, "PASS anything")
+
+	// Reset the data connection part way through each upload which
+	// must fail the STOR without storing what was sent
+	for _, name := range []string{"one.txt", "new.txt"} {
+		msg := cmd(229, "EPSV")
+		var port int
+		_, err := fmt.Sscanf(msg[strings.Index(msg, "|||"):], "|||%d|)", &port)
+		require.NoError(t, err)
+		cmd(150, "STOR %s", name)
+		data, err := net.Dial("tcp", net.JoinHostPort(u.Hostname(), strconv.Itoa(port)))
+		require.NoError(t, err)
+		_, err = data.Write([]byte("partial"))
+		require.NoError(t, err)
+		time.Sleep(100 * time.Millisecond)
+		require.NoError(t, data.(*net.TCPConn).SetLinger(0))
+		require.NoError(t, data.Close())
+		cmd(451, "")
+	}
+	assert.Equal(t, "0123456789", contents(t, dir, "one.txt"))
+	assert.False(t, exists(dir, "new.txt"))
+	infos, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	for _, info := range infos {
+		assert.False(t, strings.HasSuffix(info.Name(), ".partial"), info.Name())
+	}
+	cmd(221, "QUIT")
+}
+
+func TestServeFTPReadOnly(t *testing.T) {
+	mountlib.ReadOnly = true
+	defer func() { mountlib.ReadOnly = false }()
+	s, dir, cleanup := startServer(t, defaultOpt())
+	defer cleanup()
+	c := dial(t, s, "anonymous", "")
+	defer func() { _ = c.Quit() }()
+
+	assert.Equal(t, "0123456789", retr(t, c, "one.txt", 0))
+	assert.Error(t, c.Stor("new.txt", strings.NewReader("potato")))
+	assert.False(t, exists(dir, "new.txt"))
+	assert.Error(t, c.MakeDir("new"))
+	assert.Error(t, c.Delete("one.txt"))
+	assert.Error(t, c.Rename("one.txt", "two.txt"))
+	assert.True(t, exists(dir, "one.txt"))
+}
+
+func TestServeFTPAuth(t *testing.T) {
+	opt := defaultOpt()
+	opt.BasicUser = "user"
+	opt.BasicPass = "pass"
+	s, _, cleanup := startServer(t, opt)
+	defer cleanup()
+	u, err := url.Parse(s.URL())
+	require.NoError(t, err)
+
+	c, err := ftp.DialTimeout(u.Host, 10*time.Second)
+	require.NoError(t, err)
+	assert.Error(t, c.Login("user", "wrong"))
+	assert.Error(t, c.Login("anonymous", "pass"))
+	_, err = c.List("/")
+	assert.Error(t, err)
+	require.NoError(t, c.Login("user", "pass"))
+	_, err = c.List("/")
+	assert.NoError(t, err)
+	require.NoError(t, c.Quit())
+}
+
+func TestParsePortRange(t *testing.T) {
+	for _, test := range []struct {
+		in       string
+		min, max int
+		err      bool
+	}{
+		{"", 0, 0, false},
+		{"0", 0, 0, false},
+		{"2000", 2000, 2000, false},
+		{"30000-32000", 30000, 32000, false},
+		{" 1 - 2 ", 1, 2, false},
+		{"2-1", 0, 0, true},
+		{"1-65536", 0, 0, true},
+		{"potato", 0, 0, true},
+		{"1-potato", 0, 0, true},
+	} {
+		min, max, err := parsePortRange(test.in)
+		assert.Equal(t, test.err, err != nil, test.in)
+		assert.Equal(t, test.min, min, test.in)
+		assert.Equal(t, test.max, max, test.in)
+	}
+}
+
+func TestLsLine(t *testing.T) {
+	now := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t,
+		"-rw-rw-rw- 1 rclone rclone           10 Jan  2 15:04 one.txt",
+		lsLine(fileInfo{name: "one.txt", size: 10, modTime: time.Date(2017, 1, 2, 15, 4, 5, 0, time.UTC)}, now))
+	assert.Equal(t,
+		"drwxrwxrwx 1 rclone rclone            0 Dec 25  2016 sub dir",
+		lsLine(fileInfo{name: "sub dir", modTime: time.Date(2016, 12, 25, 15, 4, 5, 0, time.UTC), isDir: true}, now))
+}
+
+func TestListArg(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"dir", "dir"},
+		{"-la", ""},
+		{"-l dir", "dir"},
+		{"-l  -a dir name", "dir name"},
+	} {
+		assert.Equal(t, test.want, listArg(test.in), test.in)
+	}
+}
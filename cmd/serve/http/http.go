@@ -0,0 +1,324 @@
+// Package http implements the "rclone serve http" command serving a
+// remote read only over HTTP
+package http
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/cmd/mountlib"
+	"github.com/ncw/rclone/cmd/serve"
+	"github.com/ncw/rclone/cmd/serve/httplib"
+	"github.com/ncw/rclone/fs"
+	"github.com/spf13/cobra"
+)
+
+// Globals
+var (
+	opt = httplib.DefaultOpt
+)
+
+func init() {
+	httplib.AddFlags(Command.Flags(), &opt)
+	mountlib.AddFlags(Command.Flags())
+	serve.Command.AddCommand(Command)
+}
+
+// Command definition for cobra
+var Command = &cobra.Command{
+	Use:   "http remote:path",
+	Short: `Serve the remote over HTTP.`,
+	Long: `rclone serve http implements a basic web server to serve the remote
+over HTTP.  This can be viewed in a web browser or you can make a
+remote of type http read from it.
+
+You can use the filter flags (eg --include, --exclude) to control what
+is served.
+
+The server will log errors.  Use -v to see access logs.
+
+--bwlimit will be respected for file transfers.  Use --stats to
+control the stats printing.
+
+Range requests are supported so downloads can be resumed and media
+players can seek in files.
+
+### Directory Cache
+
+Directory listings are cached in the same way as they are for rclone
+mount.  Use --dir-cache-time to control how long a directory listing
+is considered valid, and --poll-interval to control how often the
+remote is polled for changes on remotes which support it.
+` + httplib.Help,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cmd.NewFsSrc(args)
+		cmd.Run(false, true, command, func() error {
+			s := newServer(f, &opt)
+			err := s.Serve()
+			if err != nil {
+				return err
+			}
+			s.Wait()
+			return nil
+		})
+	},
+}
+
+// server contains everything to run the server
+type server struct {
+	f   fs.Fs
+	fs  *mountlib.FS
+	srv *httplib.Server
+}
+
+func newServer(f fs.Fs, opt *httplib.Options) *server {
+	mux := http.NewServeMux()
+	s := &server{
+		f:   f,
+		fs:  mountlib.NewFS(f),
+		srv: httplib.NewServer(mux, opt),
+	}
+	mux.HandleFunc("/", s.handler)
+	return s
+}
+
+// Serve runs the http server - doesn't block
+func (s *server) Serve() error {
+	err := s.srv.Serve()
+	if err != nil {
+		return err
+	}
+	fs.Logf(s.f, "Serving on %s", s.srv.URL())
+	return nil
+}
+
+// Wait blocks until the server has finished
+func (s *server) Wait() {
+	s.srv.Wait()
+}
+
+// Close shuts the server down
+func (s *server) Close() {
+	s.srv.Close()
+}
+
+// handler reads incoming requests and dispatches them
+func (s *server) handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Server", "rclone/"+fs.Version)
+
+	urlPath := r.URL.Path
+	isDir := strings.HasSuffix(urlPath, "/")
+	remote := strings.Trim(urlPath, "/")
+	if isDir {
+		s.serveDir(w, r, remote)
+	} else {
+		s.serveFile(w, r, remote)
+	}
+}
+
+// entry is a directory entry
+type entry struct {
+	remote string
+	URL    string
+	Leaf   string
+}
+
+// entries represents a directory
+type entries []entry
+
+// Len is part of sort.Interface
+func (es entries) Len() int { return len(es) }
+
+// Swap is part of sort.Interface
+func (es entries) Swap(i, j int) { es[i], es[j] = es[j], es[i] }
+
+// Less is part of sort.Interface
+func (es entries) Less(i, j int) bool { return es[i].Leaf < es[j].Leaf }
+
+// indexData is used to fill in the indexTemplate
+type indexData struct {
+	Title   string
+	Entries entries
+}
+
+// indexTemplate is the instantiated indexTemplateText
+var indexTemplate = template.Must(template.New("index").Parse(indexTemplateText))
+
+// indexTemplateText is the template used to display directories
+var indexTemplateText = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+{{ range $i := .Entries }}<a href="{{ $i.URL }}">{{ $i.Leaf }}</a><br />
+{{ end }}</body>
+</html>
+`
+
+// internalError returns an http.StatusInternalServerError and logs the error
+func internalError(what interface{}, w http.ResponseWriter, text string, err error) {
+	fs.Stats.Error()
+	fs.Errorf(what, "%s: %v", text, err)
+	http.Error(w, text+".", http.StatusInternalServerError)
+}
+
+// serveDir serves a directory index at dirRemote
+func (s *server) serveDir(w http.ResponseWriter, r *http.Request, dirRemote string) {
+	node, err := s.fs.Lookup(dirRemote)
+	if err == mountlib.ENOENT {
+		fs.Infof(dirRemote, "%s: Directory not found", r.RemoteAddr)
+		http.Error(w, "Directory not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		internalError(dirRemote, w, "Failed to find directory", err)
+		return
+	}
+	dir, ok := node.(*mountlib.Dir)
+	if !ok {
+		http.Error(w, "Not a directory", http.StatusNotFound)
+		return
+	}
+	items, err := dir.ReadDirAll()
+	if err != nil {
+		internalError(dirRemote, w, "Failed to list directory", err)
+		return
+	}
+
+	var out entries
+	for _, item := range items {
+		remote := item.Obj.Remote()
+		leaf := path.Base(remote)
+		if _, isDir := item.Obj.(fs.Directory); isDir {
+			leaf += "/"
+		}
+		out = append(out, entry{
+			remote: remote,
+			URL:    (&url.URL{Path: leaf}).String(),
+			Leaf:   leaf,
+		})
+	}
+	sort.Sort(out)
+
+	// Account the transfer
+	fs.Stats.Transferring(dirRemote)
+	defer fs.Stats.DoneTransferring(dirRemote, true)
+
+	fs.Infof(dirRemote, "%s: Serving directory", r.RemoteAddr)
+	err = indexTemplate.Execute(w, indexData{
+		Entries: out,
+		Title:   fmt.Sprintf("Directory listing of /%s", dirRemote),
+	})
+	if err != nil {
+		internalError(dirRemote, w, "Failed to render template", err)
+		return
+	}
+}
+
+// serveFile serves a file object at remote
+func (s *server) serveFile(w http.ResponseWriter, r *http.Request, remote string) {
+	node, err := s.fs.Lookup(remote)
+	if err == mountlib.ENOENT {
+		fs.Infof(remote, "%s: File not found", r.RemoteAddr)
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		internalError(remote, w, "Failed to find file", err)
+		return
+	}
+	file, ok := node.(*mountlib.File)
+	if !ok {
+		// Redirect directories to have a trailing slash
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+		return
+	}
+	obj, err := file.Object()
+	if err != nil {
+		internalError(remote, w, "Failed to find file", err)
+		return
+	}
+
+	// Set the headers
+	size := obj.Size()
+	w.Header().Set("Last-Modified", obj.ModTime().UTC().Format(http.TimeFormat))
+	mimeType := fs.MimeType(obj)
+	if mimeType == "application/octet-stream" && path.Ext(remote) == "" {
+		// Leave header blank so http server guesses
+	} else {
+		w.Header().Set("Content-Type", mimeType)
+	}
+
+	// Decode the Range header if there is one
+	var options []fs.OpenOption
+	status := http.StatusOK
+	length := size
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && size >= 0 {
+		start, end, err := httplib.ParseRange(rangeHeader, size)
+		switch err {
+		case nil:
+			options = append(options, &fs.RangeOption{Start: start, End: end})
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+			status = http.StatusPartialContent
+			length = end - start + 1
+		case httplib.ErrRangeNotSatisfiable:
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			http.Error(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+			return
+		default:
+			// Ignore ranges we can't parse and serve the whole file
+			fs.Debugf(remote, "Ignoring Range: %v", err)
+		}
+	}
+	if length >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+
+	// If HEAD no need to read the object since we have set the headers
+	if r.Method == "HEAD" {
+		w.WriteHeader(status)
+		return
+	}
+
+	// open the object
+	in, err := obj.Open(options...)
+	if err != nil {
+		internalError(remote, w, "Failed to open file", err)
+		return
+	}
+	in = fs.NewLimitedReadCloser(in, length)
+
+	// Account the transfer
+	fs.Stats.Transferring(remote)
+	defer fs.Stats.DoneTransferring(remote, true)
+	acc := fs.NewAccountSizeName(in, length, remote)
+	defer func() {
+		closeErr := acc.Close()
+		if closeErr != nil {
+			fs.Errorf(remote, "Failed to close file: %v", closeErr)
+		}
+	}()
+
+	fs.Infof(remote, "%s: Serving file", r.RemoteAddr)
+	w.WriteHeader(status)
+	n, err := io.Copy(w, acc)
+	if err != nil {
+		fs.Errorf(remote, "Didn't finish writing GET request (wrote %d/%d bytes): %v", n, length, err)
+		return
+	}
+}
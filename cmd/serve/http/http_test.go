@@ -0,0 +1,165 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/cmd/serve/httplib"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	_ "github.com/ncw/rclone/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startServer makes a local directory with some files in and serves
+// it returning the server and a function to tidy up
+func startServer(t *testing.T, opt *httplib.Options) (*server, func()) {
+	fstest.Initialise()
+	dir, err := ioutil.TempDir("", "rclone-serve-http-test")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub dir"), 0777))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "one.txt"), []byte("0123456789"), 0666))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sub dir", "two.txt"), []byte("hello"), 0666))
+
+	f, err := fs.NewFs(dir)
+	require.NoError(t, err)
+
+	s := newServer(f, opt)
+	require.NoError(t, s.Serve())
+	return s, func() {
+		s.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// defaultOpt returns the default options listening on a random port
+func defaultOpt() *httplib.Options {
+	opt := httplib.DefaultOpt
+	opt.ListenAddr = "localhost:0"
+	return &opt
+}
+
+// get does an http request returning the response and body
+func get(t *testing.T, method, url string, headers map[string]string) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp, string(body)
+}
+
+func TestServeHTTP(t *testing.T) {
+	s, cleanup := startServer(t, defaultOpt())
+	defer cleanup()
+	url := s.srv.URL()
+
+	// Directory listing
+	resp, body := get(t, "GET", url, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `<a href="one.txt">one.txt</a>`)
+	assert.Contains(t, body, `<a href="sub%20dir/">sub dir/</a>`)
+
+	// Sub directory listing and redirect
+	resp, body = get(t, "GET", url+"sub%20dir", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "/sub%20dir/", resp.Request.URL.EscapedPath())
+	assert.Contains(t, body, `<a href="two.txt">two.txt</a>`)
+
+	// File
+	resp, body = get(t, "GET", url+"one.txt", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "0123456789", body)
+	assert.Equal(t, "10", resp.Header.Get("Content-Length"))
+	assert.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+	_, err := time.Parse(http.TimeFormat, resp.Header.Get("Last-Modified"))
+	assert.NoError(t, err)
+
+	// HEAD
+	resp, body = get(t, "HEAD", url+"one.txt", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "", body)
+	assert.Equal(t, "10", resp.Header.Get("Content-Length"))
+
+	// Not found
+	resp, _ = get(t, "GET", url+"notfound.txt", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = get(t, "GET", url+"notfound/", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Bad method
+	resp, _ = get(t, "POST", url+"one.txt", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestServeHTTPRange(t *testing.T) {
+	s, cleanup := startServer(t, defaultOpt())
+	defer cleanup()
+	url := s.srv.URL() + "one.txt"
+
+	for _, test := range []struct {
+		in         string
+		wantStatus int
+		wantBody   string
+		wantRange  string
+		wantLength string
+	}{
+		{in: "bytes=2-5", wantStatus: 206, wantBody: "2345", wantRange: "bytes 2-5/10", wantLength: "4"},
+		{in: "bytes=7-", wantStatus: 206, wantBody: "789", wantRange: "bytes 7-9/10", wantLength: "3"},
+		{in: "bytes=-3", wantStatus: 206, wantBody: "789", wantRange: "bytes 7-9/10", wantLength: "3"},
+		{in: "bytes=5-100", wantStatus: 206, wantBody: "56789", wantRange: "bytes 5-9/10", wantLength: "5"},
+		{in: "bytes=10-", wantStatus: 416, wantRange: "bytes */10"},
+		{in: "bytes=1-2,4-5", wantStatus: 200, wantBody: "0123456789", wantLength: "10"},
+		{in: "potato", wantStatus: 200, wantBody: "0123456789", wantLength: "10"},
+	} {
+		what := "Range: " + test.in
+		resp, body := get(t, "GET", url, map[string]string{"Range": test.in})
+		assert.Equal(t, test.wantStatus, resp.StatusCode, what)
+		assert.Equal(t, test.wantRange, resp.Header.Get("Content-Range"), what)
+		if test.wantStatus != 416 {
+			assert.Equal(t, test.wantBody, body, what)
+			assert.Equal(t, test.wantLength, resp.Header.Get("Content-Length"), what)
+		}
+	}
+}
+
+func TestServeHTTPAuth(t *testing.T) {
+	opt := defaultOpt()
+	opt.BasicUser = "user"
+	opt.BasicPass = "pass"
+	s, cleanup := startServer(t, opt)
+	defer cleanup()
+	url := s.srv.URL() + "one.txt"
+
+	resp, _ := get(t, "GET", url, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.True(t, strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Basic "))
+
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("user", "wrong")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	req.SetBasicAuth("user", "pass")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "0123456789", string(body))
+}
@@ -0,0 +1,310 @@
+// Package httplib provides common functionality for http servers
+package httplib
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+// Help contains text describing the http server to add to the command
+// help.
+var Help = `
+### Server options
+
+Use --addr to specify which IP address and port the server should
+listen on, eg --addr 1.2.3.4:8000 or --addr :8080 to listen to all
+IPs.  By default it only listens on localhost.
+
+If you set --addr to listen on a public or LAN accessible IP address
+then using Authentication is advised - see the next section for info.
+
+--server-read-timeout and --server-write-timeout can be used to
+control the timeouts on the server.  Note that this is the total time
+for a transfer.
+
+--max-header-bytes controls the maximum number of bytes the server will
+accept in the HTTP header.
+
+#### Authentication
+
+By default this will serve files without needing a login.
+
+You can set a single username and password with the --user and --pass
+flags.
+
+Use --realm to set the authentication realm.
+
+#### SSL/TLS
+
+By default this will serve over http.  If you want you can serve over
+https.  You will need to supply the --cert and --key flags.  If you
+wish to do client side certificate validation then you will need to
+supply --client-ca also.
+
+--cert should be a either a PEM encoded certificate or a concatenation
+of that with the CA certificate.  --key should be the PEM encoded
+private key and --client-ca should be the PEM encoded client
+certificate authority certificate.
+`
+
+// Options contains options for the http Server
+type Options struct {
+	ListenAddr         string        // Port to listen on
+	ServerReadTimeout  time.Duration // Timeout for server reading data
+	ServerWriteTimeout time.Duration // Timeout for server writing data
+	MaxHeaderBytes     int           // Maximum size of request header
+	SslCert            string        // SSL PEM key (concatenation of certificate and CA certificate)
+	SslKey             string        // SSL PEM Private key
+	ClientCA           string        // Client certificate authority to verify clients with
+	Realm              string        // realm for authentication
+	BasicUser          string        // single username for basic auth
+	BasicPass          string        // password for BasicUser
+}
+
+// DefaultOpt is the default values used for Options
+var DefaultOpt = Options{
+	ListenAddr:         "localhost:8080",
+	Realm:              "rclone",
+	ServerReadTimeout:  1 * time.Hour,
+	ServerWriteTimeout: 1 * time.Hour,
+	MaxHeaderBytes:     4096,
+}
+
+// AddFlags adds flags for the http server to the flagSet storing
+// them in opt
+func AddFlags(flags *pflag.FlagSet, opt *Options) {
+	AddFlagsPrefix(flags, "", opt)
+}
+
+// AddFlagsPrefix adds flags for the http server to the flagSet
+// storing them in opt.  Each flag name is prefixed with prefix so the
+// same options can be used more than once on a command.
+func AddFlagsPrefix(flags *pflag.FlagSet, prefix string, opt *Options) {
+	flags.StringVarP(&opt.ListenAddr, prefix+"addr", "", opt.ListenAddr, "IPaddress:Port or :Port to bind server to.")
+	flags.DurationVarP(&opt.ServerReadTimeout, prefix+"server-read-timeout", "", opt.ServerReadTimeout, "Timeout for server reading data")
+	flags.DurationVarP(&opt.ServerWriteTimeout, prefix+"server-write-timeout", "", opt.ServerWriteTimeout, "Timeout for server writing data")
+	flags.IntVarP(&opt.MaxHeaderBytes, prefix+"max-header-bytes", "", opt.MaxHeaderBytes, "Maximum size of request header")
+	flags.StringVarP(&opt.SslCert, prefix+"cert", "", opt.SslCert, "SSL PEM key (concatenation of certificate and CA certificate)")
+	flags.StringVarP(&opt.SslKey, prefix+"key", "", opt.SslKey, "SSL PEM Private key")
+	flags.StringVarP(&opt.ClientCA, prefix+"client-ca", "", opt.ClientCA, "Client certificate authority to verify clients with")
+	flags.StringVarP(&opt.Realm, prefix+"realm", "", opt.Realm, "realm for authentication")
+	flags.StringVarP(&opt.BasicUser, prefix+"user", "", opt.BasicUser, "User name for authentication.")
+	flags.StringVarP(&opt.BasicPass, prefix+"pass", "", opt.BasicPass, "Password for authentication.")
+}
+
+// Server contains info about the running http server
+type Server struct {
+	Opt        Options
+	handler    http.Handler // original handler
+	listener   net.Listener
+	waitChan   chan struct{} // for waiting on the listener to close
+	httpServer *http.Server
+	useSSL     bool // if server is configured for SSL/TLS
+}
+
+// NewServer creates an http server.  The opt can be nil in which case
+// the default options will be used.
+func NewServer(handler http.Handler, opt *Options) *Server {
+	s := &Server{
+		handler: handler,
+	}
+
+	// Make a copy of the options
+	if opt != nil {
+		s.Opt = *opt
+	} else {
+		s.Opt = DefaultOpt
+	}
+
+	// Use basic auth if configured
+	if s.Opt.BasicUser != "" {
+		fs.Infof(nil, "Using --user %s --pass XXXX as authenticated user", s.Opt.BasicUser)
+		handler = s.basicAuth(handler)
+	}
+
+	s.useSSL = s.Opt.SslKey != ""
+	if (s.Opt.SslCert != "") != s.useSSL {
+		log.Fatalf("Need both --cert and --key to use SSL")
+	}
+
+	s.httpServer = &http.Server{
+		Addr:           s.Opt.ListenAddr,
+		Handler:        handler,
+		ReadTimeout:    s.Opt.ServerReadTimeout,
+		WriteTimeout:   s.Opt.ServerWriteTimeout,
+		MaxHeaderBytes: s.Opt.MaxHeaderBytes,
+	}
+
+	if s.Opt.ClientCA != "" {
+		if !s.useSSL {
+			log.Fatalf("Can't use --client-ca without --cert and --key")
+		}
+		certpool := x509.NewCertPool()
+		pem, err := ioutil.ReadFile(s.Opt.ClientCA)
+		if err != nil {
+			log.Fatalf("Failed to read client certificate authority: %v", err)
+		}
+		if !certpool.AppendCertsFromPEM(pem) {
+			log.Fatalf("Can't parse client certificate authority")
+		}
+		s.httpServer.TLSConfig = &tls.Config{
+			ClientCAs:  certpool,
+			ClientAuth: tls.RequireAndVerifyClientCert,
+		}
+	}
+
+	return s
+}
+
+// basicAuth wraps handler checking the user and password of each
+// request against those configured
+func (s *Server) basicAuth(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(user), []byte(s.Opt.BasicUser)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(pass), []byte(s.Opt.BasicPass)) != 1 {
+			fs.Infof(r.RemoteAddr, "Unauthorized request from %q", user)
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+s.Opt.Realm+`"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Serve runs the server - returns an error only if
+// the listener was not started; does not block, so
+// use s.Wait() to block on the listener indefinitely.
+func (s *Server) Serve() error {
+	ln, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return errors.Wrapf(err, "start server failed")
+	}
+	s.listener = ln
+	s.waitChan = make(chan struct{})
+	go func() {
+		var err error
+		if s.useSSL {
+			// Do the TLS by hand as http.Server.ServeTLS isn't
+			// available in all the go versions we support
+			tlsConfig := s.httpServer.TLSConfig
+			if tlsConfig == nil {
+				tlsConfig = new(tls.Config)
+			}
+			tlsConfig.NextProtos = []string{"http/1.1"}
+			tlsConfig.Certificates = make([]tls.Certificate, 1)
+			tlsConfig.Certificates[0], err = tls.LoadX509KeyPair(s.Opt.SslCert, s.Opt.SslKey)
+			if err == nil {
+				err = s.httpServer.Serve(tls.NewListener(s.listener, tlsConfig))
+			}
+		} else {
+			err = s.httpServer.Serve(s.listener)
+		}
+		if err != nil {
+			fs.Debugf(nil, "Error on serving HTTP server: %v", err)
+		}
+		close(s.waitChan)
+	}()
+	return nil
+}
+
+// Wait blocks while the listener is open.
+func (s *Server) Wait() {
+	<-s.waitChan
+}
+
+// Close shuts the running server down
+func (s *Server) Close() {
+	err := s.listener.Close()
+	if err != nil {
+		fs.Errorf(nil, "Error on closing HTTP server: %v", err)
+		return
+	}
+	<-s.waitChan
+}
+
+// URL returns the serving address of this server
+func (s *Server) URL() string {
+	proto := "http"
+	if s.useSSL {
+		proto = "https"
+	}
+	addr := s.Opt.ListenAddr
+	if s.listener != nil {
+		// prefer actual listener address; required if using 0-port
+		// (i.e. port assigned by operating system)
+		addr = s.listener.Addr().String()
+	}
+	return fmt.Sprintf("%s://%s/", proto, addr)
+}
+
+// ErrRangeNotSatisfiable is returned by ParseRange if the range is
+// outside the file
+var ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// ParseRange parses an HTTP Range header for an object of size bytes
+// and returns the first and last byte to be read inclusive.
+//
+// Only a single range is supported - an error is returned for
+// anything else which means the whole object should be served.
+func ParseRange(header string, size int64) (start, end int64, err error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return 0, 0, errors.Errorf("unknown range unit in %q", header)
+	}
+	spec := strings.TrimSpace(header[len(prefix):])
+	if strings.Contains(spec, ",") {
+		return 0, 0, errors.Errorf("multiple ranges not supported %q", header)
+	}
+	dash := strings.IndexRune(spec, '-')
+	if dash < 0 {
+		return 0, 0, errors.Errorf("bad range %q", header)
+	}
+	startString, endString := strings.TrimSpace(spec[:dash]), strings.TrimSpace(spec[dash+1:])
+	if startString == "" {
+		// suffix range - the final N bytes
+		n, err := strconv.ParseInt(endString, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, errors.Errorf("bad range %q", header)
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, ErrRangeNotSatisfiable
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, nil
+	}
+	start, err = strconv.ParseInt(startString, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, errors.Errorf("bad range %q", header)
+	}
+	if start >= size {
+		return 0, 0, ErrRangeNotSatisfiable
+	}
+	end = size - 1
+	if endString != "" {
+		end, err = strconv.ParseInt(endString, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, errors.Errorf("bad range %q", header)
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, nil
+}
@@ -0,0 +1,32 @@
+package httplib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRange(t *testing.T) {
+	for _, test := range []struct {
+		in         string
+		size       int64
+		start, end int64
+		err        bool
+	}{
+		{"bytes=0-0", 10, 0, 0, false},
+		{"bytes=0-", 10, 0, 9, false},
+		{"bytes=-20", 10, 0, 9, false},
+		{"bytes= 3 - 4 ", 10, 3, 4, false},
+		{"bytes=4-3", 10, 0, 0, true},
+		{"bytes=-0", 10, 0, 0, true},
+		{"bytes=-1", 0, 0, 0, true},
+		{"bytes=x-3", 10, 0, 0, true},
+		{"bytes=3", 10, 0, 0, true},
+		{"items=0-1", 10, 0, 0, true},
+	} {
+		start, end, err := ParseRange(test.in, test.size)
+		assert.Equal(t, test.err, err != nil, test.in)
+		assert.Equal(t, test.start, start, test.in)
+		assert.Equal(t, test.end, end, test.in)
+	}
+}
@@ -0,0 +1,507 @@
+// Package restic serves a remote suitable for use with restic
+package restic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/cmd/serve"
+	"github.com/ncw/rclone/cmd/serve/httplib"
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Globals
+var (
+	opt        = httplib.DefaultOpt
+	appendOnly = false
+)
+
+func init() {
+	httplib.AddFlags(Command.Flags(), &opt)
+	Command.Flags().BoolVarP(&appendOnly, "append-only", "", appendOnly, "disallow deletion of repository data")
+	serve.Command.AddCommand(Command)
+}
+
+// Command definition for cobra
+var Command = &cobra.Command{
+	Use:   "restic remote:path",
+	Short: `Serve the remote for restic's REST API.`,
+	Long: `rclone serve restic implements restic's REST backend API
+over HTTP.  This allows restic to use rclone as a data storage
+mechanism for cloud providers that restic does not support directly.
+
+[Restic](https://restic.net/) is a command line program for doing
+backups.
+
+The server will log errors.  Use -v to see access logs.
+
+--bwlimit will be respected for file transfers.  Use --stats to
+control the stats printing.
+
+### Setting up rclone for use by restic ###
+
+First [set up a remote for your chosen cloud provider](/docs/#configure).
+
+Once you have set up the remote, check it is working with, for example
+"rclone lsd remote:".  You may have called the remote something other
+than "remote:" - just substitute whatever you called it in the
+following instructions.
+
+Now start the rclone restic server
+
+    rclone serve restic -v remote:backup
+
+Where you can replace "backup" in the above by whatever path in the
+remote you wish to use.
+
+By default this will serve on "localhost:8080" you can change this
+with use of the "--addr" flag.
+
+You might wish to start this server on boot.
+
+### Setting up restic to use rclone ###
+
+Now you can [follow the restic
+instructions](http://restic.readthedocs.io/en/latest/030_preparing_a_new_repo.html#rest-server)
+on setting up restic.
+
+For the example above you will want to use "http://localhost:8080/" as
+the URL for the REST server.
+
+For example:
+
+    $ export RESTIC_REPOSITORY=rest:http://localhost:8080/
+    $ export RESTIC_PASSWORD=yourpassword
+    $ restic init
+    created restic backend 8b1a4b56ae at rest:http://localhost:8080/
+
+    Please note that knowledge of your password is required to access
+    the repository. Losing your password means that your data is
+    irrecoverably lost.
+    $ restic backup /path/to/files/to/backup
+    scan [/path/to/files/to/backup]
+    scanned 189 directories, 312 files in 0:00
+    [0:00] 100.00%  38.128 MiB / 38.128 MiB  501 / 501 items  0 errors  ETA 0:00
+    duration: 0:00
+    snapshot 45c8fdd8 saved
+
+#### Multiple repositories ####
+
+Note that you can use the endpoint to host multiple repositories.  Do
+this by adding a directory name or path after the URL.  Note that
+these **must** end with /.  Eg
+
+    $ export RESTIC_REPOSITORY=rest:http://localhost:8080/user1repo/
+    # backup user1 stuff
+    $ export RESTIC_REPOSITORY=rest:http://localhost:8080/user2repo/
+    # backup user2 stuff
+
+The repositories are stored in the same layout restic uses for its
+own backends, so a repository created by restic directly on the
+remote can be served by this and vice versa.
+
+#### Append only mode ####
+
+Use --append-only to stop clients deleting or overwriting any of the
+repository data.  This is useful to protect backups from a client
+which has been compromised, for example by ransomware.  Locks can
+still be removed.  Note that "restic forget" and "restic prune" won't
+work in this mode - run them with a server which isn't append only.
+
+Even without --append-only existing files can't be overwritten as
+restic never needs to do this.
+` + httplib.Help,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cmd.NewFsSrc(args)
+		cmd.Run(false, true, command, func() error {
+			s := newServer(f, &opt)
+			err := s.Serve()
+			if err != nil {
+				return err
+			}
+			s.Wait()
+			return nil
+		})
+	},
+}
+
+// The MIME types for the two versions of the listing format
+const (
+	resticAPIV1 = "application/vnd.x.restic.rest.v1"
+	resticAPIV2 = "application/vnd.x.restic.rest.v2"
+)
+
+// fileTypes are the directories restic stores its files in
+var fileTypes = map[string]bool{
+	"data":      true,
+	"index":     true,
+	"keys":      true,
+	"locks":     true,
+	"snapshots": true,
+}
+
+// server contains everything to run the server
+type server struct {
+	f          fs.Fs
+	srv        *httplib.Server
+	appendOnly bool
+}
+
+func newServer(f fs.Fs, opt *httplib.Options) *server {
+	mux := http.NewServeMux()
+	s := &server{
+		f:          f,
+		srv:        httplib.NewServer(mux, opt),
+		appendOnly: appendOnly,
+	}
+	mux.HandleFunc("/", s.handler)
+	return s
+}
+
+// Serve runs the http server - doesn't block
+func (s *server) Serve() error {
+	err := s.srv.Serve()
+	if err != nil {
+		return err
+	}
+	fs.Logf(s.f, "Serving restic REST API on %s", s.srv.URL())
+	return nil
+}
+
+// Wait blocks until the server has finished
+func (s *server) Wait() {
+	s.srv.Wait()
+}
+
+// Close shuts the server down
+func (s *server) Close() {
+	s.srv.Close()
+}
+
+// request describes what a restic request refers to
+type request struct {
+	repo     string // path of the repository in the remote
+	fileType string // "data", "keys" etc, "config" or "" for the repository
+	name     string // name of the file or "" for a directory
+}
+
+// remote returns the path of the file in the remote
+//
+// Data files are stored in a sub directory named after the first two
+// characters of their name as restic does.
+func (req *request) remote() string {
+	switch {
+	case req.fileType == "config":
+		return path.Join(req.repo, "config")
+	case req.fileType == "data" && len(req.name) >= 2:
+		return path.Join(req.repo, req.fileType, req.name[:2], req.name)
+	}
+	return path.Join(req.repo, req.fileType, req.name)
+}
+
+// errBadPath is returned by parsePath for paths which aren't restic
+// files or directories
+var errBadPath = errors.New("bad path")
+
+// parsePath works out which part of which repository urlPath refers
+// to
+func parsePath(urlPath string) (*request, error) {
+	isDir := strings.HasSuffix(urlPath, "/")
+	trimmed := strings.Trim(urlPath, "/")
+	if path.Clean("/"+trimmed) != "/"+trimmed {
+		return nil, errBadPath
+	}
+	var parts []string
+	if trimmed != "" {
+		parts = strings.Split(trimmed, "/")
+	}
+	n := len(parts)
+	switch {
+	case isDir && n >= 1 && fileTypes[parts[n-1]]:
+		return &request{repo: path.Join(parts[:n-1]...), fileType: parts[n-1]}, nil
+	case isDir:
+		return &request{repo: trimmed}, nil
+	case n >= 1 && parts[n-1] == "config":
+		return &request{repo: path.Join(parts[:n-1]...), fileType: "config", name: "config"}, nil
+	case n >= 2 && fileTypes[parts[n-2]]:
+		return &request{repo: path.Join(parts[:n-2]...), fileType: parts[n-2], name: parts[n-1]}, nil
+	}
+	return nil, errBadPath
+}
+
+// internalError returns an http.StatusInternalServerError and logs the error
+func internalError(what interface{}, w http.ResponseWriter, text string, err error) {
+	fs.Stats.Error()
+	fs.Errorf(what, "%s: %v", text, err)
+	http.Error(w, text+".", http.StatusInternalServerError)
+}
+
+// handler reads incoming requests and dispatches them
+func (s *server) handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Server", "rclone/"+fs.Version)
+
+	req, err := parsePath(r.URL.Path)
+	if err != nil {
+		fs.Infof(r.URL.Path, "%s: %s: %v", r.RemoteAddr, r.Method, err)
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	fs.Infof(r.URL.Path, "%s: %s", r.RemoteAddr, r.Method)
+
+	switch {
+	case req.fileType == "":
+		if r.Method == "POST" && r.URL.Query().Get("create") == "true" {
+			s.createRepo(w, r, req)
+			return
+		}
+	case req.name == "":
+		if r.Method == "GET" {
+			s.listObjects(w, r, req)
+			return
+		}
+	default:
+		switch r.Method {
+		case "GET", "HEAD":
+			s.serveObject(w, r, req)
+			return
+		case "POST":
+			s.postObject(w, r, req)
+			return
+		case "DELETE":
+			s.deleteObject(w, r, req)
+			return
+		}
+	}
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+// createRepo makes the directories for a new repository
+func (s *server) createRepo(w http.ResponseWriter, r *http.Request, req *request) {
+	fs.Infof(req.repo, "%s: Creating repository", r.RemoteAddr)
+	dirs := []string{req.repo}
+	for fileType := range fileTypes {
+		dirs = append(dirs, path.Join(req.repo, fileType))
+	}
+	for i := 0; i < 256; i++ {
+		dirs = append(dirs, path.Join(req.repo, "data", fmt.Sprintf("%02x", i)))
+	}
+	for _, dir := range dirs {
+		err := s.f.Mkdir(dir)
+		if err != nil {
+			internalError(dir, w, "Failed to create repository", err)
+			return
+		}
+	}
+}
+
+// listItem is an item returned in a v2 listing
+type listItem struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// listObjects lists the files of req.fileType in the repository
+//
+// If the directory doesn't exist then an empty listing is returned.
+func (s *server) listObjects(w http.ResponseWriter, r *http.Request, req *request) {
+	dir := req.remote()
+	maxLevel := 1
+	if req.fileType == "data" {
+		maxLevel = 2
+	}
+	items := []listItem{}
+	err := fs.Walk(s.f, dir, true, maxLevel, func(dirPath string, entries fs.DirEntries, err error) error {
+		if err != nil {
+			if err == fs.ErrorDirNotFound {
+				return nil
+			}
+			return err
+		}
+		entries.ForObject(func(o fs.Object) {
+			items = append(items, listItem{Name: path.Base(o.Remote()), Size: o.Size()})
+		})
+		return nil
+	})
+	if err != nil {
+		internalError(dir, w, "Failed to list directory", err)
+		return
+	}
+
+	var out interface{}
+	if strings.Contains(r.Header.Get("Accept"), resticAPIV2) {
+		w.Header().Set("Content-Type", resticAPIV2)
+		out = items
+	} else {
+		w.Header().Set("Content-Type", resticAPIV1)
+		names := make([]string, len(items))
+		for i := range items {
+			names[i] = items[i].Name
+		}
+		out = names
+	}
+	err = json.NewEncoder(w).Encode(out)
+	if err != nil {
+		fs.Errorf(dir, "Failed to write listing: %v", err)
+	}
+}
+
+// serveObject serves the file for req with support for Range
+// requests
+func (s *server) serveObject(w http.ResponseWriter, r *http.Request, req *request) {
+	remote := req.remote()
+	obj, err := s.f.NewObject(remote)
+	if err == fs.ErrorObjectNotFound {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		internalError(remote, w, "Failed to find file", err)
+		return
+	}
+
+	// Decode the Range header if there is one
+	size := obj.Size()
+	var options []fs.OpenOption
+	status := http.StatusOK
+	length := size
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && size >= 0 {
+		start, end, err := httplib.ParseRange(rangeHeader, size)
+		switch err {
+		case nil:
+			options = append(options, &fs.RangeOption{Start: start, End: end})
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+			status = http.StatusPartialContent
+			length = end - start + 1
+		case httplib.ErrRangeNotSatisfiable:
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			http.Error(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+			return
+		default:
+			// Ignore ranges we can't parse and serve the whole file
+			fs.Debugf(remote, "Ignoring Range: %v", err)
+		}
+	}
+	if length >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	// If HEAD no need to read the object since we have set the headers
+	if r.Method == "HEAD" {
+		w.WriteHeader(status)
+		return
+	}
+
+	in, err := obj.Open(options...)
+	if err != nil {
+		internalError(remote, w, "Failed to open file", err)
+		return
+	}
+	in = fs.NewLimitedReadCloser(in, length)
+
+	// Account the transfer
+	fs.Stats.Transferring(remote)
+	defer fs.Stats.DoneTransferring(remote, true)
+	acc := fs.NewAccountSizeName(in, length, remote)
+	defer func() {
+		closeErr := acc.Close()
+		if closeErr != nil {
+			fs.Errorf(remote, "Failed to close file: %v", closeErr)
+		}
+	}()
+
+	w.WriteHeader(status)
+	n, err := io.Copy(w, acc)
+	if err != nil {
+		fs.Errorf(remote, "Didn't finish writing GET request (wrote %d/%d bytes): %v", n, length, err)
+		return
+	}
+}
+
+// postObject uploads the body of the request to the file for req
+//
+// Files which already exist can't be overwritten.
+func (s *server) postObject(w http.ResponseWriter, r *http.Request, req *request) {
+	remote := req.remote()
+	_, err := s.f.NewObject(remote)
+	if err == nil {
+		fs.Errorf(remote, "Refusing to overwrite existing file")
+		http.Error(w, "File already exists", http.StatusForbidden)
+		return
+	} else if err != fs.ErrorObjectNotFound {
+		internalError(remote, w, "Failed to find file", err)
+		return
+	}
+
+	// Files of unknown size are uploaded with Rcat which will
+	// spool them to disk if the remote can't stream
+	size := r.ContentLength
+	if size < 0 {
+		err = fs.Rcat(s.f, remote, r.Body, time.Now())
+		if err != nil {
+			internalError(remote, w, "Failed to upload file", err)
+		}
+		return
+	}
+
+	// Account the transfer
+	fs.Stats.Transferring(remote)
+	in := fs.NewAccountSizeName(r.Body, size, remote)
+	info := fs.NewStaticObjectInfo(remote, time.Now(), size, true, nil, s.f)
+	obj, err := s.f.Put(in, info)
+	if err == nil && obj.Size() != size {
+		err = errors.Errorf("uploaded file is wrong size - expecting %d got %d", size, obj.Size())
+	}
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	fs.Stats.DoneTransferring(remote, err == nil)
+	if err != nil {
+		// Don't leave partial files behind as restic will
+		// retry the upload
+		if obj != nil {
+			removeErr := obj.Remove()
+			if removeErr != nil {
+				fs.Errorf(remote, "Failed to remove partial upload: %v", removeErr)
+			}
+		}
+		internalError(remote, w, "Failed to upload file", err)
+		return
+	}
+}
+
+// deleteObject removes the file for req
+//
+// Only locks can be removed in append only mode.
+func (s *server) deleteObject(w http.ResponseWriter, r *http.Request, req *request) {
+	remote := req.remote()
+	if s.appendOnly && req.fileType != "locks" {
+		fs.Errorf(remote, "Refusing to delete file in append only mode")
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	obj, err := s.f.NewObject(remote)
+	if err == fs.ErrorObjectNotFound {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		internalError(remote, w, "Failed to find file", err)
+		return
+	}
+	err = obj.Remove()
+	if err != nil {
+		internalError(remote, w, "Failed to delete file", err)
+		return
+	}
+}
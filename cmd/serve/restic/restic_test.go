@@ -0,0 +1,255 @@
+package restic
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ncw/rclone/cmd/serve/httplib"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	_ "github.com/ncw/rclone/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	dataName = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	lockName = "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+)
+
+// startServer makes an empty local directory and serves it returning
+// the server, the directory and a function to tidy up
+func startServer(t *testing.T, appendOnly bool) (*server, string, func()) {
+	fstest.Initialise()
+	dir, err := ioutil.TempDir("", "rclone-serve-restic-test")
+	require.NoError(t, err)
+
+	f, err := fs.NewFs(dir)
+	require.NoError(t, err)
+
+	opt := httplib.DefaultOpt
+	opt.ListenAddr = "localhost:0"
+	s := newServer(f, &opt)
+	s.appendOnly = appendOnly
+	require.NoError(t, s.Serve())
+	return s, dir, func() {
+		s.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// do makes a request returning the response and body
+func do(t *testing.T, method, url string, body io.Reader, headers map[string]string) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, body)
+	require.NoError(t, err)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	respBody, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp, string(respBody)
+}
+
+// contents returns the contents of the file at path in dir
+func contents(t *testing.T, dir, path string) string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+	require.NoError(t, err)
+	return string(data)
+}
+
+// exists returns whether path exists in dir
+func exists(dir, path string) bool {
+	_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path)))
+	return err == nil
+}
+
+// testRepo goes through the life cycle of a restic repository at
+// repoURL which is stored in repoDir
+func testRepo(t *testing.T, repoURL, repoDir string) {
+	// No repository yet
+	resp, _ := do(t, "HEAD", repoURL+"config", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Create it
+	resp, _ = do(t, "POST", repoURL+"?create=true", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	for _, dir := range []string{"data/00", "data/ff", "index", "keys", "locks", "snapshots"} {
+		assert.True(t, exists(repoDir, dir), dir)
+	}
+
+	// Config
+	resp, _ = do(t, "POST", repoURL+"config", strings.NewReader("config data"), nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "config data", contents(t, repoDir, "config"))
+	resp, body := do(t, "GET", repoURL+"config", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "config data", body)
+
+	// Data is stored in a sub directory
+	resp, _ = do(t, "POST", repoURL+"data/"+dataName, strings.NewReader("0123456789"), nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "0123456789", contents(t, repoDir, "data/01/"+dataName))
+	resp, body = do(t, "GET", repoURL+"data/"+dataName, nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "0123456789", body)
+	resp, body = do(t, "HEAD", repoURL+"data/"+dataName, nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "10", resp.Header.Get("Content-Length"))
+	assert.Equal(t, "", body)
+	resp, body = do(t, "GET", repoURL+"data/"+dataName, nil, map[string]string{"Range": "bytes=2-4"})
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "234", body)
+
+	// Other files aren't
+	resp, _ = do(t, "POST", repoURL+"locks/"+lockName, strings.NewReader("lock"), nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "lock", contents(t, repoDir, "locks/"+lockName))
+
+	// Uploads without a Content-Length
+	resp, _ = do(t, "POST", repoURL+"index/"+dataName, io.MultiReader(strings.NewReader("index")), nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "index", contents(t, repoDir, "index/"+dataName))
+
+	// Listing version 1
+	resp, body = do(t, "GET", repoURL+"data/", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, resticAPIV1, resp.Header.Get("Content-Type"))
+	var names []string
+	require.NoError(t, json.Unmarshal([]byte(body), &names))
+	assert.Equal(t, []string{dataName}, names)
+
+	// Listing version 2
+	resp, body = do(t, "GET", repoURL+"data/", nil, map[string]string{"Accept": resticAPIV2})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, resticAPIV2, resp.Header.Get("Content-Type"))
+	var items []listItem
+	require.NoError(t, json.Unmarshal([]byte(body), &items))
+	assert.Equal(t, []listItem{{Name: dataName, Size: 10}}, items)
+
+	// Empty listing
+	resp, body = do(t, "GET", repoURL+"snapshots/", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "[]\n", body)
+
+	// Files can't be overwritten
+	resp, _ = do(t, "POST", repoURL+"data/"+dataName, strings.NewReader("potato"), nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, "0123456789", contents(t, repoDir, "data/01/"+dataName))
+}
+
+func TestServeResticRepo(t *testing.T) {
+	s, dir, cleanup := startServer(t, false)
+	defer cleanup()
+	url := s.srv.URL()
+
+	testRepo(t, url, dir)
+
+	// Delete
+	resp, _ := do(t, "DELETE", url+"data/"+dataName, nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.False(t, exists(dir, "data/01/"+dataName))
+	resp, _ = do(t, "DELETE", url+"locks/"+lockName, nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.False(t, exists(dir, "locks/"+lockName))
+	resp, _ = do(t, "DELETE", url+"data/"+dataName, nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = do(t, "GET", url+"data/"+dataName, nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServeResticMultipleRepos(t *testing.T) {
+	s, dir, cleanup := startServer(t, false)
+	defer cleanup()
+	url := s.srv.URL()
+
+	testRepo(t, url+"user1/", filepath.Join(dir, "user1"))
+	testRepo(t, url+"users/user2/", filepath.Join(dir, "users", "user2"))
+	assert.False(t, exists(dir, "config"))
+}
+
+func TestServeResticAppendOnly(t *testing.T) {
+	s, dir, cleanup := startServer(t, true)
+	defer cleanup()
+	url := s.srv.URL()
+
+	testRepo(t, url, dir)
+
+	// Can't delete data but can delete locks
+	resp, _ := do(t, "DELETE", url+"data/"+dataName, nil, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.True(t, exists(dir, "data/01/"+dataName))
+	resp, _ = do(t, "DELETE", url+"config", nil, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.True(t, exists(dir, "config"))
+	resp, _ = do(t, "DELETE", url+"locks/"+lockName, nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.False(t, exists(dir, "locks/"+lockName))
+}
+
+func TestServeResticBadRequests(t *testing.T) {
+	s, _, cleanup := startServer(t, false)
+	defer cleanup()
+	url := s.srv.URL()
+
+	for _, test := range []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "potato", http.StatusNotFound},
+		{"GET", "potato/", http.StatusMethodNotAllowed},
+		{"PUT", "config", http.StatusMethodNotAllowed},
+		{"POST", "data/", http.StatusMethodNotAllowed},
+		{"DELETE", "keys/", http.StatusMethodNotAllowed},
+	} {
+		resp, _ := do(t, test.method, url+test.path, nil, nil)
+		assert.Equal(t, test.status, resp.StatusCode, "%s %s", test.method, test.path)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want *request
+	}{
+		{"/", &request{}},
+		{"/repo/", &request{repo: "repo"}},
+		{"/config", &request{fileType: "config", name: "config"}},
+		{"/a/b/config", &request{repo: "a/b", fileType: "config", name: "config"}},
+		{"/data/", &request{fileType: "data"}},
+		{"/repo/keys/", &request{repo: "repo", fileType: "keys"}},
+		{"/data/abcd", &request{fileType: "data", name: "abcd"}},
+		{"/repo/locks/abcd", &request{repo: "repo", fileType: "locks", name: "abcd"}},
+		{"/repo/potato/abcd", nil},
+		{"/potato", nil},
+		{"/../config", nil},
+		{"/a/./config", nil},
+	} {
+		got, err := parsePath(test.in)
+		assert.Equal(t, test.want == nil, err != nil, test.in)
+		assert.Equal(t, test.want, got, test.in)
+	}
+}
+
+func TestRequestRemote(t *testing.T) {
+	for _, test := range []struct {
+		in   request
+		want string
+	}{
+		{request{fileType: "config", name: "config"}, "config"},
+		{request{repo: "a/b", fileType: "config", name: "config"}, "a/b/config"},
+		{request{fileType: "data"}, "data"},
+		{request{fileType: "data", name: "abcd"}, "data/ab/abcd"},
+		{request{repo: "repo", fileType: "keys", name: "abcd"}, "repo/keys/abcd"},
+	} {
+		assert.Equal(t, test.want, test.in.remote(), test.want)
+	}
+}
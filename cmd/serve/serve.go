@@ -0,0 +1,35 @@
+// Package serve provides the serve command and the framework for the
+// protocols it serves.
+package serve
+
+import (
+	"errors"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(Command)
+}
+
+// Command definition for cobra
+//
+// The protocols add themselves to this as sub commands
+var Command = &cobra.Command{
+	Use:   "serve <protocol> [opts] <remote>",
+	Short: `Serve a remote over a protocol.`,
+	Long: `rclone serve is used to serve a remote over a given protocol. This
+command requires the use of a subcommand to specify the protocol, eg
+
+    rclone serve http remote:
+
+Each subcommand has its own options which you can see in their help.
+`,
+	RunE: func(command *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return errors.New("serve requires a protocol, eg 'rclone serve http remote:'")
+		}
+		return errors.New("unknown protocol")
+	},
+}
@@ -0,0 +1,269 @@
+package sftp
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/ncw/rclone/cmd/mountlib"
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// serveConn does the SSH handshake on netConn then serves the
+// sessions opened on it until the client disconnects
+func (s *server) serveConn(netConn net.Conn) {
+	defer func() { _ = netConn.Close() }()
+	sshConn, chans, reqs, err := ssh.NewServerConn(netConn, s.config)
+	if err != nil {
+		fs.Debugf(nil, "SSH handshake with %s failed: %v", netConn.RemoteAddr(), err)
+		return
+	}
+	fs.Infof(nil, "SSH login from %s@%s (%s)", sshConn.User(), sshConn.RemoteAddr(), sshConn.ClientVersion())
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			fs.Errorf(nil, "Failed to accept SSH channel: %v", err)
+			continue
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveSession(channel, requests)
+		}()
+	}
+}
+
+// serveSession serves the requests on a session channel.
+//
+// Only the "sftp" subsystem and a few commands with "exec" are
+// supported - there is no shell.
+func (s *server) serveSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	started := false
+	for req := range requests {
+		ok := false
+		switch req.Type {
+		case "subsystem":
+			var payload struct{ Name string }
+			if !started && ssh.Unmarshal(req.Payload, &payload) == nil && payload.Name == "sftp" {
+				ok, started = true, true
+				s.wg.Add(1)
+				go func() {
+					defer s.wg.Done()
+					s.serveSFTP(channel)
+				}()
+			}
+		case "exec":
+			var payload struct{ Command string }
+			if !started && ssh.Unmarshal(req.Payload, &payload) == nil {
+				ok, started = true, true
+				s.wg.Add(1)
+				go func() {
+					defer s.wg.Done()
+					s.serveExec(channel, payload.Command)
+				}()
+			}
+		}
+		if req.WantReply {
+			_ = req.Reply(ok, nil)
+		}
+	}
+	if !started {
+		_ = channel.Close()
+	}
+}
+
+// serveSFTP runs the SFTP protocol on channel
+func (s *server) serveSFTP(channel ssh.Channel) {
+	h := newHandler(s.fs)
+	rs := sftp.NewRequestServer(channel, sftp.Handlers{
+		FileGet:  h,
+		FilePut:  h,
+		FileCmd:  h,
+		FileInfo: h,
+	})
+	err := rs.Serve()
+	if err != nil && err != io.EOF {
+		fs.Errorf(nil, "SFTP session failed: %v", err)
+	}
+	_ = rs.Close()
+	h.closeAll()
+}
+
+// serveExec runs command replying on channel then closes it
+func (s *server) serveExec(channel ssh.Channel, command string) {
+	defer func() { _ = channel.Close() }()
+	var status uint32
+	out, err := s.runCommand(command)
+	if err != nil {
+		fs.Errorf(nil, "Command %q failed: %v", command, err)
+		_, _ = fmt.Fprintf(channel.Stderr(), "%v\n", err)
+		status = 1
+	} else {
+		fs.Debugf(nil, "Command %q OK", command)
+		_, _ = io.WriteString(channel, out)
+	}
+	_, err = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+	if err != nil {
+		fs.Debugf(nil, "Failed to send exit status: %v", err)
+	}
+}
+
+// hashCommands maps the commands which can be run to the hash they
+// calculate
+var hashCommands = map[string]fs.HashType{
+	"md5sum":  fs.HashMD5,
+	"sha1sum": fs.HashSHA1,
+}
+
+// runCommand runs one of the supported commands returning its output.
+//
+// These are what the rclone sftp backend uses to read hashes, namely
+//
+//	md5sum <path>
+//	sha1sum <path>
+//	echo 'abc' | md5sum
+//	echo 'abc' | sha1sum
+func (s *server) runCommand(command string) (string, error) {
+	var echo []string
+	if i := strings.IndexRune(command, '|'); i >= 0 {
+		var err error
+		echo, err = shellSplit(command[:i])
+		if err != nil {
+			return "", err
+		}
+		if len(echo) == 0 || echo[0] != "echo" {
+			return "", errors.Errorf("unsupported command %q", command)
+		}
+		command = command[i+1:]
+	}
+	args, err := shellSplit(command)
+	if err != nil {
+		return "", err
+	}
+	if len(args) == 0 {
+		return "", errors.New("no command")
+	}
+	hashType, ok := hashCommands[args[0]]
+	if !ok {
+		return "", errors.Errorf("unsupported command %q", args[0])
+	}
+	if echo != nil {
+		if len(args) != 1 {
+			return "", errors.Errorf("%s: can't read files and stdin", args[0])
+		}
+		in := strings.NewReader(strings.Join(echo[1:], " ") + "\n")
+		sums, err := fs.HashStreamTypes(in, fs.NewHashSet(hashType))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s  -\n", sums[hashType]), nil
+	}
+	if len(args) != 2 {
+		return "", errors.Errorf("%s: need exactly one file", args[0])
+	}
+	sum, err := s.hashFile(hashType, args[1])
+	if err != nil {
+		return "", errors.Wrapf(err, "%s: %s", args[0], args[1])
+	}
+	return fmt.Sprintf("%s  %s\n", sum, args[1]), nil
+}
+
+// hashFile returns the hash of the file at path.
+//
+// This uses the hash from the remote if it supports it, otherwise it
+// reads the file to calculate it.
+func (s *server) hashFile(hashType fs.HashType, path string) (string, error) {
+	node, err := s.fs.Lookup(cleanPath(path))
+	if err != nil {
+		return "", err
+	}
+	file, ok := node.(*mountlib.File)
+	if !ok {
+		return "", errIsDirectory
+	}
+	o, err := file.Object()
+	if err != nil {
+		return "", err
+	}
+	if o.Fs().Hashes().Contains(hashType) {
+		sum, err := o.Hash(hashType)
+		if err != nil {
+			return "", err
+		}
+		if sum != "" {
+			return sum, nil
+		}
+	}
+	in, err := o.Open()
+	if err != nil {
+		return "", err
+	}
+	sums, err := fs.HashStreamTypes(in, fs.NewHashSet(hashType))
+	closeErr := in.Close()
+	if err != nil {
+		return "", err
+	}
+	if closeErr != nil {
+		return "", closeErr
+	}
+	return sums[hashType], nil
+}
+
+// shellSplit splits command into words in the way a POSIX shell
+// would, processing quotes and backslash escapes.
+//
+// This is enough to parse the paths escaped by the sftp backend.
+func shellSplit(command string) (words []string, err error) {
+	var (
+		word    []rune
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, c := range command {
+		switch {
+		case escaped:
+			if quote == '"' && !strings.ContainsRune("$`\"\\\n", c) {
+				word = append(word, '\\')
+			}
+			if !(quote == 0 && c == '\n') {
+				word = append(word, c)
+			}
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word = append(word, c)
+			}
+		case c == '\'' || c == '"':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, string(word))
+				word, inWord = nil, false
+			}
+		default:
+			word = append(word, c)
+			inWord = true
+		}
+	}
+	if escaped || quote != 0 {
+		return nil, errors.Errorf("unterminated quote or escape in %q", command)
+	}
+	if inWord {
+		words = append(words, string(word))
+	}
+	return words, nil
+}
@@ -0,0 +1,621 @@
+package sftp
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ncw/rclone/cmd/mountlib"
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+)
+
+// Limits on the data buffered to cope with reads and writes arriving
+// out of order.  The sftp library runs several workers per session so
+// requests near each other are often processed out of order.
+const (
+	maxReadSkip     = 1 << 20  // furthest to read forward buffering the data skipped
+	maxReadBuffer   = 4 << 20  // most data buffered by a reader
+	maxWriteBuffer  = 64 << 20 // most data buffered by a writer
+	attrFlagSize    = 0x00000001
+	attrFlagUIDGID  = 0x00000002
+	attrFlagPerms   = 0x00000004
+	attrFlagModTime = 0x00000008
+)
+
+// Errors returned by the handlers
+var (
+	errIsDirectory   = errors.New("is a directory")
+	errNotDirectory  = errors.New("not a directory")
+	errNotSequential = errors.New("can't write non sequentially")
+	errTruncate      = errors.New("can't change the size of a file")
+	errUnsupported   = errors.New("operation not supported")
+)
+
+// handler implements the sftp.Handlers on top of the mountlib.FS for
+// a single SFTP session
+type handler struct {
+	fs      *mountlib.FS
+	mu      sync.Mutex // protects the following
+	readers map[string]*reader
+	writers map[string]*writer
+}
+
+// check interfaces
+var (
+	_ sftp.FileReader = (*handler)(nil)
+	_ sftp.FileWriter = (*handler)(nil)
+	_ sftp.FileCmder  = (*handler)(nil)
+	_ sftp.FileInfoer = (*handler)(nil)
+)
+
+func newHandler(fsys *mountlib.FS) *handler {
+	return &handler{
+		fs:      fsys,
+		readers: make(map[string]*reader),
+		writers: make(map[string]*writer),
+	}
+}
+
+// closeAll closes any files left open when the session finishes
+func (h *handler) closeAll() {
+	h.mu.Lock()
+	readers := make([]*reader, 0, len(h.readers))
+	for _, r := range h.readers {
+		readers = append(readers, r)
+	}
+	writers := make([]*writer, 0, len(h.writers))
+	for _, w := range h.writers {
+		writers = append(writers, w)
+	}
+	h.mu.Unlock()
+	for _, r := range readers {
+		_ = r.Close()
+	}
+	for _, w := range writers {
+		_ = w.Close()
+	}
+}
+
+// translateError converts mountlib errors into the errors the sftp
+// library uses to choose the status code
+func translateError(err error) error {
+	switch err {
+	case mountlib.ENOENT:
+		return syscall.ENOENT
+	case mountlib.EROFS:
+		return syscall.EPERM
+	}
+	return err
+}
+
+// cleanPath converts an sftp path into a path relative to the root
+func cleanPath(name string) string {
+	return strings.Trim(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
+// splitPath converts an sftp path into the path of its parent
+// directory and its leaf name.  leaf will be empty for the root.
+func splitPath(name string) (dirPath, leaf string) {
+	dirPath, leaf = path.Split(cleanPath(name))
+	return strings.TrimSuffix(dirPath, "/"), leaf
+}
+
+// lookup finds the node at name
+func (h *handler) lookup(name string) (mountlib.Node, error) {
+	node, err := h.fs.Lookup(cleanPath(name))
+	return node, translateError(err)
+}
+
+// lookupDir finds the directory at dirPath
+func (h *handler) lookupDir(dirPath string) (*mountlib.Dir, error) {
+	node, err := h.lookup(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := node.(*mountlib.Dir)
+	if !ok {
+		return nil, errNotDirectory
+	}
+	return dir, nil
+}
+
+// lookupParent finds the directory name is in returning it and the
+// leaf name
+func (h *handler) lookupParent(name string) (*mountlib.Dir, string, error) {
+	dirPath, leaf := splitPath(name)
+	if leaf == "" {
+		return nil, "", errIsDirectory
+	}
+	dir, err := h.lookupDir(dirPath)
+	return dir, leaf, err
+}
+
+// Fileread opens the file at r.Filepath for reading
+//
+// The sftp library may call this more than once for the same open
+// file if reads race, so readers are shared by path.
+func (h *handler) Fileread(r sftp.Request) (io.ReaderAt, error) {
+	key := cleanPath(r.Filepath)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if rd, ok := h.readers[key]; ok {
+		return rd, nil
+	}
+	node, err := h.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	file, ok := node.(*mountlib.File)
+	if !ok {
+		return nil, errIsDirectory
+	}
+	rd := &reader{h: h, key: key, file: file}
+	h.readers[key] = rd
+	return rd, nil
+}
+
+// Filewrite opens the file at r.Filepath for writing, creating it if
+// necessary.  Files are always truncated.
+//
+// As with Fileread, writers are shared by path.
+func (h *handler) Filewrite(r sftp.Request) (io.WriterAt, error) {
+	key := cleanPath(r.Filepath)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if w, ok := h.writers[key]; ok {
+		return w, nil
+	}
+	dir, leaf, err := h.lookupParent(key)
+	if err != nil {
+		return nil, err
+	}
+	var fh *mountlib.WriteFileHandle
+	node, err := dir.Lookup(leaf)
+	switch {
+	case err == mountlib.ENOENT:
+		_, fh, err = dir.Create(leaf)
+	case err != nil:
+	case node.IsFile():
+		fh, err = node.(*mountlib.File).OpenWrite()
+	default:
+		err = errIsDirectory
+	}
+	if err != nil {
+		return nil, translateError(err)
+	}
+	w := &writer{h: h, key: key, fh: fh, pending: make(map[int64][]byte)}
+	h.writers[key] = w
+	return w, nil
+}
+
+// Filecmd runs the commands which don't return data
+func (h *handler) Filecmd(r sftp.Request) error {
+	switch r.Method {
+	case "Setstat":
+		return h.setstat(r)
+	case "Rename":
+		oldDir, oldLeaf, err := h.lookupParent(r.Filepath)
+		if err != nil {
+			return err
+		}
+		newDir, newLeaf, err := h.lookupParent(r.Target)
+		if err != nil {
+			return err
+		}
+		return translateError(oldDir.Rename(oldLeaf, newLeaf, newDir))
+	case "Rmdir", "Remove":
+		dir, leaf, err := h.lookupParent(r.Filepath)
+		if err != nil {
+			return err
+		}
+		node, err := dir.Lookup(leaf)
+		if err != nil {
+			return translateError(err)
+		}
+		if r.Method == "Rmdir" && node.IsFile() {
+			return errNotDirectory
+		} else if r.Method == "Remove" && !node.IsFile() {
+			return errIsDirectory
+		}
+		return translateError(dir.Remove(leaf))
+	case "Mkdir":
+		dir, leaf, err := h.lookupParent(r.Filepath)
+		if err != nil {
+			return err
+		}
+		_, err = dir.Lookup(leaf)
+		if err == nil {
+			return os.ErrExist
+		} else if err != mountlib.ENOENT {
+			return err
+		}
+		_, err = dir.Mkdir(leaf)
+		return translateError(err)
+	}
+	return errUnsupported
+}
+
+// setstat sets the attributes of a file or directory.
+//
+// Only the modification time can be set.  Permissions and ownership
+// are ignored and the size may only be set to what it is already.
+func (h *handler) setstat(r sftp.Request) error {
+	node, err := h.lookup(r.Filepath)
+	if err != nil {
+		return err
+	}
+	attrs := r.Attrs
+	next := func() (uint32, error) {
+		if len(attrs) < 4 {
+			return 0, errors.New("attributes too short")
+		}
+		v := binary.BigEndian.Uint32(attrs)
+		attrs = attrs[4:]
+		return v, nil
+	}
+	if r.Flags&attrFlagSize != 0 {
+		hi, err := next()
+		if err != nil {
+			return err
+		}
+		lo, err := next()
+		if err != nil {
+			return err
+		}
+		size := uint64(hi)<<32 | uint64(lo)
+		file, ok := node.(*mountlib.File)
+		if !ok {
+			return errIsDirectory
+		}
+		_, currentSize, _, err := file.Attr(mountlib.NoModTime)
+		if err != nil {
+			return err
+		}
+		if size != currentSize {
+			return errTruncate
+		}
+	}
+	if r.Flags&attrFlagUIDGID != 0 {
+		if _, err = next(); err == nil {
+			_, err = next()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if r.Flags&attrFlagPerms != 0 {
+		if _, err = next(); err != nil {
+			return err
+		}
+	}
+	if r.Flags&attrFlagModTime != 0 {
+		_, err := next() // atime
+		if err != nil {
+			return err
+		}
+		mtime, err := next()
+		if err != nil {
+			return err
+		}
+		modTime := time.Unix(int64(mtime), 0)
+		switch x := node.(type) {
+		case *mountlib.File:
+			err = x.SetModTime(modTime)
+		case *mountlib.Dir:
+			err = x.SetModTime(modTime)
+		}
+		return translateError(err)
+	}
+	return nil
+}
+
+// Fileinfo returns the directory listing for "List" or the info on a
+// single node for "Stat"
+func (h *handler) Fileinfo(r sftp.Request) ([]os.FileInfo, error) {
+	node, err := h.lookup(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	switch r.Method {
+	case "List":
+		dir, ok := node.(*mountlib.Dir)
+		if !ok {
+			return nil, errNotDirectory
+		}
+		items, err := dir.ReadDirAll()
+		if err != nil {
+			return nil, translateError(err)
+		}
+		fis := make([]os.FileInfo, 0, len(items))
+		for _, item := range items {
+			leaf := path.Base(item.Obj.Remote())
+			node, err := dir.Lookup(leaf)
+			if err != nil {
+				return nil, translateError(err)
+			}
+			fi, err := nodeInfo(leaf, node)
+			if err != nil {
+				return nil, err
+			}
+			fis = append(fis, fi)
+		}
+		sort.Sort(byName(fis))
+		return fis, nil
+	case "Stat":
+		_, leaf := splitPath(r.Filepath)
+		if leaf == "" {
+			leaf = "/"
+		}
+		fi, err := nodeInfo(leaf, node)
+		if err != nil {
+			return nil, err
+		}
+		return []os.FileInfo{fi}, nil
+	}
+	return nil, errUnsupported
+}
+
+// fileInfo implements os.FileInfo
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+// check interface
+var _ os.FileInfo = (*fileInfo)(nil)
+
+// nodeInfo returns the os.FileInfo for node which is called name
+func nodeInfo(name string, node mountlib.Node) (os.FileInfo, error) {
+	switch x := node.(type) {
+	case *mountlib.Dir:
+		return &fileInfo{name: name, modTime: x.ModTime(), isDir: true}, nil
+	case *mountlib.File:
+		modTime, size, _, err := x.Attr(mountlib.NoModTime)
+		if err != nil {
+			return nil, err
+		}
+		return &fileInfo{name: name, size: int64(size), modTime: modTime}, nil
+	}
+	return nil, errors.Errorf("unknown node type %T", node)
+}
+
+// Name returns the base name of the file
+func (fi *fileInfo) Name() string { return fi.name }
+
+// Size returns the length in bytes
+func (fi *fileInfo) Size() int64 { return fi.size }
+
+// Mode returns the file mode bits
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.isDir {
+		return os.ModeDir | mountlib.DirPerms
+	}
+	return mountlib.FilePerms
+}
+
+// ModTime returns the modification time
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+
+// IsDir returns true for directories
+func (fi *fileInfo) IsDir() bool { return fi.isDir }
+
+// Sys returns the underlying data source which is always nil
+func (fi *fileInfo) Sys() interface{} { return nil }
+
+// byName sorts a []os.FileInfo by name
+type byName []os.FileInfo
+
+func (fis byName) Len() int           { return len(fis) }
+func (fis byName) Swap(i, j int)      { fis[i], fis[j] = fis[j], fis[i] }
+func (fis byName) Less(i, j int) bool { return fis[i].Name() < fis[j].Name() }
+
+// reader is an io.ReaderAt for a file open for reading
+//
+// Reads are done sequentially from a mountlib.ReadFileHandle.  If a
+// read arrives for an offset a little ahead of the current one the
+// data in between is read and kept for the reads which are about to
+// arrive for it, rather than seeking back and forth.
+type reader struct {
+	h      *handler
+	key    string
+	file   *mountlib.File
+	mu     sync.Mutex               // protects the following
+	fh     *mountlib.ReadFileHandle // nil until the first read
+	offset int64                    // offset the fh is at
+	ahead  map[int64][]byte         // data read while skipping forward
+	size   int                      // total size of data in ahead
+}
+
+// check interfaces
+var (
+	_ io.ReaderAt = (*reader)(nil)
+	_ io.Closer   = (*reader)(nil)
+)
+
+// read reads up to size bytes at offset from the file handle
+//
+// Call with mu held
+func (r *reader) read(size int, offset int64) ([]byte, error) {
+	data, err := r.fh.Read(int64(size), offset)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	r.offset = offset + int64(len(data))
+	return data, nil
+}
+
+// ReadAt reads len(p) bytes from the file at off
+func (r *reader) ReadAt(p []byte, off int64) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fh == nil {
+		r.fh, err = r.file.OpenRead()
+		if err != nil {
+			return 0, translateError(err)
+		}
+		r.offset = 0
+		r.ahead = make(map[int64][]byte)
+		r.size = 0
+	}
+	data, ok := r.ahead[off]
+	if ok {
+		delete(r.ahead, off)
+		r.size -= len(data)
+	}
+	if !ok || len(data) != len(p) {
+		if off > r.offset && off-r.offset <= maxReadSkip && r.size < maxReadBuffer {
+			for r.offset < off {
+				chunkOffset := r.offset
+				chunkSize := len(p)
+				if gap := off - chunkOffset; int64(chunkSize) > gap {
+					chunkSize = int(gap)
+				}
+				chunk, err := r.read(chunkSize, chunkOffset)
+				if err != nil {
+					return 0, err
+				}
+				if len(chunk) == 0 {
+					break
+				}
+				r.ahead[chunkOffset] = chunk
+				r.size += len(chunk)
+			}
+		}
+		data, err = r.read(len(p), off)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n = copy(p, data)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Close releases the file handle
+func (r *reader) Close() error {
+	r.h.mu.Lock()
+	if r.h.readers[r.key] == r {
+		delete(r.h.readers, r.key)
+	}
+	r.h.mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fh == nil {
+		return nil
+	}
+	err := r.fh.Release()
+	r.fh = nil
+	r.ahead = nil
+	return err
+}
+
+// writer is an io.WriterAt for a file open for writing
+//
+// The file can only be written sequentially so writes which arrive
+// ahead of the current offset are kept until the data before them
+// has been written.
+type writer struct {
+	h       *handler
+	key     string
+	mu      sync.Mutex // protects the following
+	fh      *mountlib.WriteFileHandle
+	pending map[int64][]byte // data waiting to be written by offset
+	size    int              // total size of data in pending
+	err     error            // first error writing
+	closed  bool
+}
+
+// check interfaces
+var (
+	_ io.WriterAt = (*writer)(nil)
+	_ io.Closer   = (*writer)(nil)
+)
+
+// write writes data to the file handle then any pending data which
+// follows it
+//
+// Call with mu held
+func (w *writer) write(data []byte) error {
+	for {
+		_, err := w.fh.Write(data, w.fh.Offset())
+		if err != nil {
+			return err
+		}
+		offset := w.fh.Offset()
+		var ok bool
+		data, ok = w.pending[offset]
+		if !ok {
+			return nil
+		}
+		delete(w.pending, offset)
+		w.size -= len(data)
+	}
+}
+
+// WriteAt writes p to the file at off
+func (w *writer) WriteAt(p []byte, off int64) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.closed {
+		return 0, mountlib.EBADF
+	}
+	offset := w.fh.Offset()
+	switch {
+	case off == offset:
+		err = w.write(p)
+	case off < offset:
+		err = errNotSequential
+	case w.size+len(p) > maxWriteBuffer:
+		err = errNotSequential
+	default:
+		w.pending[off] = append([]byte(nil), p...)
+		w.size += len(p)
+	}
+	if err != nil {
+		w.err = translateError(err)
+		return 0, w.err
+	}
+	return len(p), nil
+}
+
+// Close finishes the upload
+func (w *writer) Close() error {
+	w.h.mu.Lock()
+	if w.h.writers[w.key] == w {
+		delete(w.h.writers, w.key)
+	}
+	w.h.mu.Unlock()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.err == nil && len(w.pending) > 0 {
+		w.err = errNotSequential
+	}
+	err := w.fh.Release()
+	if w.err != nil {
+		err = w.err
+	}
+	if err != nil {
+		fs.Errorf(w.key, "Failed to upload: %v", err)
+	}
+	return err
+}
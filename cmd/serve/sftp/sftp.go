@@ -0,0 +1,356 @@
+// Package sftp implements an SFTP server to serve a remote
+package sftp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/cmd/mountlib"
+	"github.com/ncw/rclone/cmd/serve"
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/crypto/ssh"
+)
+
+// Options contains options for the SFTP server
+type Options struct {
+	ListenAddr     string // Port to listen on
+	Key            string // Path to the private host key
+	AuthorizedKeys string // Path to the authorized_keys file
+	User           string // single username for authentication
+	Pass           string // password for User
+}
+
+// DefaultOpt is the default values used for Options
+var DefaultOpt = Options{
+	ListenAddr:     "localhost:2022",
+	AuthorizedKeys: defaultAuthorizedKeys,
+}
+
+// defaultAuthorizedKeys is ignored if it doesn't exist
+const defaultAuthorizedKeys = "~/.ssh/authorized_keys"
+
+// Globals
+var (
+	opt = DefaultOpt
+)
+
+// AddFlags adds flags for the SFTP server to the flagSet storing them
+// in opt
+func AddFlags(flags *pflag.FlagSet, opt *Options) {
+	flags.StringVarP(&opt.ListenAddr, "addr", "", opt.ListenAddr, "IPaddress:Port or :Port to bind server to.")
+	flags.StringVarP(&opt.Key, "key", "", opt.Key, "SSH private host key file (leave blank to auto generate)")
+	flags.StringVarP(&opt.AuthorizedKeys, "authorized-keys", "", opt.AuthorizedKeys, "Authorized keys file")
+	flags.StringVarP(&opt.User, "user", "", opt.User, "User name for authentication.")
+	flags.StringVarP(&opt.Pass, "pass", "", opt.Pass, "Password for authentication.")
+}
+
+func init() {
+	AddFlags(Command.Flags(), &opt)
+	mountlib.AddFlags(Command.Flags())
+	serve.Command.AddCommand(Command)
+}
+
+// Command definition for cobra
+var Command = &cobra.Command{
+	Use:   "sftp remote:path",
+	Short: `Serve the remote over SFTP.`,
+	Long: `rclone serve sftp implements an SFTP server to serve the remote
+over SFTP.  This can be used with an SFTP client or you can make a
+remote of type sftp to use with it.
+
+The server supports reading and writing unless --read-only is set.
+Files are streamed to the remote as they are uploaded so, as with
+rclone mount, they can't be modified in place and must be written
+sequentially from the start.  Because of the way the SFTP library
+works, opening a file for writing then closing it without writing
+anything won't create it, so empty files can't be uploaded.
+
+The server also answers "md5sum" and "sha1sum" commands run over SSH
+so that an rclone sftp remote pointed at it can read hashes.  If the
+remote being served doesn't support the hash asked for then the file
+will be read to calculate it.  No other commands can be run - there
+is no shell.
+
+### Server options
+
+Use --addr to specify which IP address and port the server should
+listen on, eg --addr 1.2.3.4:8000 or --addr :8080 to listen to all
+IPs.  By default it only listens on localhost.
+
+Use --key to supply the SSH private host key.  If it isn't supplied
+then an RSA key is generated on first use and stored alongside the
+rclone config file so the server's identity stays the same between
+runs.
+
+#### Authentication
+
+Use --user and --pass to set a single username and password which
+clients can log in with.
+
+Keys listed in the file given by --authorized-keys may also be used to
+log in, and if --user is set then only as that user.  This defaults to
+"~/.ssh/authorized_keys" which is ignored if it doesn't exist.
+
+At least one of --pass or an authorized keys file is required.
+
+### Directory Cache
+
+Directory listings are cached in the same way as they are for rclone
+mount.  Use --dir-cache-time to control how long a directory listing
+is considered valid, and --poll-interval to control how often the
+remote is polled for changes on remotes which support it.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cmd.NewFsSrc(args)
+		cmd.Run(false, true, command, func() error {
+			s, err := newServer(f, &opt)
+			if err != nil {
+				return err
+			}
+			err = s.Serve()
+			if err != nil {
+				return err
+			}
+			s.Wait()
+			return nil
+		})
+	},
+}
+
+// server contains everything to run the server
+type server struct {
+	f        fs.Fs
+	fs       *mountlib.FS
+	opt      Options
+	config   *ssh.ServerConfig
+	listener net.Listener
+	waitChan chan struct{}  // for waiting on the listener to close
+	wg       sync.WaitGroup // for waiting on the connections to close
+	mu       sync.Mutex     // protects the following
+	conns    map[net.Conn]struct{}
+}
+
+func newServer(f fs.Fs, opt *Options) (*server, error) {
+	s := &server{
+		f:     f,
+		fs:    mountlib.NewFS(f),
+		opt:   *opt,
+		conns: make(map[net.Conn]struct{}),
+	}
+	err := s.makeConfig()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// expandHome expands a leading ~ in path to the user's home directory
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home := os.Getenv("HOME")
+	if usr, err := user.Current(); err == nil {
+		home = usr.HomeDir
+	}
+	if home == "" {
+		return "", errors.Errorf("can't find home directory to expand %q", path)
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// loadAuthorizedKeys reads the authorized_keys file returning a set
+// of the marshalled public keys found
+func (s *server) loadAuthorizedKeys() (map[string]struct{}, error) {
+	keys := make(map[string]struct{})
+	if s.opt.AuthorizedKeys == "" {
+		return keys, nil
+	}
+	path, err := expandHome(s.opt.AuthorizedKeys)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && s.opt.AuthorizedKeys == defaultAuthorizedKeys {
+		fs.Debugf(nil, "Ignoring missing authorized keys file %q", path)
+		return keys, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to load authorized keys")
+	}
+	for len(data) > 0 {
+		var key ssh.PublicKey
+		key, _, _, data, err = ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			// no more keys found
+			break
+		}
+		keys[string(key.Marshal())] = struct{}{}
+	}
+	return keys, nil
+}
+
+// loadHostKey reads the host key from --key or from the default
+// location, making a new key there if it doesn't exist
+func (s *server) loadHostKey() (ssh.Signer, error) {
+	keyPath := s.opt.Key
+	if keyPath == "" {
+		keyPath = filepath.Join(filepath.Dir(fs.ConfigPath), "serve-sftp-id_rsa")
+		if _, err := os.Stat(keyPath); os.IsNotExist(err) {
+			fs.Logf(nil, "Generating SSH host key %q", keyPath)
+			err = generateHostKey(keyPath)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	data, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read host key")
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse host key")
+	}
+	return signer, nil
+}
+
+// generateHostKey makes a new RSA private key and writes it to path
+// in PEM format
+func generateHostKey(path string) error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate host key")
+	}
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	err = ioutil.WriteFile(path, data, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to save host key")
+	}
+	return nil
+}
+
+// makeConfig makes the ssh server config with the authentication
+// methods and host key
+func (s *server) makeConfig() error {
+	config := &ssh.ServerConfig{
+		ServerVersion: "SSH-2.0-rclone/" + fs.Version,
+	}
+	if s.opt.Pass != "" {
+		config.PasswordCallback = func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			userOK := subtle.ConstantTimeCompare([]byte(c.User()), []byte(s.opt.User))
+			passOK := subtle.ConstantTimeCompare(pass, []byte(s.opt.Pass))
+			if userOK&passOK == 1 {
+				return nil, nil
+			}
+			return nil, errors.Errorf("password rejected for %q", c.User())
+		}
+	}
+	authorizedKeys, err := s.loadAuthorizedKeys()
+	if err != nil {
+		return err
+	}
+	if len(authorizedKeys) > 0 {
+		config.PublicKeyCallback = func(c ssh.ConnMetadata, pubKey ssh.PublicKey) (*ssh.Permissions, error) {
+			if s.opt.User != "" && c.User() != s.opt.User {
+				return nil, errors.Errorf("user %q not allowed", c.User())
+			}
+			if _, ok := authorizedKeys[string(pubKey.Marshal())]; ok {
+				return nil, nil
+			}
+			return nil, errors.Errorf("unknown public key for %q", c.User())
+		}
+	}
+	if config.PasswordCallback == nil && config.PublicKeyCallback == nil {
+		return errors.New("no authentication methods - use --pass or --authorized-keys")
+	}
+	signer, err := s.loadHostKey()
+	if err != nil {
+		return err
+	}
+	config.AddHostKey(signer)
+	s.config = config
+	return nil
+}
+
+// Serve runs the SFTP server - doesn't block
+func (s *server) Serve() error {
+	ln, err := net.Listen("tcp", s.opt.ListenAddr)
+	if err != nil {
+		return errors.Wrap(err, "start server failed")
+	}
+	s.listener = ln
+	s.waitChan = make(chan struct{})
+	go func() {
+		defer close(s.waitChan)
+		for {
+			netConn, err := ln.Accept()
+			if err != nil {
+				fs.Debugf(nil, "Error on accepting SFTP connection: %v", err)
+				return
+			}
+			s.mu.Lock()
+			s.conns[netConn] = struct{}{}
+			s.mu.Unlock()
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serveConn(netConn)
+				s.mu.Lock()
+				delete(s.conns, netConn)
+				s.mu.Unlock()
+			}()
+		}
+	}()
+	fs.Logf(s.f, "SFTP Server started on %s", s.URL())
+	return nil
+}
+
+// Wait blocks while the listener is open.
+func (s *server) Wait() {
+	<-s.waitChan
+}
+
+// Close shuts the running server down along with any open
+// connections
+func (s *server) Close() {
+	err := s.listener.Close()
+	if err != nil {
+		fs.Errorf(nil, "Error on closing SFTP server: %v", err)
+		return
+	}
+	<-s.waitChan
+	s.mu.Lock()
+	for netConn := range s.conns {
+		_ = netConn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// URL returns the serving address of this server
+func (s *server) URL() string {
+	addr := s.opt.ListenAddr
+	if s.listener != nil {
+		addr = s.listener.Addr().String()
+	}
+	return fmt.Sprintf("sftp://%s/", addr)
+}
@@ -0,0 +1,390 @@
+package sftp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/cmd/mountlib"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	_ "github.com/ncw/rclone/local"
+	_ "github.com/ncw/rclone/sftp"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	testUser = "user"
+	testPass = "pass"
+)
+
+// startServer makes a local directory with some files in and serves
+// it returning the server, the directory and a function to tidy up
+//
+// The host key and authorized_keys are stored in the directory
+// "keys" next to the one served.
+func startServer(t *testing.T, opt *Options) (*server, string, func()) {
+	fstest.Initialise()
+	tmp, err := ioutil.TempDir("", "rclone-serve-sftp-test")
+	require.NoError(t, err)
+	dir := filepath.Join(tmp, "root")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub dir"), 0777))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "one.txt"), []byte("0123456789"), 0666))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sub dir", "two.txt"), []byte("hello"), 0666))
+	keys := filepath.Join(tmp, "keys")
+	require.NoError(t, os.MkdirAll(keys, 0777))
+	opt.Key = filepath.Join(keys, "id_rsa")
+	require.NoError(t, generateHostKey(opt.Key))
+
+	f, err := fs.NewFs(dir)
+	require.NoError(t, err)
+
+	s, err := newServer(f, opt)
+	require.NoError(t, err)
+	require.NoError(t, s.Serve())
+	return s, dir, func() {
+		s.Close()
+		_ = os.RemoveAll(tmp)
+	}
+}
+
+// defaultOpt returns options with password authentication listening
+// on a random port
+func defaultOpt() *Options {
+	opt := DefaultOpt
+	opt.ListenAddr = "localhost:0"
+	opt.AuthorizedKeys = ""
+	opt.User = testUser
+	opt.Pass = testPass
+	return &opt
+}
+
+// addr returns the host:port the server is listening on
+func addr(t *testing.T, s *server) string {
+	u, err := url.Parse(s.URL())
+	require.NoError(t, err)
+	return u.Host
+}
+
+// dialSSH connects to the server authenticating with auth
+func dialSSH(s *server, user string, auth ...ssh.AuthMethod) (*ssh.Client, error) {
+	return ssh.Dial("tcp", s.listener.Addr().String(), &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         10 * time.Second,
+	})
+}
+
+// dial connects to the server returning an sftp client and a function
+// to close it
+func dial(t *testing.T, s *server) (*ssh.Client, *sftp.Client, func()) {
+	sshClient, err := dialSSH(s, testUser, ssh.Password(testPass))
+	require.NoError(t, err)
+	c, err := sftp.NewClient(sshClient)
+	require.NoError(t, err)
+	return sshClient, c, func() {
+		_ = c.Close()
+		_ = sshClient.Close()
+	}
+}
+
+// get reads the file at path
+func get(t *testing.T, c *sftp.Client, path string) string {
+	in, err := c.Open(path)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = in.WriteTo(&buf)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return buf.String()
+}
+
+// put writes data to the file at path
+func put(c *sftp.Client, path string, data []byte) error {
+	out, err := c.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = out.ReadFrom(bytes.NewReader(data))
+	closeErr := out.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// run runs command on the server returning its output
+func run(client *ssh.Client, command string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = session.Close() }()
+	out, err := session.Output(command)
+	return string(out), err
+}
+
+// contents returns the contents of the file at path in dir
+func contents(t *testing.T, dir, path string) string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+	require.NoError(t, err)
+	return string(data)
+}
+
+// exists returns whether path exists in dir
+func exists(dir, path string) bool {
+	_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path)))
+	return err == nil
+}
+
+func TestServeSFTPRead(t *testing.T) {
+	s, _, cleanup := startServer(t, defaultOpt())
+	defer cleanup()
+	_, c, closeClient := dial(t, s)
+	defer closeClient()
+
+	// Listing
+	fis, err := c.ReadDir("/")
+	require.NoError(t, err)
+	require.Len(t, fis, 2)
+	assert.Equal(t, "one.txt", fis[0].Name())
+	assert.Equal(t, int64(10), fis[0].Size())
+	assert.False(t, fis[0].IsDir())
+	assert.Equal(t, "sub dir", fis[1].Name())
+	assert.True(t, fis[1].IsDir())
+	_, err = c.ReadDir("/notfound")
+	assert.True(t, os.IsNotExist(err), err)
+
+	// Stat
+	fi, err := c.Stat("sub dir/two.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), fi.Size())
+	_, err = c.Stat("notfound.txt")
+	assert.True(t, os.IsNotExist(err), err)
+
+	// Read whole files and part of one
+	assert.Equal(t, "0123456789", get(t, c, "one.txt"))
+	assert.Equal(t, "hello", get(t, c, "/sub dir/two.txt"))
+	in, err := c.Open("one.txt")
+	require.NoError(t, err)
+	_, err = in.Seek(5, os.SEEK_SET)
+	require.NoError(t, err)
+	buf := make([]byte, 3)
+	n, err := in.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "567", string(buf[:n]))
+	require.NoError(t, in.Close())
+
+	// Opening doesn't fail as the sftp library doesn't check, but
+	// reading does
+	in, err = c.Open("notfound.txt")
+	require.NoError(t, err)
+	_, err = in.Read(buf)
+	assert.Error(t, err)
+	require.NoError(t, in.Close())
+}
+
+func TestServeSFTPWrite(t *testing.T) {
+	s, dir, cleanup := startServer(t, defaultOpt())
+	defer cleanup()
+	_, c, closeClient := dial(t, s)
+	defer closeClient()
+
+	// Upload then read back
+	require.NoError(t, put(c, "new.txt", []byte("potato")))
+	assert.Equal(t, "potato", contents(t, dir, "new.txt"))
+	assert.Equal(t, "potato", get(t, c, "new.txt"))
+
+	// Overwrite
+	require.NoError(t, put(c, "new.txt", []byte("sausage")))
+	assert.Equal(t, "sausage", contents(t, dir, "new.txt"))
+
+	// Large file - the client sends lots of concurrent writes
+	// and reads which will arrive out of order
+	big := make([]byte, 5<<20)
+	_, err := rand.Read(big)
+	require.NoError(t, err)
+	require.NoError(t, put(c, "sub dir/big.bin", big))
+	assert.True(t, bytes.Equal(big, []byte(contents(t, dir, "sub dir/big.bin"))))
+	assert.True(t, bytes.Equal(big, []byte(get(t, c, "sub dir/big.bin"))))
+
+	// Set the modification time
+	modTime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	require.NoError(t, c.Chtimes("new.txt", modTime, modTime))
+	fi, err := os.Stat(filepath.Join(dir, "new.txt"))
+	require.NoError(t, err)
+	assert.True(t, modTime.Equal(fi.ModTime()), fi.ModTime())
+	assert.Error(t, c.Truncate("new.txt", 2))
+
+	// Directories
+	require.NoError(t, c.Mkdir("new dir"))
+	assert.True(t, exists(dir, "new dir"))
+	assert.Error(t, c.Mkdir("new dir"))
+	assert.Error(t, c.Mkdir("missing/dir"))
+
+	// Rename a file and a directory
+	require.NoError(t, c.Rename("new.txt", "new dir/moved.txt"))
+	assert.False(t, exists(dir, "new.txt"))
+	assert.Equal(t, "sausage", contents(t, dir, "new dir/moved.txt"))
+	require.NoError(t, c.Rename("/new dir", "/moved dir"))
+	assert.Equal(t, "sausage", contents(t, dir, "moved dir/moved.txt"))
+	assert.Error(t, c.Rename("notfound", "other"))
+
+	// Remove
+	assert.Error(t, c.RemoveDirectory("moved dir"))
+	require.NoError(t, c.Remove("moved dir/moved.txt"))
+	assert.False(t, exists(dir, "moved dir/moved.txt"))
+	assert.Error(t, c.RemoveDirectory("one.txt"))
+	require.NoError(t, c.RemoveDirectory("moved dir"))
+	assert.False(t, exists(dir, "moved dir"))
+	assert.Error(t, c.Remove("notfound.txt"))
+}
+
+func TestServeSFTPReadOnly(t *testing.T) {
+	mountlib.ReadOnly = true
+	defer func() { mountlib.ReadOnly = false }()
+	s, dir, cleanup := startServer(t, defaultOpt())
+	defer cleanup()
+	_, c, closeClient := dial(t, s)
+	defer closeClient()
+
+	assert.Equal(t, "0123456789", get(t, c, "one.txt"))
+	assert.Error(t, put(c, "new.txt", []byte("potato")))
+	assert.False(t, exists(dir, "new.txt"))
+	assert.Error(t, c.Mkdir("new"))
+	assert.Error(t, c.Remove("one.txt"))
+	assert.Error(t, c.Rename("one.txt", "two.txt"))
+	assert.True(t, exists(dir, "one.txt"))
+}
+
+func TestServeSFTPAuth(t *testing.T) {
+	clientKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(clientKey)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	otherSigner, err := ssh.NewSignerFromKey(otherKey)
+	require.NoError(t, err)
+	authorizedKeys, err := ioutil.TempFile("", "rclone-serve-sftp-test")
+	require.NoError(t, err)
+	defer func() { _ = os.Remove(authorizedKeys.Name()) }()
+	_, err = authorizedKeys.Write(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+	require.NoError(t, err)
+	require.NoError(t, authorizedKeys.Close())
+
+	opt := defaultOpt()
+	opt.AuthorizedKeys = authorizedKeys.Name()
+	s, _, cleanup := startServer(t, opt)
+	defer cleanup()
+
+	for _, test := range []struct {
+		user string
+		auth ssh.AuthMethod
+		ok   bool
+	}{
+		{testUser, ssh.Password(testPass), true},
+		{testUser, ssh.Password("wrong"), false},
+		{"other", ssh.Password(testPass), false},
+		{testUser, ssh.PublicKeys(signer), true},
+		{"other", ssh.PublicKeys(signer), false},
+		{testUser, ssh.PublicKeys(otherSigner), false},
+	} {
+		client, err := dialSSH(s, test.user, test.auth)
+		assert.Equal(t, test.ok, err == nil, "%+v: %v", test, err)
+		if err == nil {
+			_ = client.Close()
+		}
+	}
+
+	// Needs some way of logging in
+	opt = defaultOpt()
+	opt.Pass = ""
+	_, err = newServer(s.f, opt)
+	assert.Error(t, err)
+}
+
+func TestServeSFTPExec(t *testing.T) {
+	s, _, cleanup := startServer(t, defaultOpt())
+	defer cleanup()
+	client, _, closeClient := dial(t, s)
+	defer closeClient()
+
+	for _, test := range []struct {
+		command string
+		want    string
+		err     bool
+	}{
+		{"echo 'abc' | md5sum", "0bee89b07a248e27c83fc3d5951213c1  -\n", false},
+		{"echo 'abc' | sha1sum", "03cfd743661f07975fa2f1220c5194cbaff48451  -\n", false},
+		{"md5sum one.txt", "781e5e245d69b566979b86e28d23f2c7  one.txt\n", false},
+		{"sha1sum sub\\ dir/two.txt", "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d  sub dir/two.txt\n", false},
+		{"md5sum notfound.txt", "", true},
+		{"md5sum 'sub dir'", "", true},
+		{"ls", "", true},
+		{"cat one.txt | md5sum", "", true},
+	} {
+		out, err := run(client, test.command)
+		assert.Equal(t, test.err, err != nil, "%q: %v", test.command, err)
+		assert.Equal(t, test.want, out, test.command)
+	}
+}
+
+// TestServeSFTPBackend checks the rclone sftp backend can use the
+// server and read hashes from it
+func TestServeSFTPBackend(t *testing.T) {
+	s, _, cleanup := startServer(t, defaultOpt())
+	defer cleanup()
+	host, port, err := net.SplitHostPort(addr(t, s))
+	require.NoError(t, err)
+	const name = "TestServeSFTPBackend"
+	fs.ConfigFileSet(name, "type", "sftp")
+	fs.ConfigFileSet(name, "host", host)
+	fs.ConfigFileSet(name, "port", port)
+	fs.ConfigFileSet(name, "user", testUser)
+	fs.ConfigFileSet(name, "pass", fs.MustObscure(testPass))
+
+	f, err := fs.NewFs(name + ":sub dir")
+	require.NoError(t, err)
+	assert.True(t, f.Hashes().Contains(fs.HashMD5))
+	assert.True(t, f.Hashes().Contains(fs.HashSHA1))
+	o, err := f.NewObject("two.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), o.Size())
+	sum, err := o.Hash(fs.HashMD5)
+	require.NoError(t, err)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", sum)
+}
+
+func TestShellSplit(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want []string
+		err  bool
+	}{
+		{"", nil, false},
+		{"md5sum file.txt", []string{"md5sum", "file.txt"}, false},
+		{"  md5sum   file.txt ", []string{"md5sum", "file.txt"}, false},
+		{`md5sum sub\ dir/file\$.txt`, []string{"md5sum", "sub dir/file$.txt"}, false},
+		{"md5sum a'\n'b", []string{"md5sum", "a\nb"}, false},
+		{`echo 'a b' "c\"d\e"`, []string{"echo", "a b", `c"d\e`}, false},
+		{`echo ''`, []string{"echo", ""}, false},
+		{`echo 'abc`, nil, true},
+		{`echo abc\`, nil, true},
+	} {
+		got, err := shellSplit(test.in)
+		assert.Equal(t, test.err, err != nil, test.in)
+		assert.Equal(t, test.want, got, test.in)
+	}
+}
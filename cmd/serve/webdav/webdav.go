@@ -0,0 +1,642 @@
+// Package webdav implements a WebDAV server backed by a remote
+package webdav
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/cmd/mountlib"
+	"github.com/ncw/rclone/cmd/serve"
+	"github.com/ncw/rclone/cmd/serve/httplib"
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context" // switch to "context" when we stop supporting go1.6
+	"golang.org/x/net/webdav"
+)
+
+// Globals
+var (
+	opt = httplib.DefaultOpt
+)
+
+func init() {
+	httplib.AddFlags(Command.Flags(), &opt)
+	mountlib.AddFlags(Command.Flags())
+	serve.Command.AddCommand(Command)
+}
+
+// Command definition for cobra
+var Command = &cobra.Command{
+	Use:   "webdav remote:path",
+	Short: `Serve remote:path over webdav.`,
+	Long: `rclone serve webdav implements a basic webdav server to serve the
+remote over HTTP via the webdav protocol.  This can be viewed with a
+webdav client or mounted by the file manager of most operating
+systems, which makes it useful where FUSE isn't available.
+
+The server supports reading and writing unless --read-only is set.
+Files are streamed to the remote as they are uploaded so, as with
+rclone mount, files can't be modified in place - they are always
+written from the start.
+
+If the remote supports server side copy or move then these will be
+used for the webdav COPY and MOVE methods.  If it supports server side
+copy but not move then files will be moved by copying them then
+deleting the original.
+
+Listing a directory may read the first 512 bytes of any file without a
+known extension so the content type can be worked out.
+
+### Directory Cache
+
+Directory listings are cached in the same way as they are for rclone
+mount.  Use --dir-cache-time to control how long a directory listing
+is considered valid, and --poll-interval to control how often the
+remote is polled for changes on remotes which support it.
+` + httplib.Help,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cmd.NewFsSrc(args)
+		cmd.Run(false, true, command, func() error {
+			s := newServer(f, &opt)
+			err := s.Serve()
+			if err != nil {
+				return err
+			}
+			s.Wait()
+			return nil
+		})
+	},
+}
+
+// server contains everything to run the server
+//
+// It implements webdav.FileSystem on top of the mountlib.FS
+type server struct {
+	f   fs.Fs
+	fs  *mountlib.FS
+	srv *httplib.Server
+}
+
+// check interface
+var _ webdav.FileSystem = (*server)(nil)
+
+func newServer(f fs.Fs, opt *httplib.Options) *server {
+	s := &server{
+		f:  f,
+		fs: mountlib.NewFS(f),
+	}
+	handler := &webdav.Handler{
+		FileSystem: s,
+		LockSystem: webdav.NewMemLS(),
+		Logger:     s.logRequest,
+	}
+	s.srv = httplib.NewServer(handler, opt)
+	return s
+}
+
+// Serve runs the webdav server - doesn't block
+func (s *server) Serve() error {
+	err := s.srv.Serve()
+	if err != nil {
+		return err
+	}
+	fs.Logf(s.f, "WebDav Server started on %s", s.srv.URL())
+	return nil
+}
+
+// Wait blocks until the server has finished
+func (s *server) Wait() {
+	s.srv.Wait()
+}
+
+// Close shuts the server down
+func (s *server) Close() {
+	s.srv.Close()
+}
+
+// logRequest is called by the webdav module on every request
+func (s *server) logRequest(r *http.Request, err error) {
+	if err != nil {
+		fs.Infof(r.URL.Path, "%s: %s failed: %v", r.RemoteAddr, r.Method, err)
+		return
+	}
+	fs.Infof(r.URL.Path, "%s: %s", r.RemoteAddr, r.Method)
+}
+
+// Errors returned by the file handles
+var (
+	errIsDirectory  = errors.New("is a directory")
+	errNotDirectory = errors.New("not a directory")
+	errNotReadable  = errors.New("file not open for reading")
+	errNotWritable  = errors.New("file not open for writing")
+	errBadSeek      = errors.New("bad seek")
+)
+
+// translateError converts mountlib errors into the os errors the
+// webdav library uses to choose the HTTP status
+func translateError(err error) error {
+	switch err {
+	case mountlib.ENOENT:
+		return os.ErrNotExist
+	case mountlib.EEXIST:
+		return os.ErrExist
+	case mountlib.EROFS:
+		return os.ErrPermission
+	}
+	return err
+}
+
+// cleanPath converts a webdav name into a path relative to the root
+func cleanPath(name string) string {
+	return strings.Trim(path.Clean("/"+name), "/")
+}
+
+// splitPath converts a webdav name into the path of its parent
+// directory and its leaf name.  leaf will be empty for the root.
+func splitPath(name string) (dirPath, leaf string) {
+	dirPath, leaf = path.Split(cleanPath(name))
+	return strings.TrimSuffix(dirPath, "/"), leaf
+}
+
+// lookupDir finds the directory at dirPath
+func (s *server) lookupDir(dirPath string) (*mountlib.Dir, error) {
+	node, err := s.fs.Lookup(dirPath)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	dir, ok := node.(*mountlib.Dir)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return dir, nil
+}
+
+// Mkdir creates a directory
+func (s *server) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	dirPath, leaf := splitPath(name)
+	if leaf == "" {
+		return os.ErrExist
+	}
+	dir, err := s.lookupDir(dirPath)
+	if err != nil {
+		return err
+	}
+	_, err = dir.Lookup(leaf)
+	if err == nil {
+		return os.ErrExist
+	} else if err != mountlib.ENOENT {
+		return err
+	}
+	_, err = dir.Mkdir(leaf)
+	return translateError(err)
+}
+
+// OpenFile opens a file or directory
+//
+// Files opened for write are always truncated as the remote can't
+// be written to in place.
+func (s *server) OpenFile(ctx context.Context, name string, flags int, perm os.FileMode) (webdav.File, error) {
+	dirPath, leaf := splitPath(name)
+	if flags&(os.O_WRONLY|os.O_RDWR) == 0 {
+		node, err := s.fs.Lookup(cleanPath(name))
+		if err != nil {
+			return nil, translateError(err)
+		}
+		switch x := node.(type) {
+		case *mountlib.Dir:
+			return &dirFile{leaf: leaf, dir: x}, nil
+		case *mountlib.File:
+			return &readFile{leaf: leaf, file: x, dirPath: dirPath}, nil
+		}
+		return nil, errors.Errorf("unknown node type %T", node)
+	}
+	if leaf == "" {
+		return nil, errIsDirectory
+	}
+	dir, err := s.lookupDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	var file *mountlib.File
+	node, err := dir.Lookup(leaf)
+	switch {
+	case err == mountlib.ENOENT:
+		if flags&os.O_CREATE == 0 {
+			return nil, os.ErrNotExist
+		}
+	case err != nil:
+		return nil, err
+	case flags&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, os.ErrExist
+	default:
+		var ok bool
+		file, ok = node.(*mountlib.File)
+		if !ok {
+			return nil, errIsDirectory
+		}
+	}
+	return &writeFile{s: s, leaf: leaf, dir: dir, file: file}, nil
+}
+
+// RemoveAll removes a file or a directory and all its contents
+func (s *server) RemoveAll(ctx context.Context, name string) error {
+	dirPath, leaf := splitPath(name)
+	if leaf == "" {
+		return os.ErrPermission
+	}
+	dir, err := s.lookupDir(dirPath)
+	if err != nil {
+		return err
+	}
+	return s.removeAll(dir, leaf)
+}
+
+// removeAll removes leaf from dir recursively
+func (s *server) removeAll(dir *mountlib.Dir, leaf string) error {
+	node, err := dir.Lookup(leaf)
+	if err == mountlib.ENOENT {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if subDir, ok := node.(*mountlib.Dir); ok {
+		items, err := subDir.ReadDirAll()
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			err = s.removeAll(subDir, path.Base(item.Obj.Remote()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return translateError(dir.Remove(leaf))
+}
+
+// Rename renames a file or directory
+//
+// This uses server side Move or DirMove.  If the remote can't Move
+// but can Copy then files are copied then the original deleted.
+func (s *server) Rename(ctx context.Context, oldName, newName string) error {
+	oldDirPath, oldLeaf := splitPath(oldName)
+	newDirPath, newLeaf := splitPath(newName)
+	if oldLeaf == "" || newLeaf == "" {
+		return os.ErrPermission
+	}
+	oldDir, err := s.lookupDir(oldDirPath)
+	if err != nil {
+		return err
+	}
+	newDir, err := s.lookupDir(newDirPath)
+	if err != nil {
+		return err
+	}
+	node, err := oldDir.Lookup(oldLeaf)
+	if err != nil {
+		return translateError(err)
+	}
+	features := s.f.Features()
+	if node.IsFile() && features.Move == nil && features.Copy != nil {
+		err = oldDir.Copy(oldLeaf, newLeaf, newDir)
+		if err != nil {
+			return translateError(err)
+		}
+		return translateError(oldDir.Remove(oldLeaf))
+	}
+	return translateError(oldDir.Rename(oldLeaf, newLeaf, newDir))
+}
+
+// Stat returns info about the file or directory
+func (s *server) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	node, err := s.fs.Lookup(cleanPath(name))
+	if err != nil {
+		return nil, translateError(err)
+	}
+	_, leaf := splitPath(name)
+	return nodeInfo(leaf, node)
+}
+
+// fileInfo implements os.FileInfo
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+// check interface
+var _ os.FileInfo = (*fileInfo)(nil)
+
+// nodeInfo returns the os.FileInfo for node which is called name
+func nodeInfo(name string, node mountlib.Node) (os.FileInfo, error) {
+	switch x := node.(type) {
+	case *mountlib.Dir:
+		return &fileInfo{name: name, modTime: x.ModTime(), isDir: true}, nil
+	case *mountlib.File:
+		modTime, size, _, err := x.Attr(mountlib.NoModTime)
+		if err != nil {
+			return nil, err
+		}
+		return &fileInfo{name: name, size: int64(size), modTime: modTime}, nil
+	}
+	return nil, errors.Errorf("unknown node type %T", node)
+}
+
+// Name returns the base name of the file
+func (fi *fileInfo) Name() string { return fi.name }
+
+// Size returns the length in bytes
+func (fi *fileInfo) Size() int64 { return fi.size }
+
+// Mode returns the file mode bits
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.isDir {
+		return os.ModeDir | mountlib.DirPerms
+	}
+	return mountlib.FilePerms
+}
+
+// ModTime returns the modification time
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+
+// IsDir returns true for directories
+func (fi *fileInfo) IsDir() bool { return fi.isDir }
+
+// Sys returns the underlying data source which is always nil
+func (fi *fileInfo) Sys() interface{} { return nil }
+
+// byName sorts a []os.FileInfo by name
+type byName []os.FileInfo
+
+func (fis byName) Len() int           { return len(fis) }
+func (fis byName) Swap(i, j int)      { fis[i], fis[j] = fis[j], fis[i] }
+func (fis byName) Less(i, j int) bool { return fis[i].Name() < fis[j].Name() }
+
+// dirFile is a webdav.File for an open directory
+type dirFile struct {
+	leaf  string
+	dir   *mountlib.Dir
+	items []os.FileInfo // nil until read
+	pos   int           // position in items
+}
+
+// check interface
+var _ webdav.File = (*dirFile)(nil)
+
+// Readdir reads up to count entries from the directory or all of
+// them if count <= 0
+func (d *dirFile) Readdir(count int) ([]os.FileInfo, error) {
+	if d.items == nil {
+		entries, err := d.dir.ReadDirAll()
+		if err != nil {
+			return nil, err
+		}
+		d.items = make([]os.FileInfo, 0, len(entries))
+		for _, entry := range entries {
+			leaf := path.Base(entry.Obj.Remote())
+			node, err := d.dir.Lookup(leaf)
+			if err != nil {
+				return nil, err
+			}
+			fi, err := nodeInfo(leaf, node)
+			if err != nil {
+				return nil, err
+			}
+			d.items = append(d.items, fi)
+		}
+		sort.Sort(byName(d.items))
+	}
+	remaining := d.items[d.pos:]
+	if count <= 0 {
+		d.pos = len(d.items)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(remaining) {
+		count = len(remaining)
+	}
+	d.pos += count
+	return remaining[:count], nil
+}
+
+// Stat returns info about the directory
+func (d *dirFile) Stat() (os.FileInfo, error) {
+	return nodeInfo(d.leaf, d.dir)
+}
+
+// Read isn't supported on directories
+func (d *dirFile) Read(p []byte) (int, error) {
+	return 0, errIsDirectory
+}
+
+// Write isn't supported on directories
+func (d *dirFile) Write(p []byte) (int, error) {
+	return 0, errIsDirectory
+}
+
+// Seek isn't supported on directories
+func (d *dirFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, errIsDirectory
+}
+
+// Close the directory
+func (d *dirFile) Close() error {
+	return nil
+}
+
+// readFile is a webdav.File for a file opened for reading
+type readFile struct {
+	leaf    string
+	dirPath string // path of the parent directory
+	file    *mountlib.File
+	fh      *mountlib.ReadFileHandle // nil until the first Read
+	offset  int64
+}
+
+// check interface
+var _ webdav.File = (*readFile)(nil)
+
+// Read reads from the current offset, opening the file if necessary
+func (f *readFile) Read(p []byte) (n int, err error) {
+	if f.fh == nil {
+		f.fh, err = f.file.OpenRead()
+		if err != nil {
+			return 0, err
+		}
+	}
+	data, err := f.fh.Read(int64(len(p)), f.offset)
+	n = copy(p, data)
+	f.offset += int64(n)
+	if err == nil && n == 0 && len(p) != 0 {
+		err = io.EOF
+	}
+	return n, translateError(err)
+}
+
+// Seek sets the offset for the next Read
+//
+// The file is only actually seeked when it is next read.
+func (f *readFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case os.SEEK_SET:
+	case os.SEEK_CUR:
+		offset += f.offset
+	case os.SEEK_END:
+		_, size, _, err := f.file.Attr(true)
+		if err != nil {
+			return 0, err
+		}
+		offset += int64(size)
+	default:
+		return 0, errBadSeek
+	}
+	if offset < 0 {
+		return 0, errBadSeek
+	}
+	f.offset = offset
+	return f.offset, nil
+}
+
+// Readdir isn't supported on files
+func (f *readFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, errNotDirectory
+}
+
+// Stat returns info about the file
+func (f *readFile) Stat() (os.FileInfo, error) {
+	return nodeInfo(f.leaf, f.file)
+}
+
+// Write isn't supported on files opened for read
+func (f *readFile) Write(p []byte) (int, error) {
+	return 0, errNotWritable
+}
+
+// Close the file
+func (f *readFile) Close() error {
+	if f.fh == nil {
+		return nil
+	}
+	return f.fh.Release()
+}
+
+// writeFile is a webdav.File for a file opened for writing
+//
+// The upload isn't started until the first Write so that copies can
+// be done server side if possible.
+type writeFile struct {
+	s      *server
+	leaf   string
+	dir    *mountlib.Dir             // parent directory
+	file   *mountlib.File            // existing file or nil if creating
+	fh     *mountlib.WriteFileHandle // nil until the upload is started
+	copied bool                      // set if the file was copied server side
+}
+
+// check interface
+var (
+	_ webdav.File   = (*writeFile)(nil)
+	_ io.ReaderFrom = (*writeFile)(nil)
+)
+
+// open starts the upload if it hasn't been started already
+func (f *writeFile) open() (err error) {
+	if f.fh != nil {
+		return nil
+	}
+	if f.file != nil {
+		f.fh, err = f.file.OpenWrite()
+	} else {
+		f.file, f.fh, err = f.dir.Create(f.leaf)
+	}
+	return translateError(err)
+}
+
+// Write writes p to the end of the file
+func (f *writeFile) Write(p []byte) (int, error) {
+	err := f.open()
+	if err != nil {
+		return 0, err
+	}
+	n, err := f.fh.Write(p, f.fh.Offset())
+	return int(n), translateError(err)
+}
+
+// writerOnly hides the ReadFrom method of an io.Writer
+type writerOnly struct {
+	io.Writer
+}
+
+// ReadFrom is called by io.Copy.  If r is a file from the same
+// remote and the remote supports it, then the file is copied server
+// side instead of being streamed.
+func (f *writeFile) ReadFrom(r io.Reader) (n int64, err error) {
+	if src, ok := r.(*readFile); ok && f.fh == nil && f.s.f.Features().Copy != nil {
+		srcDir, err := f.s.lookupDir(src.dirPath)
+		if err == nil {
+			err = srcDir.Copy(src.leaf, f.leaf, f.dir)
+		}
+		if err == nil {
+			f.copied = true
+			_, size, _, err := src.file.Attr(true)
+			return int64(size), err
+		}
+		fs.Debugf(path.Join(src.dirPath, src.leaf), "Server side copy failed - streaming instead: %v", err)
+	}
+	return io.Copy(writerOnly{f}, r)
+}
+
+// Seek isn't supported on files opened for write
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, errBadSeek
+}
+
+// Readdir isn't supported on files
+func (f *writeFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, errNotDirectory
+}
+
+// Read isn't supported on files opened for write
+func (f *writeFile) Read(p []byte) (int, error) {
+	return 0, errNotReadable
+}
+
+// Stat returns info about the file written so far
+func (f *writeFile) Stat() (os.FileInfo, error) {
+	if f.copied {
+		node, err := f.dir.Lookup(f.leaf)
+		if err != nil {
+			return nil, translateError(err)
+		}
+		return nodeInfo(f.leaf, node)
+	}
+	fi := &fileInfo{name: f.leaf, modTime: time.Now()}
+	if f.fh != nil {
+		fi.size = f.fh.Offset()
+	}
+	return fi, nil
+}
+
+// Close finishes the upload, creating an empty file if nothing was
+// written
+func (f *writeFile) Close() error {
+	if f.copied {
+		return nil
+	}
+	err := f.open()
+	if err != nil {
+		return err
+	}
+	return translateError(f.fh.Release())
+}
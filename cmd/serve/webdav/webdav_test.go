@@ -0,0 +1,209 @@
+package webdav
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ncw/rclone/cmd/mountlib"
+	"github.com/ncw/rclone/cmd/serve/httplib"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	_ "github.com/ncw/rclone/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startServer makes a local directory with some files in and serves
+// it returning the server, the directory and a function to tidy up
+func startServer(t *testing.T) (*server, string, func()) {
+	fstest.Initialise()
+	dir, err := ioutil.TempDir("", "rclone-serve-webdav-test")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub dir"), 0777))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "one.txt"), []byte("0123456789"), 0666))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sub dir", "two.txt"), []byte("hello"), 0666))
+
+	f, err := fs.NewFs(dir)
+	require.NoError(t, err)
+
+	opt := httplib.DefaultOpt
+	opt.ListenAddr = "localhost:0"
+	s := newServer(f, &opt)
+	require.NoError(t, s.Serve())
+	return s, dir, func() {
+		s.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// do makes a webdav request returning the response and body
+func do(t *testing.T, method, url string, body io.Reader, headers map[string]string) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, body)
+	require.NoError(t, err)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	respBody, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp, string(respBody)
+}
+
+// contents returns the contents of the file at path in dir
+func contents(t *testing.T, dir, path string) string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+	require.NoError(t, err)
+	return string(data)
+}
+
+// exists returns whether path exists in dir
+func exists(dir, path string) bool {
+	_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path)))
+	return err == nil
+}
+
+func TestServeWebdavRead(t *testing.T) {
+	s, _, cleanup := startServer(t)
+	defer cleanup()
+	url := s.srv.URL()
+
+	// Listing
+	resp, body := do(t, "PROPFIND", url, nil, map[string]string{"Depth": "1"})
+	assert.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+	assert.Contains(t, body, "<D:href>/one.txt</D:href>")
+	assert.Contains(t, body, "<D:href>/sub%20dir</D:href>")
+	assert.Contains(t, body, "<D:getcontentlength>10</D:getcontentlength>")
+	assert.NotContains(t, body, "two.txt")
+
+	// Sub directory listing
+	resp, body = do(t, "PROPFIND", url+"sub%20dir/", nil, map[string]string{"Depth": "1"})
+	assert.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+	assert.Contains(t, body, "<D:href>/sub%20dir/two.txt</D:href>")
+
+	// File
+	resp, body = do(t, "GET", url+"one.txt", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "0123456789", body)
+
+	// Range
+	resp, body = do(t, "GET", url+"one.txt", nil, map[string]string{"Range": "bytes=3-5"})
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "345", body)
+
+	// Not found
+	resp, _ = do(t, "GET", url+"notfound.txt", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = do(t, "PROPFIND", url+"notfound/", nil, map[string]string{"Depth": "1"})
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServeWebdavWrite(t *testing.T) {
+	s, dir, cleanup := startServer(t)
+	defer cleanup()
+	url := s.srv.URL()
+
+	// Upload a file then read it back
+	resp, _ := do(t, "PUT", url+"new.txt", strings.NewReader("potato"), nil)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "potato", contents(t, dir, "new.txt"))
+	resp, body := do(t, "GET", url+"new.txt", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "potato", body)
+
+	// Overwrite it
+	resp, _ = do(t, "PUT", url+"new.txt", strings.NewReader("sausage"), nil)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "sausage", contents(t, dir, "new.txt"))
+
+	// Upload an empty file
+	resp, _ = do(t, "PUT", url+"empty.txt", nil, nil)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "", contents(t, dir, "empty.txt"))
+
+	// Make a directory
+	resp, _ = do(t, "MKCOL", url+"new%20dir", nil, nil)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.True(t, exists(dir, "new dir"))
+	resp, _ = do(t, "MKCOL", url+"new%20dir", nil, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	resp, _ = do(t, "MKCOL", url+"missing/dir", nil, nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// Copy a file
+	resp, _ = do(t, "COPY", url+"one.txt", nil, map[string]string{"Destination": url + "new%20dir/copy.txt"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "0123456789", contents(t, dir, "one.txt"))
+	assert.Equal(t, "0123456789", contents(t, dir, "new dir/copy.txt"))
+
+	// Copy without overwrite
+	resp, _ = do(t, "COPY", url+"one.txt", nil, map[string]string{"Destination": url + "new.txt", "Overwrite": "F"})
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	assert.Equal(t, "sausage", contents(t, dir, "new.txt"))
+
+	// Copy a directory
+	resp, _ = do(t, "COPY", url+"sub%20dir/", nil, map[string]string{"Destination": url + "new%20dir/sub"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "hello", contents(t, dir, "new dir/sub/two.txt"))
+
+	// Move a file
+	resp, _ = do(t, "MOVE", url+"new.txt", nil, map[string]string{"Destination": url + "new%20dir/moved.txt"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.False(t, exists(dir, "new.txt"))
+	assert.Equal(t, "sausage", contents(t, dir, "new dir/moved.txt"))
+
+	// Move a directory
+	resp, _ = do(t, "MOVE", url+"new%20dir/", nil, map[string]string{"Destination": url + "moved%20dir"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.False(t, exists(dir, "new dir"))
+	assert.Equal(t, "sausage", contents(t, dir, "moved dir/moved.txt"))
+
+	// The moved directory can be listed
+	resp, body = do(t, "PROPFIND", url+"moved%20dir/", nil, map[string]string{"Depth": "1"})
+	assert.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+	assert.Contains(t, body, "<D:href>/moved%20dir/copy.txt</D:href>")
+
+	// Delete a file
+	resp, _ = do(t, "DELETE", url+"empty.txt", nil, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.False(t, exists(dir, "empty.txt"))
+
+	// Delete a directory recursively
+	resp, _ = do(t, "DELETE", url+"moved%20dir/", nil, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.False(t, exists(dir, "moved dir"))
+
+	// Delete something which doesn't exist
+	resp, _ = do(t, "DELETE", url+"notfound.txt", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServeWebdavReadOnly(t *testing.T) {
+	mountlib.ReadOnly = true
+	defer func() { mountlib.ReadOnly = false }()
+	s, dir, cleanup := startServer(t)
+	defer cleanup()
+	url := s.srv.URL()
+
+	resp, body := do(t, "GET", url+"one.txt", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "0123456789", body)
+
+	resp, _ = do(t, "PUT", url+"new.txt", strings.NewReader("potato"), nil)
+	assert.NotEqual(t, http.StatusCreated, resp.StatusCode)
+	assert.False(t, exists(dir, "new.txt"))
+
+	resp, _ = do(t, "MKCOL", url+"new", nil, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	assert.False(t, exists(dir, "new"))
+
+	resp, _ = do(t, "DELETE", url+"one.txt", nil, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	assert.True(t, exists(dir, "one.txt"))
+}
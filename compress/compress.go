@@ -0,0 +1,793 @@
+// Package compress provides wrappers for Fs and Object which
+// compress the data
+package compress
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// Suffixes added to the names of files on the wrapped remote
+const (
+	compressedSuffix   = ".gz"
+	uncompressedSuffix = ".bin"
+)
+
+// maxCachedDirs is the most directories whose names existingObject
+// remembers
+const maxCachedDirs = 100
+
+// compressedRe matches the names of compressed files returning the
+// original name and size in hex
+var compressedRe = regexp.MustCompile(`^(.+)\.([0-9a-f]+)` + regexp.QuoteMeta(compressedSuffix) + `$`)
+
+// Extensions of files which are already compressed so are stored
+// as they are
+var uncompressibleExtensions = map[string]bool{
+	".7z": true, ".aac": true, ".avi": true, ".bz2": true, ".deb": true,
+	".docx": true, ".flac": true, ".gif": true, ".gz": true, ".jar": true,
+	".jpeg": true, ".jpg": true, ".lz": true, ".lzma": true, ".m4a": true,
+	".m4v": true, ".mkv": true, ".mov": true, ".mp3": true, ".mp4": true,
+	".ogg": true, ".png": true, ".rar": true, ".rpm": true, ".tgz": true,
+	".webm": true, ".webp": true, ".xlsx": true, ".xz": true, ".zip": true,
+	".zst": true,
+}
+
+// MIME types of files which are already compressed, as well as
+// audio/*, image/* and video/* apart from the xml based ones
+var uncompressibleMimeTypes = map[string]bool{
+	"application/gzip":             true,
+	"application/pdf":              true,
+	"application/x-7z-compressed":  true,
+	"application/x-bzip2":          true,
+	"application/x-gzip":           true,
+	"application/x-rar-compressed": true,
+	"application/x-xz":             true,
+	"application/zip":              true,
+}
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "compress",
+		Description: "Compress a remote",
+		NewFs:       NewFs,
+		Options: []fs.Option{{
+			Name: "remote",
+			Help: "Remote to compress.\nNormally should contain a ':' and a path, eg \"myremote:path/to/dir\",\n\"myremote:bucket\" or maybe \"myremote:\" (not recommended).",
+		}, {
+			Name:     "level",
+			Help:     "GZIP compression level (1-9).\nLeave blank to use the default.",
+			Optional: true,
+			Examples: []fs.OptionExample{{
+				Value: "1",
+				Help:  "Fastest compression",
+			}, {
+				Value: "6",
+				Help:  "Default compression",
+			}, {
+				Value: "9",
+				Help:  "Best compression",
+			}},
+		}},
+	})
+}
+
+// Fs represents a wrapped fs.Fs
+type Fs struct {
+	fs.Fs
+	name      string
+	root      string
+	features  *fs.Features // optional features
+	level     int          // gzip compression level
+	blockSize int          // size of the blocks of data compressed
+
+	// names on the wrapped remote of the files in up to
+	// maxCachedDirs directories which have been put into, by
+	// directory and original name
+	dirsMu sync.Mutex
+	dirs   map[string]map[string]string
+}
+
+// NewFs contstructs an Fs from the path, container:path
+func NewFs(name, rpath string) (fs.Fs, error) {
+	level := gzip.DefaultCompression
+	if value := fs.ConfigFileGet(name, "level"); value != "" {
+		var err error
+		level, err = strconv.Atoi(value)
+		if err != nil || level < gzip.BestSpeed || level > gzip.BestCompression {
+			return nil, errors.Errorf("level must be a number from %d to %d - not %q", gzip.BestSpeed, gzip.BestCompression, value)
+		}
+	}
+	remote := fs.ConfigFileGet(name, "remote")
+	if strings.HasPrefix(remote, name+":") {
+		return nil, errors.New("can't point compress remote at itself - check the value of the remote setting")
+	}
+	f, err := newFs(name, remote, rpath, level)
+	if err != nil {
+		return nil, err
+	}
+	// The names of files on the wrapped remote include their size
+	// so see if rpath is a file by looking it up in its parent
+	if rpath != "" {
+		parent := path.Dir(rpath)
+		if parent == "." {
+			parent = ""
+		}
+		parentFs, err := newFs(name, remote, parent, level)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := parentFs.NewObject(path.Base(rpath)); err == nil {
+			return parentFs, fs.ErrorIsFile
+		}
+	}
+	return f, nil
+}
+
+// newFs makes an Fs compressing remote/rpath
+func newFs(name, remote, rpath string, level int) (*Fs, error) {
+	remotePath := path.Join(remote, rpath)
+	wrappedFs, err := fs.NewFs(remotePath)
+	if err != fs.ErrorIsFile && err != nil {
+		return nil, errors.Wrapf(err, "failed to make remote %q to wrap", remotePath)
+	}
+	f := &Fs{
+		Fs:        wrappedFs,
+		name:      name,
+		root:      rpath,
+		level:     level,
+		blockSize: defaultBlockSize,
+	}
+	// the features here are ones we could support, and they are
+	// ANDed with the ones from wrappedFs
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		ReadMimeType:            false,
+		WriteMimeType:           false,
+		BucketBased:             true,
+		CanHaveEmptyDirectories: true,
+	}).Fill(f).Mask(wrappedFs)
+	return f, nil
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// String returns a description of the FS
+func (f *Fs) String() string {
+	return fmt.Sprintf("Compressed drive '%s:%s'", f.name, f.root)
+}
+
+// encodeName returns the name of the file remote of size on the
+// wrapped remote
+func encodeName(remote string, size int64, compressed bool) string {
+	if !compressed {
+		return remote + uncompressedSuffix
+	}
+	return fmt.Sprintf("%s.%x%s", remote, size, compressedSuffix)
+}
+
+// decodeName returns the original name of the file called name on
+// the wrapped remote, its size if compressed and whether it is
+// compressed.  It returns an error if name isn't an encoded name.
+func decodeName(name string) (remote string, size int64, compressed bool, err error) {
+	if strings.HasSuffix(name, uncompressedSuffix) && len(name) > len(uncompressedSuffix) {
+		return name[:len(name)-len(uncompressedSuffix)], -1, false, nil
+	}
+	match := compressedRe.FindStringSubmatch(name)
+	if match == nil {
+		return "", -1, false, errors.New("not a compressed or uncompressed file name")
+	}
+	size, err = strconv.ParseInt(match[2], 16, 64)
+	if err != nil {
+		return "", -1, false, errors.Wrap(err, "bad size in file name")
+	}
+	return match[1], size, true, nil
+}
+
+// compressible returns whether src should be compressed
+func compressible(src fs.ObjectInfo) bool {
+	if uncompressibleExtensions[strings.ToLower(path.Ext(src.Remote()))] {
+		return false
+	}
+	mimeType := fs.MimeType(src)
+	if i := strings.IndexRune(mimeType, ';'); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	if uncompressibleMimeTypes[mimeType] {
+		return false
+	}
+	if strings.HasSuffix(mimeType, "+xml") {
+		return true
+	}
+	for _, prefix := range []string{"audio/", "image/", "video/"} {
+		if strings.HasPrefix(mimeType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeEntries decodes the names of the entries listed from the
+// wrapped remote, skipping any which can't be decoded.  This alters
+// entries returning it as newEntries.
+func (f *Fs) decodeEntries(entries fs.DirEntries) (newEntries fs.DirEntries, err error) {
+	newEntries = entries[:0] // in place filter
+	for _, entry := range entries {
+		switch x := entry.(type) {
+		case fs.Object:
+			o, err := f.newObject(x)
+			if err != nil {
+				fs.Debugf(x, "Skipping undecodable file name: %v", err)
+				continue
+			}
+			newEntries = append(newEntries, o)
+		case fs.Directory:
+			newEntries = append(newEntries, x)
+		default:
+			return nil, errors.Errorf("Unknown object type %T", entry)
+		}
+	}
+	return newEntries, nil
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(dir string) (entries fs.DirEntries, err error) {
+	entries, err = f.Fs.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	return f.decodeEntries(entries)
+}
+
+// ListR lists the objects and directories of the Fs starting
+// from dir recursively into out.
+//
+// dir should be "" to start from the root, and should not
+// have trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+//
+// It should call callback for each tranche of entries read.
+// These need not be returned in any particular order.  If
+// callback returns an error then the listing will stop
+// immediately.
+//
+// Don't implement this unless you have a more efficient way
+// of listing recursively that doing a directory traversal.
+func (f *Fs) ListR(dir string, callback fs.ListRCallback) (err error) {
+	return f.Fs.Features().ListR(dir, func(entries fs.DirEntries) error {
+		newEntries, err := f.decodeEntries(entries)
+		if err != nil {
+			return err
+		}
+		return callback(newEntries)
+	})
+}
+
+// NewObject finds the Object at remote.
+//
+// As the names of compressed files include their size this lists
+// the directory remote is in to find it.
+func (f *Fs) NewObject(remote string) (fs.Object, error) {
+	o, err := f.Fs.NewObject(encodeName(remote, -1, false))
+	if err == nil {
+		return f.newObject(o)
+	}
+	if err != fs.ErrorObjectNotFound {
+		return nil, err
+	}
+	entries, err := f.Fs.List(parentDir(remote))
+	if err == fs.ErrorDirNotFound {
+		return nil, fs.ErrorObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		o, ok := entry.(fs.Object)
+		if !ok {
+			continue
+		}
+		if name, _, compressed, err := decodeName(o.Remote()); err == nil && compressed && name == remote {
+			return f.newObject(o)
+		}
+	}
+	return nil, fs.ErrorObjectNotFound
+}
+
+// parentDir returns the directory remote is in
+func parentDir(remote string) string {
+	dir := path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	return dir
+}
+
+// existingObject finds the Object at remote before it is overwritten.
+//
+// Unlike NewObject this doesn't list the directory remote is in each
+// time.  Instead the names of the files in it are listed the first
+// time and remembered, along with those of the files put there since,
+// so putting many files into a directory only lists it once.
+func (f *Fs) existingObject(remote string) (*Object, error) {
+	dir := parentDir(remote)
+	f.dirsMu.Lock()
+	names, ok := f.dirs[dir]
+	f.dirsMu.Unlock()
+	if !ok {
+		entries, err := f.Fs.List(dir)
+		if err != nil && err != fs.ErrorDirNotFound {
+			return nil, err
+		}
+		names = make(map[string]string)
+		for _, entry := range entries {
+			if o, ok := entry.(fs.Object); ok {
+				if name, _, _, err := decodeName(o.Remote()); err == nil {
+					names[name] = o.Remote()
+				}
+			}
+		}
+		f.dirsMu.Lock()
+		if f.dirs == nil {
+			f.dirs = make(map[string]map[string]string)
+		}
+		// forget any directory to make room
+		for oldDir := range f.dirs {
+			if len(f.dirs) < maxCachedDirs {
+				break
+			}
+			delete(f.dirs, oldDir)
+		}
+		f.dirs[dir] = names
+		f.dirsMu.Unlock()
+	}
+	f.dirsMu.Lock()
+	name := names[remote]
+	f.dirsMu.Unlock()
+	if name == "" {
+		return nil, fs.ErrorObjectNotFound
+	}
+	o, err := f.Fs.NewObject(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o)
+}
+
+// setName records that the file remote is called name on the wrapped
+// remote if the directory it is in has been listed by existingObject
+func (f *Fs) setName(remote, name string) {
+	f.dirsMu.Lock()
+	if names := f.dirs[parentDir(remote)]; names != nil {
+		names[remote] = name
+	}
+	f.dirsMu.Unlock()
+}
+
+// forgetName records that the file remote has been removed if the
+// directory it is in has been listed by existingObject
+func (f *Fs) forgetName(remote string) {
+	f.dirsMu.Lock()
+	if names := f.dirs[parentDir(remote)]; names != nil {
+		delete(names, remote)
+	}
+	f.dirsMu.Unlock()
+}
+
+// forgetNames forgets the names of the files listed by existingObject
+// as they may have changed
+func (f *Fs) forgetNames() {
+	f.dirsMu.Lock()
+	f.dirs = nil
+	f.dirsMu.Unlock()
+}
+
+// put uploads in to the remote path with the modTime given of the
+// given size, compressing it unless it looks already compressed
+func (f *Fs) put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (*Object, error) {
+	if !compressible(src) {
+		o, err := f.Fs.Put(in, f.newObjectInfo(src, src.Size(), false, src.Size()), options...)
+		if err != nil {
+			return nil, err
+		}
+		f.setName(src.Remote(), o.Remote())
+		return f.newObject(o)
+	}
+
+	// The compressed size is needed to upload it so compress
+	// into a temporary file first
+	tmp, err := ioutil.TempFile("", "rclone-compress")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to make temporary file")
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	size, err := compressData(tmp, in, f.blockSize, f.level)
+	if err != nil {
+		return nil, err
+	}
+	if src.Size() >= 0 && size != src.Size() {
+		return nil, errors.Errorf("read %d bytes expecting %d", size, src.Size())
+	}
+	compressedSize, err := tmp.Seek(0, 1)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tmp.Seek(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	o, err := f.Fs.Put(tmp, f.newObjectInfo(src, size, true, compressedSize), options...)
+	if err != nil {
+		return nil, err
+	}
+	f.setName(src.Remote(), o.Remote())
+	return f.newObject(o)
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	o, err := f.existingObject(src.Remote())
+	switch err {
+	case nil:
+		return o, o.Update(in, src, options...)
+	case fs.ErrorObjectNotFound:
+		return f.put(in, src, options...)
+	default:
+		return nil, err
+	}
+}
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() fs.HashSet {
+	return fs.HashSet(fs.HashNone)
+}
+
+// Purge all files in the root and the root directory
+//
+// Implement this if you have a way of deleting all the files
+// quicker than just running Remove() on the result of List()
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge() error {
+	do := f.Fs.Features().Purge
+	if do == nil {
+		return fs.ErrorCantPurge
+	}
+	f.forgetNames()
+	return do()
+}
+
+// copyOrMove copies or moves src to remote with do which is the
+// Copy or Move of the wrapped remote, removing any file which was
+// there before if its name on the wrapped remote was different
+func (f *Fs) copyOrMove(src *Object, remote string, do func(fs.Object, string) (fs.Object, error)) (fs.Object, error) {
+	existing, err := f.existingObject(remote)
+	if err != nil && err != fs.ErrorObjectNotFound {
+		return nil, err
+	}
+	newName := encodeName(remote, src.size, src.compressed)
+	o, err := do(src.Object, newName)
+	if err != nil {
+		return nil, err
+	}
+	f.setName(remote, newName)
+	if existing != nil && existing.Object.Remote() != newName {
+		err = existing.Object.Remove()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to remove old version")
+		}
+	}
+	return f.newObject(o)
+}
+
+// Copy src to this remote using server side copy operations.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Copy
+	if do == nil {
+		return nil, fs.ErrorCantCopy
+	}
+	o, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantCopy
+	}
+	return f.copyOrMove(o, remote, do)
+}
+
+// Move src to this remote using server side move operations.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Move
+	if do == nil {
+		return nil, fs.ErrorCantMove
+	}
+	o, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantMove
+	}
+	newO, err := f.copyOrMove(o, remote, do)
+	if err != nil {
+		return nil, err
+	}
+	o.f.forgetName(o.remote)
+	return newO, nil
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(src fs.Fs, srcRemote, dstRemote string) error {
+	do := f.Fs.Features().DirMove
+	if do == nil {
+		return fs.ErrorCantDirMove
+	}
+	srcFs, ok := src.(*Fs)
+	if !ok {
+		fs.Debugf(srcFs, "Can't move directory - not same remote type")
+		return fs.ErrorCantDirMove
+	}
+	f.forgetNames()
+	return do(srcFs.Fs, srcRemote, dstRemote)
+}
+
+// CleanUp the trash in the Fs
+//
+// Implement this if you have a way of emptying the trash or
+// otherwise cleaning up old versions of files.
+func (f *Fs) CleanUp() error {
+	do := f.Fs.Features().CleanUp
+	if do == nil {
+		return errors.New("can't CleanUp")
+	}
+	return do()
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs {
+	return f.Fs
+}
+
+// Object describes a wrapped for being read from the Fs
+//
+// This decompresses the data when it is read
+type Object struct {
+	fs.Object
+	f          *Fs
+	remote     string // the original name
+	size       int64  // the original size
+	compressed bool   // whether the data is compressed
+}
+
+// newObject makes an Object from o on the wrapped remote returning an
+// error if its name can't be decoded
+func (f *Fs) newObject(o fs.Object) (*Object, error) {
+	remote, size, compressed, err := decodeName(o.Remote())
+	if err != nil {
+		return nil, err
+	}
+	if !compressed {
+		size = o.Size()
+	}
+	return &Object{
+		Object:     o,
+		f:          f,
+		remote:     remote,
+		size:       size,
+		compressed: compressed,
+	}, nil
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the original file
+func (o *Object) Size() int64 {
+	return o.size
+}
+
+// Hash returns the selected checksum of the file
+// If no checksum is available it returns ""
+func (o *Object) Hash(hash fs.HashType) (string, error) {
+	return "", nil
+}
+
+// UnWrap returns the wrapped Object
+func (o *Object) UnWrap() fs.Object {
+	return o.Object
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+func (o *Object) Open(options ...fs.OpenOption) (rc io.ReadCloser, err error) {
+	if !o.compressed {
+		return o.Object.Open(options...)
+	}
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(o.Size())
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	return decompressData(func(offset, limit int64) (io.ReadCloser, error) {
+		var openOptions []fs.OpenOption
+		if offset > 0 {
+			openOptions = append(openOptions, &fs.SeekOption{Offset: offset})
+		}
+		in, err := o.Object.Open(openOptions...)
+		if err != nil {
+			return nil, err
+		}
+		return fs.NewLimitedReadCloser(in, limit), nil
+	}, o.Object.Size(), offset, limit)
+}
+
+// Update in to the object with the modTime given of the given size
+//
+// If the name on the wrapped remote changes the old version is
+// removed.
+func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	newO, err := o.f.put(in, src, options...)
+	if err != nil {
+		return err
+	}
+	if newO.Object.Remote() != o.Object.Remote() {
+		err = o.Object.Remove()
+		if err != nil {
+			return errors.Wrap(err, "failed to remove old version")
+		}
+	}
+	*o = *newO
+	return nil
+}
+
+// Remove an object
+func (o *Object) Remove() error {
+	err := o.Object.Remove()
+	if err != nil {
+		return err
+	}
+	o.f.forgetName(o.remote)
+	return nil
+}
+
+// ObjectInfo describes a wrapped fs.ObjectInfo for being the source
+// of the data to upload
+type ObjectInfo struct {
+	fs.ObjectInfo
+	f              *Fs
+	size           int64 // size of the original data
+	compressed     bool  // whether the data is compressed
+	compressedSize int64 // size of the data uploaded
+}
+
+func (f *Fs) newObjectInfo(src fs.ObjectInfo, size int64, compressed bool, compressedSize int64) *ObjectInfo {
+	return &ObjectInfo{
+		ObjectInfo:     src,
+		f:              f,
+		size:           size,
+		compressed:     compressed,
+		compressedSize: compressedSize,
+	}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *ObjectInfo) Fs() fs.Info {
+	return o.f
+}
+
+// Remote returns the remote path
+func (o *ObjectInfo) Remote() string {
+	return encodeName(o.ObjectInfo.Remote(), o.size, o.compressed)
+}
+
+// Size returns the size of the data uploaded
+func (o *ObjectInfo) Size() int64 {
+	return o.compressedSize
+}
+
+// Hash returns the selected checksum of the file
+// If no checksum is available it returns ""
+func (o *ObjectInfo) Hash(hash fs.HashType) (string, error) {
+	if !o.compressed {
+		return o.ObjectInfo.Hash(hash)
+	}
+	return "", nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs         = (*Fs)(nil)
+	_ fs.Purger     = (*Fs)(nil)
+	_ fs.Copier     = (*Fs)(nil)
+	_ fs.Mover      = (*Fs)(nil)
+	_ fs.DirMover   = (*Fs)(nil)
+	_ fs.CleanUpper = (*Fs)(nil)
+	_ fs.UnWrapper  = (*Fs)(nil)
+	_ fs.ListRer    = (*Fs)(nil)
+	_ fs.ObjectInfo = (*ObjectInfo)(nil)
+	_ fs.Object     = (*Object)(nil)
+)
@@ -0,0 +1,260 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	_ "github.com/ncw/rclone/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFs makes a compress remote with 4 byte blocks wrapping a
+// temporary local directory returning the Fs, the local directory and
+// a function to tidy up
+func newTestFs(t *testing.T) (*Fs, string, func()) {
+	dir, cleanup := fstest.NewLocalDir(t)
+	f, err := fstest.NewConfiguredFs("TestCompressInternal", "type", "compress", "remote", dir)
+	require.NoError(t, err)
+	f.(*Fs).blockSize = 4
+	return f.(*Fs), dir, cleanup
+}
+
+// opener returns an openFn reading data counting the bytes read
+func opener(data []byte, read *int64) openFn {
+	return func(offset, limit int64) (io.ReadCloser, error) {
+		end := int64(len(data))
+		if limit >= 0 && offset+limit < end {
+			end = offset + limit
+		}
+		*read += end - offset
+		return ioutil.NopCloser(bytes.NewReader(data[offset:end])), nil
+	}
+}
+
+func TestFormat(t *testing.T) {
+	var original []byte
+	for i := 0; i < 100; i++ {
+		original = append(original, fmt.Sprintf("line %d\n", i)...)
+	}
+	var buf bytes.Buffer
+	size, err := compressData(&buf, bytes.NewReader(original), 64, gzip.BestCompression)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(original)), size)
+	compressed := buf.Bytes()
+
+	// The blocks can be read by anything which reads gzip
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	zr.Multistream(false)
+	data, err := ioutil.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, string(original[:64]), string(data))
+
+	for _, test := range []struct {
+		offset int64
+		limit  int64
+	}{
+		{0, -1},
+		{0, 10},
+		{63, 2},
+		{64, -1},
+		{100, 200},
+		{int64(len(original)) - 1, -1},
+		{int64(len(original)), -1},
+		{int64(len(original)) + 10, -1},
+	} {
+		what := fmt.Sprintf("offset=%d, limit=%d", test.offset, test.limit)
+		var read int64
+		in, err := decompressData(opener(compressed, &read), int64(len(compressed)), test.offset, test.limit)
+		require.NoError(t, err, what)
+		data, err := ioutil.ReadAll(in)
+		require.NoError(t, err, what)
+		require.NoError(t, in.Close(), what)
+		want := original
+		if test.offset < int64(len(want)) {
+			want = want[test.offset:]
+		} else {
+			want = nil
+		}
+		if test.limit >= 0 && test.limit < int64(len(want)) {
+			want = want[:test.limit]
+		}
+		assert.Equal(t, string(want), string(data), what)
+	}
+
+	// Reading the end of the file doesn't read the start
+	var read int64
+	in, err := decompressData(opener(compressed, &read), int64(len(compressed)), int64(len(original))-1, -1)
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(in)
+	require.NoError(t, err)
+	assert.True(t, read < int64(len(compressed))/2, "read %d of %d", read, len(compressed))
+
+	// Corrupt data is detected
+	_, err = decompressData(opener(compressed[:8], &read), 8, 0, -1)
+	assert.Error(t, err)
+	_, err = decompressData(opener(original, &read), int64(len(original)), 0, -1)
+	assert.Error(t, err)
+}
+
+func TestNames(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		remote     string
+		size       int64
+		compressed bool
+		err        bool
+	}{
+		{"file.txt.bin", "file.txt", -1, false, false},
+		{"file.txt.1f.gz", "file.txt", 31, true, false},
+		{"dir/a.b.c.0.gz", "dir/a.b.c", 0, true, false},
+		{"file.txt", "", -1, false, true},
+		{".bin", "", -1, false, true},
+		{"file.gz", "", -1, false, true},
+		{"file.xyz.gz", "", -1, false, true},
+	} {
+		remote, size, compressed, err := decodeName(test.name)
+		assert.Equal(t, test.err, err != nil, test.name)
+		assert.Equal(t, test.remote, remote, test.name)
+		assert.Equal(t, test.size, size, test.name)
+		assert.Equal(t, test.compressed, compressed, test.name)
+		if err == nil {
+			assert.Equal(t, test.name, encodeName(remote, size, compressed))
+		}
+	}
+}
+
+func TestCompressible(t *testing.T) {
+	for _, test := range []struct {
+		remote string
+		want   bool
+	}{
+		{"file.txt", true},
+		{"file.csv", true},
+		{"file", true},
+		{"file.svg", true},
+		{"file.GZ", false},
+		{"file.zip", false},
+		{"file.jpg", false},
+		{"file.mp4", false},
+		{"file.pdf", false},
+	} {
+		src := fs.NewStaticObjectInfo(test.remote, fstest.Time("2001-02-03T04:05:06Z"), 1, true, nil, nil)
+		assert.Equal(t, test.want, compressible(src), test.remote)
+	}
+}
+
+func TestCompressed(t *testing.T) {
+	f, dir, cleanup := newTestFs(t)
+	defer cleanup()
+
+	contents := "0123456789"
+	o := fstest.PutFile(t, f, "file.txt", contents)
+	assert.Equal(t, int64(10), o.Size())
+	assert.Equal(t, []string{"file.txt.a.gz"}, fstest.LocalNames(t, dir))
+	fstest.PutFile(t, f, "photo.jpg", "abc")
+	assert.Equal(t, []string{"file.txt.a.gz", "photo.jpg.bin"}, fstest.LocalNames(t, dir))
+
+	// The listing shows the original names, sizes and modtimes
+	entries, err := f.List("")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(entries))
+	assert.Equal(t, "file.txt", entries[0].Remote())
+	assert.Equal(t, int64(10), entries[0].Size())
+	assert.True(t, fstest.Time("2001-02-03T04:05:06Z").Equal(entries[0].ModTime()))
+	assert.Equal(t, "photo.jpg", entries[1].Remote())
+	assert.Equal(t, int64(3), entries[1].Size())
+
+	assert.Equal(t, contents, fstest.ReadObject(t, f, "file.txt"))
+	assert.Equal(t, "3456789", fstest.ReadObject(t, f, "file.txt", &fs.SeekOption{Offset: 3}))
+	assert.Equal(t, "2345", fstest.ReadObject(t, f, "file.txt", &fs.RangeOption{Start: 2, End: 5}))
+	assert.Equal(t, "89", fstest.ReadObject(t, f, "file.txt", &fs.RangeOption{Start: -1, End: 2}))
+	assert.Equal(t, "", fstest.ReadObject(t, f, "file.txt", &fs.SeekOption{Offset: 10}))
+	assert.Equal(t, "bc", fstest.ReadObject(t, f, "photo.jpg", &fs.SeekOption{Offset: 1}))
+
+	// Updating to a different size renames the file
+	fstest.PutFile(t, f, "file.txt", "abcdef")
+	assert.Equal(t, []string{"file.txt.6.gz", "photo.jpg.bin"}, fstest.LocalNames(t, dir))
+	assert.Equal(t, "abcdef", fstest.ReadObject(t, f, "file.txt"))
+
+	// Files which can't be decoded are ignored
+	require.NoError(t, ioutil.WriteFile(dir+"/other.txt", []byte("x"), 0600))
+	entries, err = f.List("")
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+	_, err = f.NewObject("other.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+}
+
+func TestPutListsOnce(t *testing.T) {
+	f, dir, cleanup := newTestFs(t)
+	defer cleanup()
+	fstest.PutFile(t, f, "dir/a.txt", "0123456789")
+	assert.Equal(t, map[string]string{"dir/a.txt": "dir/a.txt.a.gz"}, f.dirs["dir"])
+	fstest.PutFile(t, f, "dir/b.txt", "0123")
+	assert.Equal(t, map[string]string{"dir/a.txt": "dir/a.txt.a.gz", "dir/b.txt": "dir/b.txt.4.gz"}, f.dirs["dir"])
+
+	// Files put since the directory was listed are replaced
+	fstest.PutFile(t, f, "dir/b.txt", "012345")
+	assert.Equal(t, []string{"a.txt.a.gz", "b.txt.6.gz"}, fstest.LocalNames(t, dir+"/dir"))
+	assert.Equal(t, "012345", fstest.ReadObject(t, f, "dir/b.txt"))
+
+	f.forgetNames()
+	assert.Nil(t, f.dirs)
+	fstest.PutFile(t, f, "dir/a.txt", "01")
+	assert.Equal(t, []string{"a.txt.2.gz", "b.txt.6.gz"}, fstest.LocalNames(t, dir+"/dir"))
+}
+
+func TestPutNamesForgotten(t *testing.T) {
+	f, _, cleanup := newTestFs(t)
+	defer cleanup()
+	a := fstest.PutFile(t, f, "dir/a.txt", "0123456789")
+	b := fstest.PutFile(t, f, "dir/b.txt", "0123")
+	fstest.PutFile(t, f, "dir/c.txt", "01")
+	assert.Equal(t, 3, len(f.dirs["dir"]))
+
+	// Removed and moved files are forgotten
+	require.NoError(t, a.Remove())
+	_, err := f.Move(b, "dir/d.txt")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"dir/c.txt": "dir/c.txt.2.gz", "dir/d.txt": "dir/d.txt.4.gz"}, f.dirs["dir"])
+
+	// Only maxCachedDirs directories are remembered
+	for i := 0; i < maxCachedDirs+10; i++ {
+		_, err = f.existingObject(fmt.Sprintf("dir%d/file.txt", i))
+		assert.Equal(t, fs.ErrorObjectNotFound, err)
+	}
+	assert.Equal(t, maxCachedDirs, len(f.dirs))
+}
+
+func TestCompressedMove(t *testing.T) {
+	f, dir, cleanup := newTestFs(t)
+	defer cleanup()
+	o := fstest.PutFile(t, f, "file.txt", "0123456789")
+	// a different size file to be overwritten
+	fstest.PutFile(t, f, "moved.txt", "0123456789abcdef")
+
+	moved, err := f.Move(o, "moved.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), moved.Size())
+	assert.Equal(t, []string{"moved.txt.a.gz"}, fstest.LocalNames(t, dir))
+	assert.Equal(t, "0123456789", fstest.ReadObject(t, f, "moved.txt"))
+}
+
+func TestNewFsFile(t *testing.T) {
+	f, _, cleanup := newTestFs(t)
+	defer cleanup()
+	fstest.PutFile(t, f, "file.txt", "0123456789")
+
+	f2, err := fs.NewFs("TestCompressInternal:file.txt")
+	assert.Equal(t, fs.ErrorIsFile, err)
+	assert.Equal(t, "", f2.Root())
+	assert.Equal(t, "0123456789", fstest.ReadObject(t, f2, "file.txt"))
+}
@@ -0,0 +1,203 @@
+// The block based compressed data format
+
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// The compressed data is a series of gzip members each holding
+// blockSize bytes of the original data (the last may hold less).
+// These are followed by an index of the compressed size of each
+// member as big endian uint32s and a footer holding footerMagic, the
+// block size and the number of blocks as big endian uint32s.
+//
+// The members can be decompressed by anything which reads gzip
+// streams, and the index lets a reader start at the member holding
+// any offset into the original data.
+const (
+	defaultBlockSize = 1024 * 1024
+	footerMagic      = "RCZ1"
+	footerSize       = 12
+)
+
+// footer is the end of the compressed data
+type footer struct {
+	Magic     [4]byte
+	BlockSize uint32
+	Blocks    uint32
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write implements io.Writer
+func (c *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// compressData compresses in to out in blocks of blockSize at
+// level returning the size of the data read from in
+func compressData(out io.Writer, in io.Reader, blockSize int, level int) (size int64, err error) {
+	cw := &countingWriter{w: out}
+	zw, err := gzip.NewWriterLevel(cw, level)
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, blockSize)
+	var index []uint32
+	for {
+		n, readErr := io.ReadFull(in, buf)
+		if n > 0 {
+			start := cw.n
+			zw.Reset(cw)
+			_, err = zw.Write(buf[:n])
+			if err == nil {
+				err = zw.Close()
+			}
+			if err != nil {
+				return size, errors.Wrap(err, "failed to compress block")
+			}
+			index = append(index, uint32(cw.n-start))
+			size += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return size, readErr
+		}
+	}
+	err = binary.Write(cw, binary.BigEndian, index)
+	if err != nil {
+		return size, errors.Wrap(err, "failed to write index")
+	}
+	foot := footer{BlockSize: uint32(blockSize), Blocks: uint32(len(index))}
+	copy(foot.Magic[:], footerMagic)
+	err = binary.Write(cw, binary.BigEndian, &foot)
+	if err != nil {
+		return size, errors.Wrap(err, "failed to write footer")
+	}
+	return size, nil
+}
+
+// openFn opens the compressed data at offset for limit bytes
+type openFn func(offset, limit int64) (io.ReadCloser, error)
+
+// readAt reads exactly len(p) bytes of the compressed data at offset
+func readAt(open openFn, p []byte, offset int64) error {
+	in, err := open(offset, int64(len(p)))
+	if err != nil {
+		return err
+	}
+	_, err = io.ReadFull(in, p)
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// decompressReader reads the decompressed data
+type decompressReader struct {
+	io.Reader
+	zr *gzip.Reader
+	in io.ReadCloser
+}
+
+// Close the reader
+func (r *decompressReader) Close() error {
+	err := r.zr.Close()
+	closeErr := r.in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// decompressData returns a reader for limit bytes (or all if -1) of
+// the original data starting at offset from the compressedSize bytes
+// of compressed data read with open.
+//
+// Only the index entries before offset are read and decompression
+// starts at the block containing offset.
+func decompressData(open openFn, compressedSize, offset, limit int64) (io.ReadCloser, error) {
+	if compressedSize < footerSize {
+		return nil, errors.New("compressed data too short")
+	}
+	var footerBuf [footerSize]byte
+	err := readAt(open, footerBuf[:], compressedSize-footerSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read footer")
+	}
+	var foot footer
+	err = binary.Read(bytes.NewReader(footerBuf[:]), binary.BigEndian, &foot)
+	if err != nil {
+		return nil, err
+	}
+	if string(foot.Magic[:]) != footerMagic || foot.BlockSize == 0 {
+		return nil, errors.New("compressed data has a bad footer")
+	}
+	indexStart := compressedSize - footerSize - 4*int64(foot.Blocks)
+	if indexStart < 0 {
+		return nil, errors.New("compressed data has a bad index")
+	}
+	block := offset / int64(foot.BlockSize)
+	if block >= int64(foot.Blocks) || limit == 0 {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+	var blockStart int64
+	if block > 0 {
+		index := make([]uint32, block)
+		indexBuf := make([]byte, 4*block)
+		err = readAt(open, indexBuf, indexStart)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read index")
+		}
+		err = binary.Read(bytes.NewReader(indexBuf), binary.BigEndian, index)
+		if err != nil {
+			return nil, err
+		}
+		for _, size := range index {
+			blockStart += int64(size)
+		}
+		if blockStart >= indexStart {
+			return nil, errors.New("compressed data has a bad index")
+		}
+	}
+	in, err := open(blockStart, indexStart-blockStart)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		_ = in.Close()
+		return nil, errors.Wrap(err, "failed to start decompressing")
+	}
+	skip := offset - block*int64(foot.BlockSize)
+	_, err = io.CopyN(ioutil.Discard, zr, skip)
+	if err == io.EOF {
+		// offset is past the end of the data
+		_ = zr.Close()
+		_ = in.Close()
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+	if err != nil {
+		_ = zr.Close()
+		_ = in.Close()
+		return nil, errors.Wrap(err, "failed to seek in compressed data")
+	}
+	return fs.NewLimitedReadCloser(&decompressReader{Reader: zr, zr: zr, in: in}, limit), nil
+}
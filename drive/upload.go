@@ -14,6 +14,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"regexp"
@@ -48,10 +49,31 @@ type resumableUpload struct {
 	ContentLength int64
 	// Return value
 	ret *drive.File
+	// Saves the session so an interrupted upload can be resumed
+	resume *fs.ResumableUpload
 }
 
 // Upload the io.Reader in of size bytes with contentType and info
-func (f *Fs) Upload(in io.Reader, size int64, contentType string, info *drive.File, remote string) (*drive.File, error) {
+//
+// If the upload of src was interrupted before then it is resumed if
+// possible.
+func (f *Fs) Upload(in io.Reader, size int64, contentType string, info *drive.File, remote string, src fs.ObjectInfo) (*drive.File, error) {
+	rx := &resumableUpload{
+		f:             f,
+		remote:        remote,
+		Media:         in,
+		MediaType:     contentType,
+		ContentLength: size,
+		resume:        fs.NewResumableUpload(f, remote, src, int64(chunkSize)),
+	}
+	if state := rx.resume.Resume(); state != nil {
+		rx.URI = state.Session
+		start, err := rx.transferStatus()
+		if err == nil {
+			return rx.Upload(start)
+		}
+		fs.Debugf(remote, "Can't resume upload - starting again: %v", err)
+	}
 	fileID := info.Id
 	params := make(url.Values)
 	params.Set("alt", "json")
@@ -96,16 +118,9 @@ func (f *Fs) Upload(in io.Reader, size int64, contentType string, info *drive.Fi
 	if err != nil {
 		return nil, err
 	}
-	loc := res.Header.Get("Location")
-	rx := &resumableUpload{
-		f:             f,
-		remote:        remote,
-		URI:           loc,
-		Media:         in,
-		MediaType:     contentType,
-		ContentLength: size,
-	}
-	return rx.Upload()
+	rx.URI = res.Header.Get("Location")
+	rx.resume.Start(rx.URI)
+	return rx.Upload(0)
 }
 
 // Make an http.Request for the range passed in
@@ -123,7 +138,7 @@ func (rx *resumableUpload) makeRequest(start int64, body io.ReadSeeker, reqSize
 
 // rangeRE matches the transfer status response from the server. $1 is
 // the last byte index uploaded.
-var rangeRE = regexp.MustCompile(`^0\-(\d+)$`)
+var rangeRE = regexp.MustCompile(`^bytes=0\-(\d+)$`)
 
 // Query drive for the amount transferred so far
 //
@@ -136,6 +151,9 @@ func (rx *resumableUpload) transferStatus() (start int64, err error) {
 	}
 	defer googleapi.CloseBody(res)
 	if res.StatusCode == http.StatusCreated || res.StatusCode == http.StatusOK {
+		if err = json.NewDecoder(res.Body).Decode(&rx.ret); err != nil {
+			return 0, err
+		}
 		return rx.ContentLength, nil
 	}
 	if res.StatusCode != statusResumeIncomplete {
@@ -146,10 +164,14 @@ func (rx *resumableUpload) transferStatus() (start int64, err error) {
 		return 0, errors.Errorf("unexpected http return code %v", res.StatusCode)
 	}
 	Range := res.Header.Get("Range")
+	if Range == "" {
+		// nothing has been received yet
+		return 0, nil
+	}
 	if m := rangeRE.FindStringSubmatch(Range); len(m) == 2 {
 		start, err = strconv.ParseInt(m[1], 10, 64)
 		if err == nil {
-			return start, nil
+			return start + 1, nil
 		}
 	}
 	return 0, errors.Errorf("unable to parse range %q", Range)
@@ -189,12 +211,19 @@ func (rx *resumableUpload) transferChunk(start int64, chunk io.ReadSeeker, chunk
 	return res.StatusCode, nil
 }
 
-// Upload uploads the chunks from the input
+// Upload uploads the chunks from the input starting at start, the
+// amount the server already has
 // It retries each chunk maxTries times (with a pause of uploadPause between attempts).
-func (rx *resumableUpload) Upload() (*drive.File, error) {
-	start := int64(0)
+func (rx *resumableUpload) Upload(start int64) (*drive.File, error) {
 	var StatusCode int
 	var err error
+	if start > 0 {
+		fs.Debugf(rx.remote, "Resuming upload at offset %d", start)
+		_, err = io.CopyN(ioutil.Discard, rx.Media, start)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to skip data already uploaded")
+		}
+	}
 	for start < rx.ContentLength {
 		reqSize := rx.ContentLength - start
 		if reqSize >= int64(chunkSize) {
@@ -242,5 +271,6 @@ func (rx *resumableUpload) Upload() (*drive.File, error) {
 	if rx.ret == nil {
 		return nil, fs.RetryErrorf("Incomplete upload - retry, last error %d", StatusCode)
 	}
+	rx.resume.Finish()
 	return rx.ret, nil
 }
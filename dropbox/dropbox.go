@@ -26,6 +26,7 @@ import (
 	"crypto/md5"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"path"
 	"regexp"
@@ -807,7 +808,11 @@ func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
 // avoidable request to the Dropbox API that does not carry payload.
 //
 // FIXME buffer chunks to improve upload retries
-func (o *Object) uploadChunked(in0 io.Reader, commitInfo *files.CommitInfo, size int64) (entry *files.FileMetadata, err error) {
+//
+// If the upload of src was interrupted before then it is resumed if
+// possible.
+func (o *Object) uploadChunked(in0 io.Reader, commitInfo *files.CommitInfo, src fs.ObjectInfo) (entry *files.FileMetadata, err error) {
+	size := src.Size()
 	chunkSize := int64(uploadChunkSize)
 	chunks := 0
 	if size != -1 {
@@ -825,28 +830,53 @@ func (o *Object) uploadChunked(in0 io.Reader, commitInfo *files.CommitInfo, size
 		}
 	}
 
-	// write the first chunk
-	fmtChunk(1, false)
-	var res *files.UploadSessionStartResult
-	err = o.fs.pacer.CallNoRetry(func() (bool, error) {
-		res, err = o.fs.srv.UploadSessionStart(&files.UploadSessionStartArg{}, &io.LimitedReader{R: in, N: chunkSize})
-		return shouldRetry(err)
-	})
-	if err != nil {
-		return nil, err
+	var cursor files.UploadSessionCursor
+	currentChunk := 2
+	resume := fs.NewResumableUpload(o.fs, o.remote, src, chunkSize)
+	state := resume.Resume()
+	if state != nil {
+		// carry on with the session of an interrupted upload
+		fs.Debugf(o, "Resuming chunked upload at offset %d", state.Offset)
+		_, err = io.CopyN(ioutil.Discard, in, state.Offset)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to skip data already uploaded")
+		}
+		cursor.SessionId = state.Session
+		currentChunk = int(state.Offset/chunkSize) + 1
+	} else {
+		// write the first chunk
+		fmtChunk(1, false)
+		var res *files.UploadSessionStartResult
+		err = o.fs.pacer.CallNoRetry(func() (bool, error) {
+			res, err = o.fs.srv.UploadSessionStart(&files.UploadSessionStartArg{}, &io.LimitedReader{R: in, N: chunkSize})
+			return shouldRetry(err)
+		})
+		if err != nil {
+			return nil, err
+		}
+		cursor.SessionId = res.SessionId
+		resume.Start(res.SessionId)
+		resume.SetOffset(int64(in.BytesRead()))
+	}
+
+	// There is no way of asking Dropbox about a session, so if the
+	// first request of a resumed upload fails assume the session
+	// has expired and retry the upload from the start
+	checkResumed := func(err error) error {
+		if err != nil && state != nil {
+			resume.Finish()
+			return fs.RetryError(errors.Wrap(err, "failed to resume chunked upload"))
+		}
+		state = nil
+		return err
 	}
 
-	cursor := files.UploadSessionCursor{
-		SessionId: res.SessionId,
-		Offset:    0,
-	}
 	appendArg := files.UploadSessionAppendArg{
 		Cursor: &cursor,
 		Close:  false,
 	}
 
 	// write more whole chunks (if any)
-	currentChunk := 2
 	for {
 		if chunks > 0 && currentChunk >= chunks {
 			// if the size is known, only upload full chunks. Remaining bytes are uploaded with
@@ -863,9 +893,11 @@ func (o *Object) uploadChunked(in0 io.Reader, commitInfo *files.CommitInfo, size
 			err = o.fs.srv.UploadSessionAppendV2(&appendArg, &io.LimitedReader{R: in, N: chunkSize})
 			return shouldRetry(err)
 		})
+		err = checkResumed(err)
 		if err != nil {
 			return nil, err
 		}
+		resume.SetOffset(int64(in.BytesRead()))
 		currentChunk++
 	}
 
@@ -880,9 +912,11 @@ func (o *Object) uploadChunked(in0 io.Reader, commitInfo *files.CommitInfo, size
 		entry, err = o.fs.srv.UploadSessionFinish(args, in)
 		return shouldRetry(err)
 	})
+	err = checkResumed(err)
 	if err != nil {
 		return nil, err
 	}
+	resume.Finish()
 	return entry, nil
 }
 
@@ -906,7 +940,7 @@ func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOptio
 	var err error
 	var entry *files.FileMetadata
 	if size > int64(uploadChunkSize) || size == -1 {
-		entry, err = o.uploadChunked(in, commitInfo, size)
+		entry, err = o.uploadChunked(in, commitInfo, src)
 	} else {
 		err = o.fs.pacer.CallNoRetry(func() (bool, error) {
 			entry, err = o.fs.srv.Upload(commitInfo, in)
@@ -0,0 +1,118 @@
+// Reed-Solomon coding of shards
+
+package erasure
+
+import "github.com/pkg/errors"
+
+// maxShards is the most shards which can be used as the codec needs
+// a distinct field element for each shard
+const maxShards = 256
+
+// codec makes parity shards from data shards and gets the data
+// shards back from any dataShards of the shards.
+//
+// The encoding matrix is the identity on top of a Cauchy matrix.
+// Every square matrix made from rows of a Cauchy matrix is
+// invertible, so the data can be found from any dataShards rows of
+// the encoding matrix.
+type codec struct {
+	dataShards   int
+	parityShards int
+	matrix       matrix // (dataShards+parityShards) x dataShards encoding matrix
+}
+
+// newCodec makes a codec for dataShards data and parityShards parity
+// shards
+func newCodec(dataShards, parityShards int) (*codec, error) {
+	if dataShards < 1 {
+		return nil, errors.New("need at least one data shard")
+	}
+	if parityShards < 0 {
+		return nil, errors.New("can't have a negative number of parity shards")
+	}
+	total := dataShards + parityShards
+	if total > maxShards {
+		return nil, errors.Errorf("can't have more than %d shards", maxShards)
+	}
+	m := newMatrix(total, dataShards)
+	for i := 0; i < dataShards; i++ {
+		m[i][i] = 1
+	}
+	for i := 0; i < parityShards; i++ {
+		// 1/(x_i + y_j) with x_i = dataShards+i and y_j = j
+		// which are all different
+		for j := 0; j < dataShards; j++ {
+			m[dataShards+i][j] = gfInv(byte(dataShards+i) ^ byte(j))
+		}
+	}
+	return &codec{
+		dataShards:   dataShards,
+		parityShards: parityShards,
+		matrix:       m,
+	}, nil
+}
+
+// encode calculates the parity shards from the data shards.  shards
+// must have dataShards+parityShards entries all the same length.
+func (c *codec) encode(shards [][]byte) {
+	for i := 0; i < c.parityShards; i++ {
+		out := shards[c.dataShards+i]
+		for j := range out {
+			out[j] = 0
+		}
+		for j, coefficient := range c.matrix[c.dataShards+i] {
+			mulAdd(out, shards[j], coefficient)
+		}
+	}
+}
+
+// reconstruct fills in the shards which aren't present from the
+// ones which are.  All the shards must be the same length and at
+// least dataShards of them must be present.
+//
+// If parity is false only the data shards are filled in.
+func (c *codec) reconstruct(shards [][]byte, present []bool, parity bool) error {
+	var rows []int
+	missingData := false
+	for i := range shards {
+		if present[i] {
+			if len(rows) < c.dataShards {
+				rows = append(rows, i)
+			}
+		} else if i < c.dataShards {
+			missingData = true
+		}
+	}
+	if len(rows) < c.dataShards {
+		return errors.Errorf("need %d shards but only have %d", c.dataShards, len(rows))
+	}
+	if missingData {
+		// The present shards are the rows of the encoding matrix
+		// times the data, so the data is the inverse of those rows
+		// times the present shards.
+		sub := make(matrix, c.dataShards)
+		for i, row := range rows {
+			sub[i] = c.matrix[row]
+		}
+		inverse, err := sub.invert()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < c.dataShards; i++ {
+			if present[i] {
+				continue
+			}
+			out := shards[i]
+			for j := range out {
+				out[j] = 0
+			}
+			for j, row := range rows {
+				mulAdd(out, shards[row], inverse[i][j])
+			}
+		}
+	}
+	if parity {
+		c.encode(shards)
+	}
+	return nil
+}
@@ -0,0 +1,851 @@
+// Package erasure implements a virtual provider which spreads the
+// data of each object across several remotes with erasure coding.
+package erasure
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// shardSuffix ends the names of the shards on the upstreams
+const shardSuffix = ".ec"
+
+// shardRe matches the names of the shards, which are the name of the
+// object followed by its size and the ID of the upload in hex
+var shardRe = regexp.MustCompile(`^(.+)\.([0-9a-f]+)\.([0-9a-f]{16})` + regexp.QuoteMeta(shardSuffix) + `$`)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "erasure",
+		Description: "Erasure code objects across several remotes",
+		NewFs:       NewFs,
+		Options: []fs.Option{{
+			Name: "remotes",
+			Help: "List of space separated remotes, one for each shard.\nCan be 'remotea:test/dir remoteb:', '\"remotea:test/space dir\" remoteb:', etc.",
+		}, {
+			Name:     "parity_shards",
+			Help:     "Number of parity shards - this many of the remotes can be lost without losing data.",
+			Optional: true,
+			Examples: []fs.OptionExample{{
+				Value: "1",
+				Help:  "One parity shard (default).",
+			}, {
+				Value: "2",
+				Help:  "Two parity shards.",
+			}},
+		}},
+	})
+}
+
+// Fs represents erasure coded objects on several remotes
+type Fs struct {
+	name      string       // name of this remote
+	root      string       // the path we are working on
+	features  *fs.Features // optional features
+	upstreams []fs.Fs      // the remote for each shard
+	codec     *codec       // codes the shards
+}
+
+// parseRemotes splits the remotes config value into a list of
+// remotes, allowing remotes with spaces in to be quoted
+func parseRemotes(value string) (remotes []string, err error) {
+	var (
+		current  []rune
+		inQuotes bool
+		inWord   bool
+	)
+	for _, c := range value {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+			inWord = true
+		case c == ' ' && !inQuotes:
+			if inWord {
+				remotes = append(remotes, string(current))
+			}
+			current, inWord = current[:0], false
+		default:
+			current = append(current, c)
+			inWord = true
+		}
+	}
+	if inQuotes {
+		return nil, errors.Errorf("unterminated quote in remotes %q", value)
+	}
+	if inWord {
+		remotes = append(remotes, string(current))
+	}
+	return remotes, nil
+}
+
+// newUpstreams makes the Fs for each of the remotes at root
+func newUpstreams(remotes []string, root string) (fss []fs.Fs, err error) {
+	for _, remote := range remotes {
+		remotePath := path.Join(remote, root)
+		f, err := fs.NewFs(remotePath)
+		if err != fs.ErrorIsFile && err != nil {
+			return nil, errors.Wrapf(err, "failed to make remote %q to erasure code", remotePath)
+		}
+		fss = append(fss, f)
+	}
+	return fss, nil
+}
+
+// NewFs constructs an Fs from the path.
+//
+// The returned Fs is the actual Fs, referenced by remote in the config
+func NewFs(name, root string) (fs.Fs, error) {
+	remotes, err := parseRemotes(fs.ConfigFileGet(name, "remotes"))
+	if err != nil {
+		return nil, err
+	}
+	for _, remote := range remotes {
+		if strings.HasPrefix(remote, name+":") {
+			return nil, errors.New("can't point erasure remote at itself - check the value of the remotes setting")
+		}
+	}
+	parityShards, err := strconv.Atoi(fs.ConfigFileGet(name, "parity_shards", "1"))
+	if err != nil || parityShards < 1 {
+		return nil, errors.Errorf("bad parity_shards %q", fs.ConfigFileGet(name, "parity_shards"))
+	}
+	if len(remotes) <= parityShards {
+		return nil, errors.Errorf("need more than %d remotes for %d parity shards", parityShards, parityShards)
+	}
+	c, err := newCodec(len(remotes)-parityShards, parityShards)
+	if err != nil {
+		return nil, err
+	}
+	root = strings.Trim(root, "/")
+	f, err := newFs(name, root, remotes, c)
+	if err != nil {
+		return nil, err
+	}
+	// The names of the shards include the size and upload ID of
+	// the file so see if root is a file by looking it up in its
+	// parent
+	if root != "" {
+		parentFs, err := newFs(name, parentDir(root), remotes, c)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := parentFs.NewObject(path.Base(root)); err == nil {
+			return parentFs, fs.ErrorIsFile
+		}
+	}
+	return f, nil
+}
+
+// newFs makes an Fs coding c over the remotes at root
+func newFs(name, root string, remotes []string, c *codec) (*Fs, error) {
+	upstreams, err := newUpstreams(remotes, root)
+	if err != nil {
+		return nil, err
+	}
+	f := &Fs{
+		name:      name,
+		root:      root,
+		upstreams: upstreams,
+		codec:     c,
+	}
+	// the features here are ones we could support, and they are
+	// ANDed with the ones from each of the remotes
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		ReadMimeType:            false,
+		WriteMimeType:           false,
+		BucketBased:             true,
+		CanHaveEmptyDirectories: true,
+	}).Fill(f)
+	for _, upstream := range f.upstreams {
+		f.features.Mask(upstream)
+	}
+	return f, nil
+}
+
+// parentDir returns the directory remote is in
+func parentDir(remote string) string {
+	dir := path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	return dir
+}
+
+// encodeName returns the name of the shards of the upload id of
+// remote of size
+func encodeName(remote string, size int64, id [8]byte) string {
+	return fmt.Sprintf("%s.%x.%x%s", remote, size, id, shardSuffix)
+}
+
+// decodeName returns the name of the object the shard called name is
+// part of, its size and the ID of its upload.  ok is false if name
+// isn't the name of a shard.
+func decodeName(name string) (remote string, size int64, id [8]byte, ok bool) {
+	match := shardRe.FindStringSubmatch(name)
+	if match == nil {
+		return "", -1, id, false
+	}
+	size, err := strconv.ParseInt(match[2], 16, 64)
+	if err != nil {
+		return "", -1, id, false
+	}
+	if _, err = hex.Decode(id[:], []byte(match[3])); err != nil {
+		return "", -1, id, false
+	}
+	return match[1], size, id, true
+}
+
+// foundShard is a shard of an object found on upstream i
+type foundShard struct {
+	i     int
+	shard fs.Object
+	size  int64
+	id    [8]byte
+}
+
+// newObjectFrom makes the Object for remote from the shards found for
+// it.
+//
+// If there are shards from more than one upload, because an update
+// was interrupted or one of the upstreams missed it, the upload with
+// the most shards is used, or the latest of those with the most.  The
+// shards of the other uploads are kept in others.
+func (f *Fs) newObjectFrom(remote string, found []foundShard) *Object {
+	counts := map[[8]byte]int{}
+	for _, s := range found {
+		counts[s.id]++
+	}
+	var best foundShard
+	for i, s := range found {
+		count, bestCount := counts[s.id], counts[best.id]
+		if i == 0 || count > bestCount || (count == bestCount && bytes.Compare(s.id[:], best.id[:]) > 0) {
+			best = s
+		}
+	}
+	o := f.newObject(remote, best.size, best.id)
+	for _, s := range found {
+		if s.id == best.id {
+			o.shards[s.i] = s.shard
+		} else {
+			o.others = append(o.others, s.shard)
+		}
+	}
+	return o
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("erasure root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision is the coarsest precision of all the upstreams
+func (f *Fs) Precision() time.Duration {
+	var precision time.Duration
+	for _, upstream := range f.upstreams {
+		if p := upstream.Precision(); p > precision {
+			precision = p
+		}
+	}
+	return precision
+}
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() fs.HashSet {
+	return fs.HashSet(fs.HashNone)
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// The entries of dir on all the upstreams are merged, so a file is
+// listed if any of its shards are there.  Upstreams which can't be
+// listed are skipped as long as there are enough of the others to
+// read the files.  Where there is a file and a directory with the same
+// name the directory is used.  Files on the upstreams which aren't
+// shards are ignored.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(dir string) (entries fs.DirEntries, err error) {
+	dirFound, listed := false, 0
+	dirs := map[string]bool{}
+	found := map[string][]foundShard{}
+	for i, upstream := range f.upstreams {
+		upstreamEntries, listErr := upstream.List(dir)
+		if listErr == fs.ErrorDirNotFound {
+			listed++
+			continue
+		}
+		if listErr != nil {
+			fs.Debugf(upstream, "Failed to list %q: %v", dir, listErr)
+			err = listErr
+			continue
+		}
+		dirFound = true
+		listed++
+		for _, entry := range upstreamEntries {
+			switch x := entry.(type) {
+			case fs.Object:
+				remote, size, id, ok := decodeName(x.Remote())
+				if !ok {
+					continue
+				}
+				found[remote] = append(found[remote], foundShard{i: i, shard: x, size: size, id: id})
+			case fs.Directory:
+				if !dirs[x.Remote()] {
+					dirs[x.Remote()] = true
+					entries = append(entries, fs.NewDir(x.Remote(), x.ModTime()))
+				}
+			default:
+				return nil, errors.Errorf("unknown object type %T", entry)
+			}
+		}
+	}
+	if listed < f.codec.dataShards {
+		return nil, errors.Wrapf(err, "failed to list %q on enough upstreams", dir)
+	}
+	if !dirFound {
+		return nil, fs.ErrorDirNotFound
+	}
+	for remote, shards := range found {
+		if !dirs[remote] {
+			entries = append(entries, f.newObjectFrom(remote, shards))
+		}
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote.  If it can't be found it
+// returns the error fs.ErrorObjectNotFound.
+//
+// As the names of the shards include the size and upload ID of the
+// file this lists the directory remote is in on each upstream to find
+// them.
+func (f *Fs) NewObject(remote string) (fs.Object, error) {
+	var (
+		found    []foundShard
+		notAFile bool
+		err      error
+	)
+	for i, upstream := range f.upstreams {
+		entries, listErr := upstream.List(parentDir(remote))
+		if listErr == fs.ErrorDirNotFound {
+			continue
+		}
+		if listErr != nil {
+			fs.Debugf(upstream, "Failed to find %q: %v", remote, listErr)
+			err = listErr
+			continue
+		}
+		for _, entry := range entries {
+			switch x := entry.(type) {
+			case fs.Object:
+				if name, size, id, ok := decodeName(x.Remote()); ok && name == remote {
+					found = append(found, foundShard{i: i, shard: x, size: size, id: id})
+				}
+			case fs.Directory:
+				if x.Remote() == remote {
+					notAFile = true
+				}
+			}
+		}
+	}
+	if notAFile {
+		return nil, fs.ErrorNotAFile
+	}
+	if len(found) == 0 {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fs.ErrorObjectNotFound
+	}
+	return f.newObjectFrom(remote, found), nil
+}
+
+// errUploadFinished is returned to the writer of a shard which the
+// upstream has stopped reading
+var errUploadFinished = errors.New("upload finished")
+
+// newID makes an ID for an upload from the time in microseconds
+// followed by 16 random bits, so the IDs of later uploads sort after
+// those of earlier ones
+func newID() (id [8]byte, err error) {
+	var random [2]byte
+	_, err = io.ReadFull(rand.Reader, random[:])
+	if err != nil {
+		return id, err
+	}
+	micros := uint64(time.Now().UnixNano() / 1000)
+	binary.BigEndian.PutUint64(id[:], micros<<16|uint64(binary.BigEndian.Uint16(random[:])))
+	return id, nil
+}
+
+// upload codes size bytes from in into shards and uploads the shards
+// for which upload isn't nil at once, calling upload with a reader
+// for the shard and the info to upload it with.
+//
+// It returns the shard made on each upstream and the errors, one for
+// each upstream.
+func (f *Fs) upload(in io.Reader, h header, remote string, modTime time.Time, upload []func(in io.Reader, info fs.ObjectInfo) (fs.Object, error)) ([]fs.Object, []error) {
+	var (
+		n       = len(f.upstreams)
+		shards  = make([]fs.Object, n)
+		errs    = make([]error, n)
+		writers = make([]io.Writer, n)
+		pipes   []*io.PipeWriter
+		info    = fs.NewStaticObjectInfo(remote, modTime, h.shardSize(), true, nil, f)
+		wg      sync.WaitGroup
+	)
+	for i := range f.upstreams {
+		if upload[i] == nil {
+			continue
+		}
+		pr, pw := io.Pipe()
+		writers[i] = pw
+		pipes = append(pipes, pw)
+		wg.Add(1)
+		go func(i int, pr *io.PipeReader) {
+			defer wg.Done()
+			shards[i], errs[i] = upload[i](pr, info)
+			// Make any further writes to this shard fail
+			_ = pr.CloseWithError(errUploadFinished)
+		}(i, pr)
+	}
+	readErr := encodeData(f.codec, h, in, writers)
+	for _, pw := range pipes {
+		// Closes with io.EOF if readErr is nil
+		_ = pw.CloseWithError(readErr)
+	}
+	wg.Wait()
+	return shards, errs
+}
+
+// removeShards removes shards, logging any which can't be removed
+// with why they were being removed
+func removeShards(shards []fs.Object, why string) {
+	for _, shard := range shards {
+		if shard == nil {
+			continue
+		}
+		if err := shard.Remove(); err != nil && err != fs.ErrorObjectNotFound {
+			fs.Errorf(shard, "Failed to remove shard %s: %v", why, err)
+		}
+	}
+}
+
+// put uploads in as shards to all the upstreams, replacing the
+// shards of old if it is set
+//
+// The names of the shards include the ID of the upload, so the new
+// shards never overwrite the old ones.  The old shards are only
+// removed once all the new ones have been uploaded, so a failed
+// update leaves the old object intact, and if the removal is
+// interrupted the new shards are used as they are from the later
+// upload.
+func (f *Fs) put(in io.Reader, src fs.ObjectInfo, old *Object, options ...fs.OpenOption) (*Object, error) {
+	size := src.Size()
+	if size < 0 {
+		return nil, errors.New("can't upload files of unknown size")
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to make upload ID")
+	}
+	h := newHeader(f.codec, size, id)
+	remote := src.Remote()
+	upload := make([]func(io.Reader, fs.ObjectInfo) (fs.Object, error), len(f.upstreams))
+	for i := range f.upstreams {
+		upstream := f.upstreams[i]
+		upload[i] = func(in io.Reader, info fs.ObjectInfo) (fs.Object, error) {
+			return upstream.Put(in, info, options...)
+		}
+	}
+	shards, errs := f.upload(in, h, encodeName(remote, size, id), src.ModTime(), upload)
+	for i, err := range errs {
+		if err != nil {
+			// Remove the new shards which did get uploaded so
+			// a partial upload isn't left behind
+			for j := range shards {
+				if errs[j] != nil {
+					shards[j] = nil
+				}
+			}
+			removeShards(shards, "after failed upload")
+			return nil, errors.Wrapf(err, "failed to upload shard to %v", f.upstreams[i])
+		}
+	}
+	if old != nil {
+		removeShards(old.shards, "of old upload")
+		removeShards(old.others, "of old upload")
+	}
+	o := f.newObject(remote, size, id)
+	o.shards = shards
+	o.h = &h
+	return o, nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// The data is coded into shards which are uploaded to all the
+// upstreams at once.
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	o, err := f.put(in, src, nil, options...)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Mkdir makes the directory on all the upstreams
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(dir string) error {
+	for _, upstream := range f.upstreams {
+		err := upstream.Mkdir(dir)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dirExists returns whether dir exists on the upstream
+func dirExists(upstream fs.Fs, dir string) bool {
+	_, err := upstream.List(dir)
+	return err == nil
+}
+
+// Rmdir removes the directory from all the upstreams it is on
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(dir string) error {
+	found := false
+	for _, upstream := range f.upstreams {
+		err := upstream.Rmdir(dir)
+		if err != nil {
+			if !dirExists(upstream, dir) {
+				continue
+			}
+			return err
+		}
+		found = true
+	}
+	if !found {
+		return fs.ErrorDirNotFound
+	}
+	return nil
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+//
+// This is the upstream the first data shards are on
+func (f *Fs) UnWrap() fs.Fs {
+	return f.upstreams[0]
+}
+
+// Object describes an erasure coded Object
+//
+// It is made of one shard on each of the upstreams
+type Object struct {
+	f      *Fs
+	remote string      // the name of the object
+	size   int64       // the size of the original data
+	id     [8]byte     // the ID of the upload the shards are from
+	shards []fs.Object // the shard on each upstream or nil if it is missing
+	others []fs.Object // shards found from other uploads
+	mu     sync.Mutex  // protects the following
+	h      *header     // the header of the shards if read
+}
+
+// newObject makes an Object for the upload id of remote of size with
+// no shards
+func (f *Fs) newObject(remote string, size int64, id [8]byte) *Object {
+	return &Object{
+		f:      f,
+		remote: remote,
+		size:   size,
+		id:     id,
+		shards: make([]fs.Object, len(f.upstreams)),
+	}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// String returns a description of the Object
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// firstShard returns the first shard which is present
+func (o *Object) firstShard() fs.Object {
+	for _, shard := range o.shards {
+		if shard != nil {
+			return shard
+		}
+	}
+	return nil
+}
+
+// readHeader reads the header of shard
+func readHeader(shard fs.Object) (h header, err error) {
+	in, err := shard.Open(&fs.RangeOption{Start: 0, End: headerSize - 1})
+	if err != nil {
+		return h, err
+	}
+	defer fs.CheckClose(in, &err)
+	buf := make([]byte, headerSize)
+	_, err = io.ReadFull(in, buf)
+	if err != nil {
+		return h, errors.Wrap(err, "failed to read shard header")
+	}
+	return unmarshalHeader(buf)
+}
+
+// header returns the header of the object, reading it from the
+// first shard with a valid one which matches its name if necessary
+func (o *Object) header() (*header, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.h != nil {
+		return o.h, nil
+	}
+	err := errors.New("no shards found")
+	for i, shard := range o.shards {
+		if shard == nil {
+			continue
+		}
+		var h header
+		h, err = readHeader(shard)
+		if err == nil && (int(h.Index) != i || h.ID != o.id || int64(h.Size) != o.size) {
+			err = errors.Errorf("shard on %v doesn't match its name", o.f.upstreams[i])
+		}
+		if err == nil {
+			o.h = &h
+			return o.h, nil
+		}
+		fs.Debugf(shard, "Bad shard: %v", err)
+	}
+	return nil, err
+}
+
+// ModTime returns the modification time of the object
+func (o *Object) ModTime() time.Time {
+	if shard := o.firstShard(); shard != nil {
+		return shard.ModTime()
+	}
+	return time.Now()
+}
+
+// Size returns the size of the original data, which is stored in the
+// names of the shards
+func (o *Object) Size() int64 {
+	return o.size
+}
+
+// Hash returns the selected checksum of the file
+//
+// No checksums are supported
+func (o *Object) Hash(hash fs.HashType) (string, error) {
+	return "", fs.ErrHashUnsupported
+}
+
+// Storable returns whether the object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// SetModTime sets the modification time of all the shards
+func (o *Object) SetModTime(modTime time.Time) error {
+	for _, shard := range o.shards {
+		if shard == nil {
+			continue
+		}
+		err := shard.SetModTime(modTime)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openShard opens shard i at offset returning its header and the
+// shard data from offset
+func (o *Object) openShard(i int, offset int64) (h header, in io.ReadCloser, err error) {
+	shard := o.shards[i]
+	if shard == nil {
+		return h, nil, errors.New("shard missing")
+	}
+	if offset == headerSize {
+		// read the header and data in one go
+		in, err = shard.Open()
+		if err != nil {
+			return h, nil, err
+		}
+		buf := make([]byte, headerSize)
+		_, err = io.ReadFull(in, buf)
+		if err == nil {
+			h, err = unmarshalHeader(buf)
+		}
+		if err != nil {
+			_ = in.Close()
+			return h, nil, err
+		}
+		return h, in, nil
+	}
+	h, err = readHeader(shard)
+	if err != nil {
+		return h, nil, err
+	}
+	in, err = shard.Open(&fs.SeekOption{Offset: offset})
+	return h, in, err
+}
+
+// newDecoder makes a decoder for the object from the stripe given
+// using only the shards which use returns true for
+func (o *Object) newDecoder(h *header, stripe int64, use func(i int) bool) (*decoder, error) {
+	if int(h.DataShards)+int(h.ParityShards) != len(o.f.upstreams) {
+		return nil, errors.Errorf("object has %d data and %d parity shards but there are %d remotes", h.DataShards, h.ParityShards, len(o.f.upstreams))
+	}
+	c, err := newCodec(int(h.DataShards), int(h.ParityShards))
+	if err != nil {
+		return nil, err
+	}
+	return newDecoder(c, *h, func(i int, offset int64) (header, io.ReadCloser, error) {
+		if !use(i) {
+			return header{}, nil, errors.New("shard not used")
+		}
+		return o.openShard(i, offset)
+	}, stripe), nil
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+//
+// The data is read from the data shards if possible, reading the
+// parity shards to rebuild it if any of those are missing or damaged.
+func (o *Object) Open(options ...fs.OpenOption) (io.ReadCloser, error) {
+	h, err := o.header()
+	if err != nil {
+		return nil, err
+	}
+	size := int64(h.Size)
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(size)
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	if limit < 0 || offset+limit > size {
+		limit = size - offset
+	}
+	if limit <= 0 {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+	stripe := offset / h.stripeSize()
+	d, err := o.newDecoder(h, stripe, func(int) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.CopyN(ioutil.Discard, d, offset-stripe*h.stripeSize())
+	if err != nil {
+		_ = d.Close()
+		return nil, err
+	}
+	return fs.NewLimitedReadCloser(d, limit), nil
+}
+
+// Update the object with the contents of the io.Reader, modTime and
+// size, replacing all the shards
+func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	newO, err := o.f.put(in, src, o, options...)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	o.size, o.id, o.shards, o.others, o.h = newO.size, newO.id, newO.shards, nil, newO.h
+	o.mu.Unlock()
+	return nil
+}
+
+// Remove all the shards of the object, including any from other
+// uploads
+func (o *Object) Remove() error {
+	for _, shard := range append(o.shards, o.others...) {
+		if shard == nil {
+			continue
+		}
+		err := shard.Remove()
+		if err != nil && err != fs.ErrorObjectNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnWrap returns the first shard of the object
+func (o *Object) UnWrap() fs.Object {
+	return o.firstShard()
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs        = (*Fs)(nil)
+	_ fs.UnWrapper = (*Fs)(nil)
+	_ fs.Object    = (*Object)(nil)
+)
@@ -0,0 +1,23 @@
+package erasure_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ncw/rclone/fstest/fstests"
+)
+
+// Create the TestErasure: remote
+func init() {
+	var remotes []string
+	for _, leaf := range []string{"a", "b", "c", "d"} {
+		remotes = append(remotes, filepath.Join(os.TempDir(), "rclone-erasure-test-"+leaf))
+	}
+	name := "TestErasure"
+	fstests.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "erasure"},
+		{Name: name, Key: "remotes", Value: strings.Join(remotes, " ")},
+		{Name: name, Key: "parity_shards", Value: "2"},
+	}
+}
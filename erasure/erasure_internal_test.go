@@ -0,0 +1,401 @@
+package erasure
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	_ "github.com/ncw/rclone/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGaloisField(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		assert.Equal(t, byte(1), gfMul[a][gfInv(byte(a))], "%d", a)
+		assert.Equal(t, byte(a), gfMul[a][1], "%d", a)
+		assert.Equal(t, byte(0), gfMul[a][0], "%d", a)
+	}
+	// distributive so mulAdd is linear
+	for _, x := range [][3]int{{3, 7, 200}, {255, 128, 1}, {17, 34, 68}} {
+		a, b, c := byte(x[0]), byte(x[1]), byte(x[2])
+		assert.Equal(t, gfMul[a][b^c], gfMul[a][b]^gfMul[a][c])
+	}
+}
+
+func TestInvert(t *testing.T) {
+	m := matrix{{1, 2, 3}, {4, 5, 6}, {7, 8, 10}}
+	inverse, err := m.invert()
+	require.NoError(t, err)
+	// m times its inverse should be the identity
+	for i := range m {
+		for j := range m {
+			var sum byte
+			for k := range m {
+				sum ^= gfMul[m[i][k]][inverse[k][j]]
+			}
+			want := byte(0)
+			if i == j {
+				want = 1
+			}
+			assert.Equal(t, want, sum, "%d,%d", i, j)
+		}
+	}
+	_, err = matrix{{1, 2}, {1, 2}}.invert()
+	assert.Equal(t, errSingular, err)
+}
+
+// forEachSubset calls fn with every choice of missing shards of n
+// leaving at least k present
+func forEachSubset(n, k int, fn func(present []bool)) {
+	for bits := 0; bits < 1<<uint(n); bits++ {
+		present := make([]bool, n)
+		count := 0
+		for i := range present {
+			if bits&(1<<uint(i)) != 0 {
+				present[i] = true
+				count++
+			}
+		}
+		if count >= k {
+			fn(present)
+		}
+	}
+}
+
+func TestCodec(t *testing.T) {
+	for _, test := range []struct{ k, m int }{{1, 1}, {2, 1}, {3, 2}, {4, 3}} {
+		c, err := newCodec(test.k, test.m)
+		require.NoError(t, err)
+		n := test.k + test.m
+		shards := make([][]byte, n)
+		for i := range shards {
+			shards[i] = make([]byte, 100)
+			if i < test.k {
+				_, _ = rand.Read(shards[i])
+			}
+		}
+		c.encode(shards)
+		forEachSubset(n, test.k, func(present []bool) {
+			damaged := make([][]byte, n)
+			for i := range damaged {
+				damaged[i] = make([]byte, len(shards[i]))
+				if present[i] {
+					copy(damaged[i], shards[i])
+				}
+			}
+			require.NoError(t, c.reconstruct(damaged, present, true))
+			assert.Equal(t, shards, damaged, "k=%d m=%d present=%v", test.k, test.m, present)
+		})
+		// not enough shards
+		present := make([]bool, n)
+		present[0] = true
+		if test.k > 1 {
+			assert.Error(t, c.reconstruct(shards, present, false))
+		}
+	}
+	_, err := newCodec(0, 1)
+	assert.Error(t, err)
+	_, err = newCodec(200, 57)
+	assert.Error(t, err)
+}
+
+// newTestFs makes an erasure remote with parity shards over n
+// temporary local directories returning the Fs, the directories and
+// a function to tidy up
+func newTestFs(t *testing.T, n, parity int) (*Fs, []string, func()) {
+	dirs, cleanup := fstest.NewLocalDirs(t, n)
+	f, err := fstest.NewConfiguredFs("TestErasureInternal", "type", "erasure", "remotes", strings.Join(dirs, " "), "parity_shards", string(rune('0'+parity)))
+	require.NoError(t, err)
+	return f.(*Fs), dirs, cleanup
+}
+
+// damage flips a byte in the file at offset
+func damage(t *testing.T, file string, offset int64) {
+	data, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	data[offset] ^= 0xFF
+	require.NoError(t, ioutil.WriteFile(file, data, 0666))
+}
+
+// shardPath returns the path of the shard of remote in the local
+// directory dir
+func shardPath(t *testing.T, dir, remote string) string {
+	matches, err := filepath.Glob(filepath.Join(dir, remote) + ".*" + shardSuffix)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(matches), "shards of %q in %q", remote, dir)
+	return matches[0]
+}
+
+// randomData makes size bytes of random data
+func randomData(size int) string {
+	data := make([]byte, size)
+	_, _ = rand.Read(data)
+	return string(data)
+}
+
+func TestBadConfig(t *testing.T) {
+	name := "TestErasureBadConfig"
+	_, err := fstest.NewConfiguredFs(name, "type", "erasure", "remotes", os.TempDir()+" "+os.TempDir(), "parity_shards", "2")
+	assert.Error(t, err)
+	_, err = fstest.NewConfiguredFs(name, "parity_shards", "potato")
+	assert.Error(t, err)
+}
+
+func TestShards(t *testing.T) {
+	f, dirs, cleanup := newTestFs(t, 3, 1)
+	defer cleanup()
+	data := randomData(384 * 1024)
+	fstest.PutFile(t, f, "dir/file.bin", data)
+
+	// each shard is about half the size of the data
+	h := newHeader(f.codec, int64(len(data)), [8]byte{})
+	for _, dir := range dirs {
+		fi, err := os.Stat(shardPath(t, dir, "dir/file.bin"))
+		require.NoError(t, err)
+		assert.Equal(t, h.shardSize(), fi.Size())
+		assert.True(t, fi.Size() < int64(len(data))*6/10, "shard size %d", fi.Size())
+	}
+
+	o, err := f.NewObject("dir/file.bin")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), o.Size())
+	_, err = o.Hash(fs.HashMD5)
+	assert.Equal(t, fs.ErrHashUnsupported, err)
+	assert.Equal(t, data, fstest.ReadObject(t, f, "dir/file.bin"))
+
+	// ranged reads starting in different stripes
+	for _, start := range []int64{0, 1, 64*1024 - 1, 128 * 1024, 200*1024 + 7} {
+		end := start + 100*1024
+		assert.Equal(t, data[start:end+1], fstest.ReadObject(t, f, "dir/file.bin", &fs.RangeOption{Start: start, End: end}), "start %d", start)
+	}
+	assert.Equal(t, data[len(data)-10:], fstest.ReadObject(t, f, "dir/file.bin", &fs.SeekOption{Offset: int64(len(data) - 10)}))
+}
+
+// errorReader returns the data then err
+type errorReader struct {
+	data []byte
+	err  error
+}
+
+func (r *errorReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// dirNames returns the sorted names of the files in each of dirs
+func dirNames(t *testing.T, dirs []string) (names [][]string) {
+	for _, dir := range dirs {
+		names = append(names, fstest.LocalNames(t, dir))
+	}
+	return names
+}
+
+func TestNames(t *testing.T) {
+	id := [8]byte{1, 2, 3, 4, 5, 6, 7, 0xff}
+	name := encodeName("dir/file.txt", 1000, id)
+	assert.Equal(t, "dir/file.txt.3e8.01020304050607ff.ec", name)
+	remote, size, gotID, ok := decodeName(name)
+	assert.True(t, ok)
+	assert.Equal(t, "dir/file.txt", remote)
+	assert.Equal(t, int64(1000), size)
+	assert.Equal(t, id, gotID)
+	for _, bad := range []string{"file.txt", "file.txt.ec", "file.txt.3e8.0102.ec", ".3e8.01020304050607ff.ec", "file.txt.3e8.01020304050607ff"} {
+		_, _, _, ok = decodeName(bad)
+		assert.False(t, ok, bad)
+	}
+
+	// later IDs sort after earlier ones
+	first, err := newID()
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	second, err := newID()
+	require.NoError(t, err)
+	assert.True(t, string(first[:]) < string(second[:]))
+}
+
+func TestSizeFromName(t *testing.T) {
+	f, dirs, cleanup := newTestFs(t, 3, 1)
+	defer cleanup()
+	data := randomData(1000)
+	fstest.PutFile(t, f, "file.bin", data)
+
+	// the size is listed without reading the shards
+	for _, dir := range dirs {
+		require.NoError(t, ioutil.WriteFile(shardPath(t, dir, "file.bin"), nil, 0666))
+	}
+	entries, err := f.List("")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, int64(len(data)), entries[0].Size())
+}
+
+func TestUpdate(t *testing.T) {
+	f, dirs, cleanup := newTestFs(t, 3, 1)
+	defer cleanup()
+	data := randomData(100 * 1024)
+	fstest.PutFile(t, f, "file.bin", data)
+	o, err := f.NewObject("file.bin")
+	require.NoError(t, err)
+	old := dirNames(t, dirs)
+
+	// A failed update leaves the old shards alone
+	src := fs.NewStaticObjectInfo("file.bin", time.Now(), 200*1024, true, nil, nil)
+	err = o.Update(&errorReader{data: []byte(randomData(150 * 1024)), err: errors.New("read failed")}, src)
+	require.Error(t, err)
+	assert.Equal(t, old, dirNames(t, dirs))
+	assert.Equal(t, data, fstest.ReadObject(t, f, "file.bin"))
+
+	// A successful one replaces them
+	newData := randomData(50 * 1024)
+	src = fs.NewStaticObjectInfo("file.bin", time.Now(), int64(len(newData)), true, nil, nil)
+	require.NoError(t, o.Update(strings.NewReader(newData), src))
+	assert.Equal(t, int64(len(newData)), o.Size())
+	for i, names := range dirNames(t, dirs) {
+		require.Equal(t, 1, len(names))
+		assert.NotEqual(t, old[i][0], names[0])
+	}
+	assert.Equal(t, newData, fstest.ReadObject(t, f, "file.bin"))
+}
+
+func TestUploads(t *testing.T) {
+	f, dirs, cleanup := newTestFs(t, 3, 1)
+	defer cleanup()
+	oldData, newData := randomData(1000), randomData(2000)
+	fstest.PutFile(t, f, "file.bin", oldData)
+	var oldPaths, newPaths []string
+	var oldShards [][]byte
+	for _, dir := range dirs {
+		p := shardPath(t, dir, "file.bin")
+		data, err := ioutil.ReadFile(p)
+		require.NoError(t, err)
+		oldPaths = append(oldPaths, p)
+		oldShards = append(oldShards, data)
+	}
+	o, err := f.NewObject("file.bin")
+	require.NoError(t, err)
+	src := fs.NewStaticObjectInfo("file.bin", time.Now(), int64(len(newData)), true, nil, nil)
+	require.NoError(t, o.Update(strings.NewReader(newData), src))
+	for _, dir := range dirs {
+		newPaths = append(newPaths, shardPath(t, dir, "file.bin"))
+	}
+
+	// The new version is used if the update is interrupted
+	// before all the old shards are removed
+	for i, p := range oldPaths {
+		require.NoError(t, ioutil.WriteFile(p, oldShards[i], 0666))
+	}
+	o, err = f.NewObject("file.bin")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(newData)), o.Size())
+	assert.Equal(t, 3, len(o.(*Object).others))
+	assert.Equal(t, newData, fstest.ReadObject(t, f, "file.bin"))
+
+	// but not if it is interrupted before most of the new
+	// shards are uploaded
+	require.NoError(t, os.Remove(newPaths[0]))
+	require.NoError(t, os.Remove(newPaths[2]))
+	entries, err := f.List("")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, int64(len(oldData)), entries[0].Size())
+	assert.Equal(t, 1, len(entries[0].(*Object).others))
+	assert.Equal(t, oldData, fstest.ReadObject(t, f, "file.bin"))
+
+	// Removing the object removes the shards of both
+	require.NoError(t, entries[0].(*Object).Remove())
+	assert.Equal(t, [][]string{nil, nil, nil}, dirNames(t, dirs))
+}
+
+func TestLostShards(t *testing.T) {
+	f, dirs, cleanup := newTestFs(t, 4, 2)
+	defer cleanup()
+	data := randomData(200*1024 + 3)
+	fstest.PutFile(t, f, "file.bin", data)
+
+	// any two shards can be lost
+	require.NoError(t, os.Remove(shardPath(t, dirs[0], "file.bin")))
+	require.NoError(t, os.Remove(shardPath(t, dirs[2], "file.bin")))
+	assert.Equal(t, data, fstest.ReadObject(t, f, "file.bin"))
+	assert.Equal(t, data[150*1024:], fstest.ReadObject(t, f, "file.bin", &fs.SeekOption{Offset: 150 * 1024}))
+	entries, err := f.List("")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, int64(len(data)), entries[0].Size())
+
+	// but not three
+	require.NoError(t, os.Remove(shardPath(t, dirs[1], "file.bin")))
+	o, err := f.NewObject("file.bin")
+	require.NoError(t, err)
+	in, err := o.Open()
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(in)
+	assert.Error(t, err)
+	require.NoError(t, in.Close())
+}
+
+func TestDamagedShards(t *testing.T) {
+	f, dirs, cleanup := newTestFs(t, 3, 1)
+	defer cleanup()
+	data := randomData(100 * 1024)
+	fstest.PutFile(t, f, "file.bin", data)
+
+	// a damaged block is spotted and rebuilt from the parity
+	damage(t, shardPath(t, dirs[1], "file.bin"), headerSize+10)
+	assert.Equal(t, data, fstest.ReadObject(t, f, "file.bin"))
+
+	// as is a shard from a different upload
+	fstest.PutFile(t, f, "other.bin", randomData(100*1024))
+	other, err := ioutil.ReadFile(shardPath(t, dirs[0], "other.bin"))
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(shardPath(t, dirs[1], "file.bin"), other, 0666))
+	assert.Equal(t, data, fstest.ReadObject(t, f, "file.bin"))
+}
+
+func TestRepair(t *testing.T) {
+	f, dirs, cleanup := newTestFs(t, 3, 1)
+	defer cleanup()
+	data := randomData(150 * 1024)
+	fstest.PutFile(t, f, "missing.bin", data)
+	fstest.PutFile(t, f, "damaged.bin", data)
+	fstest.PutFile(t, f, "good.bin", data)
+	fstest.PutFile(t, f, "lost.bin", data)
+	// with a shard left from an old upload
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dirs[1], encodeName("good.bin", 3, [8]byte{1})), []byte("old"), 0666))
+	missingShard := shardPath(t, dirs[0], "missing.bin")
+	goodShard, err := ioutil.ReadFile(missingShard)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(missingShard))
+	damage(t, shardPath(t, dirs[2], "damaged.bin"), headerSize+100)
+	require.NoError(t, os.Remove(shardPath(t, dirs[0], "lost.bin")))
+	require.NoError(t, os.Remove(shardPath(t, dirs[1], "lost.bin")))
+
+	// lost.bin can't be repaired
+	assert.Error(t, f.Repair())
+
+	// the shard is rebuilt exactly as it was
+	rebuilt, err := ioutil.ReadFile(missingShard)
+	require.NoError(t, err)
+	assert.Equal(t, goodShard, rebuilt)
+
+	// and all the shards are good again
+	for _, remote := range []string{"missing.bin", "damaged.bin", "good.bin"} {
+		o, err := f.NewObject(remote)
+		require.NoError(t, err)
+		_, reasons := o.(*Object).checkShards()
+		assert.Equal(t, []error{nil, nil, nil}, reasons, remote)
+		assert.Equal(t, 0, len(o.(*Object).others), remote)
+		assert.Equal(t, data, fstest.ReadObject(t, f, remote), remote)
+	}
+}
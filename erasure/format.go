@@ -0,0 +1,338 @@
+// The format of the shards
+
+package erasure
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Each shard starts with a header.  The original data is split into
+// stripes of dataShards blocks of BlockSize bytes, the last stripe
+// being padded with zeros.  For each stripe every shard holds one
+// block, data shard i holding the i-th block of the stripe and the
+// parity shards holding the parity blocks, each followed by the
+// CRC-32 of the block as a big endian uint32 so damaged blocks can be
+// spotted.
+const (
+	headerMagic      = "RCEC"
+	headerVersion    = 1
+	headerSize       = 32
+	crcSize          = 4
+	defaultBlockSize = 64 * 1024
+)
+
+// header is the start of each shard
+type header struct {
+	Magic        [4]byte
+	Version      uint16
+	DataShards   uint16
+	ParityShards uint16
+	Index        uint16  // which shard this is
+	BlockSize    uint32  // size of the blocks in each stripe
+	Size         uint64  // size of the original data
+	ID           [8]byte // ID the same for all the shards of an upload
+}
+
+// newHeader makes the header for shard 0 of size bytes of data
+// coded by c, choosing the block size so small files don't get
+// padded much
+func newHeader(c *codec, size int64, id [8]byte) header {
+	blockSize := int64(defaultBlockSize)
+	perShard := (size + int64(c.dataShards) - 1) / int64(c.dataShards)
+	if perShard < blockSize {
+		blockSize = perShard
+	}
+	if blockSize < 1 {
+		blockSize = 1
+	}
+	h := header{
+		Version:      headerVersion,
+		DataShards:   uint16(c.dataShards),
+		ParityShards: uint16(c.parityShards),
+		BlockSize:    uint32(blockSize),
+		Size:         uint64(size),
+		ID:           id,
+	}
+	copy(h.Magic[:], headerMagic)
+	return h
+}
+
+// marshal returns the header as bytes
+func (h *header) marshal() []byte {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.BigEndian, h)
+	return buf.Bytes()
+}
+
+// unmarshalHeader reads a header from data checking it is valid
+func unmarshalHeader(data []byte) (h header, err error) {
+	if len(data) < headerSize {
+		return h, errors.New("shard too short for header")
+	}
+	err = binary.Read(bytes.NewReader(data[:headerSize]), binary.BigEndian, &h)
+	if err != nil {
+		return h, err
+	}
+	if string(h.Magic[:]) != headerMagic {
+		return h, errors.New("shard has bad magic")
+	}
+	if h.Version != headerVersion {
+		return h, errors.Errorf("shard has unknown version %d", h.Version)
+	}
+	if h.DataShards == 0 || h.BlockSize == 0 || h.Index >= h.DataShards+h.ParityShards {
+		return h, errors.New("shard has a bad header")
+	}
+	return h, nil
+}
+
+// stripeSize is the amount of original data in each stripe
+func (h *header) stripeSize() int64 {
+	return int64(h.DataShards) * int64(h.BlockSize)
+}
+
+// stripes is the number of stripes
+func (h *header) stripes() int64 {
+	return (int64(h.Size) + h.stripeSize() - 1) / h.stripeSize()
+}
+
+// stripeOffset is the offset in each shard of the block of stripe
+func (h *header) stripeOffset(stripe int64) int64 {
+	return headerSize + stripe*(int64(h.BlockSize)+crcSize)
+}
+
+// shardSize is the size of each shard
+func (h *header) shardSize() int64 {
+	return h.stripeOffset(h.stripes())
+}
+
+// sameUpload returns whether h and other are headers of shards of the
+// same upload
+func (h *header) sameUpload(other *header) bool {
+	return h.ID == other.ID && h.Size == other.Size &&
+		h.DataShards == other.DataShards && h.ParityShards == other.ParityShards &&
+		h.BlockSize == other.BlockSize
+}
+
+// encodeData reads the h.Size bytes of original data from in, coding
+// it with c and writing each shard to the writer for it.
+//
+// writers should have an entry for each shard.  Shards whose writer
+// is nil aren't written and a writer which returns an error isn't
+// written to again.  It returns an error if in couldn't be read or if
+// all the writers failed.
+func encodeData(c *codec, h header, in io.Reader, writers []io.Writer) error {
+	live := append([]io.Writer(nil), writers...)
+	write := func(i int, p []byte) {
+		if live[i] == nil {
+			return
+		}
+		if _, err := live[i].Write(p); err != nil {
+			live[i] = nil
+		}
+	}
+	for i := range live {
+		h.Index = uint16(i)
+		write(i, h.marshal())
+	}
+	blockSize := int(h.BlockSize)
+	shards := make([][]byte, len(writers))
+	for i := range shards {
+		shards[i] = make([]byte, blockSize)
+	}
+	var crc [crcSize]byte
+	data := make([]byte, h.stripeSize())
+	remaining := int64(h.Size)
+	for stripe := int64(0); stripe < h.stripes(); stripe++ {
+		n := int64(len(data))
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := io.ReadFull(in, data[:n]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return errors.Wrap(err, "failed to read data to encode")
+		}
+		for i := n; i < int64(len(data)); i++ {
+			data[i] = 0
+		}
+		remaining -= n
+		for i := 0; i < c.dataShards; i++ {
+			copy(shards[i], data[i*blockSize:])
+		}
+		c.encode(shards)
+		for i, shard := range shards {
+			write(i, shard)
+			binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(shard))
+			write(i, crc[:])
+		}
+		failed := 0
+		for _, w := range live {
+			if w == nil {
+				failed++
+			}
+		}
+		if failed == len(live) {
+			return errors.New("failed to write any shards")
+		}
+	}
+	return nil
+}
+
+// shardSource opens a shard from the offset given, returning the
+// header of the shard and a stream of its data from offset
+type shardSource func(i int, offset int64) (header, io.ReadCloser, error)
+
+// decoder reads the original data back from the shards
+type decoder struct {
+	c       *codec
+	h       header          // the header the shards must match
+	open    shardSource     // opens the shards
+	streams []io.ReadCloser // an open stream for each shard in use, nil otherwise
+	failed  []bool          // shards which can't be used
+	stripe  int64           // the next stripe to read
+	shards  [][]byte        // the blocks of the current stripe
+	present []bool          // which blocks of the current stripe were read
+	data    []byte          // data of the current stripe
+	buf     []byte          // data of the current stripe not yet returned
+	err     error           // sticky error
+}
+
+// newDecoder makes a decoder for the data coded with c described by
+// h starting at the stripe given, reading the shards with open
+func newDecoder(c *codec, h header, open shardSource, stripe int64) *decoder {
+	n := c.dataShards + c.parityShards
+	d := &decoder{
+		c:       c,
+		h:       h,
+		open:    open,
+		streams: make([]io.ReadCloser, n),
+		failed:  make([]bool, n),
+		stripe:  stripe,
+		shards:  make([][]byte, n),
+		present: make([]bool, n),
+	}
+	for i := range d.shards {
+		d.shards[i] = make([]byte, int(h.BlockSize)+crcSize)
+	}
+	return d
+}
+
+// fail marks shard i as not usable, closing it if open
+func (d *decoder) fail(i int) {
+	d.failed[i] = true
+	if d.streams[i] != nil {
+		_ = d.streams[i].Close()
+		d.streams[i] = nil
+	}
+}
+
+// readBlock reads the block of the current stripe from shard i,
+// opening it if necessary, returning whether it worked
+func (d *decoder) readBlock(i int) bool {
+	if d.streams[i] == nil {
+		h, in, err := d.open(i, d.h.stripeOffset(d.stripe))
+		if err != nil {
+			d.failed[i] = true
+			return false
+		}
+		d.streams[i] = in
+		if !h.sameUpload(&d.h) || int(h.Index) != i {
+			d.fail(i)
+			return false
+		}
+	}
+	block := d.shards[i]
+	if _, err := io.ReadFull(d.streams[i], block); err != nil {
+		d.fail(i)
+		return false
+	}
+	blockSize := int(d.h.BlockSize)
+	if crc32.ChecksumIEEE(block[:blockSize]) != binary.BigEndian.Uint32(block[blockSize:]) {
+		d.fail(i)
+		return false
+	}
+	return true
+}
+
+// readStripe reads and decodes the next stripe into d.buf
+func (d *decoder) readStripe() error {
+	got := 0
+	for i := range d.present {
+		d.present[i] = false
+	}
+	// Read from the shards already open first, then open more,
+	// preferring the data shards, until there are enough
+	for pass := 0; pass < 2 && got < d.c.dataShards; pass++ {
+		for i := range d.shards {
+			// all the open shards are read to keep them in step
+			if pass == 1 && got >= d.c.dataShards {
+				break
+			}
+			if d.failed[i] || d.present[i] || (pass == 0) != (d.streams[i] != nil) {
+				continue
+			}
+			if d.readBlock(i) {
+				d.present[i] = true
+				got++
+			}
+		}
+	}
+	if got < d.c.dataShards {
+		return errors.Errorf("only %d of the %d shards needed could be read", got, d.c.dataShards)
+	}
+	blockSize := int(d.h.BlockSize)
+	blocks := make([][]byte, len(d.shards))
+	for i, shard := range d.shards {
+		blocks[i] = shard[:blockSize]
+	}
+	if err := d.c.reconstruct(blocks, d.present, false); err != nil {
+		return err
+	}
+	stripeSize := d.h.stripeSize()
+	n := int64(d.h.Size) - d.stripe*stripeSize
+	if n > stripeSize {
+		n = stripeSize
+	}
+	if d.data == nil {
+		d.data = make([]byte, stripeSize)
+	}
+	for i := 0; i < d.c.dataShards; i++ {
+		copy(d.data[i*blockSize:], blocks[i])
+	}
+	d.buf = d.data[:n]
+	d.stripe++
+	return nil
+}
+
+// Read decoded data into p
+func (d *decoder) Read(p []byte) (n int, err error) {
+	for len(d.buf) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.stripe >= d.h.stripes() {
+			return 0, io.EOF
+		}
+		d.err = d.readStripe()
+	}
+	n = copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// Close all the shards
+func (d *decoder) Close() error {
+	for i, in := range d.streams {
+		if in != nil {
+			_ = in.Close()
+			d.streams[i] = nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Arithmetic in GF(2^8) and matrices over it
+
+package erasure
+
+import "github.com/pkg/errors"
+
+// gfPoly is the polynomial used to make the field
+// x^8 + x^4 + x^3 + x^2 + 1
+const gfPoly = 0x11d
+
+var (
+	gfExp [510]byte      // 2^i, doubled so gfLog[a]+gfLog[b] can be looked up directly
+	gfLog [256]byte      // i such that 2^i = a, for a != 0
+	gfMul [256][256]byte // gfMul[a][b] is the product of a and b
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfExp[i+255] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= gfPoly
+		}
+	}
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			gfMul[a][b] = gfExp[int(gfLog[a])+int(gfLog[b])]
+		}
+	}
+}
+
+// gfInv returns the multiplicative inverse of a which must not be 0
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// mulAdd adds c times in to out, which must be at least as long as
+// in
+func mulAdd(out, in []byte, c byte) {
+	switch c {
+	case 0:
+		return
+	case 1:
+		for i, b := range in {
+			out[i] ^= b
+		}
+		return
+	}
+	row := &gfMul[c]
+	for i, b := range in {
+		out[i] ^= row[b]
+	}
+}
+
+// matrix is a matrix of field elements indexed by row then column
+type matrix [][]byte
+
+// newMatrix makes a zero matrix with the rows and columns given
+func newMatrix(rows, cols int) matrix {
+	m := make(matrix, rows)
+	for i := range m {
+		m[i] = make([]byte, cols)
+	}
+	return m
+}
+
+// errSingular is returned when inverting a matrix which has no inverse
+var errSingular = errors.New("matrix is singular")
+
+// invert returns the inverse of the square matrix m using Gauss-Jordan
+// elimination.  m is not changed.
+func (m matrix) invert() (matrix, error) {
+	n := len(m)
+	// work on m with the identity matrix to its right
+	work := newMatrix(n, 2*n)
+	for i := range m {
+		copy(work[i], m[i])
+		work[i][n+i] = 1
+	}
+	for col := 0; col < n; col++ {
+		// find a row with a non zero entry in this column
+		pivot := col
+		for pivot < n && work[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, errSingular
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+		// scale the row so the entry is 1
+		if c := work[col][col]; c != 1 {
+			inv := gfInv(c)
+			for j := range work[col] {
+				work[col][j] = gfMul[inv][work[col][j]]
+			}
+		}
+		// and clear the column in all the other rows
+		for row := 0; row < n; row++ {
+			if row != col {
+				mulAdd(work[row], work[col], work[row][col])
+			}
+		}
+	}
+	inverse := make(matrix, n)
+	for i := range work {
+		inverse[i] = work[i][n:]
+	}
+	return inverse, nil
+}
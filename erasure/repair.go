@@ -0,0 +1,186 @@
+package erasure
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// verifyShard reads all of shard i checking it is a shard of the
+// upload h describes and that none of its blocks are damaged
+func verifyShard(shard fs.Object, i int, h *header) (err error) {
+	in, err := shard.Open()
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(in, &err)
+	buf := make([]byte, headerSize)
+	if _, err = io.ReadFull(in, buf); err != nil {
+		return errors.Wrap(err, "failed to read header")
+	}
+	got, err := unmarshalHeader(buf)
+	if err != nil {
+		return err
+	}
+	if !got.sameUpload(h) || int(got.Index) != i {
+		return errors.New("shard is from a different upload")
+	}
+	blockSize := int(h.BlockSize)
+	block := make([]byte, blockSize+crcSize)
+	for stripe := int64(0); stripe < h.stripes(); stripe++ {
+		if _, err = io.ReadFull(in, block); err != nil {
+			return errors.Wrapf(err, "failed to read block %d", stripe)
+		}
+		if crc32.ChecksumIEEE(block[:blockSize]) != binary.BigEndian.Uint32(block[blockSize:]) {
+			return errors.Errorf("block %d is damaged", stripe)
+		}
+	}
+	return nil
+}
+
+// checkShards returns the header of the upload the shards are from
+// and a reason for each shard which needs rebuilding, which is nil
+// for the good ones
+func (o *Object) checkShards() (*header, []error) {
+	n := len(o.shards)
+	headers := make([]*header, n)
+	reasons := make([]error, n)
+	var best *header
+	for i, shard := range o.shards {
+		if shard == nil {
+			reasons[i] = errors.New("shard missing")
+			continue
+		}
+		h, err := readHeader(shard)
+		if err == nil && int(h.Index) != i {
+			err = errors.Errorf("shard has index %d", h.Index)
+		}
+		if err == nil && (h.ID != o.id || int64(h.Size) != o.size) {
+			err = errors.New("shard is from a different upload")
+		}
+		if err != nil {
+			reasons[i] = err
+			continue
+		}
+		headers[i] = &h
+		if best == nil {
+			best = &h
+		}
+	}
+	if best == nil {
+		return nil, reasons
+	}
+	for i, h := range headers {
+		if h == nil {
+			continue
+		}
+		if !h.sameUpload(best) {
+			reasons[i] = errors.New("shard is from a different upload")
+			continue
+		}
+		reasons[i] = verifyShard(o.shards[i], i, best)
+	}
+	return best, reasons
+}
+
+// repair rebuilds any shards of the object which are missing or
+// damaged from the good ones, returning the number rebuilt, and
+// removes any shards left from other uploads
+func (o *Object) repair() (rebuilt int, err error) {
+	h, reasons := o.checkShards()
+	good := 0
+	for i, reason := range reasons {
+		if reason == nil {
+			good++
+		} else {
+			fs.Logf(o.f.upstreams[i], "%s: shard needs rebuilding: %v", o.remote, reason)
+		}
+	}
+	for _, shard := range o.others {
+		fs.Logf(shard, "Shard of another upload of %q needs removing", o.remote)
+	}
+	if good == len(reasons) && len(o.others) == 0 {
+		return 0, nil
+	}
+	if h == nil || good < int(h.DataShards) {
+		return 0, errors.Errorf("can't rebuild shards of %q as only %d are good", o.remote, good)
+	}
+	if fs.Config.DryRun {
+		fs.Logf(o, "Not repairing shards as --dry-run is set")
+		return 0, nil
+	}
+	removeShards(o.others, "of another upload")
+	o.others = nil
+	if good == len(reasons) {
+		return 0, nil
+	}
+	d, err := o.newDecoder(h, 0, func(i int) bool { return reasons[i] == nil })
+	if err != nil {
+		return 0, err
+	}
+	defer fs.CheckClose(d, &err)
+	var modTime time.Time
+	upload := make([]func(io.Reader, fs.ObjectInfo) (fs.Object, error), len(o.shards))
+	for i := range o.shards {
+		if reasons[i] == nil {
+			modTime = o.shards[i].ModTime()
+			continue
+		}
+		upstream, shard := o.f.upstreams[i], o.shards[i]
+		upload[i] = func(in io.Reader, info fs.ObjectInfo) (fs.Object, error) {
+			if shard != nil {
+				return shard, shard.Update(in, info)
+			}
+			return upstream.Put(in, info)
+		}
+	}
+	shards, errs := o.f.upload(d, *h, encodeName(o.remote, o.size, o.id), modTime, upload)
+	for i, err := range errs {
+		if upload[i] == nil {
+			continue
+		}
+		if err != nil {
+			return rebuilt, errors.Wrapf(err, "failed to rebuild shard on %v", o.f.upstreams[i])
+		}
+		o.shards[i] = shards[i]
+		rebuilt++
+	}
+	return rebuilt, nil
+}
+
+// Repair checks the shards of every object, rebuilding any which are
+// missing or damaged from the others.
+//
+// All the shards are read to check them, so this reads all the data
+// stored.
+func (f *Fs) Repair() error {
+	objs, _, err := fs.WalkGetAll(f, "", true, -1)
+	if err != nil {
+		return err
+	}
+	rebuilt, failures := 0, 0
+	for _, obj := range objs {
+		o, ok := obj.(*Object)
+		if !ok {
+			continue
+		}
+		fs.Stats.Checking(o.remote)
+		n, err := o.repair()
+		fs.Stats.DoneChecking(o.remote)
+		rebuilt += n
+		if err != nil {
+			failures++
+			fs.Stats.Error()
+			fs.Errorf(o, "Failed to repair: %v", err)
+		}
+	}
+	fs.Logf(f, "%d shards rebuilt", rebuilt)
+	if failures > 0 {
+		return errors.Errorf("failed to repair %d files", failures)
+	}
+	return nil
+}
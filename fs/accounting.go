@@ -105,6 +105,25 @@ func startTokenTicker() {
 	}()
 }
 
+// SetBwLimit sets the current bandwidth limit to bandwidth
+// Bytes/s.  A bandwidth of 0 or less removes the limit.
+//
+// This overrides any --bwlimit timetable until its next scheduled
+// change and any toggle made with SIGUSR2.
+func SetBwLimit(bandwidth SizeSuffix) {
+	tokenBucketMu.Lock()
+	defer tokenBucketMu.Unlock()
+	bwLimitToggledOff = false
+	prevTokenBucket = nil
+	if bandwidth > 0 {
+		tokenBucket = newTokenBucket(bandwidth)
+		Logf(nil, "Bandwidth limit set to %vBytes/s", &bandwidth)
+	} else {
+		tokenBucket = nil
+		Logf(nil, "Bandwidth limit reset to unlimited")
+	}
+}
+
 // stringSet holds a set of strings
 type stringSet map[string]struct{}
 
@@ -142,12 +161,13 @@ func (ip *inProgress) get(name string) *Account {
 	return ip.m[name]
 }
 
-// Strings returns all the strings in the stringSet
-func (ss stringSet) Strings() []string {
+// Strings returns all the strings in the stringSet using the
+// accounts in progress to show the progress of each one
+func (ss stringSet) Strings(progress *inProgress) []string {
 	strings := make([]string, 0, len(ss))
 	for name := range ss {
 		var out string
-		if acc := Stats.inProgress.get(name); acc != nil {
+		if acc := progress.get(name); acc != nil {
 			out = acc.String()
 		} else {
 			out = name
@@ -159,9 +179,19 @@ func (ss stringSet) Strings() []string {
 	return sorted
 }
 
+// names returns the sorted names in the stringSet
+func (ss stringSet) names() []string {
+	names := make([]string, 0, len(ss))
+	for name := range ss {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // String returns all the file names in the stringSet joined by newline
-func (ss stringSet) String() string {
-	return strings.Join(ss.Strings(), "\n")
+func (ss stringSet) String(progress *inProgress) string {
+	return strings.Join(ss.Strings(progress), "\n")
 }
 
 // StatsInfo limits and accounts all transfers
@@ -217,17 +247,51 @@ Elapsed time:  %10v
 		s.transfers,
 		dtRounded)
 	if len(s.checking) > 0 {
-		fmt.Fprintf(buf, "Checking:\n%s\n", s.checking)
+		fmt.Fprintf(buf, "Checking:\n%s\n", s.checking.String(s.inProgress))
 	}
 	if len(s.transferring) > 0 {
-		fmt.Fprintf(buf, "Transferring:\n%s\n", s.transferring)
+		fmt.Fprintf(buf, "Transferring:\n%s\n", s.transferring.String(s.inProgress))
 	}
 	return buf.String()
 }
 
+// RemoteStats returns the stats as a map suitable for encoding as
+// JSON
+func (s *StatsInfo) RemoteStats() map[string]interface{} {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	dt := time.Now().Sub(s.start)
+	speed := 0.0
+	if dt > 0 {
+		speed = float64(s.bytes) / dt.Seconds()
+	}
+	return map[string]interface{}{
+		"bytes":        s.bytes,
+		"errors":       s.errors,
+		"checks":       s.checks,
+		"transfers":    s.transfers,
+		"speed":        speed,
+		"elapsedTime":  dt.Seconds(),
+		"checking":     s.checking.names(),
+		"transferring": s.transferring.names(),
+	}
+}
+
+// CurrentSpeed returns the sum of the current speeds of the
+// transfers in progress in bytes per second
+func (s *StatsInfo) CurrentSpeed() (speed float64) {
+	s.inProgress.mu.Lock()
+	defer s.inProgress.mu.Unlock()
+	for _, acc := range s.inProgress.m {
+		_, current := acc.Speed()
+		speed += current
+	}
+	return speed
+}
+
 // Log outputs the StatsInfo to the log
 func (s *StatsInfo) Log() {
-	LogLevelPrintf(Config.StatsLogLevel, nil, "%v\n", s)
+	logStructured(Config.StatsLogLevel, nil, map[string]interface{}{"stats": s.RemoteStats()}, "%v\n", s)
 }
 
 // Bytes updates the stats for bytes bytes
@@ -331,6 +395,7 @@ type Account struct {
 	// CancelRequest so this race can happen when it apparently
 	// shouldn't.
 	mu      sync.Mutex
+	stats   *StatsInfo // stats to account the transfer in
 	in      io.ReadCloser
 	origIn  io.ReadCloser
 	size    int64
@@ -351,7 +416,19 @@ type Account struct {
 // NewAccountSizeName makes a Account reader for an io.ReadCloser of
 // the given size and name
 func NewAccountSizeName(in io.ReadCloser, size int64, name string) *Account {
+	return Stats.NewAccountSizeName(in, size, name)
+}
+
+// NewAccount makes a Account reader for an object
+func NewAccount(in io.ReadCloser, obj Object) *Account {
+	return Stats.NewAccount(in, obj)
+}
+
+// NewAccountSizeName makes a Account reader for an io.ReadCloser of
+// the given size and name which is accounted in s
+func (s *StatsInfo) NewAccountSizeName(in io.ReadCloser, size int64, name string) *Account {
 	acc := &Account{
+		stats:  s,
 		in:     in,
 		origIn: in,
 		size:   size,
@@ -361,13 +438,14 @@ func NewAccountSizeName(in io.ReadCloser, size int64, name string) *Account {
 		lpTime: time.Now(),
 	}
 	go acc.averageLoop()
-	Stats.inProgress.set(acc.name, acc)
+	s.inProgress.set(acc.name, acc)
 	return acc
 }
 
-// NewAccount makes a Account reader for an object
-func NewAccount(in io.ReadCloser, obj Object) *Account {
-	return NewAccountSizeName(in, obj.Size(), obj.Remote())
+// NewAccount makes a Account reader for an object which is accounted
+// in s
+func (s *StatsInfo) NewAccount(in io.ReadCloser, obj Object) *Account {
+	return s.NewAccountSizeName(in, obj.Size(), obj.Remote())
 }
 
 // WithBuffer - If the file is above a certain size it adds an Async reader
@@ -466,7 +544,7 @@ func (acc *Account) read(in io.Reader, p []byte) (n int, err error) {
 	acc.bytes += int64(n)
 	acc.statmu.Unlock()
 
-	Stats.Bytes(int64(n))
+	acc.stats.Bytes(int64(n))
 
 	// Get the token bucket in use
 	tokenBucketMu.Lock()
@@ -593,7 +671,7 @@ func (acc *Account) Close() error {
 	}
 	acc.closed = true
 	close(acc.exit)
-	Stats.inProgress.clear(acc.name)
+	acc.stats.inProgress.clear(acc.name)
 	return acc.in.Close()
 }
 
@@ -618,6 +696,9 @@ func (a *accountStream) Read(p []byte) (n int, err error) {
 
 // AccountByPart turns off whole file accounting
 //
+// This only finds transfers accounted in the global Stats - others
+// continue to be accounted as a whole file.
+//
 // Returns the current account or nil if not found
 func AccountByPart(obj Object) *Account {
 	acc := Stats.inProgress.get(obj.Remote())
@@ -0,0 +1,330 @@
+// Bidirectional sync
+
+package fs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// bisyncVersion is the version of the listings file
+const bisyncVersion = 1
+
+// bisyncFile is what is remembered about a file between bisyncs
+type bisyncFile struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// bisyncListing is the files on one side keyed on their remote
+type bisyncListing map[string]bisyncFile
+
+// bisyncListings are the listings of both sides saved after a
+// successful bisync
+type bisyncListings struct {
+	Version int           `json:"version"`
+	Path1   bisyncListing `json:"path1"`
+	Path2   bisyncListing `json:"path2"`
+}
+
+// readBisyncListings reads the listings saved by the last bisync from
+// file.  If there are none then it returns empty listings.
+func readBisyncListings(file string) (*bisyncListings, error) {
+	l := &bisyncListings{
+		Version: bisyncVersion,
+		Path1:   bisyncListing{},
+		Path2:   bisyncListing{},
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		Logf(nil, "No listings from a previous bisync found - all files will be treated as new")
+		return l, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read listings")
+	}
+	err = json.Unmarshal(data, l)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode listings in %q", file)
+	}
+	if l.Version != bisyncVersion {
+		return nil, errors.Errorf("unknown version %d of listings in %q", l.Version, file)
+	}
+	if l.Path1 == nil || l.Path2 == nil {
+		return nil, errors.Errorf("listings in %q are incomplete", file)
+	}
+	return l, nil
+}
+
+// writeBisyncListings saves l in file, replacing it atomically so it
+// is never left half written
+func writeBisyncListings(file string, l *bisyncListings) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	err = WriteFileAtomic(file, data)
+	if err != nil {
+		return errors.Wrap(err, "failed to save listings")
+	}
+	return nil
+}
+
+// listBisync returns the files in f sorted by name
+func listBisync(f Fs) (entries DirEntries, err error) {
+	objs, _, err := WalkGetAll(f, "", false, -1)
+	if err == ErrorDirNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range objs {
+		entries = append(entries, o)
+	}
+	sort.Sort(entries)
+	return entries, nil
+}
+
+// makeBisyncListing makes the listing to save of the files in entries
+func makeBisyncListing(entries DirEntries) bisyncListing {
+	l := make(bisyncListing, len(entries))
+	entries.ForObject(func(o Object) {
+		l[o.Remote()] = bisyncFile{
+			Size:    o.Size(),
+			ModTime: o.ModTime(),
+		}
+	})
+	return l
+}
+
+// bisync holds the state of a bidirectional sync
+type bisync struct {
+	fs     [2]Fs              // the two sides
+	prev   [2]bisyncListing   // the listings of the last bisync
+	next   [2]bisyncListing   // the listings to save for the next bisync
+	exists [2]map[string]bool // the names in use on each side
+	suffix string             // the conflict suffix
+	errors int                // count of errors
+}
+
+// check counts err if set
+func (b *bisync) check(err error) bool {
+	if err != nil {
+		b.errors++
+		return false
+	}
+	return true
+}
+
+// changed returns whether o on side i is new or has changed since the
+// last bisync
+func (b *bisync) changed(i int, o Object) bool {
+	prev, ok := b.prev[i][o.Remote()]
+	if !ok {
+		return true
+	}
+	if prev.Size != o.Size() {
+		return true
+	}
+	if Config.ModifyWindow == ModTimeNotSupported {
+		return false
+	}
+	dt := o.ModTime().Sub(prev.ModTime)
+	return dt < -Config.ModifyWindow || dt > Config.ModifyWindow
+}
+
+// record notes remote as it is on side i after it has been written
+// so the next bisync doesn't see it as changed
+func (b *bisync) record(i int, remote string) bool {
+	if Config.DryRun {
+		return true
+	}
+	o, err := b.fs[i].NewObject(remote)
+	if !b.check(err) {
+		Errorf(remote, "Failed to find after writing it to %v: %v", b.fs[i], err)
+		return false
+	}
+	b.next[i][remote] = bisyncFile{
+		Size:    o.Size(),
+		ModTime: o.ModTime(),
+	}
+	return true
+}
+
+// transfer copies src to remote on side i replacing dst if set
+func (b *bisync) transfer(i int, dst Object, remote string, src Object) bool {
+	Stats.Transferring(remote)
+	err := Copy(b.fs[i], dst, remote, src)
+	Stats.DoneTransferring(remote, err == nil)
+	return b.check(err) && b.record(i, remote)
+}
+
+// copy o from side i to the other side replacing dst if set
+func (b *bisync) copy(i int, dst, o Object) {
+	b.transfer(1-i, dst, o.Remote(), o)
+}
+
+// onlyOn deals with o which is only on side i
+func (b *bisync) onlyOn(i int, o Object) {
+	j := 1 - i
+	if _, ok := b.prev[j][o.Remote()]; !ok {
+		Debugf(o, "New on %v", b.fs[i])
+		b.copy(i, nil, o)
+		return
+	}
+	if b.changed(i, o) {
+		Logf(o, "Changed on %v but deleted on %v - keeping it", b.fs[i], b.fs[j])
+		b.copy(i, nil, o)
+		return
+	}
+	Debugf(o, "Deleted on %v", b.fs[j])
+	if b.check(DeleteFile(o)) {
+		delete(b.next[i], o.Remote())
+	}
+}
+
+// both deals with o1 on path1 and o2 on path2 which have the same name
+func (b *bisync) both(o1, o2 Object) {
+	changed1, changed2 := b.changed(0, o1), b.changed(1, o2)
+	Stats.Checking(o1.Remote())
+	differ := NeedTransfer(o2, o1)
+	Stats.DoneChecking(o1.Remote())
+	if !differ {
+		return
+	}
+	switch {
+	case changed1 && !changed2:
+		b.copy(0, o2, o1)
+	case changed2 && !changed1:
+		b.copy(1, o1, o2)
+	case changed1 && changed2:
+		b.conflict(o1, o2)
+	default:
+		Logf(o1, "Differs from %v but neither has changed since the last bisync - leaving alone", b.fs[1])
+	}
+}
+
+// conflictName returns an unused name to rename a conflicting version
+// of remote to
+func (b *bisync) conflictName(remote string) string {
+	name := remote + b.suffix
+	for n := 1; b.exists[0][name] || b.exists[1][name]; n++ {
+		name = fmt.Sprintf("%s%s%d", remote, b.suffix, n)
+	}
+	b.exists[0][name] = true
+	b.exists[1][name] = true
+	return name
+}
+
+// conflict deals with o1 and o2 which have both changed.
+//
+// The newer one wins, or the one on path1 if they are the same age.
+// The loser is renamed with the conflict suffix on its side and
+// copied to the other side under that name, and the winner replaces
+// it, so both sides end up with both versions.
+func (b *bisync) conflict(o1, o2 Object) {
+	objs := [2]Object{o1, o2}
+	w := 0
+	if o2.ModTime().After(o1.ModTime()) {
+		w = 1
+	}
+	l := 1 - w
+	winner, loser := objs[w], objs[l]
+	name := b.conflictName(loser.Remote())
+	Logf(loser, "Changed on both %v and %v - keeping the version on %v and renaming this one to %q", b.fs[0], b.fs[1], b.fs[w], name)
+	if !b.transfer(w, nil, name, loser) {
+		return
+	}
+	if !b.check(Move(b.fs[l], nil, name, loser)) {
+		return
+	}
+	delete(b.next[l], loser.Remote())
+	if !b.record(l, name) {
+		return
+	}
+	b.transfer(l, nil, winner.Remote(), winner)
+}
+
+// Bisync makes path1 and path2 the same by copying the files created
+// or changed on each side since the last bisync to the other, and
+// deleting the files on each side which were deleted on the other.
+//
+// The listings of both sides are saved in listingsFile after each
+// successful bisync to work out what changed.  If there are none all
+// the files are treated as new so nothing is deleted.  The listings
+// saved are the ones made at the start with the changes made by the
+// bisync applied, so files changed while it runs are seen as changed
+// by the next one.
+//
+// If a file was changed on both sides, the older version is renamed
+// with conflictSuffix added to its name and both versions are kept.
+//
+// Empty directories aren't synced.
+func Bisync(path1, path2 Fs, listingsFile, conflictSuffix string) error {
+	if Overlapping(path1, path2) {
+		return errors.New("can't bisync overlapping remotes")
+	}
+	if conflictSuffix == "" {
+		return errors.New("conflict suffix must not be empty")
+	}
+	CalculateModifyWindow(path1, path2)
+	prev, err := readBisyncListings(listingsFile)
+	if err != nil {
+		return err
+	}
+	b := &bisync{
+		fs:     [2]Fs{path1, path2},
+		prev:   [2]bisyncListing{prev.Path1, prev.Path2},
+		suffix: conflictSuffix,
+	}
+	var lists [2]DirEntries
+	for i, f := range b.fs {
+		lists[i], err = listBisync(f)
+		if err != nil {
+			return errors.Wrapf(err, "failed to list %v", f)
+		}
+		// Guard against deleting everything if a side is
+		// unexpectedly empty, eg a drive not being mounted
+		if len(lists[i]) == 0 && len(b.prev[i]) > 0 {
+			return errors.Errorf("all the files on %v have gone since the last bisync - not deleting them from %v - remove %q to start again", f, b.fs[1-i], listingsFile)
+		}
+		b.exists[i] = make(map[string]bool, len(lists[i]))
+		lists[i].ForObject(func(o Object) {
+			b.exists[i][o.Remote()] = true
+		})
+		b.next[i] = makeBisyncListing(lists[i])
+		err = Mkdir(f, "")
+		if err != nil {
+			return err
+		}
+	}
+	only1, only2, matches := matchListings(lists[0], lists[1])
+	for _, entry := range only1 {
+		b.onlyOn(0, entry.(Object))
+	}
+	for _, entry := range only2 {
+		b.onlyOn(1, entry.(Object))
+	}
+	for _, match := range matches {
+		b.both(match.src.(Object), match.dst.(Object))
+	}
+	if b.errors > 0 {
+		return errors.Errorf("%d errors during bisync - not saving listings so changes will be retried", b.errors)
+	}
+	if Config.DryRun {
+		return nil
+	}
+	next := &bisyncListings{
+		Version: bisyncVersion,
+		Path1:   b.next[0],
+		Path2:   b.next[1],
+	}
+	return writeBisyncListings(listingsFile, next)
+}
@@ -0,0 +1,150 @@
+// Test bisync
+
+package fs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bisyncListings returns the name of a file to keep the listings in
+// and a function to tidy it up
+func bisyncListings(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "rclone-bisync-test")
+	require.NoError(t, err)
+	return filepath.Join(dir, "listings.json"), func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// removeObject removes remote from f
+func removeObject(t *testing.T, f fs.Fs, remote string) {
+	o, err := f.NewObject(remote)
+	require.NoError(t, err)
+	require.NoError(t, o.Remove())
+}
+
+// The first bisync merges the two sides without deleting anything
+func TestBisyncFirstRun(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	listings, cleanup := bisyncListings(t)
+	defer cleanup()
+	file1 := r.WriteFile("local only", "local", t1)
+	file2 := r.WriteObject("sub dir/remote only", "remote", t2)
+	file3 := r.WriteBoth("both", "both", t2)
+
+	fs.Stats.ResetCounters()
+	err := fs.Bisync(r.flocal, r.fremote, listings, ".conflict")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), fs.Stats.GetTransfers())
+	fstest.CheckItems(t, r.flocal, file1, file2, file3)
+	fstest.CheckItems(t, r.fremote, file1, file2, file3)
+	_, err = os.Stat(listings)
+	assert.NoError(t, err)
+}
+
+// Changes on each side are propagated to the other
+func TestBisyncChanges(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	listings, cleanup := bisyncListings(t)
+	defer cleanup()
+	r.WriteBoth("changed locally", "one", t1)
+	r.WriteBoth("changed remotely", "one", t1)
+	r.WriteBoth("deleted locally", "one", t1)
+	r.WriteBoth("deleted remotely", "one", t1)
+	file5 := r.WriteBoth("unchanged", "one", t1)
+	require.NoError(t, fs.Bisync(r.flocal, r.fremote, listings, ".conflict"))
+
+	file1 := r.WriteFile("changed locally", "two", t2)
+	file2 := r.WriteObject("changed remotely", "two", t2)
+	require.NoError(t, os.Remove(filepath.Join(r.localName, "deleted locally")))
+	removeObject(t, r.fremote, "deleted remotely")
+	file6 := r.WriteFile("new locally", "new", t2)
+	file7 := r.WriteObject("new remotely", "new", t2)
+
+	fs.Stats.ResetCounters()
+	err := fs.Bisync(r.flocal, r.fremote, listings, ".conflict")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), fs.Stats.GetTransfers())
+	fstest.CheckItems(t, r.flocal, file1, file2, file5, file6, file7)
+	fstest.CheckItems(t, r.fremote, file1, file2, file5, file6, file7)
+
+	// nothing to do the next time
+	fs.Stats.ResetCounters()
+	require.NoError(t, fs.Bisync(r.flocal, r.fremote, listings, ".conflict"))
+	assert.Equal(t, int64(0), fs.Stats.GetTransfers())
+}
+
+// A file changed on both sides keeps both versions
+func TestBisyncConflict(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	listings, cleanup := bisyncListings(t)
+	defer cleanup()
+	r.WriteBoth("file", "original", t1)
+	r.WriteBoth("changed and deleted", "original", t1)
+	require.NoError(t, fs.Bisync(r.flocal, r.fremote, listings, ".conflict"))
+
+	newer := r.WriteFile("file", "newer local version", t3)
+	older := r.WriteObject("file", "older remote", t2)
+	older.Path = "file.old"
+	kept := r.WriteObject("changed and deleted", "changed", t2)
+	require.NoError(t, os.Remove(filepath.Join(r.localName, "changed and deleted")))
+
+	err := fs.Bisync(r.flocal, r.fremote, listings, ".old")
+	require.NoError(t, err)
+	fstest.CheckItems(t, r.flocal, newer, older, kept)
+	fstest.CheckItems(t, r.fremote, newer, older, kept)
+
+	// the renamed and copied versions are in the saved listings
+	// so there is nothing to do the next time
+	fs.Stats.ResetCounters()
+	require.NoError(t, fs.Bisync(r.flocal, r.fremote, listings, ".old"))
+	assert.Equal(t, int64(0), fs.Stats.GetTransfers())
+	fstest.CheckItems(t, r.flocal, newer, older, kept)
+	fstest.CheckItems(t, r.fremote, newer, older, kept)
+}
+
+// Nothing is deleted if all the files on one side have gone
+func TestBisyncAllGone(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	listings, cleanup := bisyncListings(t)
+	defer cleanup()
+	file1 := r.WriteBoth("one", "one", t1)
+	require.NoError(t, fs.Bisync(r.flocal, r.fremote, listings, ".conflict"))
+
+	require.NoError(t, os.Remove(filepath.Join(r.localName, "one")))
+	err := fs.Bisync(r.flocal, r.fremote, listings, ".conflict")
+	assert.Error(t, err)
+	fstest.CheckItems(t, r.flocal)
+	fstest.CheckItems(t, r.fremote, file1)
+}
+
+// Check dry run doesn't change anything or save the listings
+func TestBisyncWithDryRun(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	listings, cleanup := bisyncListings(t)
+	defer cleanup()
+	file1 := r.WriteFile("local only", "local", t1)
+	file2 := r.WriteObject("remote only", "remote", t2)
+
+	fs.Config.DryRun = true
+	err := fs.Bisync(r.flocal, r.fremote, listings, ".conflict")
+	fs.Config.DryRun = false
+	require.NoError(t, err)
+	fstest.CheckItems(t, r.flocal, file1)
+	fstest.CheckItems(t, r.fremote, file2)
+	_, err = os.Stat(listings)
+	assert.True(t, os.IsNotExist(err))
+}
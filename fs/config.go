@@ -96,6 +96,10 @@ var (
 	noUpdateModTime = BoolP("no-update-modtime", "", false, "Don't update destination mod-time if files identical.")
 	backupDir       = StringP("backup-dir", "", "", "Make backups into hierarchy based in DIR.")
 	suffix          = StringP("suffix", "", "", "Suffix for use with --backup-dir.")
+	syncJournal     = StringP("sync-journal", "", "", "Record the work done by sync, copy or move in FILE so it can be resumed.")
+	uploadStateDir  = StringP("upload-state-dir", "", "", "Save the state of chunked uploads in DIR so they can be resumed.")
+	threadStreams   = IntP("multi-thread-streams", "", 4, "Max number of streams to use for multi-thread downloads.")
+	uploadConc      = IntP("upload-concurrency", "", 4, "Number of chunks of each file to upload at once for multipart uploads.")
 	useListR        = BoolP("fast-list", "", false, "Use recursive list if available. Uses more memory but fewer transactions.")
 	tpsLimit        = Float64P("tpslimit", "", 0, "Limit HTTP transactions per second to this.")
 	tpsLimitBurst   = IntP("tpslimit-burst", "", 1, "Max burst of transactions for --tpslimit.")
@@ -106,6 +110,7 @@ var (
 	statsLogLevel   = LogLevelInfo
 	bwLimit         BwTimetable
 	bufferSize      SizeSuffix = 16 << 20
+	threadCutoff    SizeSuffix = 250 << 20
 
 	// Key to use for password en/decryption.
 	// When nil, no encryption will be used for saving.
@@ -117,6 +122,7 @@ func init() {
 	VarP(&statsLogLevel, "stats-log-level", "", "Log level to show --stats output DEBUG|INFO|NOTICE|ERROR")
 	VarP(&bwLimit, "bwlimit", "", "Bandwidth limit in kBytes/s, or use suffix b|k|M|G or a full timetable.")
 	VarP(&bufferSize, "buffer-size", "", "Buffer size when copying files.")
+	VarP(&threadCutoff, "multi-thread-cutoff", "", "Use multi-thread downloads for files above this size.")
 }
 
 // crypt internals
@@ -232,8 +238,13 @@ type ConfigInfo struct {
 	DataRateUnit       string
 	BackupDir          string
 	Suffix             string
+	SyncJournal        string
+	UploadStateDir     string
 	UseListR           bool
 	BufferSize         SizeSuffix
+	MultiThreadCutoff  SizeSuffix
+	MultiThreadStreams int
+	UploadConcurrency  int
 	TPSLimit           float64
 	TPSLimitBurst      int
 	BindAddr           net.IP
@@ -373,10 +384,15 @@ func LoadConfig() {
 	Config.NoUpdateModTime = *noUpdateModTime
 	Config.BackupDir = *backupDir
 	Config.Suffix = *suffix
+	Config.SyncJournal = *syncJournal
+	Config.UploadStateDir = *uploadStateDir
 	Config.UseListR = *useListR
 	Config.TPSLimit = *tpsLimit
 	Config.TPSLimitBurst = *tpsLimitBurst
 	Config.BufferSize = bufferSize
+	Config.MultiThreadCutoff = threadCutoff
+	Config.MultiThreadStreams = *threadStreams
+	Config.UploadConcurrency = *uploadConc
 
 	Config.TrackRenames = *trackRenames
 
@@ -277,6 +277,14 @@ func BoolP(name, shorthand string, value bool, usage string) (out *bool) {
 	return out
 }
 
+// BoolVarP defines a flag which can be overridden by an environment variable
+//
+// It is a thin wrapper around pflag.BoolVarP
+func BoolVarP(p *bool, name, shorthand string, value bool, usage string) {
+	pflag.BoolVarP(p, name, shorthand, value, usage)
+	setDefaultFromEnv(name)
+}
+
 // IntP defines a flag which can be overridden by an environment variable
 //
 // It is a thin wrapper around pflag.IntP
@@ -50,6 +50,7 @@ var (
 	ErrorNotDeletingDirs             = errors.New("not deleting directories as there were IO errors")
 	ErrorCantMoveOverlapping         = errors.New("can't move files on overlapping remotes")
 	ErrorDirectoryNotEmpty           = errors.New("directory not empty")
+	ErrorCancelled                   = errors.New("operation cancelled")
 )
 
 // RegInfo provides information about a filesystem
@@ -348,6 +349,16 @@ type Features struct {
 	// Don't implement this unless you have a more efficient way
 	// of listing recursively that doing a directory traversal.
 	ListR ListRFn
+
+	// About gets quota information from the Fs
+	About func() (*Usage, error)
+
+	// OpenWriterAt opens remote for random access writes, creating
+	// it or truncating it if it exists.
+	//
+	// size is the final size of the object if known.  The object
+	// isn't complete until the WriterAtCloser is closed.
+	OpenWriterAt func(remote string, size int64) (WriterAtCloser, error)
 }
 
 // Disable nil's out the named feature.  If it isn't found then it
@@ -430,6 +441,12 @@ func (ft *Features) Fill(f Fs) *Features {
 	if do, ok := f.(ListRer); ok {
 		ft.ListR = do.ListR
 	}
+	if do, ok := f.(Abouter); ok {
+		ft.About = do.About
+	}
+	if do, ok := f.(OpenWriterAter); ok {
+		ft.OpenWriterAt = do.OpenWriterAt
+	}
 	return ft.DisableList(Config.DisableFeatures)
 }
 
@@ -483,6 +500,12 @@ func (ft *Features) Mask(f Fs) *Features {
 	if mask.ListR == nil {
 		ft.ListR = nil
 	}
+	if mask.About == nil {
+		ft.About = nil
+	}
+	if mask.OpenWriterAt == nil {
+		ft.OpenWriterAt = nil
+	}
 	return ft.DisableList(Config.DisableFeatures)
 }
 
@@ -630,6 +653,37 @@ type ListRer interface {
 	ListR(dir string, callback ListRCallback) error
 }
 
+// Abouter is an optional interface for Fs
+type Abouter interface {
+	// About gets quota information from the Fs
+	About() (*Usage, error)
+}
+
+// Usage is returned by the About call
+//
+// If a value is not known then it is set to -1
+type Usage struct {
+	Total int64 // quota of bytes that can be used
+	Used  int64 // bytes in use
+	Free  int64 // bytes which can be uploaded before reaching the quota
+}
+
+// WriterAtCloser wraps io.WriterAt and io.Closer
+type WriterAtCloser interface {
+	io.WriterAt
+	io.Closer
+}
+
+// OpenWriterAter is an optional interface for Fs
+type OpenWriterAter interface {
+	// OpenWriterAt opens remote for random access writes, creating
+	// it or truncating it if it exists.
+	//
+	// size is the final size of the object if known.  The object
+	// isn't complete until the WriterAtCloser is closed.
+	OpenWriterAt(remote string, size int64) (WriterAtCloser, error)
+}
+
 // ObjectsChan is a channel of Objects
 type ObjectsChan chan Object
 
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"reflect"
+	"strconv"
 	"sync"
 	"time"
 
@@ -22,11 +23,48 @@ const (
 )
 
 var (
-	transport   http.RoundTripper
-	noTransport sync.Once
-	tpsBucket   *rate.Limiter // for limiting number of http transactions per second
+	transport      http.RoundTripper
+	noTransport    sync.Once
+	tpsBucket      *rate.Limiter // for limiting number of http transactions per second
+	transactionsMu sync.Mutex    // protects transactions
+	transactions   = make(map[HTTPTransaction]int64)
 )
 
+// HTTPTransaction identifies a class of HTTP transactions for counting
+type HTTPTransaction struct {
+	Remote string // name of the remote making the request or ""
+	Host   string // host the request was made to
+	Code   string // HTTP status code of the response or "error"
+}
+
+// countTransaction records an HTTP transaction made by remote to req
+// which returned resp, err
+func countTransaction(remote string, req *http.Request, resp *http.Response, err error) {
+	host := req.URL.Host
+	if req.Host != "" {
+		host = req.Host
+	}
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	transactionsMu.Lock()
+	transactions[HTTPTransaction{Remote: remote, Host: host, Code: code}]++
+	transactionsMu.Unlock()
+}
+
+// HTTPTransactions returns the number of HTTP transactions made by
+// all the remotes so far, by remote, host and response code.
+func HTTPTransactions() map[HTTPTransaction]int64 {
+	transactionsMu.Lock()
+	defer transactionsMu.Unlock()
+	out := make(map[HTTPTransaction]int64, len(transactions))
+	for k, v := range transactions {
+		out[k] = v
+	}
+	return out
+}
+
 // Start the token bucket if necessary
 func startHTTPTokenBucket() {
 	if Config.TPSLimit > 0 {
@@ -108,8 +146,8 @@ func setDefaults(a, b interface{}) {
 	}
 }
 
-// Transport returns an http.RoundTripper with the correct timeouts
-func (ci *ConfigInfo) Transport() http.RoundTripper {
+// sharedTransport returns the Transport shared by all the remotes
+func (ci *ConfigInfo) sharedTransport() http.RoundTripper {
 	noTransport.Do(func() {
 		// Start with a sensible set of defaults then override.
 		// This also means we get new stuff when it gets added to go
@@ -134,13 +172,47 @@ func (ci *ConfigInfo) Transport() http.RoundTripper {
 	return transport
 }
 
+// Transport returns an http.RoundTripper with the correct timeouts
+func (ci *ConfigInfo) Transport() http.RoundTripper {
+	return ci.RemoteTransport("")
+}
+
+// RemoteTransport returns an http.RoundTripper with the correct
+// timeouts which counts its HTTP transactions against the remote
+// called name
+func (ci *ConfigInfo) RemoteTransport(name string) http.RoundTripper {
+	return &remoteTransport{
+		RoundTripper: ci.sharedTransport(),
+		remote:       name,
+	}
+}
+
 // Client returns an http.Client with the correct timeouts
 func (ci *ConfigInfo) Client() *http.Client {
+	return ci.RemoteClient("")
+}
+
+// RemoteClient returns an http.Client with the correct timeouts which
+// counts its HTTP transactions against the remote called name
+func (ci *ConfigInfo) RemoteClient(name string) *http.Client {
 	return &http.Client{
-		Transport: ci.Transport(),
+		Transport: ci.RemoteTransport(name),
 	}
 }
 
+// remoteTransport counts the transactions made by a remote
+type remoteTransport struct {
+	http.RoundTripper
+	remote string
+}
+
+// RoundTrip implements the RoundTripper interface.
+func (t *remoteTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	resp, err = t.RoundTripper.RoundTrip(req)
+	countTransaction(t.remote, req, resp, err)
+	return resp, err
+}
+
 // Transport is a our http Transport which wraps an http.Transport
 // * Sets the User Agent
 // * Does logging
@@ -5,9 +5,11 @@ package fs
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // returns the "%p" reprentation of the thing passed in
@@ -62,3 +64,29 @@ func TestCleanAuth(t *testing.T) {
 		assert.Equal(t, test.want, got, test.in)
 	}
 }
+
+func TestTransportCountsTransactions(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	host := ts.Listener.Addr().String()
+
+	get := func(client *http.Client, path string) {
+		resp, err := client.Get(ts.URL + path)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+	client := Config.Client()
+	for _, path := range []string{"/", "/", "/missing"} {
+		get(client, path)
+	}
+	get(Config.RemoteClient("remote"), "/")
+
+	transactions := HTTPTransactions()
+	assert.Equal(t, int64(2), transactions[HTTPTransaction{Host: host, Code: "200"}])
+	assert.Equal(t, int64(1), transactions[HTTPTransaction{Host: host, Code: "404"}])
+	assert.Equal(t, int64(1), transactions[HTTPTransaction{Remote: "remote", Host: host, Code: "200"}])
+}
@@ -0,0 +1,303 @@
+// Journal of the work done by a sync so it can be resumed
+
+package fs
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The journal is a file with a JSON header on the first line
+// identifying the sync, followed by a JSON record on each line for
+// each file or directory which has been completed.
+//
+// A file is complete when it has been found to be the same on the
+// destination or transferred there.  A directory is complete when it
+// has been listed and all the files in it are complete.  The size and
+// modification time of files are recorded so any which have changed
+// since are transferred again.
+const journalVersion = 1
+
+// journalHeader is the first line of the journal
+type journalHeader struct {
+	Version int    `json:"version"`
+	Src     string `json:"src"`
+	Dst     string `json:"dst"`
+	Flags   string `json:"flags"` // fingerprint of the flags in use
+}
+
+// journalRecord records a completed file or directory
+type journalRecord struct {
+	File    string    `json:"file,omitempty"`
+	Dir     *string   `json:"dir,omitempty"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// journal keeps track of the work done by a sync
+type journal struct {
+	name    string
+	mu      sync.Mutex               // protects the following
+	out     *os.File                 // where the records are written
+	err     error                    // first error writing the journal
+	files   map[string]journalRecord // files completed by previous runs
+	dirs    map[string]bool          // directories completed by previous runs
+	useDirs bool                     // set to record directories
+	pending map[string]int           // count of files in progress in each directory
+	listed  map[string]bool          // directories which have been listed
+}
+
+// journalFlags returns a fingerprint of the flags which affect what
+// a sync does
+func journalFlags(deleteMode DeleteMode, doMove bool) string {
+	h := md5.New()
+	_, _ = fmt.Fprintf(h, "%d,%v,%v,%v,%v,%v,%v,%v,%d,%v,%q,%q\n",
+		deleteMode, doMove, Config.CheckSum, Config.SizeOnly,
+		Config.IgnoreTimes, Config.IgnoreExisting, Config.IgnoreSize,
+		Config.UpdateOlder, Config.MaxDepth, Config.TrackRenames,
+		Config.BackupDir, Config.Suffix)
+	if Config.Filter != nil {
+		_, _ = fmt.Fprintf(h, "%v,%d,%d\n%s\n", Config.Filter.DeleteExcluded,
+			Config.Filter.MinSize, Config.Filter.MaxSize, Config.Filter.DumpFilters())
+		var files []string
+		for file := range Config.Filter.Files() {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			_, _ = fmt.Fprintf(h, "%q\n", file)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// openJournal opens the journal in name for a sync of fsrc to fdst.
+//
+// If the journal was written by the same sync then the work it
+// records is loaded so it can be skipped, otherwise the journal is
+// started again.
+func openJournal(name string, fdst, fsrc Fs, deleteMode DeleteMode, doMove bool) (*journal, error) {
+	j := &journal{
+		name:    name,
+		files:   map[string]journalRecord{},
+		dirs:    map[string]bool{},
+		useDirs: deleteMode == DeleteModeOff,
+		pending: map[string]int{},
+		listed:  map[string]bool{},
+	}
+	header := journalHeader{
+		Version: journalVersion,
+		Src:     fmt.Sprintf("%s:%s", fsrc.Name(), fsrc.Root()),
+		Dst:     fmt.Sprintf("%s:%s", fdst.Name(), fdst.Root()),
+		Flags:   journalFlags(deleteMode, doMove),
+	}
+	out, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open sync journal")
+	}
+	j.out = out
+	end, err := j.load(header)
+	if err == nil && end == 0 {
+		// start a new journal
+		var data []byte
+		data, err = json.Marshal(header)
+		if err == nil {
+			err = out.Truncate(0)
+		}
+		if err == nil {
+			_, err = out.WriteAt(append(data, '\n'), 0)
+		}
+		end = int64(len(data)) + 1
+	} else if err == nil {
+		// lose any partly written record
+		err = out.Truncate(end)
+	}
+	if err == nil {
+		_, err = out.Seek(end, io.SeekStart)
+	}
+	if err != nil {
+		_ = out.Close()
+		return nil, errors.Wrap(err, "failed to start sync journal")
+	}
+	return j, nil
+}
+
+// load reads the records from the journal if it has the header
+// given, returning the offset after the last complete record or 0 if
+// the journal should be started again
+func (j *journal) load(header journalHeader) (end int64, err error) {
+	in := bufio.NewReader(j.out)
+	line, err := in.ReadBytes('\n')
+	if err == io.EOF {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	var got journalHeader
+	if json.Unmarshal(line, &got) != nil || got != header {
+		Logf(nil, "Sync journal %q is from a different sync - starting again", j.name)
+		return 0, nil
+	}
+	end = int64(len(line))
+	for {
+		line, err = in.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		var record journalRecord
+		if json.Unmarshal(line, &record) != nil {
+			break
+		}
+		if record.Dir != nil {
+			j.dirs[*record.Dir] = true
+		} else {
+			j.files[record.File] = record
+		}
+		end += int64(len(line))
+	}
+	Logf(nil, "Resuming sync from journal %q with %d files and %d directories done", j.name, len(j.files), len(j.dirs))
+	return end, nil
+}
+
+// write a record to the journal - call with the lock held
+func (j *journal) write(record journalRecord) {
+	if j.err != nil {
+		return
+	}
+	data, err := json.Marshal(record)
+	if err == nil {
+		_, err = j.out.Write(append(data, '\n'))
+	}
+	if err != nil {
+		j.err = errors.Wrap(err, "failed to write sync journal")
+		Errorf(nil, "%v", j.err)
+	}
+}
+
+// isDone returns whether src was completed by a previous run and
+// hasn't changed since
+func (j *journal) isDone(src Object) bool {
+	if j == nil {
+		return false
+	}
+	j.mu.Lock()
+	record, ok := j.files[src.Remote()]
+	j.mu.Unlock()
+	if !ok || record.Size != src.Size() || !record.ModTime.Equal(src.ModTime()) {
+		return false
+	}
+	Debugf(src, "Skipping as done according to the sync journal")
+	return true
+}
+
+// dirDone returns whether dir was completed by a previous run
+func (j *journal) dirDone(dir string) bool {
+	if j == nil || !j.useDirs {
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.dirs[dir]
+}
+
+// allDone returns whether all the files in entries were completed by
+// a previous run and haven't changed since
+func (j *journal) allDone(entries DirEntries) bool {
+	for _, entry := range entries {
+		if o, ok := entry.(Object); ok && !j.isDone(o) {
+			return false
+		}
+	}
+	return true
+}
+
+// dirOf returns the directory src is in
+func dirOf(src Object) string {
+	dir := path.Dir(src.Remote())
+	if dir == "." {
+		dir = ""
+	}
+	return dir
+}
+
+// started records that work has started on src
+func (j *journal) started(src Object) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	j.pending[dirOf(src)]++
+	j.mu.Unlock()
+}
+
+// checkDir records dir as complete if it has been listed and all its
+// files are complete - call with the lock held
+func (j *journal) checkDir(dir string) {
+	if j.useDirs && j.listed[dir] && j.pending[dir] == 0 {
+		delete(j.listed, dir)
+		delete(j.pending, dir)
+		j.write(journalRecord{Dir: &dir})
+	}
+}
+
+// done records src as complete
+func (j *journal) done(src Object) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.write(journalRecord{
+		File:    src.Remote(),
+		Size:    src.Size(),
+		ModTime: src.ModTime(),
+	})
+	dir := dirOf(src)
+	j.pending[dir]--
+	j.checkDir(dir)
+}
+
+// dirListed records that all the files in dir have been started
+func (j *journal) dirListed(dir string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.listed[dir] = true
+	j.checkDir(dir)
+}
+
+// close the journal, removing it if the sync succeeded as there is
+// nothing left to resume
+func (j *journal) close(syncErr error) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	err := j.out.Close()
+	if err == nil {
+		err = j.err
+	}
+	if err == nil && syncErr == nil {
+		err = os.Remove(j.name)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to close sync journal")
+	}
+	return nil
+}
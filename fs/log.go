@@ -3,12 +3,15 @@
 package fs
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"path"
 	"reflect"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
@@ -84,21 +87,111 @@ var (
 	syslogFacility = StringP("syslog-facility", "", "DAEMON", "Facility for syslog, eg KERN,USER,...")
 )
 
+// useJSONLog is set by --use-json-log.  The flag is registered in
+// init as the logging functions depend on it.
+var useJSONLog bool
+
+func init() {
+	BoolVarP(&useJSONLog, "use-json-log", "", false, "Use json log format.")
+}
+
 // logPrint sends the text to the logger of level
 var logPrint = func(level LogLevel, text string) {
-	text = fmt.Sprintf("%-6s: %s", level, text)
+	if !useJSONLog {
+		text = fmt.Sprintf("%-6s: %s", level, text)
+	}
 	log.Print(text)
 }
 
 // logPrintf produces a log string from the arguments passed in
 func logPrintf(level LogLevel, o interface{}, text string, args ...interface{}) {
 	out := fmt.Sprintf(text, args...)
+	if useJSONLog {
+		logPrint(level, jsonLogLine(level, o, out, nil))
+		return
+	}
 	if o != nil {
 		out = fmt.Sprintf("%v: %s", o, out)
 	}
 	logPrint(level, out)
 }
 
+// thisLogFile is the name of this source file, used to skip the logging
+// functions when finding the source of a log message
+var thisLogFile string
+
+func init() {
+	_, thisLogFile, _, _ = runtime.Caller(0)
+}
+
+// logSource returns the "dir/file.go:line" of the first caller
+// outside this file
+func logSource() string {
+	for i := 1; ; i++ {
+		_, file, line, ok := runtime.Caller(i)
+		if !ok {
+			return ""
+		}
+		if file != thisLogFile {
+			return fmt.Sprintf("%s:%d", path.Join(path.Base(path.Dir(file)), path.Base(file)), line)
+		}
+	}
+}
+
+// jsonLogLine makes a single line JSON object describing the log
+// message with any extra fields passed in
+func jsonLogLine(level LogLevel, o interface{}, text string, fields map[string]interface{}) string {
+	entry := make(map[string]interface{}, len(fields)+6)
+	for k, v := range fields {
+		entry[k] = v
+	}
+	entry["level"] = strings.ToLower(level.String())
+	entry["time"] = time.Now().Format(time.RFC3339Nano)
+	entry["source"] = logSource()
+	entry["msg"] = strings.TrimSpace(text)
+	if o != nil {
+		entry["object"] = fmt.Sprint(o)
+		entry["objectType"] = fmt.Sprintf("%T", o)
+		switch x := o.(type) {
+		case Info:
+			entry["fs"] = fsString(x)
+		case ObjectInfo:
+			entry["fs"] = fsString(x.Fs())
+		}
+	}
+	out, err := json.Marshal(entry)
+	if err != nil {
+		// Shouldn't happen - all the values are marshalable
+		out, _ = json.Marshal(map[string]string{
+			"level": strings.ToLower(level.String()),
+			"msg":   text,
+			"error": err.Error(),
+		})
+	}
+	return string(out)
+}
+
+// fsString returns the remote name of f in the form "name:root"
+func fsString(f Info) string {
+	if f == nil {
+		return ""
+	}
+	return f.Name() + ":" + f.Root()
+}
+
+// logStructured logs the text and fields at level as a structured
+// log message if --use-json-log is set, or just the text otherwise
+func logStructured(level LogLevel, o interface{}, fields map[string]interface{}, text string, args ...interface{}) {
+	if Config.LogLevel < level {
+		return
+	}
+	if !useJSONLog {
+		logPrintf(level, o, text, args...)
+		return
+	}
+	logPrint(level, jsonLogLine(level, o, fmt.Sprintf(text, args...), fields))
+}
+
 // LogLevelPrintf writes logs at the given level
 func LogLevelPrintf(level LogLevel, o interface{}, text string, args ...interface{}) {
 	if Config.LogLevel >= level {
@@ -202,6 +295,11 @@ func InitLogging() {
 		redirectStderr(f)
 	}
 
+	// JSON output includes its own timestamp
+	if useJSONLog {
+		log.SetFlags(0)
+	}
+
 	// Syslog output
 	if *useSyslog {
 		if *logFile != "" {
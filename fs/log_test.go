@@ -0,0 +1,88 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLogInfo is a minimal Info for testing the log output
+type testLogInfo struct {
+	Info
+}
+
+func (testLogInfo) Name() string   { return "remote" }
+func (testLogInfo) Root() string   { return "path/to/dir" }
+func (testLogInfo) String() string { return "remote:path/to/dir" }
+
+// captureJSONLog runs fn with --use-json-log set and returns the
+// decoded log lines
+func captureJSONLog(t *testing.T, fn func()) (entries []map[string]interface{}) {
+	var buf bytes.Buffer
+	oldUseJSONLog, oldLogLevel, oldFlags := useJSONLog, Config.LogLevel, log.Flags()
+	useJSONLog = true
+	Config.LogLevel = LogLevelDebug
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		useJSONLog, Config.LogLevel = oldUseJSONLog, oldLogLevel
+		log.SetOutput(os.Stderr)
+		log.SetFlags(oldFlags)
+	}()
+	fn()
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		entry := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestJSONLog(t *testing.T) {
+	entries := captureJSONLog(t, func() {
+		Errorf(nil, "hello %s", "world")
+		Infof(testLogInfo{}, "info\n")
+		Debugf("potato", "debug")
+	})
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, "error", entries[0]["level"])
+	assert.Equal(t, "hello world", entries[0]["msg"])
+	assert.Contains(t, entries[0]["source"], "fs/log_test.go:")
+	assert.NotEqual(t, "", entries[0]["time"])
+	assert.NotContains(t, entries[0], "object")
+
+	assert.Equal(t, "info", entries[1]["level"])
+	assert.Equal(t, "info", entries[1]["msg"])
+	assert.Equal(t, "remote:path/to/dir", entries[1]["object"])
+	assert.Equal(t, "fs.testLogInfo", entries[1]["objectType"])
+	assert.Equal(t, "remote:path/to/dir", entries[1]["fs"])
+
+	assert.Equal(t, "debug", entries[2]["level"])
+	assert.Equal(t, "potato", entries[2]["object"])
+	assert.Equal(t, "string", entries[2]["objectType"])
+	assert.NotContains(t, entries[2], "fs")
+}
+
+func TestJSONLogStats(t *testing.T) {
+	oldStatsLogLevel := Config.StatsLogLevel
+	Config.StatsLogLevel = LogLevelInfo
+	defer func() {
+		Config.StatsLogLevel = oldStatsLogLevel
+	}()
+	stats := NewStats()
+	stats.Bytes(42)
+	entries := captureJSONLog(t, stats.Log)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "info", entries[0]["level"])
+	assert.Contains(t, entries[0]["source"], "fs/accounting.go:")
+	values, ok := entries[0]["stats"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, float64(42), values["bytes"])
+}
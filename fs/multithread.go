@@ -0,0 +1,161 @@
+// Multi-thread downloads of large files
+
+package fs
+
+import (
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// multiThreadMinPartSize is the smallest part a stream is given
+const multiThreadMinPartSize = 1024 * 1024
+
+// errMultiThreadAborted is returned by the streams which are stopped
+// because another stream failed
+var errMultiThreadAborted = errors.New("multi-thread copy aborted")
+
+// doMultiThreadCopy returns whether src should be copied to f using
+// multi-thread downloads
+func doMultiThreadCopy(f Fs, src Object) bool {
+	if Config.MultiThreadStreams <= 1 || Config.MultiThreadCutoff <= 0 {
+		return false
+	}
+	if src.Size() < int64(Config.MultiThreadCutoff) {
+		return false
+	}
+	return f.Features().OpenWriterAt != nil
+}
+
+// multiThreadCopyState holds the state of a multi-thread copy
+type multiThreadCopyState struct {
+	src      Object
+	out      WriterAtCloser
+	acc      *Account
+	size     int64
+	partSize int64
+	streams  int
+	mu       sync.Mutex // protects err
+	err      error      // first error from a stream
+}
+
+// setErr records err as the error for the copy if it is the first
+func (mc *multiThreadCopyState) setErr(err error) {
+	mc.mu.Lock()
+	if mc.err == nil {
+		mc.err = err
+	}
+	mc.mu.Unlock()
+}
+
+// aborted returns whether any stream has failed
+func (mc *multiThreadCopyState) aborted() bool {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.err != nil
+}
+
+// offsetWriter writes to the destination at an offset which advances
+// with each write
+type offsetWriter struct {
+	mc     *multiThreadCopyState
+	offset int64
+}
+
+// Write writes p at the current offset - see io.Writer
+func (w *offsetWriter) Write(p []byte) (n int, err error) {
+	if w.mc.aborted() {
+		return 0, errMultiThreadAborted
+	}
+	n, err = w.mc.out.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+// copyStream copies the part of the source for stream
+func (mc *multiThreadCopyState) copyStream(stream int) (err error) {
+	start := int64(stream) * mc.partSize
+	if start >= mc.size {
+		return nil
+	}
+	end := start + mc.partSize
+	if end > mc.size {
+		end = mc.size
+	}
+	Debugf(mc.src, "multi-thread copy: stream %d/%d (%d-%d) size %v starting", stream+1, mc.streams, start, end, SizeSuffix(end-start))
+	in, err := mc.src.Open(&RangeOption{Start: start, End: end - 1})
+	if err != nil {
+		return errors.Wrap(err, "multi-thread copy: failed to open source")
+	}
+	defer CheckClose(in, &err)
+	n, err := io.Copy(&offsetWriter{mc: mc, offset: start}, mc.acc.accountPart(io.LimitReader(in, end-start)))
+	if err != nil {
+		return errors.Wrap(err, "multi-thread copy: failed to copy")
+	}
+	if n != end-start {
+		return errors.Errorf("multi-thread copy: short read %d of %d bytes", n, end-start)
+	}
+	Debugf(mc.src, "multi-thread copy: stream %d/%d (%d-%d) size %v finished", stream+1, mc.streams, start, end, SizeSuffix(end-start))
+	return nil
+}
+
+// multiThreadCopy copies src to remote on f by reading the source in
+// parts concurrently and writing them at their offsets in the
+// destination.  The transfer is accounted in stats.
+func multiThreadCopy(stats *StatsInfo, f Fs, remote string, src Object) (dst Object, err error) {
+	size := src.Size()
+	streams := Config.MultiThreadStreams
+	if maxStreams := size / multiThreadMinPartSize; int64(streams) > maxStreams {
+		streams = int(maxStreams)
+	}
+	if streams < 1 {
+		streams = 1
+	}
+	mc := &multiThreadCopyState{
+		src:      src,
+		size:     size,
+		partSize: (size + int64(streams) - 1) / int64(streams),
+		streams:  streams,
+	}
+	mc.out, err = f.Features().OpenWriterAt(remote, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "multi-thread copy: failed to open destination")
+	}
+	// The reads are accounted part by part in each stream
+	mc.acc = stats.NewAccount(ioutil.NopCloser(nil), src)
+
+	var wg sync.WaitGroup
+	for stream := 0; stream < streams; stream++ {
+		wg.Add(1)
+		go func(stream int) {
+			defer wg.Done()
+			if err := mc.copyStream(stream); err != nil {
+				mc.setErr(err)
+			}
+		}(stream)
+	}
+	wg.Wait()
+	_ = mc.acc.Close()
+	err = mc.err
+	closeErr := mc.out.Close()
+	if err == nil && closeErr != nil {
+		err = errors.Wrap(closeErr, "multi-thread copy: failed to close destination")
+	}
+	if err == nil {
+		dst, err = f.NewObject(remote)
+	}
+	if err == nil {
+		err = dst.SetModTime(src.ModTime())
+	}
+	if err != nil {
+		// Remove the partially written object
+		if o, findErr := f.NewObject(remote); findErr == nil {
+			removeFailedCopy(o)
+		}
+		return nil, err
+	}
+	Debugf(src, "Finished multi-thread copy with %d parts of size %v", streams, SizeSuffix(mc.partSize))
+	return dst, nil
+}
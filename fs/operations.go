@@ -66,6 +66,11 @@ func HashEquals(src, dst string) bool {
 //
 // If an error is returned it will return equal as false
 func CheckHashes(src, dst Object) (equal bool, hash HashType, err error) {
+	return checkHashes(Stats, src, dst)
+}
+
+// checkHashes is CheckHashes counting any errors in stats
+func checkHashes(stats *StatsInfo, src, dst Object) (equal bool, hash HashType, err error) {
 	common := src.Fs().Hashes().Overlap(dst.Fs().Hashes())
 	// Debugf(nil, "Shared hashes: %v", common)
 	if common.Count() == 0 {
@@ -74,7 +79,7 @@ func CheckHashes(src, dst Object) (equal bool, hash HashType, err error) {
 	hash = common.GetOne()
 	srcHash, err := src.Hash(hash)
 	if err != nil {
-		Stats.Error()
+		stats.Error()
 		Errorf(src, "Failed to calculate src hash: %v", err)
 		return false, hash, err
 	}
@@ -83,7 +88,7 @@ func CheckHashes(src, dst Object) (equal bool, hash HashType, err error) {
 	}
 	dstHash, err := dst.Hash(hash)
 	if err != nil {
-		Stats.Error()
+		stats.Error()
 		Errorf(dst, "Failed to calculate dst hash: %v", err)
 		return false, hash, err
 	}
@@ -116,10 +121,10 @@ func CheckHashes(src, dst Object) (equal bool, hash HashType, err error) {
 // Otherwise the file is considered to be not equal including if there
 // were errors reading info.
 func Equal(src, dst Object) bool {
-	return equal(src, dst, Config.SizeOnly, Config.CheckSum)
+	return equal(Stats, src, dst, Config.SizeOnly, Config.CheckSum)
 }
 
-func equal(src, dst Object, sizeOnly, checkSum bool) bool {
+func equal(stats *StatsInfo, src, dst Object, sizeOnly, checkSum bool) bool {
 	if !Config.IgnoreSize {
 		if src.Size() != dst.Size() {
 			Debugf(src, "Sizes differ")
@@ -136,7 +141,7 @@ func equal(src, dst Object, sizeOnly, checkSum bool) bool {
 	// If checking checksum and not modtime
 	if checkSum {
 		// Check the hash
-		same, hash, _ := CheckHashes(src, dst)
+		same, hash, _ := checkHashes(stats, src, dst)
 		if !same {
 			Debugf(src, "%v differ", hash)
 			return false
@@ -166,7 +171,7 @@ func equal(src, dst Object, sizeOnly, checkSum bool) bool {
 	Debugf(src, "Modification times differ by %s: %v, %v", dt, srcModTime, dstModTime)
 
 	// Check if the hashes are the same
-	same, hash, _ := CheckHashes(src, dst)
+	same, hash, _ := checkHashes(stats, src, dst)
 	if !same {
 		Debugf(src, "%v differ", hash)
 		return false
@@ -195,7 +200,7 @@ func equal(src, dst Object, sizeOnly, checkSum bool) bool {
 				}
 				return false
 			} else if err != nil {
-				Stats.Error()
+				stats.Error()
 				Errorf(dst, "Failed to set modification time: %v", err)
 			} else {
 				Infof(src, "Updated modification time in destination")
@@ -270,6 +275,11 @@ var _ MimeTyper = (*overrideRemoteObject)(nil)
 // Copy src object to dst or f if nil.  If dst is nil then it uses
 // remote as the name of the new object.
 func Copy(f Fs, dst Object, remote string, src Object) (err error) {
+	return copyObject(Stats, f, dst, remote, src)
+}
+
+// copyObject is Copy accounting the transfer in stats
+func copyObject(stats *StatsInfo, f Fs, dst Object, remote string, src Object) (err error) {
 	if Config.DryRun {
 		Logf(src, "Not copying as --dry-run")
 		return nil
@@ -303,13 +313,24 @@ func Copy(f Fs, dst Object, remote string, src Object) (err error) {
 			err = ErrorCantCopy
 		}
 		// If can't server side copy, do it manually
-		if err == ErrorCantCopy {
+		if err == ErrorCantCopy && doMultiThreadCopy(f, src) {
+			// Download the source in parts written straight into place
+			actionTaken = "Multi-thread copied (new)"
+			if doUpdate {
+				actionTaken = "Multi-thread copied (replaced existing)"
+			}
+			var newDst Object
+			newDst, err = multiThreadCopy(stats, f, remote, src)
+			if err == nil {
+				dst = newDst
+			}
+		} else if err == ErrorCantCopy {
 			var in0 io.ReadCloser
 			in0, err = src.Open(hashOption)
 			if err != nil {
 				err = errors.Wrap(err, "failed to open source object")
 			} else {
-				in := NewAccount(in0, src).WithBuffer() // account and buffer the transfer
+				in := stats.NewAccount(in0, src).WithBuffer() // account and buffer the transfer
 				var wrappedSrc ObjectInfo = src
 				// We try to pass the original object if possible
 				if src.Remote() != remote {
@@ -341,14 +362,14 @@ func Copy(f Fs, dst Object, remote string, src Object) (err error) {
 		break
 	}
 	if err != nil {
-		Stats.Error()
+		stats.Error()
 		Errorf(src, "Failed to copy: %v", err)
 		return err
 	}
 
 	// Verify sizes are the same after transfer
 	if !Config.IgnoreSize && src.Size() != dst.Size() {
-		Stats.Error()
+		stats.Error()
 		err = errors.Errorf("corrupted on transfer: sizes differ %d vs %d", src.Size(), dst.Size())
 		Errorf(dst, "%v", err)
 		removeFailedCopy(dst)
@@ -362,16 +383,16 @@ func Copy(f Fs, dst Object, remote string, src Object) (err error) {
 		var srcSum string
 		srcSum, err = src.Hash(hashType)
 		if err != nil {
-			Stats.Error()
+			stats.Error()
 			Errorf(src, "Failed to read src hash: %v", err)
 		} else if srcSum != "" {
 			var dstSum string
 			dstSum, err = dst.Hash(hashType)
 			if err != nil {
-				Stats.Error()
+				stats.Error()
 				Errorf(dst, "Failed to read hash: %v", err)
 			} else if !Config.IgnoreChecksum && !HashEquals(srcSum, dstSum) {
-				Stats.Error()
+				stats.Error()
 				err = errors.Errorf("corrupted on transfer: %v hash differ %q vs %q", hashType, srcSum, dstSum)
 				Errorf(dst, "%v", err)
 				removeFailedCopy(dst)
@@ -387,6 +408,11 @@ func Copy(f Fs, dst Object, remote string, src Object) (err error) {
 // Move src object to dst or fdst if nil.  If dst is nil then it uses
 // remote as the name of the new object.
 func Move(fdst Fs, dst Object, remote string, src Object) (err error) {
+	return moveObject(Stats, fdst, dst, remote, src)
+}
+
+// moveObject is Move accounting the transfer in stats
+func moveObject(stats *StatsInfo, fdst Fs, dst Object, remote string, src Object) (err error) {
 	if Config.DryRun {
 		Logf(src, "Not moving as --dry-run")
 		return nil
@@ -395,7 +421,7 @@ func Move(fdst Fs, dst Object, remote string, src Object) (err error) {
 	if doMove := fdst.Features().Move; doMove != nil && SameConfig(src.Fs(), fdst) {
 		// Delete destination if it exists
 		if dst != nil {
-			err = DeleteFile(dst)
+			err = deleteFileWithBackupDir(stats, dst, nil)
 			if err != nil {
 				return err
 			}
@@ -409,19 +435,19 @@ func Move(fdst Fs, dst Object, remote string, src Object) (err error) {
 		case ErrorCantMove:
 			Debugf(src, "Can't move, switching to copy")
 		default:
-			Stats.Error()
+			stats.Error()
 			Errorf(src, "Couldn't move: %v", err)
 			return err
 		}
 	}
 	// Move not found or didn't work so copy dst <- src
-	err = Copy(fdst, dst, remote, src)
+	err = copyObject(stats, fdst, dst, remote, src)
 	if err != nil {
 		Errorf(src, "Not deleting source as copy failed: %v", err)
 		return err
 	}
 	// Delete src if no error on copy
-	return DeleteFile(src)
+	return deleteFileWithBackupDir(stats, src, nil)
 }
 
 // CanServerSideMove returns true if fdst support server side moves or
@@ -436,12 +462,12 @@ func CanServerSideMove(fdst Fs) bool {
 }
 
 // deleteFileWithBackupDir deletes a single file respecting --dry-run
-// and accumulating stats and errors.
+// and accumulating stats and errors in stats.
 //
 // If backupDir is set then it moves the file to there instead of
 // deleting
-func deleteFileWithBackupDir(dst Object, backupDir Fs) (err error) {
-	Stats.Checking(dst.Remote())
+func deleteFileWithBackupDir(stats *StatsInfo, dst Object, backupDir Fs) (err error) {
+	stats.Checking(dst.Remote())
 	action, actioned, actioning := "delete", "Deleted", "deleting"
 	if backupDir != nil {
 		action, actioned, actioning = "move into backup dir", "Moved into backup dir", "moving into backup dir"
@@ -454,18 +480,18 @@ func deleteFileWithBackupDir(dst Object, backupDir Fs) (err error) {
 		} else {
 			remoteWithSuffix := dst.Remote() + Config.Suffix
 			overwritten, _ := backupDir.NewObject(remoteWithSuffix)
-			err = Move(backupDir, overwritten, remoteWithSuffix, dst)
+			err = moveObject(stats, backupDir, overwritten, remoteWithSuffix, dst)
 		}
 	} else {
 		err = dst.Remove()
 	}
 	if err != nil {
-		Stats.Error()
+		stats.Error()
 		Errorf(dst, "Couldn't %s: %v", action, err)
 	} else if !Config.DryRun {
 		Infof(dst, actioned)
 	}
-	Stats.DoneChecking(dst.Remote())
+	stats.DoneChecking(dst.Remote())
 	return err
 }
 
@@ -474,15 +500,15 @@ func deleteFileWithBackupDir(dst Object, backupDir Fs) (err error) {
 // If useBackupDir is set and --backup-dir is in effect then it moves
 // the file to there instead of deleting
 func DeleteFile(dst Object) (err error) {
-	return deleteFileWithBackupDir(dst, nil)
+	return deleteFileWithBackupDir(Stats, dst, nil)
 }
 
 // deleteFilesWithBackupDir removes all the files passed in the
-// channel
+// channel accumulating stats and errors in stats
 //
 // If backupDir is set the files will be placed into that directory
 // instead of being deleted.
-func deleteFilesWithBackupDir(toBeDeleted ObjectsChan, backupDir Fs) error {
+func deleteFilesWithBackupDir(stats *StatsInfo, toBeDeleted ObjectsChan, backupDir Fs) error {
 	var wg sync.WaitGroup
 	wg.Add(Config.Transfers)
 	var errorCount int32
@@ -490,7 +516,7 @@ func deleteFilesWithBackupDir(toBeDeleted ObjectsChan, backupDir Fs) error {
 		go func() {
 			defer wg.Done()
 			for dst := range toBeDeleted {
-				err := deleteFileWithBackupDir(dst, backupDir)
+				err := deleteFileWithBackupDir(stats, dst, backupDir)
 				if err != nil {
 					atomic.AddInt32(&errorCount, 1)
 				}
@@ -507,7 +533,7 @@ func deleteFilesWithBackupDir(toBeDeleted ObjectsChan, backupDir Fs) error {
 
 // DeleteFiles removes all the files passed in the channel
 func DeleteFiles(toBeDeleted ObjectsChan) error {
-	return deleteFilesWithBackupDir(toBeDeleted, nil)
+	return deleteFilesWithBackupDir(Stats, toBeDeleted, nil)
 }
 
 // Read a Objects into add() for the given Fs.
@@ -1154,6 +1180,17 @@ func Rmdir(f Fs, dir string) error {
 
 // Purge removes a container and all of its contents
 func Purge(f Fs) error {
+	return purge(Stats, f)
+}
+
+// PurgeWithStats is like Purge but counts any errors in stats rather
+// than the global Stats.
+func PurgeWithStats(f Fs, stats *StatsInfo) error {
+	return purge(stats, f)
+}
+
+// purge is Purge counting errors in stats
+func purge(stats *StatsInfo, f Fs) error {
 	doFallbackPurge := true
 	var err error
 	if doPurge := f.Features().Purge; doPurge != nil {
@@ -1169,14 +1206,14 @@ func Purge(f Fs) error {
 	}
 	if doFallbackPurge {
 		// DeleteFiles and Rmdir observe --dry-run
-		err = DeleteFiles(listToChan(f))
+		err = deleteFilesWithBackupDir(stats, listToChan(stats, f), nil)
 		if err != nil {
 			return err
 		}
-		err = Rmdirs(f, "")
+		err = rmdirs(stats, f, "")
 	}
 	if err != nil {
-		Stats.Error()
+		stats.Error()
 		return err
 	}
 	return nil
@@ -1477,7 +1514,7 @@ func Deduplicate(f Fs, mode DeduplicateMode) error {
 // channel.
 //
 // If the error was ErrorDirNotFound then it will be ignored
-func listToChan(f Fs) ObjectsChan {
+func listToChan(stats *StatsInfo, f Fs) ObjectsChan {
 	o := make(ObjectsChan, Config.Checkers)
 	go func() {
 		defer close(o)
@@ -1486,7 +1523,7 @@ func listToChan(f Fs) ObjectsChan {
 				if err == ErrorDirNotFound {
 					return nil
 				}
-				Stats.Error()
+				stats.Error()
 				Errorf(nil, "Failed to list: %v", err)
 				return nil
 			}
@@ -1639,11 +1676,16 @@ func Rcat(fdst Fs, dstFileName string, in0 io.ReadCloser, modTime time.Time) (er
 // Rmdirs removes any empty directories (or directories only
 // containing empty directories) under f, including f.
 func Rmdirs(f Fs, dir string) error {
+	return rmdirs(Stats, f, dir)
+}
+
+// rmdirs is Rmdirs counting errors in stats
+func rmdirs(stats *StatsInfo, f Fs, dir string) error {
 	dirEmpty := make(map[string]bool)
 	dirEmpty[""] = true
 	err := Walk(f, dir, true, Config.MaxDepth, func(dirPath string, entries DirEntries, err error) error {
 		if err != nil {
-			Stats.Error()
+			stats.Error()
 			Errorf(f, "Failed to list %q: %v", dirPath, err)
 			return nil
 		}
@@ -1690,7 +1732,7 @@ func Rmdirs(f Fs, dir string) error {
 		dir := toDelete[i]
 		err := TryRmdir(f, dir)
 		if err != nil {
-			Stats.Error()
+			stats.Error()
 			Errorf(dir, "Failed to rmdir: %v", err)
 			return err
 		}
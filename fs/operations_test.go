@@ -861,6 +861,41 @@ func TestCopyFile(t *testing.T) {
 	fstest.CheckItems(t, r.fremote, file2)
 }
 
+// Check large files are copied in parts with multi-thread downloads
+func TestCopyFileMultiThread(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	if r.fremote.Features().OpenWriterAt == nil {
+		t.Skip("Can't test multi-thread copy as remote doesn't support OpenWriterAt")
+	}
+	oldCutoff, oldStreams := fs.Config.MultiThreadCutoff, fs.Config.MultiThreadStreams
+	fs.Config.MultiThreadCutoff, fs.Config.MultiThreadStreams = 1024*1024, 3
+	defer func() {
+		fs.Config.MultiThreadCutoff, fs.Config.MultiThreadStreams = oldCutoff, oldStreams
+	}()
+
+	contents := fstest.RandomString(5*1024*1024 + 17)
+	file1 := r.WriteFile("file1", contents, t1)
+	fstest.CheckItems(t, r.flocal, file1)
+
+	fs.Stats.ResetCounters()
+	file2 := file1
+	file2.Path = "sub/file2"
+	err := fs.CopyFile(r.fremote, r.flocal, file2.Path, file1.Path)
+	require.NoError(t, err)
+	fstest.CheckItems(t, r.fremote, file2)
+	assert.Equal(t, int64(len(contents)), fs.Stats.RemoteStats()["bytes"])
+
+	// replacing a bigger file truncates it
+	r.WriteObject("sub/file3", contents+"extra", t2)
+	file3 := r.WriteFile("file3", contents[:3*1024*1024], t1)
+	file4 := file3
+	file4.Path = "sub/file3"
+	err = fs.CopyFile(r.fremote, r.flocal, file4.Path, file3.Path)
+	require.NoError(t, err)
+	fstest.CheckItems(t, r.fremote, file2, file4)
+}
+
 // testFsInfo is for unit testing fs.Info
 type testFsInfo struct {
 	name      string
@@ -0,0 +1,119 @@
+// Define the internal rc functions
+
+package rc
+
+import (
+	"os"
+
+	"github.com/ncw/rclone/fs"
+)
+
+func init() {
+	Add(Call{
+		Path:  "rc/noop",
+		Fn:    rcNoop,
+		Title: "Echo the input to the output parameters",
+		Help: `
+This echoes the input parameters to the output parameters for testing
+purposes.  It can be used to check that rclone is still alive and to
+check that parameter passing is working properly.`,
+	})
+	Add(Call{
+		Path:  "rc/list",
+		Fn:    rcList,
+		Title: "List all the registered remote control commands",
+		Help: `
+This lists all the registered remote control commands as a JSON map in
+the commands response.`,
+	})
+	Add(Call{
+		Path:  "core/pid",
+		Fn:    rcPid,
+		Title: "Return the PID of the current process",
+		Help: `
+This returns the PID of the current process in the pid response.
+Useful for stopping rclone process.`,
+	})
+	Add(Call{
+		Path:  "core/stats",
+		Fn:    rcStats,
+		Title: "Returns stats about current transfers.",
+		Help: `
+This returns all available stats
+
+	rclone rc core/stats
+
+Returns the following values:
+
+	{
+		"bytes": total transferred bytes since the start of the process,
+		"checks": number of checked files,
+		"checking": an array of names of currently active file checks,
+		"elapsedTime": time in seconds since the start of the process,
+		"errors": number of errors,
+		"speed": average speed in bytes/sec since start of the process,
+		"transfers": number of transferred files,
+		"transferring": an array of names of currently active file transfers
+	}`,
+	})
+	Add(Call{
+		Path:  "core/bwlimit",
+		Fn:    rcBwlimit,
+		Title: "Set the bandwidth limit.",
+		Help: `
+This sets the bandwidth limit to that passed in, eg
+
+	rclone rc core/bwlimit rate=1M
+	rclone rc core/bwlimit rate=off
+
+The format of rate is the same as a single value passed to --bwlimit.
+The limit stays in force until it is changed again or the next
+scheduled change in a --bwlimit timetable.`,
+	})
+}
+
+// Echo the input to the output parameters
+func rcNoop(in Params) (out Params, err error) {
+	return in, nil
+}
+
+// List the registered commands
+func rcList(in Params) (out Params, err error) {
+	out = make(Params)
+	out["commands"] = List()
+	return out, nil
+}
+
+// Return the PID of the current process
+func rcPid(in Params) (out Params, err error) {
+	out = make(Params)
+	out["pid"] = os.Getpid()
+	return out, nil
+}
+
+// Return the current stats
+func rcStats(in Params) (out Params, err error) {
+	return Params(fs.Stats.RemoteStats()), nil
+}
+
+// Set the bandwidth limit
+func rcBwlimit(in Params) (out Params, err error) {
+	rate, err := in.GetString("rate")
+	if err != nil {
+		return nil, err
+	}
+	var bandwidth fs.SizeSuffix
+	err = bandwidth.Set(rate)
+	if err != nil {
+		return nil, err
+	}
+	fs.SetBwLimit(bandwidth)
+	out = make(Params)
+	out["rate"] = bandwidth.String()
+	if bandwidth > 0 {
+		out["bytesPerSecond"] = int64(bandwidth)
+	} else {
+		out["bytesPerSecond"] = int64(0)
+	}
+	return out, nil
+}
@@ -0,0 +1,292 @@
+// Manage background jobs that the rc is running
+
+package rc
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// JobFunc defines a type for a function run as a background job.
+//
+// It should account any transfers in stats and should return as soon
+// as possible with fs.ErrorCancelled if cancel is closed.
+type JobFunc func(in Params, stats *fs.StatsInfo, cancel <-chan struct{}) (out Params, err error)
+
+// Job describes an asynchronous task started via the rc package
+type Job struct {
+	mu        sync.Mutex
+	ID        int64
+	Path      string
+	StartTime time.Time
+	EndTime   time.Time
+	Error     string
+	Finished  bool
+	Success   bool
+	Cancelled bool
+	Duration  float64
+	Output    Params
+	stats     *fs.StatsInfo
+	cancel    chan struct{}
+}
+
+// jobs holds the background jobs
+type jobs struct {
+	mu             sync.RWMutex
+	jobs           map[int64]*Job
+	lastID         int64
+	expireDuration time.Duration
+}
+
+// running is the global registry of jobs
+var running = newJobs()
+
+// newJobs makes a new background job registry
+func newJobs() *jobs {
+	return &jobs{
+		jobs:           make(map[int64]*Job),
+		expireDuration: DefaultOpt.JobExpireDuration,
+	}
+}
+
+// finish marks the job as finished recording the output and error
+func (job *Job) finish(out Params, err error) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.EndTime = time.Now()
+	if out == nil {
+		out = make(Params)
+	}
+	job.Output = out
+	job.Duration = job.EndTime.Sub(job.StartTime).Seconds()
+	if err != nil {
+		job.Error = err.Error()
+		job.Success = false
+	} else {
+		job.Error = ""
+		job.Success = true
+	}
+	job.Finished = true
+}
+
+// run the job until completion writing the output to job.Output
+func (job *Job) run(fn JobFunc, in Params) {
+	defer func() {
+		if r := recover(); r != nil {
+			job.finish(nil, errors.Errorf("panic received: %v", r))
+		}
+	}()
+	out, err := fn(in, job.stats, job.cancel)
+	fs.Debugf(nil, "rc: job %d: %q finished: %v", job.ID, job.Path, err)
+	job.finish(out, err)
+}
+
+// stop cancels the job if it is still running
+func (job *Job) stop() {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.Finished || job.Cancelled {
+		return
+	}
+	job.Cancelled = true
+	close(job.cancel)
+}
+
+// status returns the state of the job along with its stats
+func (job *Job) status() Params {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	out := Params{
+		"id":        job.ID,
+		"path":      job.Path,
+		"startTime": job.StartTime,
+		"endTime":   job.EndTime,
+		"error":     job.Error,
+		"finished":  job.Finished,
+		"success":   job.Success,
+		"cancelled": job.Cancelled,
+		"duration":  job.Duration,
+		"output":    job.Output,
+		"stats":     job.stats.RemoteStats(),
+	}
+	if !job.Finished {
+		out["duration"] = time.Now().Sub(job.StartTime).Seconds()
+	}
+	return out
+}
+
+// setExpireDuration sets how long finished jobs are kept for
+func (jobs *jobs) setExpireDuration(expireDuration time.Duration) {
+	jobs.mu.Lock()
+	jobs.expireDuration = expireDuration
+	jobs.mu.Unlock()
+}
+
+// expire removes finished jobs older than the expiry duration
+//
+// Call with the lock held
+func (jobs *jobs) expire() {
+	now := time.Now()
+	for ID, job := range jobs.jobs {
+		job.mu.Lock()
+		if job.Finished && now.Sub(job.EndTime) > jobs.expireDuration {
+			delete(jobs.jobs, ID)
+		}
+		job.mu.Unlock()
+	}
+}
+
+// IDs returns the IDs of the jobs in ascending order
+func (jobs *jobs) IDs() (IDs []int64) {
+	jobs.mu.Lock()
+	defer jobs.mu.Unlock()
+	jobs.expire()
+	IDs = make([]int64, 0, len(jobs.jobs))
+	for ID := range jobs.jobs {
+		IDs = append(IDs, ID)
+	}
+	sort.Sort(int64s(IDs))
+	return IDs
+}
+
+// Get a job with a given ID or nil if it doesn't exist
+func (jobs *jobs) Get(ID int64) *Job {
+	jobs.mu.RLock()
+	defer jobs.mu.RUnlock()
+	return jobs.jobs[ID]
+}
+
+// NewJob starts a new Job running fn in the background returning it
+func (jobs *jobs) NewJob(path string, fn JobFunc, in Params) *Job {
+	job := &Job{
+		Path:      path,
+		StartTime: time.Now(),
+		stats:     fs.NewStats(),
+		cancel:    make(chan struct{}),
+	}
+	jobs.mu.Lock()
+	jobs.expire()
+	jobs.lastID++
+	job.ID = jobs.lastID
+	jobs.jobs[job.ID] = job
+	jobs.mu.Unlock()
+	fs.Debugf(nil, "rc: job %d: %q started", job.ID, path)
+	go job.run(fn, in)
+	return job
+}
+
+// int64s sorts a slice of int64
+type int64s []int64
+
+func (x int64s) Len() int           { return len(x) }
+func (x int64s) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+func (x int64s) Less(i, j int) bool { return x[i] < x[j] }
+
+// AddJob adds a call to the registry which runs fn in the
+// background as a Job.
+//
+// The call returns the ID of the job in the jobid parameter straight
+// away.  Use job/status to find out how it is getting on.
+func AddJob(call Call, fn JobFunc) {
+	path := call.Path
+	call.Fn = func(in Params) (out Params, err error) {
+		job := running.NewJob(path, fn, in)
+		return Params{"jobid": job.ID}, nil
+	}
+	call.Help += `
+
+This runs in the background and returns a jobid straight away.  Use
+job/status with the jobid to find out how it is getting on, or
+job/stop to cancel it.`
+	Add(call)
+}
+
+func init() {
+	Add(Call{
+		Path:  "job/status",
+		Fn:    rcJobStatus,
+		Title: "Reads the status of the job ID",
+		Help: `
+Parameters
+- jobid - id of the job (integer)
+
+Results
+- id - as passed in above
+- path - the command which started the job
+- startTime - time the job started (eg "2018-01-01T12:00:00Z")
+- endTime - time the job finished (eg "2018-01-01T12:00:00Z")
+- finished - boolean whether the job has finished or not
+- success - boolean - true for success false otherwise
+- cancelled - boolean whether job/stop was called on the job
+- error - error from the job or empty string for no error
+- duration - time in seconds that the job ran for
+- output - output of the job as would have been returned if called synchronously
+- stats - the transfer stats for this job as returned by core/stats
+
+Finished jobs are forgotten about after --rc-job-expire-duration.`,
+	})
+	Add(Call{
+		Path:  "job/list",
+		Fn:    rcJobList,
+		Title: "Lists the IDs of the running jobs",
+		Help: `
+Parameters - None
+
+Results
+- jobids - array of integer job ids`,
+	})
+	Add(Call{
+		Path:  "job/stop",
+		Fn:    rcJobStop,
+		Title: "Stop the running job",
+		Help: `
+Parameters
+- jobid - id of the job (integer)
+
+This cancels the job.  It will finish with the error "operation
+cancelled" as soon as it can.`,
+	})
+}
+
+// getJob returns the job named by the jobid parameter
+func getJob(in Params) (*Job, error) {
+	jobID, err := in.GetInt64("jobid")
+	if err != nil {
+		return nil, err
+	}
+	job := running.Get(jobID)
+	if job == nil {
+		return nil, errors.Errorf("job %d not found", jobID)
+	}
+	return job, nil
+}
+
+// Returns the status of a job
+func rcJobStatus(in Params) (out Params, err error) {
+	job, err := getJob(in)
+	if err != nil {
+		return nil, err
+	}
+	return job.status(), nil
+}
+
+// Returns the list of job IDs
+func rcJobList(in Params) (out Params, err error) {
+	out = make(Params)
+	out["jobids"] = running.IDs()
+	return out, nil
+}
+
+// Stops a job
+func rcJobStop(in Params) (out Params, err error) {
+	job, err := getJob(in)
+	if err != nil {
+		return nil, err
+	}
+	job.stop()
+	return nil, nil
+}
@@ -0,0 +1,167 @@
+package rc
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	_ "github.com/ncw/rclone/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitJob waits for the job to finish returning its status
+func waitJob(t *testing.T, jobID int64) Params {
+	for i := 0; i < 500; i++ {
+		out, err := rcJobStatus(Params{"jobid": jobID})
+		require.NoError(t, err)
+		if out["finished"].(bool) {
+			return out
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %d didn't finish", jobID)
+	return nil
+}
+
+// startJob calls path returning the job ID
+func startJob(t *testing.T, path string, in Params) int64 {
+	call := Find(path)
+	require.NotNil(t, call, path)
+	out, err := call.Fn(in)
+	require.NoError(t, err)
+	jobID, err := out.GetInt64("jobid")
+	require.NoError(t, err)
+	return jobID
+}
+
+func TestJobCopyAndPurge(t *testing.T) {
+	fstest.Initialise()
+	dir, err := ioutil.TempDir("", "rclone-rc-jobs-test")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	require.NoError(t, os.MkdirAll(src, 0777))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(src, "file.txt"), []byte("hello world"), 0666))
+
+	fs.Stats.ResetCounters()
+	jobID := startJob(t, "sync/copy", Params{"srcFs": src, "dstFs": dst})
+	out := waitJob(t, jobID)
+	assert.Equal(t, true, out["success"], out["error"])
+	assert.Equal(t, "sync/copy", out["path"])
+	data, err := ioutil.ReadFile(filepath.Join(dst, "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	// Accounted in the job stats only
+	stats := out["stats"].(map[string]interface{})
+	assert.Equal(t, int64(11), stats["bytes"])
+	assert.Equal(t, int64(1), stats["transfers"])
+	assert.Equal(t, int64(0), fs.Stats.GetTransfers())
+
+	// and exported in the metrics labelled with the job
+	var buf bytes.Buffer
+	require.NoError(t, writeMetrics(&buf, allStats()))
+	assert.Contains(t, buf.String(), fmt.Sprintf("rclone_bytes_transferred_total{job=\"%d\"} 11\n", jobID))
+
+	jobID = startJob(t, "operations/purge", Params{"fs": dst})
+	out = waitJob(t, jobID)
+	assert.Equal(t, true, out["success"], out["error"])
+	_, err = os.Stat(dst)
+	assert.True(t, os.IsNotExist(err))
+
+	// Errors are recorded
+	jobID = startJob(t, "sync/sync", Params{"srcFs": src})
+	out = waitJob(t, jobID)
+	assert.Equal(t, false, out["success"])
+	assert.Contains(t, out["error"], "dstFs")
+}
+
+func TestJobStop(t *testing.T) {
+	started := make(chan struct{})
+	AddJob(Call{Path: "test/wait"}, func(in Params, stats *fs.StatsInfo, cancel <-chan struct{}) (Params, error) {
+		close(started)
+		<-cancel
+		return nil, fs.ErrorCancelled
+	})
+	jobID := startJob(t, "test/wait", nil)
+	<-started
+
+	out, err := rcJobList(nil)
+	require.NoError(t, err)
+	assert.Contains(t, out["jobids"], jobID)
+
+	out, err = rcJobStatus(Params{"jobid": jobID})
+	require.NoError(t, err)
+	assert.Equal(t, false, out["finished"])
+
+	_, err = rcJobStop(Params{"jobid": float64(jobID)})
+	require.NoError(t, err)
+	out = waitJob(t, jobID)
+	assert.Equal(t, true, out["cancelled"])
+	assert.Equal(t, false, out["success"])
+	assert.Equal(t, fs.ErrorCancelled.Error(), out["error"])
+
+	// Stopping again is harmless
+	_, err = rcJobStop(Params{"jobid": jobID})
+	require.NoError(t, err)
+
+	_, err = rcJobStatus(Params{"jobid": int64(-1)})
+	assert.Error(t, err)
+	_, err = rcJobStop(Params{})
+	assert.True(t, IsErrParamNotFound(err))
+}
+
+func TestJobPanic(t *testing.T) {
+	AddJob(Call{Path: "test/panic"}, func(in Params, stats *fs.StatsInfo, cancel <-chan struct{}) (Params, error) {
+		panic("potato")
+	})
+	out := waitJob(t, startJob(t, "test/panic", nil))
+	assert.Equal(t, false, out["success"])
+	assert.Equal(t, "panic received: potato", out["error"])
+}
+
+func TestJobsExpire(t *testing.T) {
+	jobs := newJobs()
+	jobs.setExpireDuration(time.Millisecond)
+	job := jobs.NewJob("test", func(in Params, stats *fs.StatsInfo, cancel <-chan struct{}) (Params, error) {
+		return Params{"a": "b"}, nil
+	}, nil)
+	assert.Equal(t, job, jobs.Get(job.ID))
+	for i := 0; i < 500; i++ {
+		if len(jobs.IDs()) == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Nil(t, jobs.Get(job.ID))
+	assert.Equal(t, Params{"a": "b"}, job.Output)
+}
+
+func TestParamsGetInt64(t *testing.T) {
+	for _, test := range []struct {
+		value interface{}
+		want  int64
+		err   bool
+	}{
+		{1, 1, false},
+		{int64(2), 2, false},
+		{3.0, 3, false},
+		{3.5, 0, true},
+		{"4", 4, false},
+		{"potato", 0, true},
+		{true, 0, true},
+	} {
+		got, err := Params{"key": test.value}.GetInt64("key")
+		assert.Equal(t, test.err, err != nil, test.value)
+		assert.Equal(t, test.want, got, test.value)
+	}
+}
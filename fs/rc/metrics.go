@@ -0,0 +1,128 @@
+// Export the stats in the Prometheus text exposition format
+
+package rc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ncw/rclone/fs"
+)
+
+// metricsContentType is the content type of the Prometheus text format
+const metricsContentType = "text/plain; version=0.0.4"
+
+// metric describes a single valued metric taken from the stats
+type metric struct {
+	name string // name of the metric
+	help string // help for the metric
+	kind string // counter or gauge
+	key  string // key in the RemoteStats
+}
+
+// statsMetrics are the metrics read from fs.StatsInfo.RemoteStats
+var statsMetrics = []metric{
+	{"rclone_bytes_transferred_total", "Total transferred bytes since the start of the process or job.", "counter", "bytes"},
+	{"rclone_transfers_total", "Total number of files transferred since the start of the process or job.", "counter", "transfers"},
+	{"rclone_checks_total", "Total number of files checked since the start of the process or job.", "counter", "checks"},
+	{"rclone_errors_total", "Total number of errors since the start of the process or job.", "counter", "errors"},
+}
+
+// writeHeader writes the HELP and TYPE lines for a metric
+func writeHeader(w io.Writer, name, help, kind string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// escapeLabel escapes a label value
+var escapeLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace
+
+// jobStats are the stats for a job along with the labels to write
+// its metrics with - the global stats have no labels
+type jobStats struct {
+	labels string
+	stats  *fs.StatsInfo
+}
+
+// writeMetrics writes the metrics for each of stats to out
+func writeMetrics(out io.Writer, stats []jobStats) error {
+	w := bufio.NewWriter(out)
+	values := make([]map[string]interface{}, len(stats))
+	for i := range stats {
+		values[i] = stats[i].stats.RemoteStats()
+	}
+	for _, m := range statsMetrics {
+		writeHeader(w, m.name, m.help, m.kind)
+		for i := range stats {
+			_, _ = fmt.Fprintf(w, "%s%s %v\n", m.name, stats[i].labels, values[i][m.key])
+		}
+	}
+
+	writeHeader(w, "rclone_transfers_in_progress", "Number of files being transferred.", "gauge")
+	for i := range stats {
+		_, _ = fmt.Fprintf(w, "rclone_transfers_in_progress%s %d\n", stats[i].labels, len(values[i]["transferring"].([]string)))
+	}
+	writeHeader(w, "rclone_checks_in_progress", "Number of files being checked.", "gauge")
+	for i := range stats {
+		_, _ = fmt.Fprintf(w, "rclone_checks_in_progress%s %d\n", stats[i].labels, len(values[i]["checking"].([]string)))
+	}
+	writeHeader(w, "rclone_speed_bytes_per_second", "Current speed of the transfers in progress.", "gauge")
+	for i := range stats {
+		_, _ = fmt.Fprintf(w, "rclone_speed_bytes_per_second%s %g\n", stats[i].labels, stats[i].stats.CurrentSpeed())
+	}
+
+	writeHeader(w, "rclone_http_transactions_total", "Total number of HTTP transactions made by remote, host and response code.", "counter")
+	transactions := fs.HTTPTransactions()
+	keys := make([]fs.HTTPTransaction, 0, len(transactions))
+	for k := range transactions {
+		keys = append(keys, k)
+	}
+	sort.Sort(byRemoteHostCode(keys))
+	for _, k := range keys {
+		_, _ = fmt.Fprintf(w, "rclone_http_transactions_total{remote=\"%s\",host=\"%s\",code=\"%s\"} %d\n", escapeLabel(k.Remote), escapeLabel(k.Host), escapeLabel(k.Code), transactions[k])
+	}
+	return w.Flush()
+}
+
+// byRemoteHostCode sorts HTTP transactions by remote, host then code
+type byRemoteHostCode []fs.HTTPTransaction
+
+func (x byRemoteHostCode) Len() int      { return len(x) }
+func (x byRemoteHostCode) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
+func (x byRemoteHostCode) Less(i, j int) bool {
+	if x[i].Remote != x[j].Remote {
+		return x[i].Remote < x[j].Remote
+	}
+	if x[i].Host != x[j].Host {
+		return x[i].Host < x[j].Host
+	}
+	return x[i].Code < x[j].Code
+}
+
+// allStats returns the global stats followed by the stats of each
+// background job labelled with its ID
+func allStats() []jobStats {
+	stats := []jobStats{{stats: fs.Stats}}
+	for _, ID := range running.IDs() {
+		if job := running.Get(ID); job != nil {
+			stats = append(stats, jobStats{
+				labels: fmt.Sprintf("{job=\"%d\"}", ID),
+				stats:  job.stats,
+			})
+		}
+	}
+	return stats
+}
+
+// serveMetrics serves the global stats and those of the background
+// jobs as Prometheus metrics
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metricsContentType)
+	err := writeMetrics(w, allStats())
+	if err != nil {
+		fs.Errorf(nil, "rc: failed to write metrics: %v", err)
+	}
+}
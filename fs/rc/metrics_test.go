@@ -0,0 +1,70 @@
+package rc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	stats := fs.NewStats()
+	stats.Bytes(1234)
+	stats.Error()
+	stats.Transferring("file")
+	jobStats1 := fs.NewStats()
+	jobStats1.Bytes(99)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeMetrics(&buf, []jobStats{{stats: stats}, {labels: `{job="1"}`, stats: jobStats1}}))
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE rclone_bytes_transferred_total counter\nrclone_bytes_transferred_total 1234\n",
+		"rclone_errors_total 1\n",
+		"rclone_transfers_total 0\n",
+		"rclone_checks_total 0\n",
+		"# TYPE rclone_transfers_in_progress gauge\nrclone_transfers_in_progress 1\n",
+		"rclone_checks_in_progress 0\n",
+		"rclone_speed_bytes_per_second 0\n",
+		"rclone_bytes_transferred_total{job=\"1\"} 99\n",
+		"rclone_errors_total{job=\"1\"} 0\n",
+		"rclone_transfers_in_progress{job=\"1\"} 0\n",
+		"# TYPE rclone_http_transactions_total counter\n",
+	} {
+		assert.Contains(t, out, want)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	assert.Equal(t, `a\\b\"c\nd`, escapeLabel("a\\b\"c\nd"))
+}
+
+func TestServeMetrics(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		opt := DefaultOpt
+		opt.Enabled = true
+		opt.EnableMetrics = enabled
+		opt.HTTPOptions.ListenAddr = "localhost:0"
+		s, err := Start(&opt)
+		require.NoError(t, err)
+
+		resp, err := http.Get(s.URL() + "metrics")
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		if enabled {
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, metricsContentType, resp.Header.Get("Content-Type"))
+			assert.True(t, strings.HasPrefix(string(body), "# HELP rclone_bytes_transferred_total"))
+		} else {
+			assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+		}
+		s.Close()
+	}
+}
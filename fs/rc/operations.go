@@ -0,0 +1,99 @@
+// Define the rc functions which run sync and operations jobs
+
+package rc
+
+import (
+	"github.com/ncw/rclone/fs"
+)
+
+func init() {
+	for _, name := range []string{"sync", "copy", "move"} {
+		name := name
+		AddJob(Call{
+			Path:  "sync/" + name,
+			Title: name + " a directory from source remote to destination remote",
+			Help: `
+This takes the following parameters
+
+- srcFs - a remote name string eg "drive:src" for the source
+- dstFs - a remote name string eg "drive:dst" for the destination
+
+This returns
+- jobid - the ID of the job
+
+See the [` + name + ` command](/commands/rclone_` + name + `/) for more information on the above.`,
+		}, func(in Params, stats *fs.StatsInfo, cancel <-chan struct{}) (out Params, err error) {
+			return rcSyncCopyMove(in, name, stats, cancel)
+		})
+	}
+	AddJob(Call{
+		Path:  "operations/purge",
+		Title: "Remove a directory or container and all of its contents",
+		Help: `
+This takes the following parameters
+
+- fs - a remote name string eg "drive:path/to/dir"
+
+This returns
+- jobid - the ID of the job
+
+The purge can only be stopped before it has started deleting.
+
+See the [purge command](/commands/rclone_purge/) for more information on the above.`,
+	}, rcPurge)
+}
+
+// getFs makes an Fs from the remote named by the key parameter
+func getFs(in Params, key string) (fs.Fs, error) {
+	remote, err := in.GetString(key)
+	if err != nil {
+		return nil, err
+	}
+	return fs.NewFs(remote)
+}
+
+// Sync, copy or move from srcFs to dstFs
+func rcSyncCopyMove(in Params, name string, stats *fs.StatsInfo, cancel <-chan struct{}) (out Params, err error) {
+	srcFs, err := getFs(in, "srcFs")
+	if err != nil {
+		return nil, err
+	}
+	dstFs, err := getFs(in, "dstFs")
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "sync":
+		err = fs.SyncWithStats(dstFs, srcFs, stats, cancel)
+	case "copy":
+		err = fs.CopyDirWithStats(dstFs, srcFs, stats, cancel)
+	case "move":
+		err = fs.MoveDirWithStats(dstFs, srcFs, stats, cancel)
+	}
+	if err != nil && isCancelled(cancel) {
+		err = fs.ErrorCancelled
+	}
+	return nil, err
+}
+
+// Purge a remote
+func rcPurge(in Params, stats *fs.StatsInfo, cancel <-chan struct{}) (out Params, err error) {
+	f, err := getFs(in, "fs")
+	if err != nil {
+		return nil, err
+	}
+	if isCancelled(cancel) {
+		return nil, fs.ErrorCancelled
+	}
+	return nil, fs.PurgeWithStats(f, stats)
+}
+
+// isCancelled returns whether cancel has been closed
+func isCancelled(cancel <-chan struct{}) bool {
+	select {
+	case <-cancel:
+		return true
+	default:
+	}
+	return false
+}
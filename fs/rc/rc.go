@@ -0,0 +1,159 @@
+// Package rc implements a remote control server and registry for rclone
+//
+// To register your internal calls, call rc.Add with a Call.  Your
+// function should take and return a Params.  It can also return an
+// error which will be returned to the caller as a 500 response.
+package rc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Params is the input and output type for the Func
+type Params map[string]interface{}
+
+// Func defines a type for a remote control function
+type Func func(in Params) (out Params, err error)
+
+// Call defines info about a remote control function and is used in
+// the Add function to create new entry points.
+type Call struct {
+	Path  string // path to activate this RC
+	Fn    Func   `json:"-"` // function to call
+	Title string // help for the function
+	Help  string // multi-line markdown formatted help
+}
+
+// registry holds the internal registry of calls
+type registry struct {
+	mu   sync.RWMutex
+	call map[string]*Call
+}
+
+// calls is the global registry of calls
+var calls = &registry{
+	call: make(map[string]*Call),
+}
+
+// Add a call to the registry.  If a call with the same path already
+// exists it is replaced.
+func Add(call Call) {
+	calls.mu.Lock()
+	defer calls.mu.Unlock()
+	call.Path = strings.Trim(call.Path, "/")
+	call.Help = strings.TrimSpace(call.Help)
+	calls.call[call.Path] = &call
+}
+
+// Find returns the call with path or nil if not found
+func Find(path string) *Call {
+	calls.mu.RLock()
+	defer calls.mu.RUnlock()
+	return calls.call[strings.Trim(path, "/")]
+}
+
+// List returns all the calls sorted by path
+func List() (out []*Call) {
+	calls.mu.RLock()
+	defer calls.mu.RUnlock()
+	paths := make([]string, 0, len(calls.call))
+	for path := range calls.call {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		out = append(out, calls.call[path])
+	}
+	return out
+}
+
+// ErrParamNotFound is returned by the Get* methods if the parameter
+// is missing
+type ErrParamNotFound string
+
+// Error turns this error into a string
+func (e ErrParamNotFound) Error() string {
+	return fmt.Sprintf("Didn't find key %q in input", string(e))
+}
+
+// IsErrParamNotFound returns whether err is ErrParamNotFound
+func IsErrParamNotFound(err error) bool {
+	_, isNotFound := errors.Cause(err).(ErrParamNotFound)
+	return isNotFound
+}
+
+// Get gets a parameter from the input
+//
+// If the parameter isn't found then error will be of type
+// ErrParamNotFound and the returned value will be nil.
+func (p Params) Get(key string) (interface{}, error) {
+	value, ok := p[key]
+	if !ok {
+		return nil, ErrParamNotFound(key)
+	}
+	return value, nil
+}
+
+// GetString gets a string parameter from the input
+//
+// If the parameter isn't found then error will be of type
+// ErrParamNotFound and the returned value will be "".
+func (p Params) GetString(key string) (string, error) {
+	value, err := p.Get(key)
+	if err != nil {
+		return "", err
+	}
+	str, ok := value.(string)
+	if !ok {
+		return "", errors.Errorf("expecting string value for key %q (was %T)", key, value)
+	}
+	return str, nil
+}
+
+// GetInt64 gets an int64 parameter from the input
+//
+// The value may be a number or a string containing a number as it
+// will be if it was passed as a form or URL parameter.
+//
+// If the parameter isn't found then error will be of type
+// ErrParamNotFound and the returned value will be 0.
+func (p Params) GetInt64(key string) (int64, error) {
+	value, err := p.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	switch x := value.(type) {
+	case int:
+		return int64(x), nil
+	case int64:
+		return x, nil
+	case float64:
+		if x != math.Trunc(x) || x > math.MaxInt64 || x < math.MinInt64 {
+			return 0, errors.Errorf("key %q (%v) overflows int64", key, value)
+		}
+		return int64(x), nil
+	case string:
+		i, err := strconv.ParseInt(x, 10, 64)
+		if err != nil {
+			return 0, errors.Wrapf(err, "couldn't parse key %q (%v) as int64", key, value)
+		}
+		return i, nil
+	}
+	return 0, errors.Errorf("expecting int64 value for key %q (was %T)", key, value)
+}
+
+// WriteJSON writes JSON in out to w
+func WriteJSON(w io.Writer, out Params) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(out)
+}
@@ -0,0 +1,185 @@
+package rc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddFind(t *testing.T) {
+	Add(Call{
+		Path:  "/test/add/",
+		Fn:    rcNoop,
+		Title: "Test",
+		Help:  "\nHelp\n",
+	})
+	call := Find("test/add")
+	require.NotNil(t, call)
+	assert.Equal(t, "test/add", call.Path)
+	assert.Equal(t, "Help", call.Help)
+	assert.Nil(t, Find("test/potato"))
+
+	found := false
+	prev := ""
+	for _, call := range List() {
+		assert.True(t, prev < call.Path, "List not sorted")
+		prev = call.Path
+		if call.Path == "test/add" {
+			found = true
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestParamsGet(t *testing.T) {
+	in := Params{
+		"string": "one",
+		"int":    1,
+	}
+	value, err := in.GetString("string")
+	require.NoError(t, err)
+	assert.Equal(t, "one", value)
+
+	_, err = in.GetString("int")
+	require.Error(t, err)
+	assert.False(t, IsErrParamNotFound(err))
+
+	_, err = in.GetString("potato")
+	require.Error(t, err)
+	assert.True(t, IsErrParamNotFound(err))
+}
+
+// startServer starts a remote control server on a free port
+// requiring authentication as user if set
+func startServer(t *testing.T, user string) (*Server, func()) {
+	opt := DefaultOpt
+	opt.Enabled = true
+	opt.HTTPOptions.ListenAddr = "localhost:0"
+	opt.HTTPOptions.BasicUser = user
+	opt.HTTPOptions.BasicPass = "pass"
+	s, err := Start(&opt)
+	require.NoError(t, err)
+	require.NotNil(t, s)
+	return s, s.Close
+}
+
+// post makes a POST request as user if set returning the status and
+// decoded body
+func post(t *testing.T, user, url, contentType, body string) (int, Params) {
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	require.NoError(t, err)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if user != "" {
+		req.SetBasicAuth(user, "pass")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, resp.Body.Close())
+	}()
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	out := make(Params)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+	return resp.StatusCode, out
+}
+
+func TestStartDisabled(t *testing.T) {
+	s, err := Start(&DefaultOpt)
+	require.NoError(t, err)
+	assert.Nil(t, s)
+}
+
+func TestServer(t *testing.T) {
+	s, cleanup := startServer(t, "")
+	defer cleanup()
+	u := s.URL()
+
+	// JSON and URL parameters
+	status, out := post(t, "", u+"rc/noop?a=b", "application/json", `{"c":1}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, Params{"a": "b", "c": 1.0}, out)
+
+	// Listing
+	status, out = post(t, "", u+"rc/list", "application/json", "{}")
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEmpty(t, out["commands"])
+
+	// PID
+	status, out = post(t, "", u+"core/pid", "application/json", "{}")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(os.Getpid()), out["pid"])
+
+	// Stats
+	status, out = post(t, "", u+"core/stats", "application/json", "{}")
+	assert.Equal(t, http.StatusOK, status)
+	for _, key := range []string{"bytes", "errors", "checks", "transfers", "speed", "elapsedTime", "checking", "transferring"} {
+		assert.Contains(t, out, key)
+	}
+
+	// Bandwidth limit
+	status, out = post(t, "", u+"core/bwlimit?rate=1M", "application/json", "{}")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, Params{"rate": "1M", "bytesPerSecond": float64(1 << 20)}, out)
+	status, out = post(t, "", u+"core/bwlimit?rate=off", "application/json", "{}")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, Params{"rate": "off", "bytesPerSecond": 0.0}, out)
+}
+
+func TestServerAuth(t *testing.T) {
+	s, cleanup := startServer(t, "user")
+	defer cleanup()
+	u := s.URL()
+
+	// Form parameters are accepted from an authenticated user
+	status, out := post(t, "user", u+"rc/noop?a=b", "application/x-www-form-urlencoded", url.Values{"c": {"d"}}.Encode())
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, Params{"a": "b", "c": "d"}, out)
+	status, out = post(t, "user", u+"rc/noop", "application/json", `{"a":"b"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, Params{"a": "b"}, out)
+
+	resp, err := http.Post(u+"rc/noop", "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestServerErrors(t *testing.T) {
+	s, cleanup := startServer(t, "")
+	defer cleanup()
+	u := s.URL()
+
+	for _, test := range []struct {
+		path        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"potato", "application/json", "{}", http.StatusNotFound},
+		{"rc/noop", "application/json", "{", http.StatusBadRequest},
+		{"core/bwlimit", "application/json", "{}", http.StatusInternalServerError},
+		{"core/bwlimit?rate=1Q", "application/json", "{}", http.StatusInternalServerError},
+		// forms could be posted by any web page so need authentication
+		{"core/bwlimit?rate=1M", "", "", http.StatusUnsupportedMediaType},
+		{"core/bwlimit", "application/x-www-form-urlencoded", "rate=1M", http.StatusUnsupportedMediaType},
+		{"core/bwlimit", "text/plain", `{"rate":"1M"}`, http.StatusUnsupportedMediaType},
+	} {
+		status, out := post(t, "", u+test.path, test.contentType, test.body)
+		assert.Equal(t, test.status, status, test.path)
+		assert.Equal(t, float64(test.status), out["status"], test.path)
+		assert.NotEmpty(t, out["error"], test.path)
+	}
+
+	resp, err := http.Get(u + "rc/noop")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
@@ -0,0 +1,190 @@
+package rc
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/cmd/serve/httplib"
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+// Options contains options for the remote control server
+type Options struct {
+	HTTPOptions       httplib.Options
+	Enabled           bool          // set to enable the server
+	JobExpireDuration time.Duration // how long to keep the results of finished jobs
+	EnableMetrics     bool          // set to serve Prometheus metrics on /metrics
+}
+
+// DefaultOpt is the default values used for Options
+var DefaultOpt = Options{
+	HTTPOptions:       httplib.DefaultOpt,
+	JobExpireDuration: 60 * time.Second,
+}
+
+// Opt is the options for the remote control server set from the
+// command line flags
+var Opt Options
+
+func init() {
+	DefaultOpt.HTTPOptions.ListenAddr = "localhost:5572"
+	Opt = DefaultOpt
+}
+
+// AddFlags adds the remote control flags to the flagSet storing
+// them in opt
+func AddFlags(flags *pflag.FlagSet, opt *Options) {
+	flags.BoolVarP(&opt.Enabled, "rc", "", opt.Enabled, "Enable the remote control server.")
+	flags.BoolVarP(&opt.EnableMetrics, "rc-enable-metrics", "", opt.EnableMetrics, "Enable prometheus metrics on /metrics")
+	flags.DurationVarP(&opt.JobExpireDuration, "rc-job-expire-duration", "", opt.JobExpireDuration, "Expire finished async jobs older than this value")
+	httplib.AddFlagsPrefix(flags, "rc-", &opt.HTTPOptions)
+}
+
+// Server contains info about the running remote control server
+type Server struct {
+	opt Options
+	srv *httplib.Server
+}
+
+// Start the remote control server if configured
+func Start(opt *Options) (*Server, error) {
+	if !opt.Enabled {
+		return nil, nil
+	}
+	running.setExpireDuration(opt.JobExpireDuration)
+	s := newServer(opt)
+	err := s.Serve()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// newServer makes a remote control server from the options
+func newServer(opt *Options) *Server {
+	s := &Server{
+		opt: *opt,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handler)
+	s.srv = httplib.NewServer(mux, &opt.HTTPOptions)
+	return s
+}
+
+// Serve starts the server - it does not block
+func (s *Server) Serve() error {
+	err := s.srv.Serve()
+	if err != nil {
+		return err
+	}
+	fs.Logf(nil, "Serving remote control on %s", s.srv.URL())
+	return nil
+}
+
+// Wait blocks while the server is running
+func (s *Server) Wait() {
+	s.srv.Wait()
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// URL returns the serving address of this server
+func (s *Server) URL() string {
+	return s.srv.URL()
+}
+
+// writeError writes a formatted error to the output
+func writeError(path string, in Params, w http.ResponseWriter, err error, status int) {
+	fs.Errorf(nil, "rc: %q: error: %v", path, err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err = WriteJSON(w, Params{
+		"error":  err.Error(),
+		"input":  in,
+		"path":   path,
+		"status": status,
+	})
+	if err != nil {
+		fs.Errorf(nil, "rc: failed to write JSON output: %v", err)
+	}
+}
+
+// handler reads incoming requests and dispatches them
+func (s *Server) handler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	in := make(Params)
+
+	if path == "metrics" && s.opt.EnableMetrics && (r.Method == "GET" || r.Method == "HEAD") {
+		serveMetrics(w, r)
+		return
+	}
+
+	if r.Method != "POST" {
+		writeError(path, in, w, errors.Errorf("method %q not allowed - use POST", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse the POST and URL parameters into r.Form
+	//
+	// A web page can make the browser POST a form to the server
+	// without the user knowing, but not a JSON body, so only accept
+	// form and URL parameters if the server needs authentication.
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != "application/json" {
+		if s.opt.HTTPOptions.BasicUser == "" {
+			writeError(path, in, w, errors.New("unauthenticated requests must be sent as application/json"), http.StatusUnsupportedMediaType)
+			return
+		}
+		err := r.ParseForm()
+		if err != nil {
+			writeError(path, in, w, errors.Wrap(err, "failed to parse form/URL parameters"), http.StatusBadRequest)
+			return
+		}
+	} else {
+		r.Form = r.URL.Query()
+	}
+	for k, vs := range r.Form {
+		if len(vs) > 0 {
+			in[k] = vs[len(vs)-1]
+		}
+	}
+
+	// Parse a JSON blob if supplied
+	if contentType == "application/json" {
+		err := json.NewDecoder(r.Body).Decode(&in)
+		if err != nil {
+			writeError(path, in, w, errors.Wrap(err, "failed to read input JSON"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	fs.Debugf(nil, "rc: %q: with parameters %+v", path, in)
+	call := Find(path)
+	if call == nil {
+		writeError(path, in, w, errors.Errorf("couldn't find method %q", path), http.StatusNotFound)
+		return
+	}
+	out, err := call.Fn(in)
+	if err != nil {
+		writeError(path, in, w, errors.Wrap(err, "remote control command failed"), http.StatusInternalServerError)
+		return
+	}
+	if out == nil {
+		out = make(Params)
+	}
+	fs.Debugf(nil, "rc: %q: reply %+v: %v", path, out, err)
+	w.Header().Set("Content-Type", "application/json")
+	err = WriteJSON(w, out)
+	if err != nil {
+		// can't return the error at this point
+		fs.Errorf(nil, "rc: failed to write JSON output: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package fs
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -98,3 +99,14 @@ func TestRepeatableReader(t *testing.T) {
 	assert.Equal(t, b[2:7], dst)
 
 }
+
+func TestLimitedReadCloser(t *testing.T) {
+	rc := ioutil.NopCloser(bytes.NewBufferString("0123456789"))
+	assert.Equal(t, rc, NewLimitedReadCloser(rc, -1))
+
+	lrc := NewLimitedReadCloser(rc, 4)
+	got, err := ioutil.ReadAll(lrc)
+	require.NoError(t, err)
+	assert.Equal(t, "0123", string(got))
+	require.NoError(t, lrc.Close())
+}
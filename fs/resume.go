@@ -0,0 +1,274 @@
+// Save the state of chunked uploads so they can be resumed
+
+package fs
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// The state of an upload is kept in a file in the upload state
+// directory named after the destination of the upload.  The first
+// line is a JSON header identifying the source and the session the
+// backend gave the upload, followed by a JSON record on each line for
+// each chunk the backend has acknowledged.
+//
+// Backends which send the chunks in order record the offset they
+// have reached.  Those which send them in parallel record each part
+// along with whatever they need to finish the upload, eg its SHA1.
+const uploadStateVersion = 1
+
+// uploadStateHeader is the first line of the upload state
+type uploadStateHeader struct {
+	Version     int    `json:"version"`
+	Fingerprint string `json:"fingerprint"` // identifies the source and the chunk size
+	Session     string `json:"session"`
+}
+
+// uploadStateRecord records an acknowledged chunk
+type uploadStateRecord struct {
+	Offset *int64 `json:"offset,omitempty"`
+	Part   *int   `json:"part,omitempty"`
+	Info   string `json:"info,omitempty"`
+}
+
+// UploadState is the state of an interrupted upload
+type UploadState struct {
+	Session string   // the session URL or upload ID
+	Offset  int64    // bytes acknowledged when the chunks are sent in order
+	Parts   []string // info for each part acknowledged, "" if it wasn't
+}
+
+// ResumableUpload saves the state of a chunked upload so that if it
+// is interrupted the next upload of the same source can carry on from
+// the last chunk acknowledged.
+//
+// A nil *ResumableUpload is valid and saves nothing.
+type ResumableUpload struct {
+	remote      string // the destination for logging
+	name        string // file the state is saved in
+	fingerprint string // identifies the source and chunk size
+	mu          sync.Mutex
+	started     bool   // set once there is a state file to add to
+	err         error  // first error saving the state
+	stale       string // session of the upload of a different source found by Resume
+}
+
+// NewResumableUpload returns a ResumableUpload for the upload of src
+// to remote on f in chunks of chunkSize.
+//
+// It returns nil if --upload-state-dir isn't set or the size of src
+// isn't known.
+func NewResumableUpload(f Info, remote string, src ObjectInfo, chunkSize int64) *ResumableUpload {
+	if Config.UploadStateDir == "" || src.Size() < 0 {
+		return nil
+	}
+	srcFs := ""
+	if src.Fs() != nil {
+		srcFs = fmt.Sprintf("%s:%s", src.Fs().Name(), src.Fs().Root())
+	}
+	dst := md5.Sum([]byte(fmt.Sprintf("%s:%s\n%s", f.Name(), f.Root(), remote)))
+	fingerprint := md5.Sum([]byte(fmt.Sprintf("%s\n%s\n%d,%d,%d", srcFs, src.Remote(),
+		src.Size(), src.ModTime().UnixNano(), chunkSize)))
+	return &ResumableUpload{
+		remote:      remote,
+		name:        filepath.Join(Config.UploadStateDir, hex.EncodeToString(dst[:])+".json"),
+		fingerprint: hex.EncodeToString(fingerprint[:]),
+	}
+}
+
+// Resume returns the state saved by an interrupted upload of the
+// same source with the same chunk size, or nil if there isn't one.
+//
+// Any chunks acknowledged from now on are added to the state.
+func (u *ResumableUpload) Resume() *UploadState {
+	if u == nil {
+		return nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	state, end, err := u.load()
+	if err == nil && state != nil {
+		// lose any partly written record
+		err = os.Truncate(u.name, end)
+	}
+	if err != nil {
+		Errorf(u.remote, "Failed to read upload state - starting again: %v", err)
+		return nil
+	}
+	if state == nil {
+		return nil
+	}
+	u.started = true
+	Debugf(u.remote, "Resuming upload from offset %d with %d parts", state.Offset, len(state.Parts))
+	return state
+}
+
+// load reads the upload state, returning the offset after the last
+// complete record.  The state is nil if there isn't one for this
+// upload.
+func (u *ResumableUpload) load() (state *UploadState, end int64, err error) {
+	in, err := os.Open(u.name)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	defer CheckClose(in, &err)
+	buf := bufio.NewReader(in)
+	line, err := buf.ReadBytes('\n')
+	if err == io.EOF {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	var header uploadStateHeader
+	if json.Unmarshal(line, &header) != nil || header.Version != uploadStateVersion {
+		Debugf(u.remote, "Upload state is unreadable - starting again")
+		return nil, 0, nil
+	}
+	if header.Fingerprint != u.fingerprint {
+		Debugf(u.remote, "Upload state is for a different source - starting again")
+		u.stale = header.Session
+		return nil, 0, nil
+	}
+	end = int64(len(line))
+	state = &UploadState{Session: header.Session}
+	for {
+		line, err = buf.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, 0, err
+		}
+		var record uploadStateRecord
+		if json.Unmarshal(line, &record) != nil {
+			break
+		}
+		if record.Offset != nil {
+			state.Offset = *record.Offset
+		}
+		if part := record.Part; part != nil && *part >= 0 {
+			for len(state.Parts) <= *part {
+				state.Parts = append(state.Parts, "")
+			}
+			state.Parts[*part] = record.Info
+		}
+		end += int64(len(line))
+	}
+	return state, end, nil
+}
+
+// Stale returns the session of an interrupted upload of a different
+// source to the same destination found by Resume, or "" if there
+// wasn't one.  Its state is replaced when this upload starts, so
+// backends which can cancel sessions should cancel it first so it
+// isn't left behind on the remote.
+func (u *ResumableUpload) Stale() string {
+	if u == nil {
+		return ""
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.stale
+}
+
+// Start records the session of a new upload, replacing any state
+// saved before.
+func (u *ResumableUpload) Start(session string) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	data, err := json.Marshal(uploadStateHeader{
+		Version:     uploadStateVersion,
+		Fingerprint: u.fingerprint,
+		Session:     session,
+	})
+	if err == nil {
+		err = WriteFileAtomic(u.name, append(data, '\n'))
+	}
+	u.err = nil
+	u.started = err == nil
+	u.check(err)
+}
+
+// check records err if it is the first error saving the state - call
+// with the lock held
+func (u *ResumableUpload) check(err error) {
+	if err != nil && u.err == nil {
+		u.err = errors.Wrap(err, "failed to save upload state")
+		Errorf(u.remote, "%v", u.err)
+	}
+}
+
+// add a record to the state - call with the lock held
+func (u *ResumableUpload) add(record uploadStateRecord) {
+	if !u.started || u.err != nil {
+		return
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		u.check(err)
+		return
+	}
+	out, err := os.OpenFile(u.name, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		u.check(err)
+		return
+	}
+	_, err = out.Write(append(data, '\n'))
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	u.check(err)
+}
+
+// SetOffset records that the chunks before offset have been
+// acknowledged.
+func (u *ResumableUpload) SetOffset(offset int64) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.add(uploadStateRecord{Offset: &offset})
+}
+
+// SetPart records that part, numbered from 0, has been acknowledged
+// along with the info needed to finish the upload.  It may be called
+// concurrently.
+func (u *ResumableUpload) SetPart(part int, info string) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.add(uploadStateRecord{Part: &part, Info: info})
+}
+
+// Finish removes the state as the upload is complete or can't be
+// resumed.
+func (u *ResumableUpload) Finish() {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.started = false
+	err := os.Remove(u.name)
+	if err != nil && !os.IsNotExist(err) {
+		Errorf(u.remote, "Failed to remove upload state: %v", err)
+	}
+}
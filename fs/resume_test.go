@@ -0,0 +1,122 @@
+// Test resumable uploads
+
+package fs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// uploadStateDir sets --upload-state-dir to a temporary directory and
+// returns a function to tidy it up
+func uploadStateDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "rclone-upload-state-test")
+	require.NoError(t, err)
+	fs.Config.UploadStateDir = dir
+	return dir, func() {
+		fs.Config.UploadStateDir = ""
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// Without --upload-state-dir nothing is saved
+func TestResumableUploadDisabled(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	src := fs.NewStaticObjectInfo("file", t1, 100, true, nil, r.flocal)
+	u := fs.NewResumableUpload(r.fremote, "file", src, 10)
+	assert.Nil(t, u)
+	u.Start("session")
+	u.SetOffset(10)
+	u.SetPart(0, "info")
+	assert.Nil(t, u.Resume())
+	u.Finish()
+}
+
+// An upload of the same source carries on where the last one left off
+func TestResumableUpload(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	dir, cleanup := uploadStateDir(t)
+	defer cleanup()
+	src := fs.NewStaticObjectInfo("file", t1, 100, true, nil, r.flocal)
+
+	u := fs.NewResumableUpload(r.fremote, "file", src, 10)
+	require.NotNil(t, u)
+	assert.Nil(t, u.Resume())
+	u.SetOffset(10) // not started so ignored
+	u.Start("session")
+	u.SetOffset(20)
+	u.SetPart(2, "two")
+	u.SetPart(0, "zero")
+
+	u = fs.NewResumableUpload(r.fremote, "file", src, 10)
+	state := u.Resume()
+	require.NotNil(t, state)
+	assert.Equal(t, &fs.UploadState{
+		Session: "session",
+		Offset:  20,
+		Parts:   []string{"zero", "", "two"},
+	}, state)
+
+	// a partly written record is ignored and the state added to
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(files))
+	name := filepath.Join(dir, files[0].Name())
+	out, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = out.WriteString(`{"offset":9`)
+	require.NoError(t, err)
+	require.NoError(t, out.Close())
+	state = u.Resume()
+	require.NotNil(t, state)
+	assert.Equal(t, int64(20), state.Offset)
+	u.SetOffset(30)
+	state = u.Resume()
+	require.NotNil(t, state)
+	assert.Equal(t, int64(30), state.Offset)
+
+	assert.Equal(t, "", u.Stale())
+
+	// a different source or chunk size doesn't resume, but the
+	// session it would replace is returned to be cancelled
+	changed := fs.NewStaticObjectInfo("file", t2, 100, true, nil, r.flocal)
+	other := fs.NewResumableUpload(r.fremote, "file", changed, 10)
+	assert.Nil(t, other.Resume())
+	assert.Equal(t, "session", other.Stale())
+	other = fs.NewResumableUpload(r.fremote, "file", src, 20)
+	assert.Nil(t, other.Resume())
+	assert.Equal(t, "session", other.Stale())
+	other = fs.NewResumableUpload(r.fremote, "other", src, 10)
+	assert.Nil(t, other.Resume())
+	assert.Equal(t, "", other.Stale())
+
+	// starting again replaces the state
+	u.Start("new session")
+	state = fs.NewResumableUpload(r.fremote, "file", src, 10).Resume()
+	require.NotNil(t, state)
+	assert.Equal(t, &fs.UploadState{Session: "new session"}, state)
+
+	u.Finish()
+	assert.Nil(t, fs.NewResumableUpload(r.fremote, "file", src, 10).Resume())
+	files, err = ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(files))
+}
+
+// A source of unknown size can't be resumed
+func TestResumableUploadUnknownSize(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	_, cleanup := uploadStateDir(t)
+	defer cleanup()
+	src := fs.NewStaticObjectInfo("file", t1, -1, true, nil, r.flocal)
+	assert.Nil(t, fs.NewResumableUpload(r.fremote, "file", src, 10))
+}
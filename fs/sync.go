@@ -20,6 +20,8 @@ type syncCopyMove struct {
 	deleteMode DeleteMode // how we are doing deletions
 	DoMove     bool
 	dir        string
+	stats      *StatsInfo      // where to account the transfers
+	cancel     <-chan struct{} // abort the sync if this is closed
 	// internal state
 	noTraverse     bool                // if set don't trafevers the dst
 	deletersWg     sync.WaitGroup      // for delete before go routine
@@ -54,15 +56,18 @@ type syncCopyMove struct {
 	suffix         string              // suffix to add to files placed in backupDir
 	srcListDir     listDirFn           // function to call to list a directory in the src
 	dstListDir     listDirFn           // function to call to list a directory in the dst
+	journal        *journal            // journal of the work done if --sync-journal is set
 }
 
-func newSyncCopyMove(fdst, fsrc Fs, deleteMode DeleteMode, DoMove bool) (*syncCopyMove, error) {
+func newSyncCopyMove(fdst, fsrc Fs, deleteMode DeleteMode, DoMove bool, stats *StatsInfo, cancel <-chan struct{}) (*syncCopyMove, error) {
 	s := &syncCopyMove{
 		fdst:           fdst,
 		fsrc:           fsrc,
 		deleteMode:     deleteMode,
 		DoMove:         DoMove,
 		dir:            "",
+		stats:          stats,
+		cancel:         cancel,
 		srcFilesChan:   make(chan Object, Config.Checkers+Config.Transfers),
 		srcFilesResult: make(chan error, 1),
 		dstFilesResult: make(chan error, 1),
@@ -197,6 +202,11 @@ outer:
 // Returns a flag which indicates whether the file needs to be
 // transferred or not.
 func NeedTransfer(dst, src Object) bool {
+	return needTransfer(Stats, dst, src)
+}
+
+// needTransfer is NeedTransfer counting any errors in stats
+func needTransfer(stats *StatsInfo, dst, src Object) bool {
 	if dst == nil {
 		Debugf(src, "Couldn't find file - need to transfer")
 		return true
@@ -239,7 +249,7 @@ func NeedTransfer(dst, src Object) bool {
 		}
 	} else {
 		// Check to see if changed or not
-		if Equal(src, dst) {
+		if equal(stats, src, dst, Config.SizeOnly, Config.CheckSum) {
 			Debugf(src, "Unchanged skipping")
 			return false
 		}
@@ -298,15 +308,15 @@ func (s *syncCopyMove) pairChecker(in ObjectPairChan, out ObjectPairChan, wg *sy
 				return
 			}
 			src := pair.src
-			Stats.Checking(src.Remote())
+			s.stats.Checking(src.Remote())
 			// Check to see if can store this
 			if src.Storable() {
-				if NeedTransfer(pair.dst, pair.src) {
+				if needTransfer(s.stats, pair.dst, pair.src) {
 					// If destination already exists, then we must move it into --backup-dir if required
 					if pair.dst != nil && s.backupDir != nil {
 						remoteWithSuffix := pair.dst.Remote() + s.suffix
 						overwritten, _ := s.backupDir.NewObject(remoteWithSuffix)
-						err := Move(s.backupDir, overwritten, remoteWithSuffix, pair.dst)
+						err := moveObject(s.stats, s.backupDir, overwritten, remoteWithSuffix, pair.dst)
 						if err != nil {
 							s.processError(err)
 						} else {
@@ -321,11 +331,19 @@ func (s *syncCopyMove) pairChecker(in ObjectPairChan, out ObjectPairChan, wg *sy
 					// If moving need to delete the files we don't need to copy
 					if s.DoMove {
 						// Delete src if no error on copy
-						s.processError(DeleteFile(src))
+						err := deleteFileWithBackupDir(s.stats, src, nil)
+						s.processError(err)
+						if err == nil {
+							s.journal.done(src)
+						}
+					} else {
+						s.journal.done(src)
 					}
 				}
+			} else {
+				s.journal.done(src)
 			}
-			Stats.DoneChecking(src.Remote())
+			s.stats.DoneChecking(src.Remote())
 		case <-s.abort:
 			return
 		}
@@ -370,14 +388,17 @@ func (s *syncCopyMove) pairCopyOrMove(in ObjectPairChan, fdst Fs, wg *sync.WaitG
 				return
 			}
 			src := pair.src
-			Stats.Transferring(src.Remote())
+			s.stats.Transferring(src.Remote())
 			if s.DoMove {
-				err = Move(fdst, pair.dst, src.Remote(), src)
+				err = moveObject(s.stats, fdst, pair.dst, src.Remote(), src)
 			} else {
-				err = Copy(fdst, pair.dst, src.Remote(), src)
+				err = copyObject(s.stats, fdst, pair.dst, src.Remote(), src)
 			}
 			s.processError(err)
-			Stats.DoneTransferring(src.Remote(), err == nil)
+			if err == nil {
+				s.journal.done(src)
+			}
+			s.stats.DoneTransferring(src.Remote(), err == nil)
 		case <-s.abort:
 			return
 		}
@@ -466,7 +487,7 @@ func (s *syncCopyMove) startDeleters() {
 	s.deletersWg.Add(1)
 	go func() {
 		defer s.deletersWg.Done()
-		err := deleteFilesWithBackupDir(s.deleteFilesCh, s.backupDir)
+		err := deleteFilesWithBackupDir(s.stats, s.deleteFilesCh, s.backupDir)
 		s.processError(err)
 	}()
 }
@@ -486,7 +507,7 @@ func (s *syncCopyMove) stopDeleters() {
 // checkSrcMap is clear then it assumes that the any source files that
 // have been found have been removed from dstFiles already.
 func (s *syncCopyMove) deleteFiles(checkSrcMap bool) error {
-	if Stats.Errored() {
+	if s.stats.Errored() {
 		Errorf(s.fdst, "%v", ErrorNotDeleting)
 		return ErrorNotDeleting
 	}
@@ -508,16 +529,16 @@ func (s *syncCopyMove) deleteFiles(checkSrcMap bool) error {
 		}
 		close(toDelete)
 	}()
-	return deleteFilesWithBackupDir(toDelete, s.backupDir)
+	return deleteFilesWithBackupDir(s.stats, toDelete, s.backupDir)
 }
 
 // This deletes the empty directories in the slice passed in.  It
 // ignores any errors deleting directories
-func deleteEmptyDirectories(f Fs, entries DirEntries) error {
+func deleteEmptyDirectories(stats *StatsInfo, f Fs, entries DirEntries) error {
 	if len(entries) == 0 {
 		return nil
 	}
-	if Stats.Errored() {
+	if stats.Errored() {
 		Errorf(f, "%v", ErrorNotDeletingDirs)
 		return ErrorNotDeletingDirs
 	}
@@ -616,12 +637,12 @@ func (s *syncCopyMove) makeRenameMap() {
 			for obj := range in {
 				// only create hash for dst Object if its size could match
 				if _, found := possibleSizes[obj.Size()]; found {
-					Stats.Checking(obj.Remote())
+					s.stats.Checking(obj.Remote())
 					hash := s.renameHash(obj)
 					if hash != "" {
 						s.pushRenameMap(hash, obj)
 					}
-					Stats.DoneChecking(obj.Remote())
+					s.stats.DoneChecking(obj.Remote())
 				}
 			}
 		}()
@@ -633,8 +654,8 @@ func (s *syncCopyMove) makeRenameMap() {
 // tryRename renames a src object when doing track renames if
 // possible, it returns true if the object was renamed.
 func (s *syncCopyMove) tryRename(src Object) bool {
-	Stats.Checking(src.Remote())
-	defer Stats.DoneChecking(src.Remote())
+	s.stats.Checking(src.Remote())
+	defer s.stats.DoneChecking(src.Remote())
 
 	// Calculate the hash of the src object
 	hash := s.renameHash(src)
@@ -652,7 +673,7 @@ func (s *syncCopyMove) tryRename(src Object) bool {
 	dstOverwritten, _ := s.fdst.NewObject(src.Remote())
 
 	// Rename dst to have name src.Remote()
-	err := Move(s.fdst, dstOverwritten, src.Remote(), dst)
+	err := moveObject(s.stats, s.fdst, dstOverwritten, src.Remote(), dst)
 	if err != nil {
 		Debugf(src, "Failed to rename to %q: %v", dst.Remote(), err)
 		return false
@@ -664,6 +685,7 @@ func (s *syncCopyMove) tryRename(src Object) bool {
 	s.dstFilesMu.Unlock()
 
 	Infof(src, "Renamed from %q", dst.Remote())
+	s.journal.done(src)
 	return true
 }
 
@@ -698,6 +720,25 @@ func (s *syncCopyMove) run() error {
 		return nil
 	}
 
+	// Abort if cancelled
+	if s.cancel != nil {
+		select {
+		case <-s.cancel:
+			return FatalError(ErrorCancelled)
+		default:
+		}
+		finished := make(chan struct{})
+		defer close(finished)
+		go func() {
+			select {
+			case <-s.cancel:
+				Logf(s.fdst, "Cancelling")
+				s.processError(FatalError(ErrorCancelled))
+			case <-finished:
+			}
+		}()
+	}
+
 	// Start background checking and transferring pipeline
 	s.startCheckers()
 	s.startRenamers()
@@ -783,7 +824,7 @@ func (s *syncCopyMove) run() error {
 		if s.currentError() != nil {
 			Errorf(s.fdst, "%v", ErrorNotDeletingDirs)
 		} else {
-			s.processError(deleteEmptyDirectories(s.fdst, s.dstEmptyDirs))
+			s.processError(deleteEmptyDirectories(s.stats, s.fdst, s.dstEmptyDirs))
 		}
 	}
 	return s.currentError()
@@ -835,6 +876,10 @@ func (s *syncCopyMove) srcOnly(src DirEntry, job listDirJob, jobs *[]listDirJob)
 	}
 	switch x := src.(type) {
 	case Object:
+		if s.journal.isDone(x) {
+			return
+		}
+		s.journal.started(x)
 		if s.trackRenames {
 			// Save object to check for a rename later
 			s.trackRenamesCh <- x
@@ -860,9 +905,10 @@ func (s *syncCopyMove) srcOnly(src DirEntry, job listDirJob, jobs *[]listDirJob)
 func (s *syncCopyMove) transfer(dst, src DirEntry, job listDirJob, jobs *[]listDirJob) {
 	switch srcX := src.(type) {
 	case Object:
-		if s.deleteMode == DeleteModeOnly {
+		if s.deleteMode == DeleteModeOnly || s.journal.isDone(srcX) {
 			return
 		}
+		s.journal.started(srcX)
 		dstX, ok := dst.(Object)
 		if ok {
 			s.toBeChecked <- ObjectPair{srcX, dstX}
@@ -977,8 +1023,20 @@ func (s *syncCopyMove) processJob(job listDirJob) (jobs []listDirJob) {
 		wg                     sync.WaitGroup
 	)
 
+	// If the directory was completed by a previous run then only the
+	// source needs listing to check nothing in it has changed
+	srcListed := false
+	if !job.noSrc && !job.noDst && s.journal.dirDone(job.remote) {
+		srcList, srcListErr = s.srcListDir(job.remote)
+		if srcListErr == nil && s.journal.allDone(srcList) {
+			Debugf(s.fdst, "Skipping directory %q as done according to the sync journal", job.remote)
+			return doneDirJobs(srcList, job)
+		}
+		srcListed = true
+	}
+
 	// List the src and dst directories
-	if !job.noSrc {
+	if !job.noSrc && !srcListed {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -1026,6 +1084,25 @@ func (s *syncCopyMove) processJob(job listDirJob) (jobs []listDirJob) {
 		}
 		s.transfer(match.dst, match.src, job, &jobs)
 	}
+	if !job.noSrc {
+		s.journal.dirListed(job.remote)
+	}
+	return jobs
+}
+
+// doneDirJobs returns the jobs for the subdirectories in srcList of a
+// directory which is complete
+func doneDirJobs(srcList DirEntries, job listDirJob) (jobs []listDirJob) {
+	if job.srcDepth <= 0 || job.dstDepth <= 0 {
+		return nil
+	}
+	srcList.ForDir(func(dir Directory) {
+		jobs = append(jobs, listDirJob{
+			remote:   dir.Remote(),
+			srcDepth: job.srcDepth - 1,
+			dstDepth: job.dstDepth - 1,
+		})
+	})
 	return jobs
 }
 
@@ -1035,8 +1112,11 @@ func (s *syncCopyMove) processJob(job listDirJob) (jobs []listDirJob) {
 //
 // If DoMove is true then files will be moved instead of copied
 //
+// The transfers are accounted in stats and the sync is aborted with
+// ErrorCancelled if cancel is closed.
+//
 // dir is the start directory, "" for root
-func runSyncCopyMove(fdst, fsrc Fs, deleteMode DeleteMode, DoMove bool) error {
+func runSyncCopyMove(fdst, fsrc Fs, deleteMode DeleteMode, DoMove bool, stats *StatsInfo, cancel <-chan struct{}) error {
 	if *oldSyncMethod {
 		return FatalError(errors.New("--old-sync-method is deprecated use --fast-list instead"))
 	}
@@ -1049,7 +1129,7 @@ func runSyncCopyMove(fdst, fsrc Fs, deleteMode DeleteMode, DoMove bool) error {
 			return FatalError(errors.New("can't use --delete-before with --track-renames"))
 		}
 		// only delete stuff during in this pass
-		do, err := newSyncCopyMove(fdst, fsrc, DeleteModeOnly, false)
+		do, err := newSyncCopyMove(fdst, fsrc, DeleteModeOnly, false, stats, cancel)
 		if err != nil {
 			return err
 		}
@@ -1060,30 +1140,67 @@ func runSyncCopyMove(fdst, fsrc Fs, deleteMode DeleteMode, DoMove bool) error {
 		// Next pass does a copy only
 		deleteMode = DeleteModeOff
 	}
-	do, err := newSyncCopyMove(fdst, fsrc, deleteMode, DoMove)
+	do, err := newSyncCopyMove(fdst, fsrc, deleteMode, DoMove, stats, cancel)
 	if err != nil {
 		return err
 	}
-	return do.run()
+	if Config.SyncJournal != "" && !Config.DryRun {
+		do.journal, err = openJournal(Config.SyncJournal, fdst, fsrc, deleteMode, DoMove)
+		if err != nil {
+			return FatalError(err)
+		}
+	}
+	err = do.run()
+	closeErr := do.journal.close(err)
+	if err == nil {
+		err = closeErr
+	}
+	return err
 }
 
 // Sync fsrc into fdst
 func Sync(fdst, fsrc Fs) error {
-	return runSyncCopyMove(fdst, fsrc, Config.DeleteMode, false)
+	return runSyncCopyMove(fdst, fsrc, Config.DeleteMode, false, Stats, nil)
+}
+
+// SyncWithStats is like Sync but accounts the transfers in stats
+// rather than the global Stats.  If cancel is closed then the sync
+// is aborted returning ErrorCancelled.
+func SyncWithStats(fdst, fsrc Fs, stats *StatsInfo, cancel <-chan struct{}) error {
+	return runSyncCopyMove(fdst, fsrc, Config.DeleteMode, false, stats, cancel)
 }
 
 // CopyDir copies fsrc into fdst
 func CopyDir(fdst, fsrc Fs) error {
-	return runSyncCopyMove(fdst, fsrc, DeleteModeOff, false)
+	return runSyncCopyMove(fdst, fsrc, DeleteModeOff, false, Stats, nil)
+}
+
+// CopyDirWithStats is like CopyDir but accounts the transfers in
+// stats rather than the global Stats.  If cancel is closed then the
+// copy is aborted returning ErrorCancelled.
+func CopyDirWithStats(fdst, fsrc Fs, stats *StatsInfo, cancel <-chan struct{}) error {
+	return runSyncCopyMove(fdst, fsrc, DeleteModeOff, false, stats, cancel)
 }
 
 // moveDir moves fsrc into fdst
-func moveDir(fdst, fsrc Fs) error {
-	return runSyncCopyMove(fdst, fsrc, DeleteModeOff, true)
+func moveDir(fdst, fsrc Fs, stats *StatsInfo, cancel <-chan struct{}) error {
+	return runSyncCopyMove(fdst, fsrc, DeleteModeOff, true, stats, cancel)
 }
 
 // MoveDir moves fsrc into fdst
 func MoveDir(fdst, fsrc Fs) error {
+	return moveDirWithStats(fdst, fsrc, Stats, nil)
+}
+
+// MoveDirWithStats is like MoveDir but accounts the transfers in
+// stats rather than the global Stats.  If cancel is closed then the
+// move is aborted returning ErrorCancelled.
+func MoveDirWithStats(fdst, fsrc Fs, stats *StatsInfo, cancel <-chan struct{}) error {
+	return moveDirWithStats(fdst, fsrc, stats, cancel)
+}
+
+// moveDirWithStats implements MoveDir and MoveDirWithStats
+func moveDirWithStats(fdst, fsrc Fs, stats *StatsInfo, cancel <-chan struct{}) error {
 	if Same(fdst, fsrc) {
 		Errorf(fdst, "Nothing to do as source and destination are the same")
 		return nil
@@ -1104,7 +1221,7 @@ func MoveDir(fdst, fsrc Fs) error {
 			Infof(fdst, "Server side directory move succeeded")
 			return nil
 		default:
-			Stats.Error()
+			stats.Error()
 			Errorf(fdst, "Server side directory move failed: %v", err)
 			return err
 		}
@@ -1118,5 +1235,5 @@ func MoveDir(fdst, fsrc Fs) error {
 	}
 
 	// Otherwise move the files one by one
-	return moveDir(fdst, fsrc)
+	return moveDir(fdst, fsrc, stats, cancel)
 }
@@ -3,6 +3,9 @@
 package fs_test
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -42,6 +45,43 @@ func TestCopy(t *testing.T) {
 	fstest.CheckItems(t, r.fremote, file1)
 }
 
+// Test copy accounting in separate stats
+func TestCopyDirWithStats(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	file1 := r.WriteFile("sub dir/hello world", "hello world", t1)
+	r.Mkdir(r.fremote)
+
+	fs.Stats.ResetCounters()
+	stats := fs.NewStats()
+	err := fs.CopyDirWithStats(r.fremote, r.flocal, stats, nil)
+	require.NoError(t, err)
+
+	fstest.CheckItems(t, r.flocal, file1)
+	fstest.CheckItems(t, r.fremote, file1)
+	assert.Equal(t, int64(1), stats.GetTransfers())
+	assert.Equal(t, int64(0), fs.Stats.GetTransfers())
+}
+
+// Test a cancelled sync doesn't do anything
+func TestSyncWithStatsCancelled(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	file1 := r.WriteFile("sub dir/hello world", "hello world", t1)
+	file2 := r.WriteObject("potato", "delete me", t2)
+	fstest.CheckItems(t, r.fremote, file2)
+
+	cancel := make(chan struct{})
+	close(cancel)
+	stats := fs.NewStats()
+	err := fs.SyncWithStats(r.fremote, r.flocal, stats, cancel)
+	require.Error(t, err)
+	assert.True(t, fs.IsFatalError(err))
+
+	fstest.CheckItems(t, r.flocal, file1)
+	fstest.CheckItems(t, r.fremote, file2)
+}
+
 // Now with --no-traverse
 func TestCopyNoTraverse(t *testing.T) {
 	r := NewRun(t)
@@ -961,3 +1001,81 @@ func testSyncBackupDir(t *testing.T, suffix string) {
 }
 func TestSyncBackupDir(t *testing.T)           { testSyncBackupDir(t, "") }
 func TestSyncBackupDirWithSuffix(t *testing.T) { testSyncBackupDir(t, ".bak") }
+
+// syncJournal sets --sync-journal to a temporary file returning its
+// name and a function to tidy up
+func syncJournal(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "rclone-sync-journal-test")
+	require.NoError(t, err)
+	fs.Config.SyncJournal = filepath.Join(dir, "journal")
+	return fs.Config.SyncJournal, func() {
+		fs.Config.SyncJournal = ""
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// Test a copy which fails resumes from the journal
+func TestCopyWithSyncJournal(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	journal, cleanup := syncJournal(t)
+	defer cleanup()
+	file1 := r.WriteFile("one", "one", t1)
+	r.WriteFile("two", "two", t1)
+	file3 := r.WriteFile("sub/three", "three", t1)
+	file4 := r.WriteFile("clash/four", "four", t1)
+	r.WriteFile("clash/five", "five", t1)
+	// a directory on the remote with the name of a file stops the
+	// copy completing
+	r.WriteObject("clash/five/six", "six", t1)
+
+	err := fs.CopyDir(r.fremote, r.flocal)
+	require.Error(t, err)
+	_, err = os.Stat(journal)
+	require.NoError(t, err, "journal should be kept after an error")
+
+	// Change the destination of the completed files - the restarted
+	// copy shouldn't notice as it skips them
+	file1a := r.WriteObject("one", "ONE", t2)
+	file3a := r.WriteObject("sub/three", "THREE", t2)
+	// but changes to the source should be copied
+	file2 := r.WriteFile("two", "TWO", t3)
+	// and the clash removed
+	o, err := r.fremote.NewObject("clash/five/six")
+	require.NoError(t, err)
+	require.NoError(t, o.Remove())
+	require.NoError(t, r.fremote.Rmdir("clash/five"))
+
+	fs.Stats.ResetCounters()
+	err = fs.CopyDir(r.fremote, r.flocal)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), fs.Stats.GetTransfers())
+	file5 := fstest.NewItem("clash/five", "five", t1)
+	fstest.CheckItems(t, r.fremote, file1a, file2, file3a, file4, file5)
+
+	// the journal is removed when the copy succeeds
+	_, err = os.Stat(journal)
+	assert.True(t, os.IsNotExist(err), "journal should be removed")
+
+	// so the next copy checks everything again
+	err = fs.CopyDir(r.fremote, r.flocal)
+	require.NoError(t, err)
+	fstest.CheckItems(t, r.fremote, file1, file2, file3, file4, file5)
+}
+
+// Test a journal from a different sync isn't used
+func TestSyncJournalFromDifferentSync(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	journal, cleanup := syncJournal(t)
+	defer cleanup()
+	file1 := r.WriteFile("one", "one", t1)
+	r.WriteObject("one", "ONE", t2)
+	require.NoError(t, ioutil.WriteFile(journal, []byte(`{"version":1,"src":"potato:","dst":"sausage:","flags":""}
+{"file":"one","size":3,"modTime":"2001-02-03T04:05:06.499999999Z"}
+`), 0600))
+
+	err := fs.Sync(r.fremote, r.flocal)
+	require.NoError(t, err)
+	fstest.CheckItems(t, r.fremote, file1)
+}
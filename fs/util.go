@@ -0,0 +1,50 @@
+// Utilities for files on the local disk
+
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WriteFileAtomic writes data to file via a temporary file in the
+// same directory which is renamed over it, so readers never see a
+// partial file.  It makes the directory file is in if necessary.
+func WriteFileAtomic(file string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return err
+	}
+	out, err := ioutil.TempFile(filepath.Dir(file), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(out.Name(), file)
+	}
+	if err != nil {
+		_ = os.Remove(out.Name())
+	}
+	return err
+}
+
+// PrefixedDirPath returns the OS path to the directory dir, which is
+// "" or a "/" separated path, under root with each of the segments of
+// dir prefixed by prefix.  This stops the names of the directories
+// clashing with those of the files stored alongside them.
+func PrefixedDirPath(root, dir, prefix string) string {
+	p := root
+	if dir != "" {
+		for _, segment := range strings.Split(dir, "/") {
+			p = filepath.Join(p, prefix+segment)
+		}
+	}
+	return p
+}
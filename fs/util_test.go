@@ -0,0 +1,36 @@
+package fs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-util-test")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	file := filepath.Join(dir, "sub", "file")
+	require.NoError(t, fs.WriteFileAtomic(file, []byte("one")))
+	require.NoError(t, fs.WriteFileAtomic(file, []byte("two")))
+	data, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "two", string(data))
+
+	// no temporary files are left behind
+	infos, err := ioutil.ReadDir(filepath.Dir(file))
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(infos))
+}
+
+func TestPrefixedDirPath(t *testing.T) {
+	assert.Equal(t, "root", fs.PrefixedDirPath("root", "", "d."))
+	assert.Equal(t, filepath.Join("root", "d.a", "d.b"), fs.PrefixedDirPath("root", "a/b", "d."))
+}
@@ -805,6 +805,26 @@ func TestObjectOpenSeek(t *testing.T) {
 	assert.Equal(t, file1Contents[50:], readObject(t, obj, -1, &fs.SeekOption{Offset: 50}), "contents of file1 differ after seek")
 }
 
+// TestObjectOpenRange tests that Open works with RangeOption
+func TestObjectOpenRange(t *testing.T) {
+	skipIfNotOk(t)
+	obj := findObject(t, file1.Path)
+	for _, test := range []struct {
+		ro                 fs.RangeOption
+		wantStart, wantEnd int
+	}{
+		{fs.RangeOption{Start: 5, End: 15}, 5, 16},
+		{fs.RangeOption{Start: 80, End: -1}, 80, 100},
+		{fs.RangeOption{Start: 81, End: 100000}, 81, 100},
+		{fs.RangeOption{Start: -1, End: 20}, 80, 100}, // if start is omitted this means get the final bytes
+	} {
+		got := readObject(t, obj, -1, &test.ro)
+		foundAt := strings.Index(file1Contents, got)
+		help := fmt.Sprintf("%#v failed want [%d:%d] got [%d:%d]", test.ro, test.wantStart, test.wantEnd, foundAt, foundAt+len(got))
+		assert.Equal(t, file1Contents[test.wantStart:test.wantEnd], got, help)
+	}
+}
+
 // TestObjectPartialRead tests that reading only part of the object does the correct thing
 func TestObjectPartialRead(t *testing.T) {
 	skipIfNotOk(t)
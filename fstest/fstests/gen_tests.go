@@ -66,7 +66,7 @@ import (
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fstest/fstests"
 	"github.com/ncw/rclone/{{ .FsName }}"
-{{ if eq .FsName "crypt" }}	_ "github.com/ncw/rclone/local"
+{{ if or (eq .FsName "crypt") (eq .FsName "cache") (eq .FsName "union") (eq .FsName "chunker") (eq .FsName "compress") (eq .FsName "hasher") (eq .FsName "mirror") (eq .FsName "erasure") (eq .FsName "cas") }}	_ "github.com/ncw/rclone/local"
 {{end}})
 
 func TestSetup{{ .Suffix }}(t *testing.T)() {
@@ -159,9 +159,19 @@ func main() {
 	generateTestProgram(t, fns, "Crypt")
 	generateTestProgram(t, fns, "Crypt", suffix("2"))
 	generateTestProgram(t, fns, "Crypt", suffix("3"))
+	generateTestProgram(t, fns, "Cache")
+	generateTestProgram(t, fns, "Union")
+	generateTestProgram(t, fns, "Chunker")
+	generateTestProgram(t, fns, "Compress")
+	generateTestProgram(t, fns, "Hasher")
+	generateTestProgram(t, fns, "Mirror")
+	generateTestProgram(t, fns, "Erasure")
+	generateTestProgram(t, fns, "Cas")
+	generateTestProgram(t, fns, "Memory")
 	generateTestProgram(t, fns, "Sftp")
 	generateTestProgram(t, fns, "FTP")
 	generateTestProgram(t, fns, "Box")
+	generateTestProgram(t, fns, "Webdav")
 	generateTestProgram(t, fns, "QingStor", buildConstraint("!plan9"))
 	generateTestProgram(t, fns, "AzureBlob", buildConstraint("go1.7"))
 	log.Printf("Done")
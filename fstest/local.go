@@ -0,0 +1,100 @@
+// Helpers for testing remotes using temporary local directories
+
+package fstest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/stretchr/testify/require"
+)
+
+var initialise sync.Once
+
+// NewConfiguredFs sets up the remote called name in the config with
+// the config values passed as pairs of key and value, initialising
+// rclone for testing the first time it is called, then makes an Fs
+// of its root.
+//
+// To test a remote wrapping the local filesystem pass it a directory
+// made by NewLocalDir or NewLocalDirs as its remote.
+func NewConfiguredFs(name string, config ...string) (fs.Fs, error) {
+	initialise.Do(Initialise)
+	for i := 0; i+1 < len(config); i += 2 {
+		fs.ConfigFileSet(name, config[i], config[i+1])
+	}
+	return fs.NewFs(name + ":")
+}
+
+// NewLocalDir makes a temporary local directory returning it and a
+// function to tidy up
+func NewLocalDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "rclone-test")
+	require.NoError(t, err)
+	return dir, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// NewLocalDirs makes n temporary local directories called "a", "b",
+// ... in the same parent returning them and a function to tidy up
+func NewLocalDirs(t *testing.T, n int) ([]string, func()) {
+	parent, cleanup := NewLocalDir(t)
+	var dirs []string
+	for i := 0; i < n; i++ {
+		dir := filepath.Join(parent, string(rune('a'+i)))
+		require.NoError(t, os.MkdirAll(dir, 0777))
+		dirs = append(dirs, dir)
+	}
+	return dirs, cleanup
+}
+
+// WriteFile writes contents to the file name in the local directory
+// dir with modTime, making any directories needed
+func WriteFile(t *testing.T, dir, name, contents string, modTime time.Time) {
+	p := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0777))
+	require.NoError(t, ioutil.WriteFile(p, []byte(contents), 0666))
+	require.NoError(t, os.Chtimes(p, modTime, modTime))
+}
+
+// LocalNames returns the sorted names of the entries in the local
+// directory dir
+func LocalNames(t *testing.T, dir string) (names []string) {
+	infos, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PutFile uploads contents to remote on f with a fixed modification
+// time returning the Object
+func PutFile(t *testing.T, f fs.Fs, remote, contents string) fs.Object {
+	src := fs.NewStaticObjectInfo(remote, Time("2001-02-03T04:05:06Z"), int64(len(contents)), true, nil, nil)
+	o, err := f.Put(strings.NewReader(contents), src)
+	require.NoError(t, err)
+	return o
+}
+
+// ReadObject reads remote on f with the options given returning its
+// contents
+func ReadObject(t *testing.T, f fs.Fs, remote string, options ...fs.OpenOption) string {
+	o, err := f.NewObject(remote)
+	require.NoError(t, err)
+	in, err := o.Open(options...)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
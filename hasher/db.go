@@ -0,0 +1,328 @@
+// The database of checksums
+
+package hasher
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// The checksums for each remote are kept in a directory named after
+// the remote in the hasher directory.
+//
+// This mirrors the directory structure of the remote with each
+// directory name prefixed with "d.".  The checksums of the files in
+// a directory are stored in a file called ".sums" in that directory
+// as a log of changes, one JSON record per line, so storing the
+// checksums of a file only appends a line.  The log is rewritten with
+// just the current checksums once it has grown to twice the size it
+// needs to be.  The size and modification time of the file the
+// checksums were computed from are stored with them so they are
+// ignored if the file changes.
+const (
+	sumsName  = ".sums"
+	dirPrefix = "d."
+
+	// maxCachedDirs is the most directories whose checksums are
+	// kept in memory
+	maxCachedDirs = 100
+
+	// minCompactRecords is the fewest records a log is compacted at
+	minCompactRecords = 16
+)
+
+// entry is the checksums of a file
+type entry struct {
+	Size    int64                  `json:"size"`
+	ModTime time.Time              `json:"modTime"`
+	Hashes  map[fs.HashType]string `json:"hashes"`
+}
+
+// record is a line of the log of a directory's checksums setting
+// the checksums of the file Name or removing them if Entry is nil
+type record struct {
+	Name  string `json:"name"`
+	Entry *entry `json:"entry,omitempty"`
+}
+
+// sums is the checksums of the files in a directory keyed on the leaf
+type sums map[string]entry
+
+// dirSums is the checksums of a directory read from its log
+type dirSums struct {
+	sums    sums
+	records int   // number of records in the log
+	size    int64 // size of the log when last read or written
+	partial bool  // set if the log ends with a line cut short
+}
+
+// db is the database of checksums for a remote
+type db struct {
+	dir  string              // directory the database is stored in
+	mu   sync.Mutex          // protects the files in dir and below
+	dirs map[string]*dirSums // checksums of the directories read
+}
+
+var (
+	dbsMu sync.Mutex
+	dbs   = map[string]*db{}
+)
+
+// getDB returns the database stored in dir, sharing it with any other
+// users of dir in this process
+func getDB(dir string) *db {
+	dbsMu.Lock()
+	defer dbsMu.Unlock()
+	d := dbs[dir]
+	if d == nil {
+		d = &db{
+			dir:  dir,
+			dirs: make(map[string]*dirSums),
+		}
+		dbs[dir] = d
+	}
+	return d
+}
+
+// dirPath returns the OS path to the database directory for dir
+func (d *db) dirPath(dir string) string {
+	return fs.PrefixedDirPath(d.dir, dir, dirPrefix)
+}
+
+// split returns the directory and leaf of remote with "" for the root
+func split(remote string) (dir, leaf string) {
+	dir, leaf = path.Split(remote)
+	return strings.TrimSuffix(dir, "/"), leaf
+}
+
+// readSums returns the checksums for dir.  They are only read from
+// the log if it has changed size since it was last read or written,
+// so if another process has written to it.
+//
+// Call with the lock held
+func (d *db) readSums(dir string) (*dirSums, error) {
+	name := filepath.Join(d.dirPath(dir), sumsName)
+	var size int64
+	info, err := os.Stat(name)
+	if err == nil {
+		size = info.Size()
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "failed to read checksums")
+	}
+	ds := d.dirs[dir]
+	if ds != nil && ds.size == size {
+		return ds, nil
+	}
+	ds = &dirSums{sums: sums{}}
+	if size > 0 {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read checksums")
+		}
+		ds.size = int64(len(data))
+		ds.partial = data[len(data)-1] != '\n'
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			if len(line) == 0 {
+				continue
+			}
+			var r record
+			err = json.Unmarshal(line, &r)
+			if err != nil {
+				// probably a line cut short by a crash
+				fs.Debugf(nil, "hasher: ignoring bad line in %q: %v", name, err)
+				continue
+			}
+			ds.records++
+			if r.Entry == nil {
+				delete(ds.sums, r.Name)
+			} else {
+				ds.sums[r.Name] = *r.Entry
+			}
+		}
+	}
+	// forget any directory to make room
+	for oldDir := range d.dirs {
+		if len(d.dirs) < maxCachedDirs {
+			break
+		}
+		delete(d.dirs, oldDir)
+	}
+	d.dirs[dir] = ds
+	return ds, nil
+}
+
+// appendRecord adds r to the log of dir, compacting the log if it
+// has grown too big
+//
+// Call with the lock held
+func (d *db) appendRecord(dir string, ds *dirSums, r record) error {
+	if ds.records >= minCompactRecords && ds.records >= 2*len(ds.sums) {
+		return d.compact(dir, ds)
+	}
+	name := filepath.Join(d.dirPath(dir), sumsName)
+	data, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode checksums")
+	}
+	data = append(data, '\n')
+	if ds.partial {
+		// finish the line cut short so this one can be read
+		data = append([]byte{'\n'}, data...)
+	}
+	err = os.MkdirAll(filepath.Dir(name), 0700)
+	if err != nil {
+		return errors.Wrap(err, "failed to write checksums")
+	}
+	out, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to write checksums")
+	}
+	_, err = out.Write(data)
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		delete(d.dirs, dir)
+		return errors.Wrap(err, "failed to write checksums")
+	}
+	ds.records++
+	ds.size += int64(len(data))
+	ds.partial = false
+	return nil
+}
+
+// compact rewrites the log of dir with one record for each file
+//
+// Call with the lock held
+func (d *db) compact(dir string, ds *dirSums) error {
+	name := filepath.Join(d.dirPath(dir), sumsName)
+	if len(ds.sums) == 0 {
+		err := os.Remove(name)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed to remove checksums")
+		}
+		ds.records, ds.size, ds.partial = 0, 0, false
+		return nil
+	}
+	var buf bytes.Buffer
+	for leaf := range ds.sums {
+		e := ds.sums[leaf]
+		data, err := json.Marshal(record{Name: leaf, Entry: &e})
+		if err != nil {
+			return errors.Wrap(err, "failed to encode checksums")
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	err := fs.WriteFileAtomic(name, buf.Bytes())
+	if err != nil {
+		delete(d.dirs, dir)
+		return errors.Wrap(err, "failed to write checksums")
+	}
+	ds.records, ds.size, ds.partial = len(ds.sums), int64(buf.Len()), false
+	return nil
+}
+
+// get returns the checksums stored for remote if they were computed
+// from a file of size and modTime, or nil if there aren't any
+func (d *db) get(remote string, size int64, modTime time.Time) (map[fs.HashType]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dir, leaf := split(remote)
+	ds, err := d.readSums(dir)
+	if err != nil {
+		return nil, err
+	}
+	e, ok := ds.sums[leaf]
+	if !ok || e.Size != size || !e.ModTime.Equal(modTime) {
+		return nil, nil
+	}
+	return e.Hashes, nil
+}
+
+// put stores the checksums for remote computed from a file of size
+// and modTime
+func (d *db) put(remote string, size int64, modTime time.Time, hashes map[fs.HashType]string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dir, leaf := split(remote)
+	ds, err := d.readSums(dir)
+	if err != nil {
+		return err
+	}
+	e := entry{
+		Size:    size,
+		ModTime: modTime,
+		Hashes:  hashes,
+	}
+	ds.sums[leaf] = e
+	return d.appendRecord(dir, ds, record{Name: leaf, Entry: &e})
+}
+
+// remove removes the checksums stored for remote if any
+func (d *db) remove(remote string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dir, leaf := split(remote)
+	ds, err := d.readSums(dir)
+	if err != nil {
+		return err
+	}
+	if _, ok := ds.sums[leaf]; !ok {
+		return nil
+	}
+	delete(ds.sums, leaf)
+	return d.appendRecord(dir, ds, record{Name: leaf})
+}
+
+// forgetDirs removes dir and everything in it from the checksums
+// kept in memory
+//
+// Call with the lock held
+func (d *db) forgetDirs(dir string) {
+	for cached := range d.dirs {
+		if dir == "" || cached == dir || strings.HasPrefix(cached, dir+"/") {
+			delete(d.dirs, cached)
+		}
+	}
+}
+
+// removeDir removes the checksums stored for everything in dir
+func (d *db) removeDir(dir string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.forgetDirs(dir)
+	return os.RemoveAll(d.dirPath(dir))
+}
+
+// moveDir moves the checksums stored for everything in src to dst
+func (d *db) moveDir(src, dst string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.forgetDirs(src)
+	d.forgetDirs(dst)
+	srcPath, dstPath := d.dirPath(src), d.dirPath(dst)
+	if _, err := os.Stat(srcPath); os.IsNotExist(err) {
+		return nil
+	}
+	err := os.RemoveAll(dstPath)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(dstPath), 0700)
+	if err != nil {
+		return err
+	}
+	return os.Rename(srcPath, dstPath)
+}
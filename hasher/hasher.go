@@ -0,0 +1,560 @@
+// Package hasher provides wrappers for Fs and Object which compute
+// and store MD5 and SHA1 checksums for remotes which don't support
+// them
+package hasher
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// Globals
+var (
+	// Flags
+	hasherDir = fs.StringP("hasher-dir", "", defaultHasherDir(), "Directory rclone will store the checksums of hasher remotes in.")
+
+	// The hashes computed by the hasher
+	computedHashes = fs.NewHashSet(fs.HashMD5, fs.HashSHA1)
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "hasher",
+		Description: "Add checksums to a remote",
+		NewFs:       NewFs,
+		Options: []fs.Option{{
+			Name: "remote",
+			Help: "Remote to add checksums to.\nNormally should contain a ':' and a path, eg \"myremote:path/to/dir\",\n\"myremote:bucket\" or maybe \"myremote:\" (not recommended).",
+		}},
+	})
+}
+
+// defaultHasherDir returns the directory to store the checksums in
+// if --hasher-dir isn't set
+func defaultHasherDir() string {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "rclone", "hasher")
+	}
+	homedir := os.Getenv("HOME")
+	if usr, err := user.Current(); err == nil {
+		homedir = usr.HomeDir
+	}
+	if homedir == "" {
+		return filepath.Join(os.TempDir(), "rclone-hasher")
+	}
+	return filepath.Join(homedir, ".cache", "rclone", "hasher")
+}
+
+// NewFs contstructs an Fs from the path, container:path
+func NewFs(name, rpath string) (fs.Fs, error) {
+	remote := fs.ConfigFileGet(name, "remote")
+	if strings.HasPrefix(remote, name+":") {
+		return nil, errors.New("can't point hasher remote at itself - check the value of the remote setting")
+	}
+	root := strings.Trim(path.Clean(rpath), "/")
+	if root == "." {
+		root = ""
+	}
+	remotePath := path.Join(remote, root)
+	wrappedFs, err := fs.NewFs(remotePath)
+	if err != fs.ErrorIsFile && err != nil {
+		return nil, errors.Wrapf(err, "failed to make remote %q to wrap", remotePath)
+	}
+	if err == fs.ErrorIsFile {
+		// The wrapped Fs now points to the parent so follow it
+		root = path.Dir(root)
+		if root == "." {
+			root = ""
+		}
+	}
+	f := &Fs{
+		Fs:   wrappedFs,
+		name: name,
+		root: root,
+		db:   getDB(filepath.Join(*hasherDir, name)),
+	}
+	// the features here are ones we could support, and they are
+	// ANDed with the ones from wrappedFs
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false, // the checksums are keyed on the file name
+		ReadMimeType:            true,
+		WriteMimeType:           true,
+		BucketBased:             true,
+		CanHaveEmptyDirectories: true,
+	}).Fill(f).Mask(wrappedFs)
+	return f, err
+}
+
+// Fs represents a wrapped fs.Fs
+type Fs struct {
+	fs.Fs
+	name     string
+	root     string
+	features *fs.Features // optional features
+	db       *db          // the stored checksums
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// String returns a description of the FS
+func (f *Fs) String() string {
+	return fmt.Sprintf("Hasher '%s:%s'", f.name, f.root)
+}
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() fs.HashSet {
+	hashes := f.Fs.Hashes()
+	return hashes.Add(computedHashes.Array()...)
+}
+
+// dbPath returns the path of remote in the database
+func (f *Fs) dbPath(remote string) string {
+	return path.Join(f.root, remote)
+}
+
+// wrapEntries wraps the objects in entries.  This alters entries
+// returning it as newEntries.
+func (f *Fs) wrapEntries(entries fs.DirEntries) (newEntries fs.DirEntries, err error) {
+	for i, entry := range entries {
+		switch x := entry.(type) {
+		case fs.Object:
+			entries[i] = f.newObject(x)
+		case fs.Directory:
+		default:
+			return nil, errors.Errorf("Unknown object type %T", entry)
+		}
+	}
+	return entries, nil
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(dir string) (entries fs.DirEntries, err error) {
+	entries, err = f.Fs.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	return f.wrapEntries(entries)
+}
+
+// ListR lists the objects and directories of the Fs starting
+// from dir recursively into out.
+//
+// dir should be "" to start from the root, and should not
+// have trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+//
+// It should call callback for each tranche of entries read.
+// These need not be returned in any particular order.  If
+// callback returns an error then the listing will stop
+// immediately.
+//
+// Don't implement this unless you have a more efficient way
+// of listing recursively that doing a directory traversal.
+func (f *Fs) ListR(dir string, callback fs.ListRCallback) (err error) {
+	return f.Fs.Features().ListR(dir, func(entries fs.DirEntries) error {
+		newEntries, err := f.wrapEntries(entries)
+		if err != nil {
+			return err
+		}
+		return callback(newEntries)
+	})
+}
+
+// NewObject finds the Object at remote.
+func (f *Fs) NewObject(remote string) (fs.Object, error) {
+	o, err := f.Fs.NewObject(remote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o), nil
+}
+
+// putFn is the signature of Put and PutStream
+type putFn func(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error)
+
+// put uploads in with do computing the checksums as it goes
+func (f *Fs) put(do putFn, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	hasher, err := fs.NewMultiHasherTypes(computedHashes)
+	if err != nil {
+		return nil, err
+	}
+	o, err := do(io.TeeReader(in, hasher), src, options...)
+	if err != nil {
+		return nil, err
+	}
+	newO := f.newObject(o)
+	newO.storeSums(hasher)
+	return newO, nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(f.Fs.Put, in, src, options...)
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(f.Fs.Features().PutStream, in, src, options...)
+}
+
+// Purge all files in the root and the root directory
+//
+// Implement this if you have a way of deleting all the files
+// quicker than just running Remove() on the result of List()
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge() error {
+	do := f.Fs.Features().Purge
+	if do == nil {
+		return fs.ErrorCantPurge
+	}
+	err := do()
+	if err != nil {
+		return err
+	}
+	return f.db.removeDir(f.root)
+}
+
+// copySums stores the checksums of src if known as the checksums of
+// dst
+func (f *Fs) copySums(src *Object, dst *Object) {
+	hashes, err := src.sums()
+	if err != nil || hashes == nil {
+		return
+	}
+	err = f.db.put(f.dbPath(dst.Remote()), dst.Size(), dst.ModTime(), hashes)
+	if err != nil {
+		fs.Errorf(dst, "Failed to store checksums: %v", err)
+	}
+}
+
+// Copy src to this remote using server side copy operations.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Copy
+	if do == nil {
+		return nil, fs.ErrorCantCopy
+	}
+	o, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantCopy
+	}
+	newO, err := do(o.Object, remote)
+	if err != nil {
+		return nil, err
+	}
+	dst := f.newObject(newO)
+	f.copySums(o, dst)
+	return dst, nil
+}
+
+// Move src to this remote using server side move operations.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Move
+	if do == nil {
+		return nil, fs.ErrorCantMove
+	}
+	o, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantMove
+	}
+	// read the checksums before the source disappears
+	hashes, _ := o.sums()
+	newO, err := do(o.Object, remote)
+	if err != nil {
+		return nil, err
+	}
+	dst := f.newObject(newO)
+	if hashes != nil {
+		err = f.db.put(f.dbPath(dst.Remote()), dst.Size(), dst.ModTime(), hashes)
+		if err != nil {
+			fs.Errorf(dst, "Failed to store checksums: %v", err)
+		}
+	}
+	err = o.f.db.remove(o.f.dbPath(o.Remote()))
+	if err != nil {
+		fs.Errorf(o, "Failed to remove checksums: %v", err)
+	}
+	return dst, nil
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(src fs.Fs, srcRemote, dstRemote string) error {
+	do := f.Fs.Features().DirMove
+	if do == nil {
+		return fs.ErrorCantDirMove
+	}
+	srcFs, ok := src.(*Fs)
+	if !ok {
+		fs.Debugf(srcFs, "Can't move directory - not same remote type")
+		return fs.ErrorCantDirMove
+	}
+	err := do(srcFs.Fs, srcRemote, dstRemote)
+	if err != nil {
+		return err
+	}
+	err = f.db.moveDir(srcFs.dbPath(srcRemote), f.dbPath(dstRemote))
+	if err != nil {
+		fs.Errorf(f, "Failed to move checksums: %v", err)
+	}
+	return nil
+}
+
+// CleanUp the trash in the Fs
+//
+// Implement this if you have a way of emptying the trash or
+// otherwise cleaning up old versions of files.
+func (f *Fs) CleanUp() error {
+	do := f.Fs.Features().CleanUp
+	if do == nil {
+		return errors.New("can't CleanUp")
+	}
+	return do()
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs {
+	return f.Fs
+}
+
+// Object describes a wrapped object
+//
+// The MD5 and SHA1 checksums are computed when it is uploaded or
+// read and stored in the database
+type Object struct {
+	fs.Object
+	f *Fs
+}
+
+func (f *Fs) newObject(o fs.Object) *Object {
+	return &Object{
+		Object: o,
+		f:      f,
+	}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.Remote()
+}
+
+// UnWrap returns the wrapped Object
+func (o *Object) UnWrap() fs.Object {
+	return o.Object
+}
+
+// MimeType of an Object if known, "" otherwise
+func (o *Object) MimeType() string {
+	return fs.MimeType(o.Object)
+}
+
+// sums returns the stored checksums of the object or nil if there
+// aren't any for its current size and modification time
+func (o *Object) sums() (map[fs.HashType]string, error) {
+	return o.f.db.get(o.f.dbPath(o.Remote()), o.Size(), o.ModTime())
+}
+
+// storeSums stores the checksums computed by hasher if it read all
+// of the object
+func (o *Object) storeSums(hasher *fs.MultiHasher) {
+	if hasher.Size() != o.Size() {
+		fs.Debugf(o, "Not storing checksums as read %d bytes of %d", hasher.Size(), o.Size())
+		return
+	}
+	err := o.f.db.put(o.f.dbPath(o.Remote()), o.Size(), o.ModTime(), hasher.Sums())
+	if err != nil {
+		fs.Errorf(o, "Failed to store checksums: %v", err)
+	}
+}
+
+// Hash returns the selected checksum of the file
+//
+// Hashes the wrapped remote supports are read from it, otherwise they
+// are read from the database.  If they aren't known it returns "".
+func (o *Object) Hash(hash fs.HashType) (string, error) {
+	if o.f.Fs.Hashes().Contains(hash) {
+		return o.Object.Hash(hash)
+	}
+	if !computedHashes.Contains(hash) {
+		return "", fs.ErrHashUnsupported
+	}
+	hashes, err := o.sums()
+	if err != nil {
+		return "", err
+	}
+	return hashes[hash], nil
+}
+
+// hashingReader computes the checksums of the object as it is read
+// storing them when the end is reached
+type hashingReader struct {
+	io.ReadCloser
+	o      *Object
+	hasher *fs.MultiHasher
+	done   bool
+}
+
+// Read bytes from the object - see io.Reader
+func (r *hashingReader) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	_, _ = r.hasher.Write(p[:n])
+	if err == io.EOF && !r.done {
+		r.done = true
+		r.o.storeSums(r.hasher)
+	}
+	return n, err
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+//
+// If all of the file is read and its checksums aren't known they are
+// computed and stored.
+func (o *Object) Open(options ...fs.OpenOption) (io.ReadCloser, error) {
+	in, err := o.Object.Open(options...)
+	if err != nil {
+		return nil, err
+	}
+	for _, option := range options {
+		switch option.(type) {
+		case *fs.SeekOption, *fs.RangeOption:
+			// Not reading all of the file
+			return in, nil
+		}
+	}
+	if hashes, err := o.sums(); err != nil || hashes != nil {
+		return in, nil
+	}
+	hasher, err := fs.NewMultiHasherTypes(computedHashes)
+	if err != nil {
+		_ = in.Close()
+		return nil, err
+	}
+	return &hashingReader{ReadCloser: in, o: o, hasher: hasher}, nil
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	hasher, err := fs.NewMultiHasherTypes(computedHashes)
+	if err != nil {
+		return err
+	}
+	err = o.Object.Update(io.TeeReader(in, hasher), src, options...)
+	if err != nil {
+		return err
+	}
+	o.storeSums(hasher)
+	return nil
+}
+
+// SetModTime sets the modification time of the file keeping the
+// stored checksums
+func (o *Object) SetModTime(modTime time.Time) error {
+	hashes, _ := o.sums()
+	err := o.Object.SetModTime(modTime)
+	if err != nil {
+		return err
+	}
+	if hashes != nil {
+		err = o.f.db.put(o.f.dbPath(o.Remote()), o.Size(), o.ModTime(), hashes)
+		if err != nil {
+			fs.Errorf(o, "Failed to store checksums: %v", err)
+		}
+	}
+	return nil
+}
+
+// Remove an object
+func (o *Object) Remove() error {
+	err := o.Object.Remove()
+	if err != nil {
+		return err
+	}
+	err = o.f.db.remove(o.f.dbPath(o.Remote()))
+	if err != nil {
+		fs.Errorf(o, "Failed to remove checksums: %v", err)
+	}
+	return nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs          = (*Fs)(nil)
+	_ fs.Purger      = (*Fs)(nil)
+	_ fs.Copier      = (*Fs)(nil)
+	_ fs.Mover       = (*Fs)(nil)
+	_ fs.DirMover    = (*Fs)(nil)
+	_ fs.PutStreamer = (*Fs)(nil)
+	_ fs.CleanUpper  = (*Fs)(nil)
+	_ fs.UnWrapper   = (*Fs)(nil)
+	_ fs.ListRer     = (*Fs)(nil)
+	_ fs.Object      = (*Object)(nil)
+	_ fs.MimeTyper   = (*Object)(nil)
+)
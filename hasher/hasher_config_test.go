@@ -0,0 +1,28 @@
+package hasher_test
+
+import (
+	"os"
+	"path/filepath"
+
+	_ "github.com/ncw/rclone/compress"
+	"github.com/ncw/rclone/fstest/fstests"
+	"github.com/spf13/pflag"
+)
+
+// Create the TestHasher: remote
+func init() {
+	tempdir := filepath.Join(os.TempDir(), "rclone-hasher-test-remote")
+	name := "TestHasher"
+	err := pflag.Set("hasher-dir", filepath.Join(os.TempDir(), "rclone-hasher-test-db"))
+	if err != nil {
+		panic(err)
+	}
+	fstests.ExtraConfig = []fstests.ExtraConfigItem{
+		// wrap a remote without any hashes so they are all
+		// computed by the hasher
+		{Name: name + "Base", Key: "type", Value: "compress"},
+		{Name: name + "Base", Key: "remote", Value: tempdir},
+		{Name: name, Key: "type", Value: "hasher"},
+		{Name: name, Key: "remote", Value: name + "Base:"},
+	}
+}
@@ -0,0 +1,185 @@
+package hasher
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/ncw/rclone/compress"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFs makes a hasher remote wrapping a compress remote, which
+// doesn't support any hashes, of a temporary local directory
+// returning the Fs, the compress Fs and a function to tidy up
+func newTestFs(t *testing.T) (*Fs, fs.Fs, func()) {
+	dir, cleanup := fstest.NewLocalDir(t)
+	oldHasherDir := *hasherDir
+	*hasherDir = filepath.Join(dir, "db")
+	name := "TestHasherInternal"
+	_, err := fstest.NewConfiguredFs(name+"Base", "type", "compress", "remote", filepath.Join(dir, "remote"))
+	require.NoError(t, err)
+	f, err := fstest.NewConfiguredFs(name, "type", "hasher", "remote", name+"Base:")
+	require.NoError(t, err)
+	return f.(*Fs), f.(*Fs).UnWrap(), func() {
+		*hasherDir = oldHasherDir
+		cleanup()
+	}
+}
+
+// checkHashes checks the hashes of remote on f are those of contents
+// or "" if contents is ""
+func checkHashes(t *testing.T, f fs.Fs, remote, contents string) {
+	var wantMD5, wantSHA1 string
+	if contents != "" {
+		md5sum := md5.Sum([]byte(contents))
+		sha1sum := sha1.Sum([]byte(contents))
+		wantMD5, wantSHA1 = hex.EncodeToString(md5sum[:]), hex.EncodeToString(sha1sum[:])
+	}
+	o, err := f.NewObject(remote)
+	require.NoError(t, err)
+	hash, err := o.Hash(fs.HashMD5)
+	require.NoError(t, err)
+	assert.Equal(t, wantMD5, hash, remote)
+	hash, err = o.Hash(fs.HashSHA1)
+	require.NoError(t, err)
+	assert.Equal(t, wantSHA1, hash, remote)
+}
+
+func TestHashes(t *testing.T) {
+	f, base, cleanup := newTestFs(t)
+	defer cleanup()
+	assert.Equal(t, fs.HashSet(fs.HashNone), base.Hashes())
+	assert.Equal(t, fs.NewHashSet(fs.HashMD5, fs.HashSHA1), f.Hashes())
+	o := fstest.PutFile(t, f, "file.txt", "hello")
+	_, err := o.Hash(fs.HashDropbox)
+	assert.Equal(t, fs.ErrHashUnsupported, err)
+}
+
+func TestPut(t *testing.T) {
+	f, _, cleanup := newTestFs(t)
+	defer cleanup()
+
+	fstest.PutFile(t, f, "dir/file.txt", "hello")
+	checkHashes(t, f, "dir/file.txt", "hello")
+	_, err := os.Stat(filepath.Join(*hasherDir, "TestHasherInternal", "d.dir", sumsName))
+	assert.NoError(t, err)
+
+	o, err := f.NewObject("dir/file.txt")
+	require.NoError(t, err)
+	src := fs.NewStaticObjectInfo("dir/file.txt", fstest.Time("2002-02-03T04:05:06Z"), 7, true, nil, nil)
+	require.NoError(t, o.Update(strings.NewReader("goodbye"), src))
+	checkHashes(t, f, "dir/file.txt", "goodbye")
+
+	// The checksums persist in new instances of the remote
+	f2, err := fs.NewFs("TestHasherInternal:dir")
+	require.NoError(t, err)
+	checkHashes(t, f2, "file.txt", "goodbye")
+}
+
+func TestOpen(t *testing.T) {
+	f, base, cleanup := newTestFs(t)
+	defer cleanup()
+
+	// Files uploaded without the hasher have no checksums
+	fstest.PutFile(t, base, "file.txt", "0123456789")
+	checkHashes(t, f, "file.txt", "")
+
+	// until they are read completely
+	assert.Equal(t, "2345", fstest.ReadObject(t, f, "file.txt", &fs.RangeOption{Start: 2, End: 5}))
+	checkHashes(t, f, "file.txt", "")
+	assert.Equal(t, "0123456789", fstest.ReadObject(t, f, "file.txt"))
+	checkHashes(t, f, "file.txt", "0123456789")
+
+	// Changing the file behind the hasher's back invalidates them
+	fstest.PutFile(t, base, "file.txt", "abcdefghijk")
+	checkHashes(t, f, "file.txt", "")
+}
+
+func TestSetModTime(t *testing.T) {
+	f, _, cleanup := newTestFs(t)
+	defer cleanup()
+
+	o := fstest.PutFile(t, f, "file.txt", "hello")
+	require.NoError(t, o.SetModTime(fstest.Time("2003-02-03T04:05:06Z")))
+	checkHashes(t, f, "file.txt", "hello")
+}
+
+func TestMoveRemove(t *testing.T) {
+	f, _, cleanup := newTestFs(t)
+	defer cleanup()
+
+	o := fstest.PutFile(t, f, "file.txt", "hello")
+	_, err := f.Move(o, "dir/moved.txt")
+	require.NoError(t, err)
+	checkHashes(t, f, "dir/moved.txt", "hello")
+	hashes, err := f.db.get("file.txt", o.Size(), o.ModTime())
+	require.NoError(t, err)
+	assert.Nil(t, hashes)
+
+	require.NoError(t, f.DirMove(f, "dir", "newdir"))
+	checkHashes(t, f, "newdir/moved.txt", "hello")
+
+	moved, err := f.NewObject("newdir/moved.txt")
+	require.NoError(t, err)
+	require.NoError(t, moved.Remove())
+	hashes, err = f.db.get("newdir/moved.txt", moved.Size(), moved.ModTime())
+	require.NoError(t, err)
+	assert.Nil(t, hashes)
+}
+
+func TestDBLog(t *testing.T) {
+	dir, cleanup := fstest.NewLocalDir(t)
+	defer cleanup()
+	d := &db{dir: dir, dirs: make(map[string]*dirSums)}
+	t1 := fstest.Time("2001-02-03T04:05:06Z")
+	hashes := map[fs.HashType]string{fs.HashMD5: "md5"}
+
+	// Storing checksums appends to the log which is compacted
+	// when it gets too big
+	for i := 0; i < 100; i++ {
+		require.NoError(t, d.put(fmt.Sprintf("dir/file%d", i%5), int64(i), t1, hashes))
+	}
+	require.NoError(t, d.remove("dir/file0"))
+	data, err := ioutil.ReadFile(filepath.Join(dir, "d.dir", sumsName))
+	require.NoError(t, err)
+	assert.True(t, strings.Count(string(data), "\n") <= minCompactRecords, string(data))
+
+	// Another user of the database sees the changes
+	d2 := &db{dir: dir, dirs: make(map[string]*dirSums)}
+	got, err := d2.get("dir/file4", 99, t1)
+	require.NoError(t, err)
+	assert.Equal(t, hashes, got)
+	got, err = d2.get("dir/file0", 95, t1)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	// and this sees theirs
+	require.NoError(t, d2.put("dir/file0", 1, t1, hashes))
+	got, err = d.get("dir/file0", 1, t1)
+	require.NoError(t, err)
+	assert.Equal(t, hashes, got)
+
+	// A line cut short is ignored
+	f, err := os.OpenFile(filepath.Join(dir, "d.dir", sumsName), os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"name":"file1","ent`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	got, err = d.get("dir/file4", 99, t1)
+	require.NoError(t, err)
+	assert.Equal(t, hashes, got)
+	require.NoError(t, d.put("dir/file5", 5, t1, hashes))
+	got, err = d2.get("dir/file5", 5, t1)
+	require.NoError(t, err)
+	assert.Equal(t, hashes, got)
+}
@@ -111,7 +111,7 @@ func NewFs(name, root string) (fs.Fs, error) {
 		return nil, err
 	}
 
-	client := fs.Config.Client()
+	client := fs.Config.RemoteClient(name)
 
 	var isFile = false
 	if !strings.HasSuffix(u.String(), "/") {
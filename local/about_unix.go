@@ -0,0 +1,43 @@
+// Read the disk usage
+
+// +build darwin freebsd linux
+
+package local
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// About gets quota information
+func (f *Fs) About() (*fs.Usage, error) {
+	var s syscall.Statfs_t
+	// the root may not have been created yet so use the first
+	// directory above it which exists
+	root := f.root
+	for {
+		err := syscall.Statfs(root, &s)
+		if err == nil {
+			break
+		}
+		parent := filepath.Dir(root)
+		if !os.IsNotExist(err) || parent == root {
+			return nil, errors.Wrap(err, "failed to read disk usage")
+		}
+		root = parent
+	}
+	bs := int64(s.Bsize)
+	usage := &fs.Usage{
+		Total: bs * int64(s.Blocks),
+		Used:  bs * int64(s.Blocks-s.Bfree),
+		Free:  bs * int64(s.Bavail),
+	}
+	return usage, nil
+}
+
+// check interface
+var _ fs.Abouter = &Fs{}
@@ -335,6 +335,30 @@ func (f *Fs) PutStream(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption
 	return f.Put(in, src, options...)
 }
 
+// OpenWriterAt opens remote for random access writes, creating it
+// or truncating it if it exists
+func (f *Fs) OpenWriterAt(remote string, size int64) (fs.WriterAtCloser, error) {
+	// Temporary Object under construction
+	o := f.newObject(remote, "")
+	err := o.mkdirAll()
+	if err != nil {
+		return nil, err
+	}
+	out, err := os.OpenFile(o.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if size > 0 {
+		// Set the size now as the file will be written out of order
+		err = out.Truncate(size)
+		if err != nil {
+			_ = out.Close()
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
 // Mkdir creates the directory if it doesn't exist
 func (f *Fs) Mkdir(dir string) error {
 	// FIXME: https://github.com/syncthing/syncthing/blob/master/lib/osutil/mkdirall_windows.go
@@ -668,12 +692,14 @@ func (file *localOpenFile) Close() (err error) {
 
 // Open an object for read
 func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
-	var offset int64
+	var offset, limit int64 = 0, -1
 	hashes := fs.SupportedHashes
 	for _, option := range options {
 		switch x := option.(type) {
 		case *fs.SeekOption:
 			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(o.size)
 		case *fs.HashesOption:
 			hashes = x.Hashes
 		default:
@@ -687,11 +713,16 @@ func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
 	if err != nil {
 		return
 	}
+	wrappedFd := fs.NewLimitedReadCloser(fd, limit)
 	if offset != 0 {
 		// seek the object
 		_, err = fd.Seek(offset, 0)
 		// don't attempt to make checksums
-		return fd, err
+		return wrappedFd, err
+	}
+	if limit >= 0 {
+		// don't attempt to make checksums of partial reads
+		return wrappedFd, nil
 	}
 	hash, err := fs.NewMultiHasherTypes(hashes)
 	if err != nil {
@@ -909,10 +940,11 @@ func cleanWindowsName(f *Fs, name string) string {
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs          = &Fs{}
-	_ fs.Purger      = &Fs{}
-	_ fs.PutStreamer = &Fs{}
-	_ fs.Mover       = &Fs{}
-	_ fs.DirMover    = &Fs{}
-	_ fs.Object      = &Object{}
+	_ fs.Fs             = &Fs{}
+	_ fs.Purger         = &Fs{}
+	_ fs.PutStreamer    = &Fs{}
+	_ fs.Mover          = &Fs{}
+	_ fs.DirMover       = &Fs{}
+	_ fs.OpenWriterAter = &Fs{}
+	_ fs.Object         = &Object{}
 )
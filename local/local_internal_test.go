@@ -1,9 +1,13 @@
 package local
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/ncw/rclone/fs"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMapper(t *testing.T) {
@@ -18,3 +22,17 @@ func TestMapper(t *testing.T) {
 	assert.Equal(t, "potato", m.Load("potato"))
 	assert.Equal(t, "-r?'a´o¨", m.Load("-r'áö"))
 }
+
+func TestAbout(t *testing.T) {
+	// use a directory which doesn't exist yet
+	var f fs.Fs = &Fs{root: filepath.Join(os.TempDir(), "rclone-test-about-not-found")}
+	do, ok := f.(fs.Abouter)
+	if !ok {
+		t.Skip("About not supported on this OS")
+	}
+	usage, err := do.About()
+	require.NoError(t, err)
+	assert.True(t, usage.Total > 0)
+	assert.True(t, usage.Free >= 0 && usage.Free <= usage.Total)
+	assert.True(t, usage.Used >= 0 && usage.Used <= usage.Total)
+}
@@ -0,0 +1,629 @@
+// Package memory provides an interface to an in memory object storage system
+package memory
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "memory",
+		Description: "In memory object storage system.",
+		NewFs:       NewFs,
+		Options:     []fs.Option{},
+	})
+}
+
+// The storage is shared by all the memory remotes in the process.
+//
+// Like the object storage systems it is made of buckets holding
+// objects keyed on their full path within the bucket.  Directories
+// only exist as the prefixes of the object names.
+
+// objectData is the data and metadata of an object
+type objectData struct {
+	data     []byte
+	modTime  time.Time
+	hashes   map[fs.HashType]string
+	mimeType string
+}
+
+// bucket holds the objects in a bucket
+type bucket struct {
+	created time.Time
+	objects map[string]*objectData
+}
+
+var (
+	bucketsMu sync.RWMutex // protects the buckets and the objects in them
+	buckets   = map[string]*bucket{}
+)
+
+// Fs represents a remote memory server
+type Fs struct {
+	name     string       // name of this remote
+	root     string       // the path we are working on - the bucket and directory
+	features *fs.Features // optional features
+}
+
+// Object describes a memory object
+type Object struct {
+	fs     *Fs         // what this object is part of
+	remote string      // The remote path
+	od     *objectData // the object data
+}
+
+// ------------------------------------------------------------
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("Memory root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// parsePath splits the full path p into the bucket and the path
+// within it
+func parsePath(p string) (bucketName, bucketPath string) {
+	p = strings.Trim(p, "/")
+	if i := strings.IndexRune(p, '/'); i >= 0 {
+		return p[:i], p[i+1:]
+	}
+	return p, ""
+}
+
+// split returns the bucket and the path within it of remote
+func (f *Fs) split(remote string) (bucketName, bucketPath string) {
+	return parsePath(path.Join(f.root, remote))
+}
+
+// NewFs constructs an Fs from the path, bucket:path
+func NewFs(name, root string) (fs.Fs, error) {
+	root = strings.Trim(path.Clean(root), "/")
+	if root == "." {
+		root = ""
+	}
+	f := &Fs{
+		name: name,
+		root: root,
+	}
+	f.features = (&fs.Features{
+		ReadMimeType:  true,
+		WriteMimeType: true,
+		BucketBased:   true,
+	}).Fill(f)
+	if bucketName, bucketPath := parsePath(root); bucketPath != "" {
+		// Check to see if the object exists
+		bucketsMu.RLock()
+		b := buckets[bucketName]
+		isFile := b != nil && b.objects[bucketPath] != nil
+		bucketsMu.RUnlock()
+		if isFile {
+			f.root = path.Dir(root)
+			// return an error with an fs which points to the parent
+			return f, fs.ErrorIsFile
+		}
+	}
+	return f, nil
+}
+
+// newObject makes an Object at remote from od
+func (f *Fs) newObject(remote string, od *objectData) *Object {
+	return &Object{
+		fs:     f,
+		remote: remote,
+		od:     od,
+	}
+}
+
+// NewObject finds the Object at remote.  If it can't be found
+// it returns the error fs.ErrorObjectNotFound.
+func (f *Fs) NewObject(remote string) (fs.Object, error) {
+	bucketName, bucketPath := f.split(remote)
+	bucketsMu.RLock()
+	defer bucketsMu.RUnlock()
+	b := buckets[bucketName]
+	if b == nil || bucketPath == "" {
+		return nil, fs.ErrorObjectNotFound
+	}
+	od := b.objects[bucketPath]
+	if od == nil {
+		return nil, fs.ErrorObjectNotFound
+	}
+	return f.newObject(remote, od), nil
+}
+
+// listFn is called from list to handle an entry.
+type listFn func(entry fs.DirEntry) error
+
+// list the objects into the function supplied
+//
+// dir is the starting directory, "" for root
+//
+// Set recurse to read sub directories
+//
+// Call with the read lock held
+func (f *Fs) list(dir string, recurse bool, fn listFn) error {
+	bucketName, bucketPath := f.split(dir)
+	if bucketName == "" {
+		// list the buckets
+		for bucketName, b := range buckets {
+			remote := path.Join(dir, bucketName)
+			err := fn(fs.NewDir(remote, b.created))
+			if err != nil {
+				return err
+			}
+			if recurse {
+				err = f.list(remote, true, fn)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	b := buckets[bucketName]
+	if b == nil {
+		return fs.ErrorDirNotFound
+	}
+	prefix := bucketPath
+	if prefix != "" {
+		prefix += "/"
+	}
+	dirs := map[string]struct{}{}
+	for key, od := range b.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		leaf := key[len(prefix):]
+		if i := strings.IndexRune(leaf, '/'); i >= 0 && !recurse {
+			// the object is in a sub directory
+			leaf = leaf[:i]
+			if _, found := dirs[leaf]; found {
+				continue
+			}
+			dirs[leaf] = struct{}{}
+			err := fn(fs.NewDir(path.Join(dir, leaf), time.Time{}))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := fn(f.newObject(path.Join(dir, leaf), od))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(dir string) (entries fs.DirEntries, err error) {
+	bucketsMu.RLock()
+	defer bucketsMu.RUnlock()
+	err = f.list(dir, false, func(entry fs.DirEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ListR lists the objects and directories of the Fs starting
+// from dir recursively into out.
+//
+// dir should be "" to start from the root, and should not
+// have trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+//
+// It should call callback for each tranche of entries read.
+// These need not be returned in any particular order.  If
+// callback returns an error then the listing will stop
+// immediately.
+//
+// Don't implement this unless you have a more efficient way
+// of listing recursively that doing a directory traversal.
+func (f *Fs) ListR(dir string, callback fs.ListRCallback) (err error) {
+	// Read the entries first so the lock isn't held while
+	// calling back
+	var entries fs.DirEntries
+	bucketsMu.RLock()
+	err = f.list(dir, true, func(entry fs.DirEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	bucketsMu.RUnlock()
+	if err != nil {
+		return err
+	}
+	list := fs.NewListRHelper(callback)
+	for _, entry := range entries {
+		err = list.Add(entry)
+		if err != nil {
+			return err
+		}
+	}
+	return list.Flush()
+}
+
+// Put the Object into the bucket
+func (f *Fs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	// Temporary Object under construction
+	o := &Object{
+		fs:     f,
+		remote: src.Remote(),
+	}
+	return o, o.Update(in, src, options...)
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.Put(in, src, options...)
+}
+
+// makeBucket returns the bucket called bucketName creating it if
+// necessary
+//
+// Call with the write lock held
+func makeBucket(bucketName string) *bucket {
+	b := buckets[bucketName]
+	if b == nil {
+		b = &bucket{
+			created: time.Now(),
+			objects: map[string]*objectData{},
+		}
+		buckets[bucketName] = b
+	}
+	return b
+}
+
+// Mkdir creates the bucket if it doesn't exist
+func (f *Fs) Mkdir(dir string) error {
+	bucketName, _ := f.split(dir)
+	if bucketName == "" {
+		return nil
+	}
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	makeBucket(bucketName)
+	return nil
+}
+
+// Rmdir deletes the bucket if the fs is at the root
+//
+// Returns an error if it isn't empty
+func (f *Fs) Rmdir(dir string) error {
+	bucketName, bucketPath := f.split(dir)
+	if bucketName == "" || bucketPath != "" {
+		return nil
+	}
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	b := buckets[bucketName]
+	if b == nil {
+		return fs.ErrorDirNotFound
+	}
+	if len(b.objects) != 0 {
+		return fs.ErrorDirectoryNotEmpty
+	}
+	delete(buckets, bucketName)
+	return nil
+}
+
+// Precision of the remote
+func (f *Fs) Precision() time.Duration {
+	return time.Nanosecond
+}
+
+// Purge deletes all the files and directories including the old versions.
+func (f *Fs) Purge() error {
+	bucketName, bucketPath := f.split("")
+	if bucketName == "" {
+		return errors.New("can't purge all the buckets")
+	}
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	b := buckets[bucketName]
+	if b == nil {
+		return fs.ErrorDirNotFound
+	}
+	if bucketPath == "" {
+		delete(buckets, bucketName)
+		return nil
+	}
+	prefix := bucketPath + "/"
+	found := false
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) {
+			delete(b.objects, key)
+			found = true
+		}
+	}
+	if !found {
+		return fs.ErrorDirNotFound
+	}
+	return nil
+}
+
+// Copy src to this remote using server side copy operations.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't copy - not same remote type")
+		return nil, fs.ErrorCantCopy
+	}
+	bucketName, bucketPath := f.split(remote)
+	if bucketName == "" || bucketPath == "" {
+		return nil, errors.New("can't copy to a bucket")
+	}
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	od := *srcObj.od // the data is never modified so can be shared
+	makeBucket(bucketName).objects[bucketPath] = &od
+	return f.newObject(remote, &od), nil
+}
+
+// Move src to this remote using server side move operations.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't move - not same remote type")
+		return nil, fs.ErrorCantMove
+	}
+	dstObj, err := f.Copy(src, remote)
+	if err != nil {
+		return nil, err
+	}
+	if path.Join(srcObj.fs.root, srcObj.remote) == path.Join(f.root, remote) {
+		return dstObj, nil
+	}
+	err = srcObj.Remove()
+	if err != nil {
+		return nil, err
+	}
+	return dstObj, nil
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(src fs.Fs, srcRemote, dstRemote string) error {
+	srcFs, ok := src.(*Fs)
+	if !ok {
+		fs.Debugf(srcFs, "Can't move directory - not same remote type")
+		return fs.ErrorCantDirMove
+	}
+	srcBucketName, srcPath := srcFs.split(srcRemote)
+	dstBucketName, dstPath := f.split(dstRemote)
+	if srcBucketName == "" || dstBucketName == "" {
+		return errors.New("can't move buckets")
+	}
+	if srcBucketName == dstBucketName && srcPath == dstPath {
+		return fs.ErrorDirExists
+	}
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	srcBucket := buckets[srcBucketName]
+	if srcBucket == nil {
+		return fs.ErrorDirNotFound
+	}
+	dstBucket := makeBucket(dstBucketName)
+	srcPrefix, dstPrefix := srcPath, dstPath
+	if srcPrefix != "" {
+		srcPrefix += "/"
+	}
+	if dstPrefix != "" {
+		dstPrefix += "/"
+	}
+	for key := range dstBucket.objects {
+		if strings.HasPrefix(key, dstPrefix) {
+			return fs.ErrorDirExists
+		}
+	}
+	for key, od := range srcBucket.objects {
+		if strings.HasPrefix(key, srcPrefix) {
+			delete(srcBucket.objects, key)
+			dstBucket.objects[dstPrefix+key[len(srcPrefix):]] = od
+		}
+	}
+	return nil
+}
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() fs.HashSet {
+	return fs.NewHashSet(fs.HashMD5, fs.HashSHA1)
+}
+
+// ------------------------------------------------------------
+
+// Fs returns the parent Fs
+func (o *Object) Fs() fs.Info {
+	return o.fs
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Hash returns the hash of an object returning a lowercase hex string
+func (o *Object) Hash(t fs.HashType) (string, error) {
+	if t != fs.HashMD5 && t != fs.HashSHA1 {
+		return "", fs.ErrHashUnsupported
+	}
+	return o.od.hashes[t], nil
+}
+
+// Size returns the size of an object in bytes
+func (o *Object) Size() int64 {
+	return int64(len(o.od.data))
+}
+
+// ModTime returns the modification time of the object
+func (o *Object) ModTime() time.Time {
+	bucketsMu.RLock()
+	defer bucketsMu.RUnlock()
+	return o.od.modTime
+}
+
+// SetModTime sets the modification time of the local fs object
+func (o *Object) SetModTime(modTime time.Time) error {
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	o.od.modTime = modTime
+	return nil
+}
+
+// Storable raturns a boolean indicating if this object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// Open an object for read
+func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
+	data := o.od.data
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(int64(len(data)))
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if limit >= 0 && limit < int64(len(data)) {
+		data = data[:limit]
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Update the Object from in with modTime and size
+func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	bucketName, bucketPath := o.fs.split(o.remote)
+	if bucketName == "" || bucketPath == "" {
+		return errors.New("can't upload to a bucket")
+	}
+	hasher, err := fs.NewMultiHasherTypes(o.fs.Hashes())
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(io.TeeReader(in, hasher))
+	if err != nil {
+		return errors.Wrap(err, "failed to read data")
+	}
+	od := &objectData{
+		data:     data,
+		modTime:  src.ModTime(),
+		hashes:   hasher.Sums(),
+		mimeType: fs.MimeType(src),
+	}
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	makeBucket(bucketName).objects[bucketPath] = od
+	o.od = od
+	return nil
+}
+
+// Remove an object
+func (o *Object) Remove() error {
+	bucketName, bucketPath := o.fs.split(o.remote)
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	b := buckets[bucketName]
+	if b == nil || b.objects[bucketPath] == nil {
+		return fs.ErrorObjectNotFound
+	}
+	delete(b.objects, bucketPath)
+	return nil
+}
+
+// MimeType of an Object if known, "" otherwise
+func (o *Object) MimeType() string {
+	return o.od.mimeType
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs          = &Fs{}
+	_ fs.Purger      = &Fs{}
+	_ fs.Copier      = &Fs{}
+	_ fs.Mover       = &Fs{}
+	_ fs.DirMover    = &Fs{}
+	_ fs.PutStreamer = &Fs{}
+	_ fs.ListRer     = &Fs{}
+	_ fs.Object      = &Object{}
+	_ fs.MimeTyper   = &Object{}
+)
@@ -0,0 +1,12 @@
+package memory_test
+
+import (
+	"github.com/ncw/rclone/fstest/fstests"
+)
+
+// Create the TestMemory: remote
+func init() {
+	fstests.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: "TestMemory", Key: "type", Value: "memory"},
+	}
+}
@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// putFile uploads contents to remote through f
+func putFile(t *testing.T, f fs.Fs, remote, contents string) fs.Object {
+	src := fs.NewStaticObjectInfo(remote, fstest.Time("2001-02-03T04:05:06.123456789Z"), int64(len(contents)), true, nil, nil)
+	o, err := f.Put(strings.NewReader(contents), src)
+	require.NoError(t, err)
+	return o
+}
+
+// remotes returns the sorted remotes of entries
+func remotes(entries fs.DirEntries) (names []string) {
+	for _, entry := range entries {
+		names = append(names, entry.Remote())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestBuckets(t *testing.T) {
+	root, err := NewFs("memory", "")
+	require.NoError(t, err)
+	f, err := NewFs("memory", "test-buckets")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, f.Features().Purge())
+	}()
+
+	// Listing a bucket which doesn't exist is an error
+	_, err = f.List("")
+	assert.Equal(t, fs.ErrorDirNotFound, err)
+
+	o := putFile(t, f, "dir/file.txt", "hello")
+	assert.True(t, fstest.Time("2001-02-03T04:05:06.123456789Z").Equal(o.ModTime()))
+	entries, err := root.List("")
+	require.NoError(t, err)
+	assert.Contains(t, remotes(entries), "test-buckets")
+	entries, err = root.List("test-buckets")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test-buckets/dir"}, remotes(entries))
+
+	// The storage is shared between remotes
+	other, err := NewFs("other", "test-buckets/dir/file.txt")
+	assert.Equal(t, fs.ErrorIsFile, err)
+	assert.Equal(t, "test-buckets/dir", other.Root())
+	o, err = other.NewObject("file.txt")
+	require.NoError(t, err)
+	in, err := o.Open(&fs.RangeOption{Start: 1, End: 3})
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(in)
+	require.NoError(t, err)
+	assert.Equal(t, "ell", string(data))
+
+	// Buckets can only be removed when empty
+	assert.Equal(t, fs.ErrorDirectoryNotEmpty, f.Rmdir(""))
+	require.NoError(t, f.Features().DirMove(f, "dir", "newdir"))
+	var names []string
+	require.NoError(t, f.Features().ListR("", func(entries fs.DirEntries) error {
+		names = append(names, remotes(entries)...)
+		return nil
+	}))
+	assert.Equal(t, []string{"newdir/file.txt"}, names)
+}
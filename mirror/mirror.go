@@ -0,0 +1,641 @@
+// Package mirror implements a virtual provider which writes every
+// object to several remotes.
+package mirror
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// Policies for what happens when a change only works on some of the
+// upstreams
+const (
+	failureFail     = "fail"     // return an error
+	failureDegraded = "degraded" // log the failures and succeed
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "mirror",
+		Description: "Mirror writes every object to several remotes",
+		NewFs:       NewFs,
+		Options: []fs.Option{{
+			Name: "remotes",
+			Help: "List of space separated remotes.\nCan be 'remotea:test/dir remoteb:', '\"remotea:test/space dir\" remoteb:', etc.\nReads come from the first remote listed which works.",
+		}, {
+			Name:     "failure_policy",
+			Help:     "What to do if a change works on some of the remotes but not others.",
+			Optional: true,
+			Examples: []fs.OptionExample{{
+				Value: failureFail,
+				Help:  "Return an error.",
+			}, {
+				Value: failureDegraded,
+				Help:  "Log the failures and carry on - use \"rclone repair\" to fix the remotes afterwards.",
+			}},
+		}},
+	})
+}
+
+// Fs represents a mirror of remotes
+type Fs struct {
+	name          string       // name of this remote
+	root          string       // the path we are working on
+	features      *fs.Features // optional features
+	upstreams     []fs.Fs      // the upstream remotes in order of preference
+	failurePolicy string       // what to do if only some upstreams fail
+}
+
+// parseRemotes splits the remotes config value into a list of
+// remotes, allowing remotes with spaces in to be quoted
+func parseRemotes(value string) (remotes []string, err error) {
+	var (
+		current  []rune
+		inQuotes bool
+		inWord   bool
+	)
+	for _, c := range value {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+			inWord = true
+		case c == ' ' && !inQuotes:
+			if inWord {
+				remotes = append(remotes, string(current))
+			}
+			current, inWord = current[:0], false
+		default:
+			current = append(current, c)
+			inWord = true
+		}
+	}
+	if inQuotes {
+		return nil, errors.Errorf("unterminated quote in remotes %q", value)
+	}
+	if inWord {
+		remotes = append(remotes, string(current))
+	}
+	return remotes, nil
+}
+
+// newUpstreams makes the Fs for each of the remotes at root
+//
+// If root is a file on any of the remotes it returns fs.ErrorIsFile
+func newUpstreams(remotes []string, root string) (fss []fs.Fs, err error) {
+	isFile := false
+	for _, remote := range remotes {
+		remotePath := path.Join(remote, root)
+		f, err := fs.NewFs(remotePath)
+		if err == fs.ErrorIsFile {
+			isFile = true
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "failed to make remote %q to mirror", remotePath)
+		}
+		fss = append(fss, f)
+	}
+	if isFile {
+		return fss, fs.ErrorIsFile
+	}
+	return fss, nil
+}
+
+// NewFs constructs an Fs from the path.
+//
+// The returned Fs is the actual Fs, referenced by remote in the config
+func NewFs(name, root string) (fs.Fs, error) {
+	remotes, err := parseRemotes(fs.ConfigFileGet(name, "remotes"))
+	if err != nil {
+		return nil, err
+	}
+	if len(remotes) == 0 {
+		return nil, errors.New("remotes not set in config file")
+	}
+	for _, remote := range remotes {
+		if strings.HasPrefix(remote, name+":") {
+			return nil, errors.New("can't point mirror remote at itself - check the value of the remotes setting")
+		}
+	}
+	failurePolicy := fs.ConfigFileGet(name, "failure_policy", failureFail)
+	switch failurePolicy {
+	case failureFail, failureDegraded:
+	default:
+		return nil, errors.Errorf("unknown failure_policy %q", failurePolicy)
+	}
+	root = strings.Trim(root, "/")
+	upstreams, err := newUpstreams(remotes, root)
+	if err == fs.ErrorIsFile {
+		// the root is a file so point all the remotes at the
+		// directory it is in
+		root = path.Dir(root)
+		if root == "." {
+			root = ""
+		}
+		upstreams, err = newUpstreams(remotes, root)
+		if err == nil {
+			err = fs.ErrorIsFile
+		}
+	}
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, err
+	}
+	f := &Fs{
+		name:          name,
+		root:          root,
+		upstreams:     upstreams,
+		failurePolicy: failurePolicy,
+	}
+	// the features here are ones we could support, and they are
+	// ANDed with the ones from each of the remotes
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		ReadMimeType:            false,
+		WriteMimeType:           false,
+		BucketBased:             true,
+		CanHaveEmptyDirectories: true,
+	}).Fill(f)
+	for _, upstream := range f.upstreams {
+		f.features.Mask(upstream)
+	}
+	return f, err
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("mirror root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Upstreams returns the remotes being mirrored in order of preference
+func (f *Fs) Upstreams() []fs.Fs {
+	return f.upstreams
+}
+
+// Precision is the coarsest precision of all the upstreams
+func (f *Fs) Precision() time.Duration {
+	var precision time.Duration
+	for _, upstream := range f.upstreams {
+		if p := upstream.Precision(); p > precision {
+			precision = p
+		}
+	}
+	return precision
+}
+
+// Hashes returns the hashes supported by all the upstreams
+func (f *Fs) Hashes() fs.HashSet {
+	var hashes fs.HashSet
+	for i, upstream := range f.upstreams {
+		if i == 0 {
+			hashes = upstream.Hashes()
+		} else {
+			hashes = hashes.Overlap(upstream.Hashes())
+		}
+	}
+	return hashes
+}
+
+// checkErrors returns the error for an operation called what which
+// was run on all the upstreams, errs having the error from each.
+//
+// If all the upstreams failed, or some did and the failure policy is
+// fail, then it returns the first error.  Otherwise the failures are
+// logged and the mirror carries on in a degraded state.
+func (f *Fs) checkErrors(what string, errs []error) error {
+	var firstErr error
+	failed := 0
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		failed++
+		if firstErr == nil {
+			firstErr = errors.Wrapf(err, "failed to %s on %v", what, f.upstreams[i])
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	if f.failurePolicy != failureDegraded || failed == len(errs) {
+		return firstErr
+	}
+	for i, err := range errs {
+		if err != nil {
+			fs.Errorf(f.upstreams[i], "Mirror degraded: failed to %s: %v - run \"rclone repair\" to fix", what, err)
+		}
+	}
+	return nil
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// The listing comes from the first upstream which has the directory,
+// as it may be missing from upstreams which failed to make it when
+// the mirror was degraded.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(dir string) (entries fs.DirEntries, err error) {
+	notFound := false
+	for i, upstream := range f.upstreams {
+		upstreamEntries, listErr := upstream.List(dir)
+		if listErr == fs.ErrorDirNotFound {
+			notFound = true
+			continue
+		}
+		if listErr != nil {
+			fs.Debugf(upstream, "Failed to list %q, trying next upstream: %v", dir, listErr)
+			err = listErr
+			continue
+		}
+		for _, entry := range upstreamEntries {
+			switch x := entry.(type) {
+			case fs.Object:
+				entries = append(entries, f.newObject(x, i))
+			case fs.Directory:
+				entries = append(entries, fs.NewDir(x.Remote(), x.ModTime()))
+			default:
+				return nil, errors.Errorf("unknown object type %T", entry)
+			}
+		}
+		return entries, nil
+	}
+	if notFound {
+		return nil, fs.ErrorDirNotFound
+	}
+	return nil, errors.Wrapf(err, "failed to list %q on any upstream", dir)
+}
+
+// NewObject finds the Object at remote on the first upstream which
+// has it, as it may be missing from upstreams which failed to write
+// it when the mirror was degraded.  If it can't be found on any of
+// the upstreams which work it returns the error
+// fs.ErrorObjectNotFound.
+func (f *Fs) NewObject(remote string) (o fs.Object, err error) {
+	var notFoundErr error
+	for i, upstream := range f.upstreams {
+		obj, findErr := upstream.NewObject(remote)
+		if findErr == fs.ErrorObjectNotFound || findErr == fs.ErrorNotAFile {
+			if notFoundErr == nil {
+				notFoundErr = findErr
+			}
+			continue
+		}
+		if findErr != nil {
+			fs.Debugf(upstream, "Failed to find %q, trying next upstream: %v", remote, findErr)
+			err = findErr
+			continue
+		}
+		return f.newObject(obj, i), nil
+	}
+	if notFoundErr != nil {
+		return nil, notFoundErr
+	}
+	return nil, errors.Wrapf(err, "failed to find %q on any upstream", remote)
+}
+
+// errUploadFinished is returned to the writer of an upload which the
+// upstream has stopped reading
+var errUploadFinished = errors.New("upload finished")
+
+// upload sends in to all the upstreams at once, calling fn for each
+// upstream with a reader of the data.  It returns the object made on
+// each upstream and the error from each.
+//
+// The data is only read from in once so it is accounted properly.
+func (f *Fs) upload(in io.Reader, fn func(i int, upstream fs.Fs, in io.Reader) (fs.Object, error)) ([]fs.Object, []error) {
+	var (
+		n       = len(f.upstreams)
+		objs    = make([]fs.Object, n)
+		errs    = make([]error, n)
+		writers = make([]*io.PipeWriter, n)
+		wg      sync.WaitGroup
+	)
+	wg.Add(n)
+	for i, upstream := range f.upstreams {
+		pr, pw := io.Pipe()
+		writers[i] = pw
+		go func(i int, upstream fs.Fs, pr *io.PipeReader) {
+			defer wg.Done()
+			objs[i], errs[i] = fn(i, upstream, pr)
+			// Make any further writes to this upstream fail
+			_ = pr.CloseWithError(errUploadFinished)
+		}(i, upstream, pr)
+	}
+	readErr := fanOut(in, writers)
+	for _, pw := range writers {
+		// Closes with io.EOF if readErr is nil
+		_ = pw.CloseWithError(readErr)
+	}
+	wg.Wait()
+	return objs, errs
+}
+
+// fanOut copies in to all the writers, dropping any writer which
+// fails.  It returns any error reading in.
+func fanOut(in io.Reader, writers []*io.PipeWriter) error {
+	live := append([]*io.PipeWriter(nil), writers...)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			writing := 0
+			for i, w := range live {
+				if w == nil {
+					continue
+				}
+				if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+					live[i] = nil
+					continue
+				}
+				writing++
+			}
+			if writing == 0 {
+				// all the uploads have failed so stop reading
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// firstObject returns the first of the objects which was made
+// without error
+func (f *Fs) firstObject(objs []fs.Object, errs []error) *Object {
+	for i, obj := range objs {
+		if errs[i] == nil && obj != nil {
+			return f.newObject(obj, i)
+		}
+	}
+	return nil
+}
+
+// put uploads in to all the upstreams with put
+func (f *Fs) put(in io.Reader, src fs.ObjectInfo, what string, put func(upstream fs.Fs) func(io.Reader, fs.ObjectInfo, ...fs.OpenOption) (fs.Object, error), options ...fs.OpenOption) (fs.Object, error) {
+	objs, errs := f.upload(in, func(i int, upstream fs.Fs, in io.Reader) (fs.Object, error) {
+		return put(upstream)(in, src, options...)
+	})
+	err := f.checkErrors(fmt.Sprintf("%s %q", what, src.Remote()), errs)
+	o := f.firstObject(objs, errs)
+	if o == nil {
+		return nil, err
+	}
+	return o, err
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// The data is uploaded to all the upstreams at once.
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(in, src, "upload", func(upstream fs.Fs) func(io.Reader, fs.ObjectInfo, ...fs.OpenOption) (fs.Object, error) {
+		return upstream.Put
+	}, options...)
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(in, src, "upload", func(upstream fs.Fs) func(io.Reader, fs.ObjectInfo, ...fs.OpenOption) (fs.Object, error) {
+		return upstream.Features().PutStream
+	}, options...)
+}
+
+// Mkdir makes the directory on all the upstreams
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(dir string) error {
+	errs := make([]error, len(f.upstreams))
+	for i, upstream := range f.upstreams {
+		errs[i] = upstream.Mkdir(dir)
+	}
+	return f.checkErrors(fmt.Sprintf("make directory %q", dir), errs)
+}
+
+// dirExists returns whether dir exists on the upstream
+func dirExists(upstream fs.Fs, dir string) bool {
+	_, err := upstream.List(dir)
+	return err == nil
+}
+
+// Rmdir removes the directory from all the upstreams it is on
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(dir string) error {
+	found := false
+	errs := make([]error, len(f.upstreams))
+	for i, upstream := range f.upstreams {
+		err := upstream.Rmdir(dir)
+		if err != nil && !dirExists(upstream, dir) {
+			continue
+		}
+		found = true
+		errs[i] = err
+	}
+	if !found {
+		return fs.ErrorDirNotFound
+	}
+	return f.checkErrors(fmt.Sprintf("remove directory %q", dir), errs)
+}
+
+// Purge all files in the root and the root directory on all the
+// upstreams
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge() error {
+	// Check first so no upstream is purged unless they all can be
+	for _, upstream := range f.upstreams {
+		if upstream.Features().Purge == nil {
+			return fs.ErrorCantPurge
+		}
+	}
+	found := false
+	errs := make([]error, len(f.upstreams))
+	for i, upstream := range f.upstreams {
+		err := upstream.Features().Purge()
+		if err != nil && !dirExists(upstream, "") {
+			continue
+		}
+		found = true
+		errs[i] = err
+	}
+	if !found {
+		return fs.ErrorDirNotFound
+	}
+	return f.checkErrors("purge", errs)
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+//
+// This is the first of the upstreams as that is the one reads come
+// from
+func (f *Fs) UnWrap() fs.Fs {
+	return f.upstreams[0]
+}
+
+// Object describes a mirror Object
+//
+// This is the Object on the upstream it was found on
+type Object struct {
+	fs.Object
+	f        *Fs
+	upstream int // index of the upstream the Object is on
+}
+
+// newObject wraps o which is on the i-th upstream
+func (f *Fs) newObject(o fs.Object, i int) *Object {
+	return &Object{
+		Object:   o,
+		f:        f,
+		upstream: i,
+	}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// String returns a description of the Object
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.Object.String()
+}
+
+// Open an object for read
+//
+// If it can't be opened on the upstream it was found on the other
+// upstreams are tried in turn.
+func (o *Object) Open(options ...fs.OpenOption) (io.ReadCloser, error) {
+	in, err := o.Object.Open(options...)
+	if err == nil {
+		return in, nil
+	}
+	for i, upstream := range o.f.upstreams {
+		if i == o.upstream {
+			continue
+		}
+		fs.Debugf(o, "Failed to open on %v, trying %v: %v", o.f.upstreams[o.upstream], upstream, err)
+		obj, findErr := upstream.NewObject(o.Remote())
+		if findErr != nil {
+			continue
+		}
+		in, openErr := obj.Open(options...)
+		if openErr == nil {
+			return in, nil
+		}
+	}
+	return nil, err
+}
+
+// forEach calls fn with the copy of the object on each upstream it
+// is on, returning the error from each
+func (o *Object) forEach(fn func(obj fs.Object) error) []error {
+	errs := make([]error, len(o.f.upstreams))
+	for i, upstream := range o.f.upstreams {
+		if i == o.upstream {
+			errs[i] = fn(o.Object)
+			continue
+		}
+		obj, err := upstream.NewObject(o.Remote())
+		if err == fs.ErrorObjectNotFound {
+			continue
+		}
+		if err == nil {
+			err = fn(obj)
+		}
+		errs[i] = err
+	}
+	return errs
+}
+
+// Update the object on all the upstreams with the contents of the
+// io.Reader, modTime and size
+//
+// Upstreams which don't have the object have it created.
+func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	objs, errs := o.f.upload(in, func(i int, upstream fs.Fs, in io.Reader) (fs.Object, error) {
+		if i == o.upstream {
+			return o.Object, o.Object.Update(in, src, options...)
+		}
+		obj, err := upstream.NewObject(o.Remote())
+		if err == fs.ErrorObjectNotFound {
+			return upstream.Put(in, src, options...)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return obj, obj.Update(in, src, options...)
+	})
+	if newO := o.f.firstObject(objs, errs); newO != nil {
+		o.Object, o.upstream = newO.Object, newO.upstream
+	}
+	return o.f.checkErrors(fmt.Sprintf("update %q", o.Remote()), errs)
+}
+
+// SetModTime sets the modification time of the object on all the
+// upstreams
+func (o *Object) SetModTime(modTime time.Time) error {
+	errs := o.forEach(func(obj fs.Object) error {
+		return obj.SetModTime(modTime)
+	})
+	return o.f.checkErrors(fmt.Sprintf("set modification time of %q", o.Remote()), errs)
+}
+
+// Remove the object from all the upstreams
+func (o *Object) Remove() error {
+	errs := o.forEach(func(obj fs.Object) error {
+		return obj.Remove()
+	})
+	return o.f.checkErrors(fmt.Sprintf("remove %q", o.Remote()), errs)
+}
+
+// UnWrap returns the wrapped Object
+func (o *Object) UnWrap() fs.Object {
+	return o.Object
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs          = (*Fs)(nil)
+	_ fs.Purger      = (*Fs)(nil)
+	_ fs.PutStreamer = (*Fs)(nil)
+	_ fs.UnWrapper   = (*Fs)(nil)
+	_ fs.Object      = (*Object)(nil)
+)
@@ -0,0 +1,22 @@
+package mirror_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ncw/rclone/fstest/fstests"
+)
+
+// Create the TestMirror: remote
+func init() {
+	var remotes []string
+	for _, leaf := range []string{"a", "b"} {
+		remotes = append(remotes, filepath.Join(os.TempDir(), "rclone-mirror-test-"+leaf))
+	}
+	name := "TestMirror"
+	fstests.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "mirror"},
+		{Name: name, Key: "remotes", Value: strings.Join(remotes, " ")},
+	}
+}
@@ -0,0 +1,210 @@
+package mirror
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/ncw/rclone/cas"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	_ "github.com/ncw/rclone/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFs makes a mirror of the directories with the failure
+// policy given
+func newTestFs(t *testing.T, failurePolicy string, dirs ...string) *Fs {
+	f, err := fstest.NewConfiguredFs("TestMirrorInternal", "type", "mirror", "remotes", strings.Join(dirs, " "), "failure_policy", failurePolicy)
+	require.NoError(t, err)
+	return f.(*Fs)
+}
+
+// newBrokenDir returns a directory path inside a file so nothing can
+// be written to it
+func newBrokenDir(t *testing.T, dir string) string {
+	file := filepath.Join(dir, "broken")
+	require.NoError(t, ioutil.WriteFile(file, []byte("not a directory"), 0666))
+	return filepath.Join(file, "dir")
+}
+
+// readFile reads a file from the local directory returning "" if it
+// doesn't exist
+func readFile(dir, name string) string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// putFile uploads contents to remote through f
+func putFile(f fs.Fs, remote, contents string) (fs.Object, error) {
+	src := fs.NewStaticObjectInfo(remote, time.Now(), int64(len(contents)), true, nil, nil)
+	return f.Put(strings.NewReader(contents), src)
+}
+
+func TestBadPolicy(t *testing.T) {
+	name := "TestMirrorBadPolicy"
+	_, err := fstest.NewConfiguredFs(name, "type", "mirror", "remotes", os.TempDir(), "failure_policy", "potato")
+	assert.Error(t, err)
+	_, err = fstest.NewConfiguredFs(name, "remotes", name+":dir", "failure_policy", "")
+	assert.Error(t, err)
+}
+
+func TestWritesGoEverywhere(t *testing.T) {
+	dirs, cleanup := fstest.NewLocalDirs(t, 3)
+	defer cleanup()
+	f := newTestFs(t, "", dirs...)
+
+	require.NoError(t, f.Mkdir("dir"))
+	o, err := putFile(f, "dir/file.txt", "hello world")
+	require.NoError(t, err)
+	for _, dir := range dirs {
+		assert.Equal(t, "hello world", readFile(dir, "dir/file.txt"), dir)
+	}
+
+	src := fs.NewStaticObjectInfo("dir/file.txt", time.Now(), 7, true, nil, nil)
+	require.NoError(t, o.Update(strings.NewReader("updated"), src))
+	for _, dir := range dirs {
+		assert.Equal(t, "updated", readFile(dir, "dir/file.txt"), dir)
+	}
+
+	// An upstream missing the file has it made by an update
+	require.NoError(t, os.Remove(filepath.Join(dirs[2], "dir/file.txt")))
+	src = fs.NewStaticObjectInfo("dir/file.txt", time.Now(), 5, true, nil, nil)
+	require.NoError(t, o.Update(strings.NewReader("again"), src))
+	for _, dir := range dirs {
+		assert.Equal(t, "again", readFile(dir, "dir/file.txt"), dir)
+	}
+
+	require.NoError(t, o.Remove())
+	require.NoError(t, f.Rmdir("dir"))
+	for _, dir := range dirs {
+		_, err := os.Stat(filepath.Join(dir, "dir"))
+		assert.True(t, os.IsNotExist(err), dir)
+	}
+	assert.Equal(t, fs.ErrorDirNotFound, f.Rmdir("dir"))
+}
+
+func TestReadFallback(t *testing.T) {
+	dirs, cleanup := fstest.NewLocalDirs(t, 2)
+	defer cleanup()
+	f := newTestFs(t, "", dirs...)
+
+	_, err := putFile(f, "file.txt", "hello world")
+	require.NoError(t, err)
+	o, err := f.NewObject("file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, 0, o.(*Object).upstream)
+
+	// The file vanishes from the first upstream after it was found
+	require.NoError(t, os.Remove(filepath.Join(dirs[0], "file.txt")))
+	in, err := o.Open()
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "hello world", string(data))
+}
+
+func TestFailurePolicy(t *testing.T) {
+	dirs, cleanup := fstest.NewLocalDirs(t, 1)
+	defer cleanup()
+	broken := newBrokenDir(t, dirs[0])
+
+	// fail returns an error but the file is on the working upstream
+	f := newTestFs(t, failureFail, dirs[0], broken)
+	o, err := putFile(f, "file.txt", "hello")
+	assert.Error(t, err)
+	require.NotNil(t, o)
+	assert.Equal(t, "hello", readFile(dirs[0], "file.txt"))
+	assert.Error(t, f.Mkdir("dir"))
+
+	// degraded carries on if any upstream worked
+	f = newTestFs(t, failureDegraded, dirs[0], broken)
+	o, err = putFile(f, "file2.txt", "hello again")
+	require.NoError(t, err)
+	assert.Equal(t, "hello again", readFile(dirs[0], "file2.txt"))
+	assert.Equal(t, "hello again", fstest.ReadObject(t, f, "file2.txt"))
+	require.NoError(t, o.Remove())
+	assert.Equal(t, "", readFile(dirs[0], "file2.txt"))
+	require.NoError(t, f.Mkdir("dir2"))
+
+	// but not if they all failed
+	f = newTestFs(t, failureDegraded, broken, broken)
+	_, err = putFile(f, "file3.txt", "hello")
+	assert.Error(t, err)
+}
+
+func TestDegradedRead(t *testing.T) {
+	dirs, cleanup := fstest.NewLocalDirs(t, 2)
+	defer cleanup()
+	broken := newBrokenDir(t, dirs[1])
+	f := newTestFs(t, failureDegraded, broken, dirs[0])
+	_, err := putFile(f, "dir/file.txt", "hello")
+	require.NoError(t, err)
+
+	// The first upstream works again but is missing the file so
+	// it is read from the second
+	require.NoError(t, os.Remove(filepath.Join(dirs[1], "broken")))
+	assert.Equal(t, "hello", fstest.ReadObject(t, f, "dir/file.txt"))
+	entries, err := f.List("dir")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, "dir/file.txt", entries[0].Remote())
+
+	_, err = f.NewObject("dir/missing.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+	_, err = f.List("missing")
+	assert.Equal(t, fs.ErrorDirNotFound, err)
+}
+
+func TestRepair(t *testing.T) {
+	dirs, cleanup := fstest.NewLocalDirs(t, 3)
+	defer cleanup()
+	old := fstest.Time("2001-02-03T04:05:06Z")
+	recent := fstest.Time("2011-12-13T14:15:16Z")
+
+	fstest.WriteFile(t, dirs[0], "same.txt", "same", old)
+	fstest.WriteFile(t, dirs[1], "same.txt", "same", old)
+	fstest.WriteFile(t, dirs[2], "same.txt", "same", old)
+	fstest.WriteFile(t, dirs[1], "missing/file.txt", "only on b", old)
+	fstest.WriteFile(t, dirs[0], "changed.txt", "old version", old)
+	fstest.WriteFile(t, dirs[1], "changed.txt", "new version", recent)
+	require.NoError(t, os.MkdirAll(filepath.Join(dirs[2], "empty"), 0777))
+
+	f := newTestFs(t, "", dirs...)
+	require.NoError(t, f.Repair())
+
+	for _, dir := range dirs {
+		assert.Equal(t, "same", readFile(dir, "same.txt"), dir)
+		assert.Equal(t, "only on b", readFile(dir, "missing/file.txt"), dir)
+		assert.Equal(t, "new version", readFile(dir, "changed.txt"), dir)
+		fi, err := os.Stat(filepath.Join(dir, "empty"))
+		require.NoError(t, err, dir)
+		assert.True(t, fi.IsDir(), dir)
+	}
+
+	// Nothing to do the second time
+	require.NoError(t, f.Repair())
+}
+
+func TestPurgeUnsupported(t *testing.T) {
+	dirs, cleanup := fstest.NewLocalDirs(t, 2)
+	defer cleanup()
+	fstest.WriteFile(t, dirs[0], "file.txt", "contents", fstest.Time("2001-02-03T04:05:06Z"))
+
+	// cas remotes can't purge
+	_, err := fstest.NewConfiguredFs("TestMirrorInternalCas", "type", "cas", "remote", dirs[1])
+	require.NoError(t, err)
+	f := newTestFs(t, "", dirs[0], "TestMirrorInternalCas:")
+	assert.Equal(t, fs.ErrorCantPurge, f.Purge())
+
+	// nothing was purged from the upstreams which can
+	assert.Equal(t, "contents", readFile(dirs[0], "file.txt"))
+}
@@ -0,0 +1,123 @@
+package mirror
+
+import (
+	"sort"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// contents is what is on an upstream
+type contents struct {
+	objs map[string]fs.Object // files by remote
+	dirs map[string]bool      // directories
+}
+
+// readContents lists everything on upstream
+func readContents(upstream fs.Fs) (*contents, error) {
+	c := &contents{
+		objs: map[string]fs.Object{},
+		dirs: map[string]bool{},
+	}
+	objs, dirs, err := fs.WalkGetAll(upstream, "", true, -1)
+	if err == fs.ErrorDirNotFound {
+		return c, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list %v", upstream)
+	}
+	for _, o := range objs {
+		c.objs[o.Remote()] = o
+	}
+	for _, dir := range dirs {
+		c.dirs[dir.Remote()] = true
+	}
+	return c, nil
+}
+
+// Repair makes the upstreams the same again after they have
+// diverged, eg after changes have failed on some of them with the
+// degraded failure policy.
+//
+// Files missing from or different on some of the upstreams are
+// copied to them from the upstream with the newest version, the
+// first upstream listed winning if they are the same age, and missing
+// directories are made.  Nothing is ever deleted.
+func (f *Fs) Repair() error {
+	fs.CalculateModifyWindow(f.upstreams...)
+	all := make([]*contents, len(f.upstreams))
+	var dirNames, objNames []string
+	seenDirs, seenObjs := map[string]bool{}, map[string]bool{}
+	for i, upstream := range f.upstreams {
+		c, err := readContents(upstream)
+		if err != nil {
+			return err
+		}
+		all[i] = c
+		for dir := range c.dirs {
+			if !seenDirs[dir] {
+				seenDirs[dir] = true
+				dirNames = append(dirNames, dir)
+			}
+		}
+		for remote := range c.objs {
+			if !seenObjs[remote] {
+				seenObjs[remote] = true
+				objNames = append(objNames, remote)
+			}
+		}
+	}
+	sort.Strings(dirNames)
+	sort.Strings(objNames)
+
+	differences, failures := 0, 0
+	for _, dir := range dirNames {
+		for i, upstream := range f.upstreams {
+			if all[i].dirs[dir] {
+				continue
+			}
+			differences++
+			fs.Logf(upstream, "%s: directory missing", dir)
+			if err := fs.Mkdir(upstream, dir); err != nil {
+				failures++
+				fs.Errorf(upstream, "%s: failed to make directory: %v", dir, err)
+			}
+		}
+	}
+	for _, remote := range objNames {
+		var newest fs.Object
+		for _, c := range all {
+			o := c.objs[remote]
+			if o != nil && (newest == nil || o.ModTime().After(newest.ModTime())) {
+				newest = o
+			}
+		}
+		for i, upstream := range f.upstreams {
+			dst := all[i].objs[remote]
+			if dst == newest {
+				continue
+			}
+			fs.Stats.Checking(remote)
+			same := dst != nil && fs.Equal(newest, dst)
+			fs.Stats.DoneChecking(remote)
+			if same {
+				continue
+			}
+			differences++
+			if dst == nil {
+				fs.Logf(upstream, "%s: file missing", remote)
+			} else {
+				fs.Logf(upstream, "%s: file differs", remote)
+			}
+			if err := fs.Copy(upstream, dst, remote, newest); err != nil {
+				failures++
+				fs.Errorf(upstream, "%s: failed to repair: %v", remote, err)
+			}
+		}
+	}
+	fs.Logf(f, "%d differences found between the upstreams", differences)
+	if failures > 0 {
+		return errors.Errorf("failed to repair %d differences", failures)
+	}
+	return nil
+}
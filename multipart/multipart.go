@@ -0,0 +1,202 @@
+// Package multipart uploads the parts of a large file concurrently.
+//
+// It is for backends whose APIs let the parts of a file be sent in any
+// order and then put together once they have all arrived, like b2 and
+// azureblob.  Resumable upload protocols which need the data to arrive
+// in order, like those of drive and onedrive, can't use it.
+package multipart
+
+import (
+	"io"
+	"sync"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/pacer"
+	"github.com/pkg/errors"
+)
+
+// Part is a part of the file being uploaded
+type Part struct {
+	Number int    // number of the part counting from 0
+	Offset int64  // offset of the part in the file
+	Data   []byte // contents of the part - only valid until Skip or Send returns
+}
+
+// Uploader uploads the parts of a file concurrently
+type Uploader struct {
+	Obj      interface{}  // what to log the upload against
+	Pacer    *pacer.Pacer // paces and retries the sending of each part
+	PartSize int64        // size of each part except the last
+
+	// Concurrency is the number of parts to send at once.  If it
+	// isn't set then --upload-concurrency is used.
+	Concurrency int
+
+	// Skip is called if set before each part is sent.  If the part
+	// was sent by an earlier upload it should return its ID,
+	// otherwise "".
+	Skip func(part *Part) (id string)
+
+	// Send sends part, returning its ID.  It is called by the Pacer
+	// so should return whether it would like to be retried.
+	Send func(part *Part) (id string, retry bool, err error)
+}
+
+// The parts being sent by all the uploads are read into buffers taken
+// from a budget shared by all the uploads of --transfers times
+// --buffer-size bytes, so the memory used doesn't grow with
+// --transfers times --upload-concurrency.  Each upload may always
+// have one part in memory so it can make progress however large its
+// parts.  Free buffers are kept in a sync.Pool for each part size so
+// the garbage collector can reclaim them when they aren't being used.
+var (
+	buffersMu   sync.Mutex // protects the variables below
+	buffersCond = sync.NewCond(&buffersMu)
+	buffersUsed int64                    // bytes of buffers in use
+	buffers     = map[int64]*sync.Pool{} // free buffers by size
+)
+
+// buffersLimit returns the number of bytes of buffers the uploads may
+// use between them
+func buffersLimit() int64 {
+	transfers := fs.Config.Transfers
+	if transfers < 1 {
+		transfers = 1
+	}
+	return int64(transfers) * int64(fs.Config.BufferSize)
+}
+
+// getBuffer returns a buffer of size bytes, waiting until it fits in
+// the budget unless the upload holds none already.  held is the
+// number of buffers the upload holds.
+func getBuffer(size int64, held *int) []byte {
+	buffersMu.Lock()
+	for *held > 0 && buffersUsed+size > buffersLimit() {
+		buffersCond.Wait()
+	}
+	buffersUsed += size
+	*held++
+	pool := buffers[size]
+	if pool == nil {
+		pool = &sync.Pool{}
+		buffers[size] = pool
+	}
+	buffersMu.Unlock()
+	buf, _ := pool.Get().([]byte)
+	if buf == nil {
+		buf = make([]byte, size)
+	}
+	return buf
+}
+
+// putBuffer returns buf got with getBuffer to its pool
+func putBuffer(buf []byte, held *int) {
+	size := int64(cap(buf))
+	buffersMu.Lock()
+	buffersUsed -= size
+	*held--
+	pool := buffers[size]
+	buffersMu.Unlock()
+	pool.Put(buf[:size])
+	buffersCond.Broadcast()
+}
+
+// Upload reads the file of size bytes from in and sends it in parts,
+// returning the IDs of the parts in order ready to commit the upload.
+//
+// Each part is read into a buffer counted against the --transfers
+// times --buffer-size bytes shared by all uploads, so uploads may send
+// fewer parts at once than their Concurrency if the memory is in use,
+// but always at least one.  If sending a part fails after the Pacer's
+// retries then no more parts are read and the first error is returned
+// once the parts in flight have finished.
+func (u *Uploader) Upload(in io.Reader, size int64) (ids []string, err error) {
+	if u.PartSize <= 0 {
+		return nil, errors.New("multipart upload needs a part size")
+	}
+	parts := int((size + u.PartSize - 1) / u.PartSize)
+	concurrency := u.Concurrency
+	if concurrency <= 0 {
+		concurrency = fs.Config.UploadConcurrency
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	tokens := pacer.NewTokenDispenser(concurrency)
+	held := 0 // number of buffers held - protected by buffersMu
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex // protects firstErr
+		firstErr error
+	)
+	setErr := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	ids = make([]string, parts)
+	for n := 0; n < parts && !failed(); n++ {
+		tokens.Get()
+		buf := getBuffer(u.PartSize, &held)
+		part := &Part{
+			Number: n,
+			Offset: int64(n) * u.PartSize,
+		}
+		partSize := size - part.Offset
+		if partSize > u.PartSize {
+			partSize = u.PartSize
+		}
+		part.Data = buf[:partSize]
+		_, err = io.ReadFull(in, part.Data)
+		if err != nil {
+			putBuffer(buf, &held)
+			tokens.Put()
+			setErr(errors.Wrap(err, "multipart upload failed to read source"))
+			break
+		}
+
+		// Skip the part if it was sent before
+		if u.Skip != nil {
+			if id := u.Skip(part); id != "" {
+				fs.Debugf(u.Obj, "Skipping part %d/%d as it was sent before", n+1, parts)
+				ids[n] = id
+				putBuffer(buf, &held)
+				tokens.Put()
+				continue
+			}
+		}
+
+		// Send the part
+		wg.Add(1)
+		go func(part *Part, buf []byte) {
+			defer wg.Done()
+			defer tokens.Put()
+			defer putBuffer(buf, &held)
+			fs.Debugf(u.Obj, "Sending part %d/%d offset %v/%v part size %v", part.Number+1, parts, fs.SizeSuffix(part.Offset), fs.SizeSuffix(size), fs.SizeSuffix(len(part.Data)))
+			var id string
+			err := u.Pacer.Call(func() (retry bool, err error) {
+				id, retry, err = u.Send(part)
+				return retry, err
+			})
+			if err != nil {
+				setErr(err)
+				return
+			}
+			ids[part.Number] = id
+		}(part, buf)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return ids, nil
+}
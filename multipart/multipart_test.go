@@ -0,0 +1,218 @@
+package multipart
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/pacer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The config isn't loaded in the tests so set the memory for the
+// buffers explicitly - enough for 4 parts of 10 bytes.  --transfers
+// is left unset so the pacer doesn't limit the connections.
+func init() {
+	fs.Config.BufferSize = 40
+}
+
+// setBufferSize sets --buffer-size for the test, returning a function
+// to restore it
+func setBufferSize(size fs.SizeSuffix) func() {
+	old := fs.Config.BufferSize
+	fs.Config.BufferSize = size
+	return func() {
+		fs.Config.BufferSize = old
+	}
+}
+
+// testSender records the parts sent to it
+type testSender struct {
+	mu          sync.Mutex
+	data        map[int]string
+	attempts    map[int]int
+	inFlight    int
+	maxInFlight int
+	fail        func(part *Part, attempt int) (retry bool, err error)
+}
+
+func newTestSender() *testSender {
+	return &testSender{
+		data:     map[int]string{},
+		attempts: map[int]int{},
+	}
+}
+
+// Send is an Uploader.Send function
+func (s *testSender) Send(part *Part) (id string, retry bool, err error) {
+	s.mu.Lock()
+	s.attempts[part.Number]++
+	attempt := s.attempts[part.Number]
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+	time.Sleep(time.Millisecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	if s.fail != nil {
+		retry, err = s.fail(part, attempt)
+		if err != nil {
+			return "", retry, err
+		}
+	}
+	s.data[part.Number] = string(part.Data)
+	return fmt.Sprintf("id%d@%d", part.Number, part.Offset), false, nil
+}
+
+// newUploader makes an Uploader sending to s
+func newUploader(s *testSender, concurrency int) *Uploader {
+	return &Uploader{
+		Obj:         "test",
+		Pacer:       pacer.New().SetMinSleep(time.Microsecond).SetMaxSleep(time.Microsecond).SetRetries(3),
+		PartSize:    10,
+		Concurrency: concurrency,
+		Send:        s.Send,
+	}
+}
+
+// testData makes n bytes of data to upload
+func testData(n int) string {
+	return strings.Repeat("0123456789abcdefghijklmnopqrstuvwxyz", n/36+1)[:n]
+}
+
+func TestUpload(t *testing.T) {
+	for _, size := range []int{0, 1, 10, 11, 95, 100} {
+		s := newTestSender()
+		data := testData(size)
+		ids, err := newUploader(s, 3).Upload(strings.NewReader(data), int64(size))
+		require.NoError(t, err)
+		parts := (size + 9) / 10
+		require.Equal(t, parts, len(ids), fmt.Sprintf("size %d", size))
+		var got bytes.Buffer
+		for i, id := range ids {
+			assert.Equal(t, fmt.Sprintf("id%d@%d", i, i*10), id)
+			got.WriteString(s.data[i])
+		}
+		assert.Equal(t, data, got.String())
+		assert.True(t, s.maxInFlight <= 3, fmt.Sprintf("%d parts in flight", s.maxInFlight))
+	}
+}
+
+func TestUploadConcurrency(t *testing.T) {
+	s := newTestSender()
+	_, err := newUploader(s, 4).Upload(strings.NewReader(testData(1000)), 1000)
+	require.NoError(t, err)
+	assert.True(t, s.maxInFlight > 1, "parts weren't sent concurrently")
+	assert.True(t, s.maxInFlight <= 4, fmt.Sprintf("%d parts in flight", s.maxInFlight))
+}
+
+func TestUploadSharedBuffers(t *testing.T) {
+	defer setBufferSize(30)()
+
+	// an upload only sends as many parts as fit in --buffer-size
+	s := newTestSender()
+	_, err := newUploader(s, 4).Upload(strings.NewReader(testData(200)), 200)
+	require.NoError(t, err)
+	assert.Equal(t, 3, s.maxInFlight)
+
+	// all the uploads together only send as many parts as fit
+	// in --buffer-size plus one part for each of the others
+	s = newTestSender()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := newUploader(s, 4).Upload(strings.NewReader(testData(200)), 200)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.True(t, s.maxInFlight > 1, "parts weren't sent concurrently")
+	assert.True(t, s.maxInFlight <= 5, fmt.Sprintf("%d parts in flight", s.maxInFlight))
+	assert.Equal(t, int64(0), buffersUsed)
+
+	// parts bigger than --buffer-size are sent one at a time
+	s = newTestSender()
+	u := newUploader(s, 2)
+	u.PartSize = 35
+	data := testData(100)
+	ids, err := u.Upload(strings.NewReader(data), 100)
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(ids))
+	assert.Equal(t, data[35:70], s.data[1])
+	assert.Equal(t, 1, s.maxInFlight)
+	assert.Equal(t, int64(0), buffersUsed)
+}
+
+func TestUploadRetry(t *testing.T) {
+	s := newTestSender()
+	s.fail = func(part *Part, attempt int) (bool, error) {
+		if attempt == 1 {
+			return true, errors.New("try again")
+		}
+		return false, nil
+	}
+	data := testData(55)
+	ids, err := newUploader(s, 2).Upload(strings.NewReader(data), 55)
+	require.NoError(t, err)
+	assert.Equal(t, 6, len(ids))
+	for i := range ids {
+		assert.Equal(t, 2, s.attempts[i])
+	}
+}
+
+func TestUploadError(t *testing.T) {
+	s := newTestSender()
+	s.fail = func(part *Part, attempt int) (bool, error) {
+		if part.Number == 2 {
+			return false, errors.New("bad part")
+		}
+		return false, nil
+	}
+	ids, err := newUploader(s, 1).Upload(strings.NewReader(testData(100)), 100)
+	require.Error(t, err)
+	assert.Equal(t, "bad part", err.Error())
+	assert.Nil(t, ids)
+	assert.Equal(t, 1, s.attempts[2])
+	assert.True(t, len(s.attempts) < 10, "didn't stop reading after the error")
+}
+
+func TestUploadShortRead(t *testing.T) {
+	s := newTestSender()
+	_, err := newUploader(s, 2).Upload(strings.NewReader(testData(35)), 40)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read source")
+}
+
+func TestUploadSkip(t *testing.T) {
+	s := newTestSender()
+	u := newUploader(s, 2)
+	u.Skip = func(part *Part) string {
+		if part.Number%2 == 0 {
+			return "skipped " + string(part.Data)
+		}
+		return ""
+	}
+	data := testData(45)
+	ids, err := u.Upload(strings.NewReader(data), 45)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"skipped " + data[0:10], "id1@10", "skipped " + data[20:30], "id3@30", "skipped " + data[40:45]}, ids)
+	assert.Equal(t, 2, len(s.attempts))
+}
+
+func TestUploadNoPartSize(t *testing.T) {
+	u := newUploader(newTestSender(), 1)
+	u.PartSize = 0
+	_, err := u.Upload(strings.NewReader(""), 0)
+	assert.Error(t, err)
+}
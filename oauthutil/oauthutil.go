@@ -190,7 +190,13 @@ var _ oauth2.TokenSource = (*TokenSource)(nil)
 
 // Context returns a context with our HTTP Client baked in for oauth2
 func Context() context.Context {
-	return context.WithValue(context.Background(), oauth2.HTTPClient, fs.Config.Client())
+	return RemoteContext("")
+}
+
+// RemoteContext returns a context with our HTTP Client for the remote
+// called name baked in for oauth2
+func RemoteContext(name string) context.Context {
+	return context.WithValue(context.Background(), oauth2.HTTPClient, fs.Config.RemoteClient(name))
 }
 
 // overrideCredentials sets the ClientID and ClientSecret from the
@@ -234,7 +240,7 @@ func NewClient(name string, config *oauth2.Config) (*http.Client, *TokenSource,
 	}
 
 	// Set our own http client in the context
-	ctx := Context()
+	ctx := RemoteContext(name)
 
 	// Wrap the TokenSource in our TokenSource which saves changed
 	// tokens in the config file
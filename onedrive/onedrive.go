@@ -6,11 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -947,6 +949,36 @@ func (o *Object) uploadFragment(url string, start int64, totalSize int64, chunk
 	return err
 }
 
+// nextExpectedRE matches the start of the first range the server
+// expects in an upload session
+var nextExpectedRE = regexp.MustCompile(`^(\d+)-`)
+
+// getUploadSessionStatus returns the position the upload session at
+// url expects the next fragment from
+func (o *Object) getUploadSessionStatus(url string) (position int64, err error) {
+	opts := rest.Opts{
+		Method:  "GET",
+		RootURL: url,
+	}
+	var response api.UploadFragmentResponse
+	var resp *http.Response
+	err = o.fs.pacer.Call(func() (bool, error) {
+		resp, err = o.fs.srv.CallJSON(&opts, nil, &response)
+		return shouldRetry(resp, err)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(response.NextExpectedRanges) == 0 {
+		return 0, errors.New("upload session isn't expecting any more data")
+	}
+	m := nextExpectedRE.FindStringSubmatch(response.NextExpectedRanges[0])
+	if m == nil {
+		return 0, errors.Errorf("unable to parse next expected range %q", response.NextExpectedRanges[0])
+	}
+	return strconv.ParseInt(m[1], 10, 64)
+}
+
 // cancelUploadSession cancels an upload session
 func (o *Object) cancelUploadSession(url string) (err error) {
 	opts := rest.Opts{
@@ -963,22 +995,57 @@ func (o *Object) cancelUploadSession(url string) (err error) {
 }
 
 // uploadMultipart uploads a file using multipart upload
-func (o *Object) uploadMultipart(in io.Reader, size int64) (err error) {
+//
+// If the upload of src was interrupted before then it is resumed if
+// possible.
+func (o *Object) uploadMultipart(in io.Reader, src fs.ObjectInfo) (err error) {
 	if chunkSize%(320*1024) != 0 {
 		return errors.Errorf("chunk size %d is not a multiple of 320k", chunkSize)
 	}
+	size := src.Size()
+	position := int64(0)
+	uploadURL := ""
+
+	// Carry on with the session from an interrupted upload if possible
+	resume := fs.NewResumableUpload(o.fs, o.remote, src, int64(chunkSize))
+	if state := resume.Resume(); state != nil {
+		position, err = o.getUploadSessionStatus(state.Session)
+		if err == nil {
+			fs.Debugf(o, "Resuming multipart upload at offset %d", position)
+			uploadURL = state.Session
+			_, err = io.CopyN(ioutil.Discard, in, position)
+			if err != nil {
+				return errors.Wrap(err, "failed to skip data already uploaded")
+			}
+		} else {
+			fs.Debugf(o, "Can't resume multipart upload - starting again: %v", err)
+			position = 0
+		}
+	} else if stale := resume.Stale(); stale != "" {
+		// Cancel the session of an interrupted upload of a
+		// different version of the file as its state is about
+		// to be replaced
+		fs.Debugf(o, "Cancelling multipart upload which won't be resumed")
+		if cancelErr := o.cancelUploadSession(stale); cancelErr != nil {
+			fs.Debugf(o, "Failed to cancel multipart upload: %v", cancelErr)
+		}
+	}
 
 	// Create upload session
-	fs.Debugf(o, "Starting multipart upload")
-	session, err := o.createUploadSession()
-	if err != nil {
-		return err
+	if uploadURL == "" {
+		fs.Debugf(o, "Starting multipart upload")
+		session, err := o.createUploadSession()
+		if err != nil {
+			return err
+		}
+		uploadURL = session.UploadURL
+		resume.Start(uploadURL)
 	}
-	uploadURL := session.UploadURL
 
-	// Cancel the session if something went wrong
+	// Cancel the session if something went wrong, unless it is
+	// being kept to resume
 	defer func() {
-		if err != nil {
+		if err != nil && resume == nil {
 			fs.Debugf(o, "Cancelling multipart upload: %v", err)
 			cancelErr := o.cancelUploadSession(uploadURL)
 			if cancelErr != nil {
@@ -988,8 +1055,7 @@ func (o *Object) uploadMultipart(in io.Reader, size int64) (err error) {
 	}()
 
 	// Upload the chunks
-	remaining := size
-	position := int64(0)
+	remaining := size - position
 	for remaining > 0 {
 		n := int64(chunkSize)
 		if remaining < n {
@@ -1005,6 +1071,7 @@ func (o *Object) uploadMultipart(in io.Reader, size int64) (err error) {
 		position += n
 	}
 
+	resume.Finish()
 	return nil
 }
 
@@ -1041,7 +1108,7 @@ func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOptio
 		}
 		err = o.setMetaData(info)
 	} else {
-		err = o.uploadMultipart(in, size)
+		err = o.uploadMultipart(in, src)
 	}
 	if err != nil {
 		return err
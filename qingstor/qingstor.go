@@ -213,7 +213,7 @@ func qsServiceConnection(name string) (*qs.Service, error) {
 	cf.Host = host
 	cf.Port = port
 	cf.ConnectionRetries = connectionRetries
-	cf.Connection = fs.Config.Client()
+	cf.Connection = fs.Config.RemoteClient(name)
 
 	svc, _ := qs.Init(cf)
 
@@ -6,6 +6,7 @@ package rest
 import (
 	"bytes"
 	"encoding/json"
+	"encoding/xml"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
@@ -78,6 +79,15 @@ func (api *Client) SetHeader(key, value string) *Client {
 	return api
 }
 
+// SetUserPass creates an Authorization header for all requests with
+// the UserName and Password passed in
+func (api *Client) SetUserPass(UserName, Password string) *Client {
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	req.SetBasicAuth(UserName, Password)
+	api.SetHeader("Authorization", req.Header.Get("Authorization"))
+	return api
+}
+
 // Opts contains parameters for Call, CallJSON etc
 type Opts struct {
 	Method                string // GET, POST etc
@@ -112,6 +122,13 @@ func DecodeJSON(resp *http.Response, result interface{}) (err error) {
 	return decoder.Decode(result)
 }
 
+// DecodeXML decodes resp.Body into result
+func DecodeXML(resp *http.Response, result interface{}) (err error) {
+	defer fs.CheckClose(resp.Body, &err)
+	decoder := xml.NewDecoder(resp.Body)
+	return decoder.Decode(result)
+}
+
 // ClientWithHeaderReset makes a new http client which resets the
 // headers passed in on redirect
 //
@@ -217,12 +234,32 @@ func (api *Client) Call(opts *Opts) (resp *http.Response, err error) {
 //
 // It will return resp if at all possible, even if err is set
 func (api *Client) CallJSON(opts *Opts, request interface{}, response interface{}) (resp *http.Response, err error) {
+	return api.callCodec(opts, request, response, json.Marshal, DecodeJSON, "application/json")
+}
+
+// CallXML runs Call and decodes the body as an XML object into response (if not nil)
+//
+// If request is not nil then it will be XML encoded as the body of the request
+//
+// It will return resp if at all possible, even if err is set
+func (api *Client) CallXML(opts *Opts, request interface{}, response interface{}) (resp *http.Response, err error) {
+	return api.callCodec(opts, request, response, xml.Marshal, DecodeXML, "application/xml")
+}
+
+type marshalFn func(v interface{}) ([]byte, error)
+type decodeFn func(resp *http.Response, result interface{}) (err error)
+
+// callCodec runs Call, encoding request with marshal and decoding the
+// response into response with decode
+//
+// It will return resp if at all possible, even if err is set
+func (api *Client) callCodec(opts *Opts, request interface{}, response interface{}, marshal marshalFn, decode decodeFn, contentType string) (resp *http.Response, err error) {
 	var requestBody []byte
 	// Marshal the request if given
 	if request != nil {
 		opts = opts.Copy()
-		requestBody, err = json.Marshal(request)
-		opts.ContentType = "application/json"
+		requestBody, err = marshal(request)
+		opts.ContentType = contentType
 		if err != nil {
 			return nil, err
 		}
@@ -278,6 +315,6 @@ func (api *Client) CallJSON(opts *Opts, request interface{}, response interface{
 			return resp, err
 		}
 	}
-	err = DecodeJSON(resp, response)
+	err = decode(resp, response)
 	return resp, err
 }
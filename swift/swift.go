@@ -191,7 +191,7 @@ func swiftConnection(name string) (*swift.Connection, error) {
 		EndpointType:   swift.EndpointType(fs.ConfigFileGet(name, "endpoint_type", "public")),
 		ConnectTimeout: 10 * fs.Config.ConnectTimeout, // Use the timeouts in the transport
 		Timeout:        10 * fs.Config.Timeout,        // Use the timeouts in the transport
-		Transport:      fs.Config.Transport(),
+		Transport:      fs.Config.RemoteTransport(name),
 	}
 	if fs.ConfigFileGetBool(name, "env_auth", false) {
 		err := c.ApplyEnvironment()
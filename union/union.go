@@ -0,0 +1,698 @@
+// Package union implements a virtual provider to join existing remotes.
+package union
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// Policies for choosing the upstream remote new files are created on
+const (
+	createFirstFound = "ff"  // first remote with the parent directory
+	createMostFree   = "mfs" // remote with the most free space
+	createRoundRobin = "rr"  // each remote in turn
+)
+
+// Policies for choosing which of several files with the same name is used
+const (
+	clashFirst  = "first"  // file on the first remote listed
+	clashNewest = "newest" // file with the latest modification time
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "union",
+		Description: "Union merges the contents of several remotes",
+		NewFs:       NewFs,
+		Options: []fs.Option{{
+			Name: "remotes",
+			Help: "List of space separated remotes.\nCan be 'remotea:test/dir remoteb:', '\"remotea:test/space dir\" remoteb:', etc.\nThe first remote listed is used in preference to the others.",
+		}, {
+			Name:     "create_policy",
+			Help:     "Which remote new files are created on.",
+			Optional: true,
+			Examples: []fs.OptionExample{{
+				Value: createFirstFound,
+				Help:  "First remote listed which has the directory the file goes in.",
+			}, {
+				Value: createMostFree,
+				Help:  "Remote with the most free space.",
+			}, {
+				Value: createRoundRobin,
+				Help:  "Each remote in turn.",
+			}},
+		}, {
+			Name:     "clash_policy",
+			Help:     "Which file is used if there is a file with the same name on more than one remote.",
+			Optional: true,
+			Examples: []fs.OptionExample{{
+				Value: clashFirst,
+				Help:  "The file on the first remote listed.",
+			}, {
+				Value: clashNewest,
+				Help:  "The file with the latest modification time.",
+			}},
+		}},
+	})
+}
+
+// Fs represents a union of remotes
+type Fs struct {
+	name         string       // name of this remote
+	root         string       // the path we are working on
+	features     *fs.Features // optional features
+	remotes      []fs.Fs      // the upstream remotes in order of preference
+	createPolicy string       // how to choose the remote for new files
+	clashPolicy  string       // how to choose between files with the same name
+	mu           sync.Mutex       // protects the following
+	next         int              // next remote to use for round robin
+	dirs         map[string]fs.Fs // remote found with each directory by ff
+}
+
+// parseRemotes splits the remotes config value into a list of
+// remotes, allowing remotes with spaces in to be quoted
+func parseRemotes(value string) (remotes []string, err error) {
+	var (
+		current  []rune
+		inQuotes bool
+		inWord   bool
+	)
+	for _, c := range value {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+			inWord = true
+		case c == ' ' && !inQuotes:
+			if inWord {
+				remotes = append(remotes, string(current))
+			}
+			current, inWord = current[:0], false
+		default:
+			current = append(current, c)
+			inWord = true
+		}
+	}
+	if inQuotes {
+		return nil, errors.Errorf("unterminated quote in remotes %q", value)
+	}
+	if inWord {
+		remotes = append(remotes, string(current))
+	}
+	return remotes, nil
+}
+
+// newUpstreams makes the Fs for each of the remotes at root
+//
+// If root is a file on any of the remotes it returns fs.ErrorIsFile
+func newUpstreams(remotes []string, root string) (fss []fs.Fs, err error) {
+	isFile := false
+	for _, remote := range remotes {
+		remotePath := path.Join(remote, root)
+		f, err := fs.NewFs(remotePath)
+		if err == fs.ErrorIsFile {
+			isFile = true
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "failed to make remote %q to union", remotePath)
+		}
+		fss = append(fss, f)
+	}
+	if isFile {
+		return fss, fs.ErrorIsFile
+	}
+	return fss, nil
+}
+
+// NewFs constructs an Fs from the path.
+//
+// The returned Fs is the actual Fs, referenced by remote in the config
+func NewFs(name, root string) (fs.Fs, error) {
+	remotes, err := parseRemotes(fs.ConfigFileGet(name, "remotes"))
+	if err != nil {
+		return nil, err
+	}
+	if len(remotes) == 0 {
+		return nil, errors.New("remotes not set in config file")
+	}
+	for _, remote := range remotes {
+		if strings.HasPrefix(remote, name+":") {
+			return nil, errors.New("can't point union remote at itself - check the value of the remotes setting")
+		}
+	}
+	createPolicy := fs.ConfigFileGet(name, "create_policy", createFirstFound)
+	switch createPolicy {
+	case createFirstFound, createMostFree, createRoundRobin:
+	default:
+		return nil, errors.Errorf("unknown create_policy %q", createPolicy)
+	}
+	clashPolicy := fs.ConfigFileGet(name, "clash_policy", clashFirst)
+	switch clashPolicy {
+	case clashFirst, clashNewest:
+	default:
+		return nil, errors.Errorf("unknown clash_policy %q", clashPolicy)
+	}
+	root = strings.Trim(root, "/")
+	upstreams, err := newUpstreams(remotes, root)
+	if err == fs.ErrorIsFile {
+		// the root is a file so point all the remotes at the
+		// directory it is in
+		root = path.Dir(root)
+		if root == "." {
+			root = ""
+		}
+		upstreams, err = newUpstreams(remotes, root)
+		if err == nil {
+			err = fs.ErrorIsFile
+		}
+	}
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, err
+	}
+	f := &Fs{
+		name:         name,
+		root:         root,
+		remotes:      upstreams,
+		createPolicy: createPolicy,
+		clashPolicy:  clashPolicy,
+		dirs:         make(map[string]fs.Fs),
+	}
+	// the features here are ones we could support, and they are
+	// ANDed with the ones from each of the remotes
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		ReadMimeType:            false,
+		WriteMimeType:           false,
+		BucketBased:             true,
+		CanHaveEmptyDirectories: true,
+	}).Fill(f)
+	for _, remote := range f.remotes {
+		f.features.Mask(remote)
+	}
+	return f, err
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("union root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision is the coarsest precision of all the remotes
+func (f *Fs) Precision() time.Duration {
+	var precision time.Duration
+	for _, remote := range f.remotes {
+		if p := remote.Precision(); p > precision {
+			precision = p
+		}
+	}
+	return precision
+}
+
+// Hashes returns the hashes supported by all the remotes
+func (f *Fs) Hashes() fs.HashSet {
+	var hashes fs.HashSet
+	for i, remote := range f.remotes {
+		if i == 0 {
+			hashes = remote.Hashes()
+		} else {
+			hashes = hashes.Overlap(remote.Hashes())
+		}
+	}
+	return hashes
+}
+
+// wins returns true if the object o should be used instead of
+// existing which is on a remote listed before o's
+func (f *Fs) wins(o, existing fs.Object) bool {
+	if f.clashPolicy == clashNewest {
+		return o.ModTime().After(existing.ModTime())
+	}
+	return false
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// The entries of dir on all the remotes are merged.  Where there is
+// a file and a directory with the same name the directory is used.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(dir string) (entries fs.DirEntries, err error) {
+	found := false
+	index := map[string]int{}
+	for _, remote := range f.remotes {
+		remoteEntries, err := remote.List(dir)
+		if err == fs.ErrorDirNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list %v", remote)
+		}
+		found = true
+		for _, entry := range remoteEntries {
+			var newEntry fs.DirEntry
+			switch x := entry.(type) {
+			case fs.Object:
+				newEntry = f.newObject(x, remote)
+			case fs.Directory:
+				newEntry = fs.NewDir(x.Remote(), x.ModTime())
+			default:
+				return nil, errors.Errorf("unknown object type %T", entry)
+			}
+			i, ok := index[entry.Remote()]
+			if !ok {
+				index[entry.Remote()] = len(entries)
+				entries = append(entries, newEntry)
+				continue
+			}
+			existing, isObject := entries[i].(fs.Object)
+			if !isObject {
+				// directories win over everything
+				continue
+			}
+			if o, ok := newEntry.(fs.Object); !ok || f.wins(o, existing) {
+				entries[i] = newEntry
+			}
+		}
+	}
+	if !found {
+		return nil, fs.ErrorDirNotFound
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote choosing between the copies
+// on the different remotes with the clash policy.  If it can't be
+// found it returns the error fs.ErrorObjectNotFound.
+func (f *Fs) NewObject(remote string) (fs.Object, error) {
+	var o *Object
+	for _, upstream := range f.remotes {
+		obj, err := upstream.NewObject(remote)
+		if err == fs.ErrorObjectNotFound || err == fs.ErrorNotAFile {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if o == nil || f.wins(obj, o.Object) {
+			o = f.newObject(obj, upstream)
+		}
+	}
+	if o == nil {
+		return nil, fs.ErrorObjectNotFound
+	}
+	return o, nil
+}
+
+// dirExists returns whether dir exists on the remote
+func dirExists(remote fs.Fs, dir string) bool {
+	_, err := remote.List(dir)
+	return err == nil
+}
+
+// create returns the remote to create a new file called remote on
+// using the create policy
+func (f *Fs) create(remote string) fs.Fs {
+	switch f.createPolicy {
+	case createMostFree:
+		var (
+			best fs.Fs
+			free int64 = -1
+		)
+		for _, upstream := range f.remotes {
+			do := upstream.Features().About
+			if do == nil {
+				continue
+			}
+			usage, err := do()
+			if err != nil {
+				fs.Debugf(upstream, "Failed to read free space: %v", err)
+				continue
+			}
+			if usage.Free > free {
+				best, free = upstream, usage.Free
+			}
+		}
+		if best != nil {
+			return best
+		}
+	case createRoundRobin:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		upstream := f.remotes[f.next]
+		f.next = (f.next + 1) % len(f.remotes)
+		return upstream
+	default:
+		dir := path.Dir(remote)
+		if dir == "." {
+			dir = ""
+		}
+		// Remember the remote found for each directory so that
+		// uploading lots of files to it doesn't list it each time
+		f.mu.Lock()
+		upstream := f.dirs[dir]
+		f.mu.Unlock()
+		if upstream != nil {
+			return upstream
+		}
+		for _, upstream := range f.remotes {
+			if dirExists(upstream, dir) {
+				f.mu.Lock()
+				f.dirs[dir] = upstream
+				f.mu.Unlock()
+				return upstream
+			}
+		}
+	}
+	return f.remotes[0]
+}
+
+// forgetDirs removes dir and everything in it from the directories
+// remembered by the ff create policy
+func (f *Fs) forgetDirs(dir string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for d := range f.dirs {
+		if dir == "" || d == dir || strings.HasPrefix(d, dir+"/") {
+			delete(f.dirs, d)
+		}
+	}
+}
+
+// put uploads in to the remote path with the modTime given of the
+// given size, streaming it to a new file if stream is set
+//
+// If the file already exists it is updated in place
+func (f *Fs) put(in io.Reader, src fs.ObjectInfo, stream bool, options ...fs.OpenOption) (fs.Object, error) {
+	o, err := f.NewObject(src.Remote())
+	switch err {
+	case nil:
+		return o, o.Update(in, src, options...)
+	case fs.ErrorObjectNotFound:
+	default:
+		return nil, err
+	}
+	upstream := f.create(src.Remote())
+	putFn := upstream.Put
+	if stream {
+		putFn = upstream.Features().PutStream
+		if putFn == nil {
+			return nil, errors.Errorf("%v can't stream uploads", upstream)
+		}
+	}
+	obj, err := putFn(in, src, options...)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(obj, upstream), nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(in, src, false, options...)
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(in, src, true, options...)
+}
+
+// Mkdir makes the directory on all the remotes
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(dir string) error {
+	for _, remote := range f.remotes {
+		err := remote.Mkdir(dir)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rmdir removes the directory from all the remotes it is on
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(dir string) error {
+	f.forgetDirs(dir)
+	found := false
+	for _, remote := range f.remotes {
+		err := remote.Rmdir(dir)
+		if err != nil {
+			if !dirExists(remote, dir) {
+				continue
+			}
+			return err
+		}
+		found = true
+	}
+	if !found {
+		return fs.ErrorDirNotFound
+	}
+	return nil
+}
+
+// Purge all files in the root and the root directory on all the
+// remotes
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge() error {
+	f.forgetDirs("")
+	found := false
+	for _, remote := range f.remotes {
+		do := remote.Features().Purge
+		if do == nil {
+			return fs.ErrorCantPurge
+		}
+		err := do()
+		if err != nil {
+			if !dirExists(remote, "") {
+				continue
+			}
+			return err
+		}
+		found = true
+	}
+	if !found {
+		return fs.ErrorDirNotFound
+	}
+	return nil
+}
+
+// Copy src to this remote using server side copy operations.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't copy - not same remote type")
+		return nil, fs.ErrorCantCopy
+	}
+	upstream := f.sameUpstream(srcObj)
+	if upstream == nil {
+		fs.Debugf(src, "Can't copy - not on one of the remotes")
+		return nil, fs.ErrorCantCopy
+	}
+	do := upstream.Features().Copy
+	if do == nil {
+		return nil, fs.ErrorCantCopy
+	}
+	o, err := do(srcObj.Object, remote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o, upstream), nil
+}
+
+// Move src to this remote using server side move operations.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't move - not same remote type")
+		return nil, fs.ErrorCantMove
+	}
+	upstream := f.sameUpstream(srcObj)
+	if upstream == nil {
+		fs.Debugf(src, "Can't move - not on one of the remotes")
+		return nil, fs.ErrorCantMove
+	}
+	do := upstream.Features().Move
+	if do == nil {
+		return nil, fs.ErrorCantMove
+	}
+	o, err := do(srcObj.Object, remote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o, upstream), nil
+}
+
+// sameUpstream returns the remote of f which is the one o is on,
+// which may be in a union with a different root, or nil if o isn't
+// on any of them
+func (f *Fs) sameUpstream(o *Object) fs.Fs {
+	if o.f.name != f.name || len(o.f.remotes) != len(f.remotes) {
+		return nil
+	}
+	for i, upstream := range o.f.remotes {
+		if upstream == o.upstream && f.remotes[i].Name() == upstream.Name() {
+			return f.remotes[i]
+		}
+	}
+	return nil
+}
+
+// About gets quota information by adding up that of all the
+// remotes
+func (f *Fs) About() (*fs.Usage, error) {
+	total := &fs.Usage{}
+	for _, remote := range f.remotes {
+		do := remote.Features().About
+		if do == nil {
+			return nil, errors.Errorf("%v can't read quota information", remote)
+		}
+		usage, err := do()
+		if err != nil {
+			return nil, err
+		}
+		total.Total = addUsage(total.Total, usage.Total)
+		total.Used = addUsage(total.Used, usage.Used)
+		total.Free = addUsage(total.Free, usage.Free)
+	}
+	return total, nil
+}
+
+// addUsage adds two usage values which are -1 if unknown
+func addUsage(a, b int64) int64 {
+	if a < 0 || b < 0 {
+		return -1
+	}
+	return a + b
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+//
+// This is the first of the remotes as that is the one used in
+// preference to the others
+func (f *Fs) UnWrap() fs.Fs {
+	return f.remotes[0]
+}
+
+// Object describes a union Object
+//
+// This is an Object on one of the remotes
+type Object struct {
+	fs.Object
+	f        *Fs
+	upstream fs.Fs // the remote the Object is on
+}
+
+// newObject wraps o which is on upstream
+func (f *Fs) newObject(o fs.Object, upstream fs.Fs) *Object {
+	return &Object{
+		Object:   o,
+		f:        f,
+		upstream: upstream,
+	}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// String returns a description of the Object
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.Object.String()
+}
+
+// Remove the object and any copies of it hidden on the other
+// remotes so it isn't replaced by one of them
+func (o *Object) Remove() error {
+	err := o.Object.Remove()
+	if err != nil {
+		return err
+	}
+	for _, upstream := range o.f.remotes {
+		if upstream == o.upstream {
+			continue
+		}
+		obj, err := upstream.NewObject(o.Remote())
+		if err == fs.ErrorObjectNotFound || err == fs.ErrorNotAFile {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = obj.Remove()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnWrap returns the wrapped Object
+func (o *Object) UnWrap() fs.Object {
+	return o.Object
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs          = (*Fs)(nil)
+	_ fs.Purger      = (*Fs)(nil)
+	_ fs.PutStreamer = (*Fs)(nil)
+	_ fs.Copier      = (*Fs)(nil)
+	_ fs.Mover       = (*Fs)(nil)
+	_ fs.Abouter     = (*Fs)(nil)
+	_ fs.UnWrapper   = (*Fs)(nil)
+	_ fs.Object      = (*Object)(nil)
+)
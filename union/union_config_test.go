@@ -0,0 +1,24 @@
+package union_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ncw/rclone/fstest/fstests"
+)
+
+// Create the TestUnion: remote
+func init() {
+	var remotes []string
+	for _, leaf := range []string{"a", "b", "c"} {
+		remotes = append(remotes, filepath.Join(os.TempDir(), "rclone-union-test-"+leaf))
+	}
+	name := "TestUnion"
+	fstests.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "union"},
+		{Name: name, Key: "remotes", Value: strings.Join(remotes, " ")},
+		// spread the files over the remotes so the listings are merged
+		{Name: name, Key: "create_policy", Value: "rr"},
+	}
+}
@@ -0,0 +1,280 @@
+package union
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	_ "github.com/ncw/rclone/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFs makes a union of n temporary local directories with the
+// config values in config returning the Fs, the directories and a
+// function to tidy up
+func newTestFs(t *testing.T, n int, config ...string) (*Fs, []string, func()) {
+	dirs, cleanup := fstest.NewLocalDirs(t, n)
+	config = append([]string{"type", "union", "remotes", strings.Join(dirs, " "), "create_policy", "", "clash_policy", ""}, config...)
+	f, err := fstest.NewConfiguredFs("TestUnionInternal", config...)
+	require.NoError(t, err)
+	return f.(*Fs), dirs, cleanup
+}
+
+// listEntries lists dir returning the sorted names with a trailing
+// "/" on directories
+func listEntries(t *testing.T, f fs.Fs, dir string) (names []string) {
+	entries, err := f.List(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		name := entry.Remote()
+		if _, ok := entry.(fs.Directory); ok {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// exists returns whether name exists in the local directory dir
+func exists(dir, name string) bool {
+	_, err := os.Stat(filepath.Join(dir, name))
+	return err == nil
+}
+
+func TestParseRemotes(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want []string
+		err  bool
+	}{
+		{"", nil, false},
+		{"a: b:dir", []string{"a:", "b:dir"}, false},
+		{"  a:   b:dir  ", []string{"a:", "b:dir"}, false},
+		{`"a:space dir" b:`, []string{"a:space dir", "b:"}, false},
+		{`a:"space dir"`, []string{"a:space dir"}, false},
+		{`"a:space dir`, nil, true},
+	} {
+		got, err := parseRemotes(test.in)
+		if test.err {
+			assert.Error(t, err, test.in)
+			continue
+		}
+		require.NoError(t, err, test.in)
+		assert.Equal(t, test.want, got, test.in)
+	}
+}
+
+func TestBadPolicies(t *testing.T) {
+	name := "TestUnionBadPolicy"
+	_, err := fstest.NewConfiguredFs(name, "type", "union", "remotes", os.TempDir(), "create_policy", "potato")
+	assert.Error(t, err)
+	_, err = fstest.NewConfiguredFs(name, "create_policy", "", "clash_policy", "potato")
+	assert.Error(t, err)
+	_, err = fstest.NewConfiguredFs(name, "remotes", name+":dir", "clash_policy", "")
+	assert.Error(t, err)
+}
+
+func TestListMerged(t *testing.T) {
+	f, dirs, cleanup := newTestFs(t, 2)
+	defer cleanup()
+	t1 := fstest.Time("2001-02-03T04:05:06Z")
+
+	fstest.WriteFile(t, dirs[0], "one.txt", "one", t1)
+	fstest.WriteFile(t, dirs[0], "dir/a.txt", "a", t1)
+	fstest.WriteFile(t, dirs[1], "two.txt", "two", t1)
+	fstest.WriteFile(t, dirs[1], "dir/b.txt", "b", t1)
+	fstest.WriteFile(t, dirs[1], "clash", "file", t1)
+	require.NoError(t, os.MkdirAll(filepath.Join(dirs[0], "clash"), 0777))
+	require.NoError(t, os.MkdirAll(filepath.Join(dirs[1], "only1"), 0777))
+
+	assert.Equal(t, []string{"clash/", "dir/", "one.txt", "only1/", "two.txt"}, listEntries(t, f, ""))
+	assert.Equal(t, []string{"dir/a.txt", "dir/b.txt"}, listEntries(t, f, "dir"))
+	assert.Equal(t, []string(nil), listEntries(t, f, "only1"))
+	_, err := f.List("notfound")
+	assert.Equal(t, fs.ErrorDirNotFound, err)
+
+	// The objects belong to the union
+	o, err := f.NewObject("two.txt")
+	require.NoError(t, err)
+	assert.Equal(t, f, o.Fs())
+	assert.Equal(t, "two", fstest.ReadObject(t, f, "two.txt"))
+}
+
+func TestClashPolicy(t *testing.T) {
+	// both before the time fstest.PutFile uses
+	t1 := fstest.Time("1999-02-03T04:05:06Z")
+	t2 := fstest.Time("2000-02-03T04:05:06Z")
+	for _, test := range []struct {
+		policy string
+		want   string
+	}{
+		{"", "older"},
+		{"first", "older"},
+		{"newest", "newer"},
+	} {
+		f, dirs, cleanup := newTestFs(t, 2, "clash_policy", test.policy)
+		fstest.WriteFile(t, dirs[0], "file.txt", "older", t1)
+		fstest.WriteFile(t, dirs[1], "file.txt", "newer", t2)
+
+		assert.Equal(t, test.want, fstest.ReadObject(t, f, "file.txt"), test.policy)
+		entries, err := f.List("")
+		require.NoError(t, err)
+		require.Equal(t, 1, len(entries), test.policy)
+		assert.Equal(t, int64(len(test.want)), entries[0].Size(), test.policy)
+
+		// Updating the file changes the copy which is used
+		fstest.PutFile(t, f, "file.txt", "updated")
+		assert.Equal(t, "updated", fstest.ReadObject(t, f, "file.txt"), test.policy)
+		cleanup()
+	}
+}
+
+func TestRemoveHidden(t *testing.T) {
+	f, dirs, cleanup := newTestFs(t, 2)
+	defer cleanup()
+	t1 := fstest.Time("2001-02-03T04:05:06Z")
+	fstest.WriteFile(t, dirs[0], "file.txt", "one", t1)
+	fstest.WriteFile(t, dirs[1], "file.txt", "two", t1)
+
+	// Removing the file removes the copy hidden underneath it too
+	o, err := f.NewObject("file.txt")
+	require.NoError(t, err)
+	require.NoError(t, o.Remove())
+	assert.False(t, exists(dirs[0], "file.txt"))
+	assert.False(t, exists(dirs[1], "file.txt"))
+	_, err = f.NewObject("file.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+}
+
+func TestCreateFirstFound(t *testing.T) {
+	f, dirs, cleanup := newTestFs(t, 3)
+	defer cleanup()
+	require.NoError(t, os.MkdirAll(filepath.Join(dirs[1], "dir"), 0777))
+
+	fstest.PutFile(t, f, "root.txt", "root")
+	fstest.PutFile(t, f, "dir/file.txt", "file")
+	fstest.PutFile(t, f, "new/file.txt", "file")
+	assert.True(t, exists(dirs[0], "root.txt"))
+	assert.True(t, exists(dirs[1], "dir/file.txt"))
+	assert.True(t, exists(dirs[0], "new/file.txt"))
+}
+
+// listFs is an Fs which counts the calls to List
+type listFs struct {
+	fs.Fs
+	lists int
+}
+
+func (f *listFs) List(dir string) (fs.DirEntries, error) {
+	f.lists++
+	return f.Fs.List(dir)
+}
+
+func TestCreateFirstFoundListsOnce(t *testing.T) {
+	f, dirs, cleanup := newTestFs(t, 2)
+	defer cleanup()
+	require.NoError(t, os.MkdirAll(filepath.Join(dirs[1], "dir"), 0777))
+	remotes := []*listFs{{Fs: f.remotes[0]}, {Fs: f.remotes[1]}}
+	f.remotes[0], f.remotes[1] = remotes[0], remotes[1]
+
+	for _, name := range []string{"1", "2", "3"} {
+		fstest.PutFile(t, f, "dir/"+name, name)
+		assert.True(t, exists(dirs[1], "dir/"+name))
+	}
+	assert.Equal(t, 1, remotes[0].lists)
+	assert.Equal(t, 1, remotes[1].lists)
+
+	// Removing the directory forgets where it was
+	for _, name := range []string{"1", "2", "3"} {
+		o, err := f.NewObject("dir/" + name)
+		require.NoError(t, err)
+		require.NoError(t, o.Remove())
+	}
+	require.NoError(t, f.Rmdir("dir"))
+	require.NoError(t, os.MkdirAll(filepath.Join(dirs[0], "dir"), 0777))
+	fstest.PutFile(t, f, "dir/4", "4")
+	assert.True(t, exists(dirs[0], "dir/4"))
+}
+
+func TestMoveOtherRoot(t *testing.T) {
+	_, dirs, cleanup := newTestFs(t, 2)
+	defer cleanup()
+	t1 := fstest.Time("2001-02-03T04:05:06Z")
+	fstest.WriteFile(t, dirs[1], "a/file.txt", "file", t1)
+	require.NoError(t, os.MkdirAll(filepath.Join(dirs[1], "b"), 0777))
+	fa, err := fs.NewFs("TestUnionInternal:a")
+	require.NoError(t, err)
+	fb, err := fs.NewFs("TestUnionInternal:b")
+	require.NoError(t, err)
+
+	// The file must end up in the root of the destination
+	src, err := fa.NewObject("file.txt")
+	require.NoError(t, err)
+	o, err := fb.Features().Move(src, "moved.txt")
+	require.NoError(t, err)
+	assert.Equal(t, fb, o.Fs())
+	assert.False(t, exists(dirs[1], "a/file.txt"))
+	assert.True(t, exists(dirs[1], "b/moved.txt"))
+	assert.Equal(t, "file", fstest.ReadObject(t, fb, "moved.txt"))
+}
+
+func TestCreateRoundRobin(t *testing.T) {
+	f, dirs, cleanup := newTestFs(t, 3, "create_policy", "rr")
+	defer cleanup()
+
+	for _, name := range []string{"1", "2", "3", "4"} {
+		fstest.PutFile(t, f, name, name)
+	}
+	assert.True(t, exists(dirs[0], "1"))
+	assert.True(t, exists(dirs[1], "2"))
+	assert.True(t, exists(dirs[2], "3"))
+	assert.True(t, exists(dirs[0], "4"))
+}
+
+// aboutFs is an Fs with a fixed amount of free space
+type aboutFs struct {
+	fs.Fs
+	free int64
+}
+
+func (f *aboutFs) Features() *fs.Features {
+	return (&fs.Features{}).Fill(f)
+}
+
+func (f *aboutFs) About() (*fs.Usage, error) {
+	return &fs.Usage{Total: 100, Used: 100 - f.free, Free: f.free}, nil
+}
+
+func TestCreateMostFree(t *testing.T) {
+	f, dirs, cleanup := newTestFs(t, 3, "create_policy", "mfs")
+	defer cleanup()
+	f.remotes[0] = &aboutFs{Fs: f.remotes[0], free: 10}
+	f.remotes[1] = &aboutFs{Fs: f.remotes[1], free: 30}
+	f.remotes[2] = &aboutFs{Fs: f.remotes[2], free: 20}
+
+	fstest.PutFile(t, f, "file.txt", "file")
+	assert.True(t, exists(dirs[1], "file.txt"))
+
+	usage, err := f.About()
+	require.NoError(t, err)
+	assert.Equal(t, &fs.Usage{Total: 300, Used: 240, Free: 60}, usage)
+}
+
+func TestRootIsFile(t *testing.T) {
+	_, dirs, cleanup := newTestFs(t, 2)
+	defer cleanup()
+	t1 := fstest.Time("2001-02-03T04:05:06Z")
+	fstest.WriteFile(t, dirs[1], "dir/file.txt", "file", t1)
+
+	f, err := fs.NewFs("TestUnionInternal:dir/file.txt")
+	assert.Equal(t, fs.ErrorIsFile, err)
+	require.NotNil(t, f)
+	assert.Equal(t, "dir", f.Root())
+	assert.Equal(t, "file", fstest.ReadObject(t, f, "file.txt"))
+}
@@ -0,0 +1,167 @@
+// Package api has type definitions for webdav
+package api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// OwnCloudNamespace is the XML namespace of the ownCloud
+	// extensions to WebDAV
+	OwnCloudNamespace = "http://owncloud.org/ns"
+)
+
+// PropFindBody is sent with PROPFIND requests to ask for the
+// properties rclone uses
+const PropFindBody = `<?xml version="1.0" encoding="utf-8" ?>
+<d:propfind xmlns:d="DAV:" xmlns:oc="` + OwnCloudNamespace + `">
+ <d:prop>
+  <d:displayname />
+  <d:getlastmodified />
+  <d:getcontentlength />
+  <d:getcontenttype />
+  <d:resourcetype />
+  <oc:checksums />
+ </d:prop>
+</d:propfind>
+`
+
+// Multistatus contains responses returned from an HTTP 207 return code
+type Multistatus struct {
+	Responses []Response `xml:"DAV: response"`
+}
+
+// Response contains the Href of the item the response is about and
+// its properties
+type Response struct {
+	Href      string     `xml:"DAV: href"`
+	Propstats []Propstat `xml:"DAV: propstat"`
+}
+
+// Propstat contains a group of properties and the status they were
+// returned with
+type Propstat struct {
+	Status string `xml:"DAV: status"`
+	Prop   Prop   `xml:"DAV: prop"`
+}
+
+// Prop is the properties of a response
+type Prop struct {
+	Name        string    `xml:"DAV: displayname"`
+	Size        int64     `xml:"DAV: getcontentlength"`
+	Modified    Time      `xml:"DAV: getlastmodified"`
+	ContentType string    `xml:"DAV: getcontenttype"`
+	Collection  *struct{} `xml:"DAV: resourcetype>collection"`
+	Checksums   []string  `xml:"http://owncloud.org/ns checksums>checksum"`
+}
+
+// StatusOK returns whether the status string of the propstat,
+// eg "HTTP/1.1 200 OK", is a 2xx status
+func (p *Propstat) StatusOK() bool {
+	fields := strings.Fields(p.Status)
+	if len(fields) < 2 {
+		return false
+	}
+	code, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return false
+	}
+	return code >= 200 && code <= 299
+}
+
+// Props returns the properties of the response which were returned
+// with a 2xx status and whether there were any
+func (r *Response) Props() (prop Prop, ok bool) {
+	for i := range r.Propstats {
+		propstat := &r.Propstats[i]
+		if propstat.StatusOK() {
+			return propstat.Prop, true
+		}
+	}
+	return prop, false
+}
+
+// IsDir returns whether the properties are those of a collection
+func (p *Prop) IsDir() bool {
+	return p.Collection != nil
+}
+
+// Hashes returns the checksums of the properties as a map of
+// lower case checksum type, eg "sha1", to the lower case hex checksum
+//
+// ownCloud returns them space separated in one element, eg
+// "SHA1:2a... MD5:5d... ADLER32:0a..."
+func (p *Prop) Hashes() map[string]string {
+	hashes := make(map[string]string)
+	for _, checksums := range p.Checksums {
+		for _, checksum := range strings.Fields(checksums) {
+			i := strings.IndexRune(checksum, ':')
+			if i < 0 {
+				continue
+			}
+			hashes[strings.ToLower(checksum[:i])] = strings.ToLower(checksum[i+1:])
+		}
+	}
+	return hashes
+}
+
+// Time represents date and time information for the
+// webdav API, which is in the RFC1123 format HTTP uses
+type Time time.Time
+
+// MarshalXML turns a Time into XML
+func (t *Time) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	timeString := (*time.Time)(t).UTC().Format(http.TimeFormat)
+	return e.EncodeElement(timeString, start)
+}
+
+// UnmarshalXML turns XML into a Time
+func (t *Time) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var v string
+	err := d.DecodeElement(&v, &start)
+	if err != nil {
+		return err
+	}
+	newT, err := http.ParseTime(v)
+	if err != nil {
+		return err
+	}
+	*t = Time(newT)
+	return nil
+}
+
+// Error is used to describe errors returned from the webdav server,
+// which may have an XML body like
+//
+//    <d:error xmlns:d="DAV:" xmlns:s="http://sabredav.org/ns">
+//      <s:exception>Sabre\DAV\Exception\NotFound</s:exception>
+//      <s:message>File with name foo could not be located</s:message>
+//    </d:error>
+type Error struct {
+	Exception  string `xml:"exception,omitempty"`
+	Message    string `xml:"message,omitempty"`
+	Status     string `xml:"-"` // status returned in the HTTP response
+	StatusCode int    `xml:"-"` // status code returned in the HTTP response
+}
+
+// Error returns a string for the error and satisfies the error interface
+func (e *Error) Error() string {
+	var out []string
+	if e.Message != "" {
+		out = append(out, e.Message)
+	}
+	if e.Exception != "" {
+		out = append(out, e.Exception)
+	}
+	if e.Status != "" {
+		out = append(out, e.Status)
+	}
+	if len(out) == 0 {
+		return "Webdav Error"
+	}
+	return strings.Join(out, ": ")
+}
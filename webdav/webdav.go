@@ -0,0 +1,889 @@
+// Package webdav provides an interface to the Webdav
+// object storage system.
+//
+// It uses PROPFIND to read directory listings and PUT, MKCOL,
+// DELETE, MOVE and COPY to change things.  Servers which are known
+// to support the ownCloud extensions (ownCloud and Nextcloud) have
+// their modification times set with the X-OC-Mtime header and their
+// checksums read and written with OC-Checksum.
+package webdav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/pacer"
+	"github.com/ncw/rclone/rest"
+	"github.com/ncw/rclone/webdav/api"
+	"github.com/pkg/errors"
+)
+
+const (
+	minSleep      = 10 * time.Millisecond
+	maxSleep      = 2 * time.Second
+	decayConstant = 2 // bigger for slower decay, exponential
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "webdav",
+		Description: "Webdav",
+		NewFs:       NewFs,
+		Options: []fs.Option{{
+			Name:     "url",
+			Help:     "URL of http host to connect to",
+			Optional: false,
+			Examples: []fs.OptionExample{{
+				Value: "https://example.com",
+				Help:  "Connect to example.com",
+			}},
+		}, {
+			Name:     "vendor",
+			Help:     "Name of the Webdav site/service/software you are using",
+			Optional: false,
+			Examples: []fs.OptionExample{{
+				Value: "nextcloud",
+				Help:  "Nextcloud",
+			}, {
+				Value: "owncloud",
+				Help:  "Owncloud",
+			}, {
+				Value: "other",
+				Help:  "Other site/service or software",
+			}},
+		}, {
+			Name:     "user",
+			Help:     "User name",
+			Optional: true,
+		}, {
+			Name:       "pass",
+			Help:       "Password.",
+			IsPassword: true,
+			Optional:   true,
+		}},
+	})
+}
+
+// Fs represents a remote webdav
+type Fs struct {
+	name         string        // name of this remote
+	root         string        // the path we are working on
+	features     *fs.Features  // optional features
+	endpoint     *url.URL      // URL of the host
+	endpointURL  string        // endpoint as a string
+	srv          *rest.Client  // the connection to the webdav server
+	pacer        *pacer.Pacer  // pacer for API calls
+	precision    time.Duration // mod time precision
+	useOCMtime   bool          // set if can use X-OC-Mtime
+	hasChecksums bool          // set if can use ownCloud style checksums
+}
+
+// Object describes a webdav object
+//
+// Will definitely have info but maybe not meta
+type Object struct {
+	fs          *Fs       // what this object is part of
+	remote      string    // The remote path
+	hasMetaData bool      // whether info below has been set
+	size        int64     // size of the object
+	modTime     time.Time // modification time of the object
+	sha1        string    // SHA-1 of the object content if known
+	md5         string    // MD5 of the object content if known
+	mimeType    string    // Content-Type of the object
+}
+
+// ------------------------------------------------------------
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("webdav root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// retryErrorCodes is a slice of error codes that we will retry
+var retryErrorCodes = []int{
+	429, // Too Many Requests.
+	500, // Internal Server Error
+	502, // Bad Gateway
+	503, // Service Unavailable
+	504, // Gateway Timeout
+	509, // Bandwidth Limit Exceeded
+}
+
+// shouldRetry returns a boolean as to whether this resp and err
+// deserve to be retried.  It returns the err as a convenience
+func shouldRetry(resp *http.Response, err error) (bool, error) {
+	return fs.ShouldRetry(err) || fs.ShouldRetryHTTP(resp, retryErrorCodes), err
+}
+
+// statusCode returns the HTTP status code of err if it came from the
+// server or 0 otherwise
+func statusCode(err error) int {
+	if apiErr, ok := err.(*api.Error); ok {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// mimics url.PathEscape which only available from go 1.8
+func pathEscape(path string) string {
+	u := url.URL{
+		Path: path,
+	}
+	return u.EscapedPath()
+}
+
+// addSlash adds a trailing slash to dirPath unless it is the
+// endpoint itself
+func addSlash(dirPath string) string {
+	if dirPath != "" && !strings.HasSuffix(dirPath, "/") {
+		dirPath += "/"
+	}
+	return dirPath
+}
+
+// filePath returns the path of remote relative to the endpoint
+func (f *Fs) filePath(remote string) string {
+	return path.Join(f.root, remote)
+}
+
+// dirPath returns the path of the directory dir relative to the
+// endpoint with a trailing slash
+func (f *Fs) dirPath(dir string) string {
+	return addSlash(f.filePath(dir))
+}
+
+// url returns the absolute URL of a path relative to the endpoint
+func (f *Fs) url(relPath string) string {
+	return f.endpointURL + pathEscape(relPath)
+}
+
+// propfind reads the properties of relPath and, if depth is "1", its
+// children
+func (f *Fs) propfind(relPath string, depth string) (result *api.Multistatus, err error) {
+	result = new(api.Multistatus)
+	opts := rest.Opts{
+		Method:      "PROPFIND",
+		Path:        pathEscape(relPath),
+		ContentType: "application/xml; charset=utf-8",
+		ExtraHeaders: map[string]string{
+			"Depth": depth,
+		},
+	}
+	var resp *http.Response
+	err = f.pacer.Call(func() (bool, error) {
+		opts.Body = strings.NewReader(api.PropFindBody)
+		resp, err = f.srv.CallXML(&opts, nil, result)
+		return shouldRetry(resp, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// readMetaDataForPath reads the metadata from the path relative to
+// the endpoint
+func (f *Fs) readMetaDataForPath(relPath string) (info *api.Prop, err error) {
+	result, err := f.propfind(relPath, "0")
+	if err != nil {
+		if statusCode(err) == http.StatusNotFound {
+			return nil, fs.ErrorObjectNotFound
+		}
+		return nil, errors.Wrap(err, "read metadata failed")
+	}
+	if len(result.Responses) < 1 {
+		return nil, fs.ErrorObjectNotFound
+	}
+	prop, ok := result.Responses[0].Props()
+	if !ok {
+		return nil, fs.ErrorObjectNotFound
+	}
+	return &prop, nil
+}
+
+// errorHandler parses a non 2xx error response into an error
+func errorHandler(resp *http.Response) error {
+	body, err := rest.ReadBody(resp)
+	if err != nil {
+		return errors.Wrap(err, "error when trying to read error from body")
+	}
+	// Decode error response
+	errResponse := new(api.Error)
+	err = xml.Unmarshal(body, &errResponse)
+	if err != nil {
+		// set the Message to be the body if can't parse it
+		errResponse.Message = strings.TrimSpace(string(body))
+	}
+	errResponse.Status = resp.Status
+	errResponse.StatusCode = resp.StatusCode
+	return errResponse
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(name, root string) (fs.Fs, error) {
+	endpoint := fs.ConfigFileGet(name, "url")
+	if !strings.HasSuffix(endpoint, "/") {
+		endpoint += "/"
+	}
+	user := fs.ConfigFileGet(name, "user")
+	pass := fs.ConfigFileGet(name, "pass")
+	if pass != "" {
+		var err error
+		pass, err = fs.Reveal(pass)
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't decrypt password")
+		}
+	}
+	vendor := fs.ConfigFileGet(name, "vendor")
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't parse URL %q", endpoint)
+	}
+
+	root = strings.Trim(root, "/")
+	f := &Fs{
+		name:        name,
+		root:        root,
+		endpoint:    u,
+		endpointURL: u.String(),
+		srv:         rest.NewClient(fs.Config.RemoteClient(name)).SetRoot(u.String()),
+		pacer:       pacer.New().SetMinSleep(minSleep).SetMaxSleep(maxSleep).SetDecayConstant(decayConstant),
+		precision:   fs.ModTimeNotSupported,
+	}
+	f.features = (&fs.Features{
+		CanHaveEmptyDirectories: true,
+	}).Fill(f)
+	f.srv.SetErrorHandler(errorHandler)
+	if user != "" || pass != "" {
+		f.srv.SetUserPass(user, pass)
+	}
+	f.setQuirks(vendor)
+
+	if root != "" {
+		// Check to see if the root actually an existing file
+		remote := path.Base(root)
+		f.root = path.Dir(root)
+		if f.root == "." {
+			f.root = ""
+		}
+		_, err := f.NewObject(remote)
+		if err != nil {
+			if errors.Cause(err) == fs.ErrorObjectNotFound || errors.Cause(err) == fs.ErrorNotAFile {
+				// File doesn't exist so return old f
+				f.root = root
+				return f, nil
+			}
+			return nil, err
+		}
+		// return an error with an fs which points to the parent
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// setQuirks adjusts the Fs for the vendor passed in
+func (f *Fs) setQuirks(vendor string) {
+	switch vendor {
+	case "owncloud", "nextcloud":
+		f.precision = time.Second
+		f.useOCMtime = true
+		f.hasChecksums = true
+	case "other", "":
+	default:
+		fs.Debugf(f, "Unknown vendor %q", vendor)
+	}
+}
+
+// Return an Object from a path
+//
+// If it can't be found it returns the error fs.ErrorObjectNotFound.
+func (f *Fs) newObjectWithInfo(remote string, info *api.Prop) (fs.Object, error) {
+	o := &Object{
+		fs:     f,
+		remote: remote,
+	}
+	var err error
+	if info != nil {
+		// Set info
+		err = o.setMetaData(info)
+	} else {
+		err = o.readMetaData() // reads info and meta, returning an error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// NewObject finds the Object at remote.  If it can't be found
+// it returns the error fs.ErrorObjectNotFound.
+func (f *Fs) NewObject(remote string) (fs.Object, error) {
+	return f.newObjectWithInfo(remote, nil)
+}
+
+// User function to process a File item from listAll
+//
+// Should return true to finish processing
+type listAllFn func(remote string, isDir bool, info *api.Prop) bool
+
+// Lists the directory required calling the user function on each item found
+//
+// If the user fn ever returns true then it early exits with found = true
+func (f *Fs) listAll(dir string, fn listAllFn) (found bool, err error) {
+	dirPath := f.dirPath(dir)
+	result, err := f.propfind(dirPath, "1")
+	if err != nil {
+		if statusCode(err) == http.StatusNotFound {
+			return found, fs.ErrorDirNotFound
+		}
+		return found, errors.Wrap(err, "couldn't list files")
+	}
+	baseDir := path.Join(f.endpoint.Path, dirPath)
+	for i := range result.Responses {
+		item := &result.Responses[i]
+		u, err := url.Parse(item.Href)
+		if err != nil {
+			return found, errors.Wrapf(err, "couldn't parse href %q", item.Href)
+		}
+		itemPath := path.Clean(u.Path)
+		info, ok := item.Props()
+		if !ok {
+			fs.Debugf(f, "Ignoring %q with no properties", item.Href)
+			continue
+		}
+		// The directory itself is returned in the listing
+		if itemPath == baseDir {
+			if !info.IsDir() {
+				return found, fs.ErrorDirNotFound
+			}
+			continue
+		}
+		remote := path.Join(dir, path.Base(itemPath))
+		if fn(remote, info.IsDir(), &info) {
+			found = true
+			break
+		}
+	}
+	return found, nil
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(dir string) (entries fs.DirEntries, err error) {
+	var iErr error
+	_, err = f.listAll(dir, func(remote string, isDir bool, info *api.Prop) bool {
+		if isDir {
+			d := fs.NewDir(remote, time.Time(info.Modified))
+			entries = append(entries, d)
+		} else {
+			o, err := f.newObjectWithInfo(remote, info)
+			if err != nil {
+				iErr = err
+				return true
+			}
+			entries = append(entries, o)
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if iErr != nil {
+		return nil, iErr
+	}
+	return entries, nil
+}
+
+// Put the object
+//
+// Copy the reader in to the new object which is returned
+//
+// The new object may have been created if an error is returned
+func (f *Fs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	o := &Object{
+		fs:     f,
+		remote: src.Remote(),
+	}
+	return o, o.Update(in, src, options...)
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.Put(in, src, options...)
+}
+
+// mkParentDir makes the parent of the path relative to the endpoint
+// if necessary
+func (f *Fs) mkParentDir(relPath string) error {
+	parent := path.Dir(relPath)
+	if parent == "." {
+		parent = ""
+	}
+	return f.mkdir(parent)
+}
+
+// mkdir makes the directory relative to the endpoint and any parents
+// necessary
+func (f *Fs) mkdir(dirPath string) error {
+	// We assume the endpoint itself already exists
+	if dirPath == "" {
+		return nil
+	}
+	err := f._mkdir(dirPath)
+	if statusCode(err) == http.StatusConflict {
+		// The parent doesn't exist so make it then try again
+		err = f.mkParentDir(dirPath)
+		if err == nil {
+			err = f._mkdir(dirPath)
+		}
+	}
+	return err
+}
+
+// _mkdir makes the directory relative to the endpoint
+//
+// It returns an error with a StatusConflict code if the parent
+// doesn't exist
+func (f *Fs) _mkdir(dirPath string) error {
+	opts := rest.Opts{
+		Method:     "MKCOL",
+		Path:       pathEscape(addSlash(dirPath)),
+		NoResponse: true,
+	}
+	err := f.pacer.Call(func() (bool, error) {
+		resp, err := f.srv.Call(&opts)
+		return shouldRetry(resp, err)
+	})
+	// Method Not Allowed is returned if the directory exists already
+	if statusCode(err) == http.StatusMethodNotAllowed {
+		return nil
+	}
+	return err
+}
+
+// Mkdir creates the directory if it doesn't exist
+func (f *Fs) Mkdir(dir string) error {
+	return f.mkdir(f.filePath(dir))
+}
+
+// purgeCheck removes the directory, if check is set then it refuses
+// to do so if it has anything in
+func (f *Fs) purgeCheck(dir string, check bool) error {
+	if f.filePath(dir) == "" {
+		return errors.New("can't remove root directory")
+	}
+	if check {
+		notEmpty, err := f.listAll(dir, func(string, bool, *api.Prop) bool {
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if notEmpty {
+			return fs.ErrorDirectoryNotEmpty
+		}
+	}
+	opts := rest.Opts{
+		Method:     "DELETE",
+		Path:       pathEscape(f.dirPath(dir)),
+		NoResponse: true,
+	}
+	err := f.pacer.Call(func() (bool, error) {
+		resp, err := f.srv.Call(&opts)
+		return shouldRetry(resp, err)
+	})
+	if err != nil {
+		return errors.Wrap(err, "rmdir failed")
+	}
+	return nil
+}
+
+// Rmdir deletes the directory
+//
+// Returns an error if it isn't empty
+func (f *Fs) Rmdir(dir string) error {
+	return f.purgeCheck(dir, true)
+}
+
+// Precision return the precision of this Fs
+func (f *Fs) Precision() time.Duration {
+	return f.precision
+}
+
+// ocMtime returns the value of the X-OC-Mtime header for modTime
+func ocMtime(modTime time.Time) string {
+	return strconv.FormatInt(modTime.Unix(), 10)
+}
+
+// copyOrMove copies or moves src to remote with the method ("COPY" or
+// "MOVE") passed in
+func (f *Fs) copyOrMove(src fs.Object, remote string, method string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok || srcObj.fs.endpointURL != f.endpointURL {
+		fs.Debugf(src, "Can't %s - not same remote type", strings.ToLower(method))
+		if method == "COPY" {
+			return nil, fs.ErrorCantCopy
+		}
+		return nil, fs.ErrorCantMove
+	}
+	dstPath := f.filePath(remote)
+	err := f.mkParentDir(dstPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "copy mkParentDir failed")
+	}
+	opts := rest.Opts{
+		Method:     method,
+		Path:       pathEscape(srcObj.filePath()),
+		NoResponse: true,
+		ExtraHeaders: map[string]string{
+			"Destination": f.url(dstPath),
+			"Overwrite":   "T",
+		},
+	}
+	if f.useOCMtime {
+		opts.ExtraHeaders["X-OC-Mtime"] = ocMtime(src.ModTime())
+	}
+	err = f.pacer.Call(func() (bool, error) {
+		resp, err := f.srv.Call(&opts)
+		return shouldRetry(resp, err)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s failed", strings.ToLower(method))
+	}
+	return f.NewObject(remote)
+}
+
+// Copy src to this remote using server side copy operations.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(src fs.Object, remote string) (fs.Object, error) {
+	return f.copyOrMove(src, remote, "COPY")
+}
+
+// Purge deletes all the files and the container
+//
+// Optional interface: Only implement this if you have a way of
+// deleting all the files quicker than just running Remove() on the
+// result of List()
+func (f *Fs) Purge() error {
+	return f.purgeCheck("", false)
+}
+
+// Move src to this remote using server side move operations.
+//
+// This is stored with the remote path given
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(src fs.Object, remote string) (fs.Object, error) {
+	return f.copyOrMove(src, remote, "MOVE")
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(src fs.Fs, srcRemote, dstRemote string) error {
+	srcFs, ok := src.(*Fs)
+	if !ok || srcFs.endpointURL != f.endpointURL {
+		fs.Debugf(srcFs, "Can't move directory - not same remote type")
+		return fs.ErrorCantDirMove
+	}
+	srcPath := srcFs.filePath(srcRemote)
+	dstPath := f.filePath(dstRemote)
+
+	// Check if destination exists
+	_, err := f.readMetaDataForPath(dstPath)
+	if err == nil {
+		return fs.ErrorDirExists
+	}
+	if err != fs.ErrorObjectNotFound {
+		return errors.Wrap(err, "DirMove dirExists dst failed")
+	}
+
+	// Make sure the parent directory exists
+	err = f.mkParentDir(dstPath)
+	if err != nil {
+		return errors.Wrap(err, "DirMove mkParentDir dst failed")
+	}
+
+	opts := rest.Opts{
+		Method:     "MOVE",
+		Path:       pathEscape(addSlash(srcPath)),
+		NoResponse: true,
+		ExtraHeaders: map[string]string{
+			"Destination": f.url(addSlash(dstPath)),
+			"Overwrite":   "F",
+		},
+	}
+	err = f.pacer.Call(func() (bool, error) {
+		resp, err := f.srv.Call(&opts)
+		return shouldRetry(resp, err)
+	})
+	if err != nil {
+		return errors.Wrap(err, "DirMove MOVE call failed")
+	}
+	return nil
+}
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() fs.HashSet {
+	if f.hasChecksums {
+		return fs.NewHashSet(fs.HashSHA1, fs.HashMD5)
+	}
+	return fs.HashSet(fs.HashNone)
+}
+
+// ------------------------------------------------------------
+
+// Fs returns the parent Fs
+func (o *Object) Fs() fs.Info {
+	return o.fs
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// filePath returns the path of the object relative to the endpoint
+func (o *Object) filePath() string {
+	return o.fs.filePath(o.remote)
+}
+
+// Hash returns the SHA-1 or MD5 of an object returning a lowercase hex string
+func (o *Object) Hash(t fs.HashType) (string, error) {
+	if !o.fs.Hashes().Contains(t) {
+		return "", fs.ErrHashUnsupported
+	}
+	if t == fs.HashSHA1 {
+		return o.sha1, nil
+	}
+	return o.md5, nil
+}
+
+// Size returns the size of an object in bytes
+func (o *Object) Size() int64 {
+	err := o.readMetaData()
+	if err != nil {
+		fs.Logf(o, "Failed to read metadata: %v", err)
+		return 0
+	}
+	return o.size
+}
+
+// setMetaData sets the metadata from info
+func (o *Object) setMetaData(info *api.Prop) (err error) {
+	if info.IsDir() {
+		return errors.Wrapf(fs.ErrorNotAFile, "%q", o.remote)
+	}
+	o.hasMetaData = true
+	o.size = info.Size
+	o.modTime = time.Time(info.Modified)
+	o.mimeType = info.ContentType
+	hashes := info.Hashes()
+	o.sha1 = hashes["sha1"]
+	o.md5 = hashes["md5"]
+	return nil
+}
+
+// readMetaData gets the metadata if it hasn't already been fetched
+//
+// it also sets the info
+func (o *Object) readMetaData() (err error) {
+	if o.hasMetaData {
+		return nil
+	}
+	info, err := o.fs.readMetaDataForPath(o.filePath())
+	if err != nil {
+		return err
+	}
+	return o.setMetaData(info)
+}
+
+// ModTime returns the modification time of the object
+func (o *Object) ModTime() time.Time {
+	err := o.readMetaData()
+	if err != nil {
+		fs.Logf(o, "Failed to read metadata: %v", err)
+		return time.Now()
+	}
+	return o.modTime
+}
+
+// SetModTime sets the modification time of the object
+//
+// This isn't possible with webdav so the time is only set on upload
+func (o *Object) SetModTime(modTime time.Time) error {
+	return fs.ErrorCantSetModTime
+}
+
+// Storable returns a boolean showing whether this object storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// Open an object for read
+func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
+	var resp *http.Response
+	opts := rest.Opts{
+		Method:  "GET",
+		Path:    pathEscape(o.filePath()),
+		Options: options,
+	}
+	err = o.fs.pacer.Call(func() (bool, error) {
+		resp, err = o.fs.srv.Call(&opts)
+		return shouldRetry(resp, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, err
+}
+
+// Update the object with the contents of the io.Reader, modTime and size
+//
+// If existing is set then it updates the object rather than creating a new one
+//
+// The new object may have been created if an error is returned
+func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (err error) {
+	err = o.fs.mkParentDir(o.filePath())
+	if err != nil {
+		return errors.Wrap(err, "Update mkParentDir failed")
+	}
+
+	// Find out if there is a file there already as it must be
+	// left alone if the upload fails
+	existed := o.hasMetaData
+	if !existed {
+		existed = errors.Cause(o.readMetaData()) != fs.ErrorObjectNotFound
+	}
+
+	size := src.Size()
+	var resp *http.Response
+	opts := rest.Opts{
+		Method:       "PUT",
+		Path:         pathEscape(o.filePath()),
+		Body:         in,
+		NoResponse:   true,
+		ContentType:  fs.MimeType(src),
+		Options:      options,
+		ExtraHeaders: map[string]string{},
+	}
+	if size >= 0 {
+		opts.ContentLength = &size
+	}
+	if o.fs.useOCMtime {
+		opts.ExtraHeaders["X-OC-Mtime"] = ocMtime(src.ModTime())
+	}
+	if o.fs.hasChecksums {
+		if sha1, _ := src.Hash(fs.HashSHA1); sha1 != "" {
+			opts.ExtraHeaders["OC-Checksum"] = "SHA1:" + sha1
+		} else if md5, _ := src.Hash(fs.HashMD5); md5 != "" {
+			opts.ExtraHeaders["OC-Checksum"] = "MD5:" + md5
+		}
+	}
+	err = o.fs.pacer.CallNoRetry(func() (bool, error) {
+		resp, err = o.fs.srv.Call(&opts)
+		return shouldRetry(resp, err)
+	})
+	if err != nil {
+		// Remove the partial upload which some servers leave
+		// behind if it isn't the previous version of the file
+		if !existed {
+			if removeErr := o.Remove(); removeErr != nil {
+				fs.Debugf(o, "Failed to remove failed upload: %v", removeErr)
+			}
+		}
+		return err
+	}
+	if o.fs.useOCMtime && resp.Header.Get("X-OC-Mtime") != "accepted" {
+		fs.Debugf(o, "Server didn't accept X-OC-Mtime")
+	}
+	// read metadata from remote
+	o.hasMetaData = false
+	return o.readMetaData()
+}
+
+// Remove an object
+func (o *Object) Remove() error {
+	opts := rest.Opts{
+		Method:     "DELETE",
+		Path:       pathEscape(o.filePath()),
+		NoResponse: true,
+	}
+	return o.fs.pacer.Call(func() (bool, error) {
+		resp, err := o.fs.srv.Call(&opts)
+		return shouldRetry(resp, err)
+	})
+}
+
+// MimeType of an Object if known, "" otherwise
+func (o *Object) MimeType() string {
+	return o.mimeType
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs          = (*Fs)(nil)
+	_ fs.Purger      = (*Fs)(nil)
+	_ fs.PutStreamer = (*Fs)(nil)
+	_ fs.Copier      = (*Fs)(nil)
+	_ fs.Mover       = (*Fs)(nil)
+	_ fs.DirMover    = (*Fs)(nil)
+	_ fs.Object      = (*Object)(nil)
+	_ fs.MimeTyper   = &Object{}
+)
@@ -0,0 +1,104 @@
+package webdav
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fstest/fstests"
+	xwebdav "golang.org/x/net/webdav"
+)
+
+// testPrefix is the path the test servers serve webdav on, the same
+// as ownCloud uses
+const testPrefix = "/remote.php/webdav"
+
+// newTestServer starts an in-process webdav server serving dir.  If
+// ownCloud is set then it sets modification times from the
+// X-OC-Mtime header like ownCloud does.
+func newTestServer(dir string, ownCloud bool) *httptest.Server {
+	var handler http.Handler = &xwebdav.Handler{
+		Prefix:     testPrefix,
+		FileSystem: xwebdav.Dir(dir),
+		LockSystem: xwebdav.NewMemLS(),
+	}
+	if ownCloud {
+		handler = &ocMtimeHandler{dir: dir, handler: handler}
+	}
+	return httptest.NewServer(handler)
+}
+
+// ocMtimeHandler sets the modification time of files written with
+// PUT, COPY or MOVE from the X-OC-Mtime header
+type ocMtimeHandler struct {
+	dir     string
+	handler http.Handler
+}
+
+// statusRecorder records the status written to a ResponseWriter
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status and passes it on
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// ServeHTTP serves the request then applies any X-OC-Mtime header
+func (h *ocMtimeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mtime, err := strconv.ParseInt(r.Header.Get("X-OC-Mtime"), 10, 64)
+	if err != nil {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+	target := r.URL.Path
+	if r.Method == "COPY" || r.Method == "MOVE" {
+		u, err := url.Parse(r.Header.Get("Destination"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		target = u.Path
+	}
+	w.Header().Set("X-OC-Mtime", "accepted")
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	h.handler.ServeHTTP(recorder, r)
+	if recorder.status/100 == 2 {
+		modTime := time.Unix(mtime, 0)
+		localPath := filepath.Join(h.dir, filepath.FromSlash(strings.TrimPrefix(target, testPrefix)))
+		if err := os.Chtimes(localPath, modTime, modTime); err != nil {
+			log.Printf("Failed to set modification time: %v", err)
+		}
+	}
+}
+
+// TestMain starts a webdav server for the TestWebdav: remote to use
+// and stops it when the tests have finished
+func TestMain(m *testing.M) {
+	tempdir, err := ioutil.TempDir("", "rclone-webdav-test")
+	if err != nil {
+		log.Fatalf("Failed to make temporary directory: %v", err)
+	}
+	server := newTestServer(tempdir, true)
+	name := "TestWebdav"
+	fstests.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "webdav"},
+		{Name: name, Key: "url", Value: server.URL + testPrefix},
+		{Name: name, Key: "vendor", Value: "owncloud"},
+	}
+	code := m.Run()
+	server.Close()
+	_ = os.RemoveAll(tempdir)
+	os.Exit(code)
+}
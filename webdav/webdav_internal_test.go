@@ -0,0 +1,216 @@
+package webdav
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	"github.com/ncw/rclone/webdav/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var initialise sync.Once
+
+// newTestFs makes a remote with the vendor given for the server at
+// url returning the Fs
+func newTestFs(t *testing.T, url, vendor, root string) (fs.Fs, error) {
+	initialise.Do(fstest.Initialise)
+	name := "TestWebdavInternal" + vendor
+	fs.ConfigFileSet(name, "type", "webdav")
+	fs.ConfigFileSet(name, "url", url)
+	fs.ConfigFileSet(name, "vendor", vendor)
+	return fs.NewFs(name + ":" + root)
+}
+
+// putFile uploads contents to remote through f
+func putFile(t *testing.T, f fs.Fs, remote, contents string, hashes map[fs.HashType]string) fs.Object {
+	src := fs.NewStaticObjectInfo(remote, fstest.Time("2001-02-03T04:05:06Z"), int64(len(contents)), true, hashes, nil)
+	o, err := f.Put(strings.NewReader(contents), src)
+	require.NoError(t, err)
+	return o
+}
+
+func TestOtherVendor(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "rclone-webdav-internal-test")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(tempdir)
+	}()
+	server := newTestServer(tempdir, false)
+	defer server.Close()
+
+	f, err := newTestFs(t, server.URL+testPrefix, "other", "")
+	require.NoError(t, err)
+	assert.Equal(t, fs.ModTimeNotSupported, f.Precision())
+	assert.Equal(t, fs.HashSet(fs.HashNone), f.Hashes())
+
+	// Parent directories are made as needed
+	o := putFile(t, f, "a/b/file.txt", "hello", nil)
+	assert.Equal(t, int64(5), o.Size())
+	assert.Equal(t, fs.ErrorDirectoryNotEmpty, f.Rmdir("a"))
+	_, err = f.List("a/b/file.txt")
+	assert.Equal(t, fs.ErrorDirNotFound, err)
+	_, err = f.List("a/c")
+	assert.Equal(t, fs.ErrorDirNotFound, err)
+
+	// Pointing the remote at a file makes one pointing at its parent
+	f, err = newTestFs(t, server.URL+testPrefix, "other", "a/b/file.txt")
+	assert.Equal(t, fs.ErrorIsFile, err)
+	assert.Equal(t, "a/b", f.Root())
+	_, err = f.NewObject("file.txt")
+	assert.NoError(t, err)
+}
+
+func TestUpdateFailed(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "rclone-webdav-internal-test")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(tempdir)
+	}()
+	var failPuts bool
+	inner := newTestServer(tempdir, false)
+	defer inner.Close()
+	handler := inner.Config.Handler
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" && failPuts {
+			// leave a partial upload behind
+			name := filepath.Join(tempdir, strings.TrimPrefix(r.URL.Path, testPrefix))
+			if _, err := os.Stat(name); os.IsNotExist(err) {
+				_ = ioutil.WriteFile(name, []byte("par"), 0666)
+			}
+			http.Error(w, "upload failed", http.StatusInternalServerError)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	f, err := newTestFs(t, server.URL+testPrefix, "other", "")
+	require.NoError(t, err)
+	putFile(t, f, "file.txt", "hello", nil)
+	failPuts = true
+
+	// The previous version of a file is kept
+	src := fs.NewStaticObjectInfo("file.txt", fstest.Time("2001-02-03T04:05:06Z"), 7, true, nil, nil)
+	_, err = f.Put(strings.NewReader("goodbye"), src)
+	require.Error(t, err)
+	data, err := ioutil.ReadFile(filepath.Join(tempdir, "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	// but a partial new file is removed
+	src = fs.NewStaticObjectInfo("new.txt", fstest.Time("2001-02-03T04:05:06Z"), 7, true, nil, nil)
+	_, err = f.Put(strings.NewReader("goodbye"), src)
+	require.Error(t, err)
+	_, err = os.Stat(filepath.Join(tempdir, "new.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// multistatus is returned by the ownCloud server in TestOwnCloud
+const multistatus = `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:" xmlns:s="http://sabredav.org/ns" xmlns:oc="http://owncloud.org/ns">
+ <d:response>
+  <d:href>/remote.php/webdav/file%20name.txt</d:href>
+  <d:propstat>
+   <d:prop>
+    <d:getlastmodified>Sat, 03 Feb 2001 04:05:06 GMT</d:getlastmodified>
+    <d:getcontentlength>5</d:getcontentlength>
+    <d:getcontenttype>text/plain</d:getcontenttype>
+    <d:resourcetype/>
+    <oc:checksums>
+     <oc:checksum>SHA1:AAF4C61DDCC5E8A2DABEDE0F3B482CD9AEA9434D MD5:5d41402abc4b2a76b9719d911017c592 ADLER32:062c0215</oc:checksum>
+    </oc:checksums>
+   </d:prop>
+   <d:status>HTTP/1.1 200 OK</d:status>
+  </d:propstat>
+  <d:propstat>
+   <d:prop>
+    <d:displayname/>
+   </d:prop>
+   <d:status>HTTP/1.1 404 Not Found</d:status>
+  </d:propstat>
+ </d:response>
+</d:multistatus>
+`
+
+func TestOwnCloud(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		headers http.Header
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "PUT":
+			mu.Lock()
+			headers = r.Header
+			mu.Unlock()
+			w.Header().Set("X-OC-Mtime", "accepted")
+			w.WriteHeader(http.StatusCreated)
+		case "PROPFIND":
+			assert.Equal(t, "/remote.php/webdav/file%20name.txt", r.URL.EscapedPath())
+			assert.Equal(t, "0", r.Header.Get("Depth"))
+			w.WriteHeader(http.StatusMultiStatus)
+			_, _ = w.Write([]byte(multistatus))
+		default:
+			http.Error(w, "unexpected method", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	f, err := newTestFs(t, server.URL+testPrefix, "owncloud", "")
+	require.NoError(t, err)
+	assert.Equal(t, fs.NewHashSet(fs.HashSHA1, fs.HashMD5), f.Hashes())
+
+	// The modification time and checksum are sent with the upload
+	o := putFile(t, f, "file name.txt", "hello", map[fs.HashType]string{
+		fs.HashSHA1: "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d",
+	})
+	mu.Lock()
+	assert.Equal(t, "981173106", headers.Get("X-OC-Mtime"))
+	assert.Equal(t, "SHA1:aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", headers.Get("OC-Checksum"))
+	mu.Unlock()
+
+	// The object is read back from the PROPFIND response
+	assert.Equal(t, int64(5), o.Size())
+	assert.True(t, fstest.Time("2001-02-03T04:05:06Z").Equal(o.ModTime()))
+	assert.Equal(t, "text/plain", fs.MimeType(o))
+	hash, err := o.Hash(fs.HashSHA1)
+	require.NoError(t, err)
+	assert.Equal(t, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", hash)
+	hash, err = o.Hash(fs.HashMD5)
+	require.NoError(t, err)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", hash)
+}
+
+func TestErrorHandler(t *testing.T) {
+	for _, test := range []struct {
+		body string
+		want string
+	}{{
+		body: `<?xml version="1.0" encoding="utf-8"?>
+<d:error xmlns:d="DAV:" xmlns:s="http://sabredav.org/ns">
+  <s:exception>Sabre\DAV\Exception\Forbidden</s:exception>
+  <s:message>Permission denied</s:message>
+</d:error>`,
+		want: `Permission denied: Sabre\DAV\Exception\Forbidden: 403 Forbidden`,
+	}, {
+		body: "Forbidden\n",
+		want: "Forbidden: 403 Forbidden",
+	}} {
+		resp := &http.Response{
+			Status:     "403 Forbidden",
+			StatusCode: http.StatusForbidden,
+			Body:       ioutil.NopCloser(strings.NewReader(test.body)),
+		}
+		err := errorHandler(resp)
+		assert.Equal(t, test.want, err.Error())
+		assert.Equal(t, http.StatusForbidden, err.(*api.Error).StatusCode)
+	}
+}
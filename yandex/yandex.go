@@ -127,7 +127,7 @@ func NewFs(name, root string) (fs.Fs, error) {
 	}
 
 	//create new client
-	yandexDisk := yandex.NewClient(token.AccessToken, fs.Config.Client())
+	yandexDisk := yandex.NewClient(token.AccessToken, fs.Config.RemoteClient(name))
 
 	f := &Fs{
 		name: name,